@@ -1,28 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/wTHU1Ew/TenyoJubaku/internal/admin"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/monitor"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/tpsl"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
 )
 
+// configPath 配置文件路径 / Config file path
+const configPath = "configs/config.yaml"
+
 func main() {
+	once := flag.Bool("once", false, "run a single monitoring cycle and TPSL check, print the coverage summary and exit (exit code 2 on placement failures)")
+	flag.Parse()
+
 	// Exit code
 	exitCode := 0
 	defer func() {
 		os.Exit(exitCode)
 	}()
 
+	// Self-test subcommand: check the whole pipeline against demo trading and exit
+	if flag.Arg(0) == "selftest" {
+		newClient := func(cfg *config.Config) selfTestAPI {
+			return newOKXClient(&cfg.OKX, nil, true)
+		}
+		if !runSelfTest(configPath, os.Stdout, newClient) {
+			exitCode = 1
+		}
+		return
+	}
+
 	// Load configuration
-	cfg, err := config.Load("configs/config.yaml")
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
 		exitCode = 1
@@ -52,6 +76,24 @@ func main() {
 		exitCode = 1
 		return
 	}
+	if *once {
+		// Keep stdout for the coverage summary so cron output stays parseable
+		log.SetConsoleWriter(os.Stderr)
+	}
+	if len(cfg.Logging.MaskKeys) > 0 {
+		log.SetMaskKeys(cfg.Logging.MaskKeys)
+	}
+	if cfg.Logging.RotateAt != "" || cfg.Logging.RotateIntervalHours > 0 {
+		interval := time.Duration(cfg.Logging.RotateIntervalHours) * time.Hour
+		if err := log.SetTimeRotation(cfg.Logging.RotateAt, interval, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to enable time-based log rotation: %v\n", err)
+			exitCode = 1
+			return
+		}
+	}
+	if cfg.Logging.Async {
+		log.SetAsync(cfg.Logging.AsyncQueueSize, cfg.Logging.AsyncOverflow == "drop")
+	}
 	defer log.Close()
 
 	log.Info("=== TenyoJubaku Starting ===")
@@ -64,6 +106,7 @@ func main() {
 		cfg.Database.WALMode,
 		cfg.Database.MaxOpenConns,
 		cfg.Database.MaxIdleConns,
+		storage.WithBusyTimeout(cfg.Database.BusyTimeoutMs),
 	)
 	if err != nil {
 		log.Error("Failed to initialize database: %v", err)
@@ -76,72 +119,170 @@ func main() {
 	// Initialize OKX API client
 	log.Info("Initializing OKX API client")
 	if cfg.OKX.DebugEnable {
-		log.Info("OKX API debug mode enabled - API responses will be printed to console")
-	}
-	okxClient := okx.New(
-		cfg.OKX.APIURL,
-		cfg.OKX.APIKey,
-		cfg.OKX.APISecret,
-		cfg.OKX.Passphrase,
-		cfg.OKX.Timeout,
-		cfg.OKX.MaxRetries,
-		cfg.OKX.DebugEnable,
-	)
+		log.Info("OKX API debug mode enabled - API requests and responses are logged at DEBUG level")
+	}
+	okxClient := newOKXClient(&cfg.OKX, log, cfg.OKX.SimulatedTrading)
 
 	// Initialize monitoring service
 	log.Info("Initializing monitoring service")
+	alerter := alert.New(log, time.Duration(cfg.Alert.RepeatInterval)*time.Second)
 	monitorService := monitor.New(
 		okxClient,
 		db,
 		log,
-		cfg.Monitoring.Interval,
+		alerter,
+		&cfg.Monitoring,
 	)
+	monitorService.SetMaintenanceInterval(time.Duration(*cfg.Database.MaintenanceIntervalHours) * time.Hour)
 
 	// Initialize TPSL scheduler if enabled
 	var tpslScheduler *tpsl.Scheduler
 	if cfg.TPSL.Enabled {
 		log.Info("Initializing TPSL scheduler")
 		tpslScheduler = tpsl.NewScheduler(&cfg.TPSL, db, okxClient, log)
+		tpslScheduler.Manager().SetAlerter(alerter)
+		if err := tpslScheduler.Manager().DetectPositionMode(); err != nil {
+			log.Warn("Failed to detect account position mode, inferring posSide from positions: %v", err)
+		}
+		if _, err := tpslScheduler.Manager().ReconcileOrders(); err != nil {
+			log.Warn("Failed to reconcile TPSL order records: %v", err)
+		}
 	} else {
 		log.Info("TPSL management disabled in configuration")
 	}
 
+	// Single-run mode for cron: one monitoring cycle then one TPSL check, no long-running services
+	if *once {
+		// Store a fresh snapshot first so position_source "db" works without a running monitor
+		if err := monitorService.RunOnce(); err != nil {
+			log.Error("Single monitoring cycle failed: %v", err)
+			exitCode = 1
+			return
+		}
+		if tpslScheduler == nil {
+			log.Info("TPSL management disabled, single run complete")
+			return
+		}
+		_, err := tpslScheduler.RunOnce(os.Stdout)
+		if err != nil {
+			log.Error("Single TPSL check failed: %v", err)
+		}
+		exitCode = onceExitCode(err)
+		return
+	}
+
+	// Start WebSocket ticker stream if enabled
+	var wsClient *okx.WSClient
+	if cfg.OKX.WSEnabled && tpslScheduler != nil {
+		wsClient = okx.NewWSClient(cfg.OKX.WSPublicURL, log)
+		wsClient.Start()
+		tpslScheduler.Manager().SetWSClient(wsClient)
+	}
+
+	// Start WebSocket private stream if enabled
+	var wsPrivateClient *okx.WSPrivateClient
+	if cfg.OKX.WSPrivateEnabled && tpslScheduler != nil {
+		wsPrivateClient = okx.NewWSPrivateClient(cfg.OKX.WSPrivateURL, cfg.OKX.APIKey, cfg.OKX.APISecret, cfg.OKX.Passphrase, log)
+		wsPrivateClient.SetPositionsHandler(func(positions []okx.PositionData) {
+			log.Info("Position change received over WebSocket (%d positions), triggering TPSL check", len(positions))
+			tpslScheduler.TriggerCheck()
+		})
+		wsPrivateClient.Start()
+	}
+
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	// Context cancelled on shutdown; services finish their current cycle before exiting
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Start monitoring service in a goroutine
+	startedAt := time.Now()
 	errChan := make(chan error, 1)
 	go func() {
-		if err := monitorService.Start(); err != nil {
+		if err := monitorService.Start(ctx); err != nil {
 			errChan <- err
 		}
 	}()
 
+	// Start monitoring watchdog if enabled
+	var watchdog *monitor.Watchdog
+	if cfg.Watchdog.Enabled {
+		watchdog = monitor.NewWatchdog(monitorService, okxClient, log, alerter, &cfg.Watchdog)
+		watchdog.Start(ctx)
+	}
+
 	// Start TPSL scheduler if enabled
 	if tpslScheduler != nil {
-		tpslScheduler.Start()
+		tpslScheduler.Start(ctx)
+	}
+
+	// Start admin API if enabled
+	var adminServer *admin.Server
+	if cfg.Admin.Enabled {
+		if tpslScheduler == nil {
+			log.Warn("Admin API enabled but TPSL management is disabled, not starting admin API")
+		} else {
+			adminServer = admin.New(&cfg.Admin, tpslScheduler, log)
+			adminServer.SetDashboard(db, monitorService)
+			if err := adminServer.Start(ctx); err != nil {
+				log.Error("Failed to start admin API: %v", err)
+				exitCode = 1
+				return
+			}
+		}
 	}
 
 	// Wait for shutdown signal or error
 	select {
 	case sig := <-sigChan:
 		log.Info("Received signal: %v", sig)
-		log.Info("Initiating graceful shutdown...")
+		log.Info("Initiating graceful shutdown (grace period: %ds)...", cfg.Shutdown.GracePeriod)
 
-		// Stop TPSL scheduler if running
+		// Stop starting new cycles and wait for in-progress work to drain
+		cancel()
+		done := []<-chan struct{}{monitorService.Done()}
 		if tpslScheduler != nil {
-			tpslScheduler.Stop()
+			done = append(done, tpslScheduler.Done())
+		}
+		if adminServer != nil {
+			done = append(done, adminServer.Done())
+		}
+		if watchdog != nil {
+			done = append(done, watchdog.Done())
+		}
+		if !waitForDrain(time.Duration(cfg.Shutdown.GracePeriod)*time.Second, done...) {
+			log.Warn("Grace period elapsed before in-progress work finished, exiting anyway")
 		}
 
-		// Stop monitoring service
-		monitorService.Stop()
+		// Stop WebSocket streams
+		if wsClient != nil {
+			wsClient.Stop()
+		}
+		if wsPrivateClient != nil {
+			wsPrivateClient.Stop()
+		}
 
 		// Get final metrics
 		metrics := monitorService.GetMetrics()
 		log.Info("Final metrics: success_count=%v, error_count=%v, last_success=%v",
 			metrics["success_count"], metrics["error_count"], metrics["last_success"])
 
+		// Record the run summary so uptime and activity survive restarts
+		var tpslMetrics map[string]interface{}
+		if tpslScheduler != nil {
+			tpslMetrics = tpslScheduler.Manager().GetMetrics()
+		}
+		session := runSession(startedAt, time.Now(), metrics, tpslMetrics)
+		if err := db.InsertRunSession(session); err != nil {
+			log.Error("Failed to record run session: %v", err)
+		} else {
+			log.Info("Run session recorded: uptime=%v, cycles=%d, orders_placed=%d",
+				session.Uptime().Round(time.Second), session.Cycles, session.OrdersPlaced)
+		}
+
 		log.Info("Shutdown complete")
 
 	case err := <-errChan:
@@ -151,3 +292,105 @@ func main() {
 
 	log.Info("=== TenyoJubaku Stopped ===")
 }
+
+// newOKXClient 根据配置创建OKX客户端 / Create the OKX client from the config
+//
+// Parameters:
+//   - cfg: OKX配置 / OKX configuration
+//   - log: 调试输出的日志记录器，nil时不输出 / Logger for debug output, nil for none
+//   - simulated: 是否使用模拟盘 / Whether to use demo trading
+//
+// Returns:
+//   - *okx.Client: OKX客户端 / OKX client
+func newOKXClient(cfg *config.OKXConfig, log *logger.Logger, simulated bool) *okx.Client {
+	requestTimeouts := make(map[string]time.Duration, len(cfg.RequestTimeouts))
+	for path, seconds := range cfg.RequestTimeouts {
+		requestTimeouts[path] = time.Duration(seconds) * time.Second
+	}
+	return okx.New(
+		cfg.APIURL,
+		cfg.APIKey,
+		cfg.APISecret,
+		cfg.Passphrase,
+		cfg.Timeout,
+		cfg.MaxRetries,
+		cfg.DebugEnable,
+		okx.WithMaxBackoff(time.Duration(cfg.MaxBackoff)*time.Second),
+		okx.WithBaseBackoff(time.Duration(cfg.BaseBackoff*float64(time.Second))),
+		okx.WithJitterFraction(*cfg.JitterFraction),
+		okx.WithRequestTimeouts(requestTimeouts),
+		okx.WithMaintenanceBackoff(time.Duration(cfg.MaintenanceBackoff)*time.Second),
+		okx.WithSimulatedTrading(simulated),
+		okx.WithLogger(log),
+		okx.WithFallbackURLs(cfg.FallbackURLs, cfg.FailoverThreshold),
+		okx.WithConnectionPool(cfg.MaxIdleConns, cfg.MaxIdleConnsPerHost, time.Duration(cfg.IdleConnTimeout)*time.Second),
+	)
+}
+
+// onceExitCode 单次运行模式的退出码 / Exit code for single-run mode
+// 0: 成功；1: 检查失败；2: 检查完成但有下单失败
+// 0: success; 1: the check failed; 2: the check ran but some placements failed
+//
+// Parameters:
+//   - err: RunOnce返回的错误 / Error returned by RunOnce
+//
+// Returns:
+//   - int: 进程退出码 / Process exit code
+func onceExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, tpsl.ErrPlacementFailures):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// waitForDrain 等待所有服务退出 / Wait for all services to exit
+// 在超时前等待每个done通道关闭
+// Wait for every done channel to close before the timeout elapses
+//
+// Parameters:
+//   - timeout: 宽限期 / Grace period
+//   - done: 服务退出时关闭的通道 / Channels closed when each service has exited
+//
+// Returns:
+//   - bool: 所有服务是否在宽限期内退出 / Whether all services exited within the grace period
+func waitForDrain(timeout time.Duration, done ...<-chan struct{}) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for _, ch := range done {
+		select {
+		case <-ch:
+		case <-deadline.C:
+			return false
+		}
+	}
+	return true
+}
+
+// runSession 根据最终指标生成运行会话记录 / Build the run session record from final metrics
+//
+// Parameters:
+//   - startedAt: 服务启动时间 / Time the services were started
+//   - stoppedAt: 服务停止时间 / Time the services stopped
+//   - monitorMetrics: 监控服务指标 / Monitoring service metrics
+//   - tpslMetrics: TPSL管理器指标，TPSL未启用时为nil / TPSL manager metrics, nil when TPSL is disabled
+//
+// Returns:
+//   - *models.RunSession: 运行会话记录 / Run session record
+func runSession(startedAt, stoppedAt time.Time, monitorMetrics, tpslMetrics map[string]interface{}) *models.RunSession {
+	success, _ := monitorMetrics["success_count"].(int64)
+	failed, _ := monitorMetrics["error_count"].(int64)
+	placed, _ := tpslMetrics["orders_placed"].(int64)
+	return &models.RunSession{
+		StartedAt:    startedAt,
+		StoppedAt:    stoppedAt,
+		Cycles:       int(success + failed),
+		SuccessCount: int(success),
+		ErrorCount:   int(failed),
+		OrdersPlaced: int(placed),
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/monitor"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/tpsl"
+)
+
+func TestOnceExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"success", nil, 0},
+		{"placement failures", fmt.Errorf("%w: 1 of 2 checked positions", tpsl.ErrPlacementFailures), 2},
+		{"check failed", errors.New("failed to get pending algo orders"), 1},
+		{"stale snapshot", tpsl.ErrSnapshotStale, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onceExitCode(tt.err); got != tt.expected {
+				t.Errorf("expected exit code %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunSessionRecorded(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+	}))
+	defer server.Close()
+
+	db, err := storage.New(filepath.Join(tmpDir, "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer db.Close()
+
+	log, err := logger.New(filepath.Join(tmpDir, "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	client := okx.New(server.URL, "key", "secret", "pass", 5, 0, false)
+	cfg := &config.MonitoringConfig{Interval: 1}
+	monitorService := monitor.New(client, db, log, alert.New(log, time.Minute), cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	startedAt := time.Now()
+	go monitorService.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for monitorService.GetMetrics()["success_count"] != int64(1) {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("monitoring cycle did not complete, metrics: %v", monitorService.GetMetrics())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-monitorService.Done()
+
+	tpslMetrics := map[string]interface{}{"orders_placed": int64(2)}
+	if err := db.InsertRunSession(runSession(startedAt, time.Now(), monitorService.GetMetrics(), tpslMetrics)); err != nil {
+		t.Fatalf("InsertRunSession() error = %v", err)
+	}
+
+	sessions, err := db.GetRunSessions(0)
+	if err != nil {
+		t.Fatalf("GetRunSessions() error = %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 run session, got %d", len(sessions))
+	}
+	got := sessions[0]
+	if got.Cycles != 1 || got.SuccessCount != 1 || got.ErrorCount != 0 || got.OrdersPlaced != 2 {
+		t.Errorf("unexpected session counts: %+v", got)
+	}
+	if got.StartedAt.Sub(startedAt).Abs() > time.Millisecond {
+		t.Errorf("expected started_at %v, got %v", startedAt, got.StartedAt)
+	}
+	if got.Uptime() < time.Second {
+		t.Errorf("expected uptime of at least one interval, got %v", got.Uptime())
+	}
+}
+
+func TestRunSessionWithoutTPSL(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	monitorMetrics := map[string]interface{}{"success_count": int64(10), "error_count": int64(3)}
+
+	session := runSession(start, start.Add(time.Hour), monitorMetrics, nil)
+	if session.Cycles != 13 || session.SuccessCount != 10 || session.ErrorCount != 3 || session.OrdersPlaced != 0 {
+		t.Errorf("unexpected session: %+v", session)
+	}
+	if session.Uptime() != time.Hour {
+		t.Errorf("expected uptime 1h, got %v", session.Uptime())
+	}
+}
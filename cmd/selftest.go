@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// selfTestInstrument 未配置监控合约时自检使用的合约 / Instrument used when no instruments are configured
+const selfTestInstrument = "BTC-USDT-SWAP"
+
+// errSelfTestRollback 自检写入后故意回滚 / Returned from the self-test write to roll it back
+var errSelfTestRollback = errors.New("self-test rollback")
+
+// selfTestAPI 自检使用的OKX接口 / OKX API used by the self-test
+type selfTestAPI interface {
+	GetAccountConfig() (*okx.AccountConfigResponse, error)
+	GetTicker(instId string) (*okx.TickerResponse, error)
+	PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error)
+	CancelAlgoOrders(orders []okx.CancelAlgoOrderRequest) (*okx.AlgoOrderResponse, error)
+}
+
+// selfTest 自检清单 / Self-test checklist
+type selfTest struct {
+	out    io.Writer
+	failed bool
+}
+
+// step 执行一项检查并打印结果 / Run one check and print its result
+// 前置检查失败时跳过并记为失败 / Skipped, and counted as failed, when a prerequisite failed
+//
+// Parameters:
+//   - name: 检查名称 / Check name
+//   - ready: 前置检查是否通过 / Whether the prerequisites passed
+//   - fn: 检查函数 / Check function
+//
+// Returns:
+//   - bool: 检查是否通过 / Whether the check passed
+func (s *selfTest) step(name string, ready bool, fn func() error) bool {
+	if !ready {
+		fmt.Fprintf(s.out, "[SKIP] %s\n", name)
+		s.failed = true
+		return false
+	}
+	if err := fn(); err != nil {
+		fmt.Fprintf(s.out, "[FAIL] %s: %v\n", name, err)
+		s.failed = true
+		return false
+	}
+	fmt.Fprintf(s.out, "[PASS] %s\n", name)
+	return true
+}
+
+// runSelfTest 在模拟盘中检查完整流程 / Exercise the full pipeline against demo trading
+// 依次检查配置加载、OKX认证、获取行情、下一个不会触发的算法订单并立即撤销、数据库读写，
+// 并打印每项的通过/失败清单。数据库写入在事务中回滚，不留下数据
+// Checks in turn that the config loads, OKX auth works, a ticker can be fetched, an algo order
+// that never triggers can be placed and cancelled straight away and the database can be written
+// and read, printing a pass/fail line for each. The database write is rolled back in a
+// transaction so nothing is left behind
+//
+// Parameters:
+//   - configPath: 配置文件路径 / Config file path
+//   - out: 清单输出 / Checklist output
+//   - newClient: 根据配置创建模拟盘客户端 / Creates the demo trading client from the config
+//
+// Returns:
+//   - bool: 所有检查是否通过 / Whether every check passed
+func runSelfTest(configPath string, out io.Writer, newClient func(cfg *config.Config) selfTestAPI) bool {
+	s := &selfTest{out: out}
+
+	var cfg *config.Config
+	configOK := s.step("load configuration", true, func() error {
+		var err error
+		cfg, err = config.Load(configPath)
+		return err
+	})
+
+	var client selfTestAPI
+	hedgeMode := false
+	authOK := s.step("OKX authentication", configOK, func() error {
+		client = newClient(cfg)
+		resp, err := client.GetAccountConfig()
+		if err != nil {
+			return err
+		}
+		if len(resp.Data) == 0 {
+			return errors.New("empty account config response")
+		}
+		hedgeMode = resp.Data[0].PosMode == okx.PosModeLongShort
+		return nil
+	})
+
+	instId := selfTestInstrument
+	if configOK && len(cfg.Monitoring.Instruments) > 0 {
+		instId = cfg.Monitoring.Instruments[0]
+	}
+
+	var last float64
+	tickerOK := s.step("fetch ticker "+instId, authOK, func() error {
+		resp, err := client.GetTicker(instId)
+		if err != nil {
+			return err
+		}
+		if len(resp.Data) == 0 {
+			return errors.New("empty ticker response")
+		}
+		last, err = strconv.ParseFloat(resp.Data[0].Last, 64)
+		if err != nil || last <= 0 {
+			return fmt.Errorf("invalid last price %q", resp.Data[0].Last)
+		}
+		return nil
+	})
+
+	var algoId string
+	placeOK := s.step("place algo order", tickerOK, func() error {
+		// A buy take-profit at half the last price, far enough away that it never triggers
+		req := okx.AlgoOrderRequest{
+			InstId:      instId,
+			TdMode:      "cross",
+			Side:        "buy",
+			OrdType:     "conditional",
+			Sz:          "1",
+			TpTriggerPx: strconv.FormatFloat(last/2, 'f', -1, 64),
+			TpOrdPx:     "-1",
+		}
+		if hedgeMode {
+			req.PosSide = "short"
+		}
+		resp, err := client.PlaceAlgoOrder(req)
+		if err != nil {
+			return err
+		}
+		if len(resp.Data) == 0 || resp.Data[0].AlgoId == "" {
+			return errors.New("no algo ID in response")
+		}
+		algoId = resp.Data[0].AlgoId
+		return nil
+	})
+
+	s.step("cancel algo order", placeOK, func() error {
+		_, err := client.CancelAlgoOrders([]okx.CancelAlgoOrderRequest{{AlgoId: algoId, InstId: instId}})
+		if err != nil {
+			return fmt.Errorf("%w (cancel algo order %s manually)", err, algoId)
+		}
+		return nil
+	})
+
+	s.step("database write and read", configOK, func() error {
+		db, err := storage.New(cfg.Database.Path, cfg.Database.WALMode, cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns,
+			storage.WithBusyTimeout(cfg.Database.BusyTimeoutMs))
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		err = db.WithTx(func(tx *storage.Tx) error {
+			balance := &models.AccountBalance{Timestamp: time.Now(), Currency: "SELFTEST"}
+			if err := tx.InsertAccountBalance(balance); err != nil {
+				return err
+			}
+			return errSelfTestRollback
+		})
+		if !errors.Is(err, errSelfTestRollback) {
+			return fmt.Errorf("write failed: %w", err)
+		}
+		if _, err := db.GetLatestAccountBalances(); err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		return nil
+	})
+
+	if s.failed {
+		fmt.Fprintln(out, "Self-test FAILED")
+		return false
+	}
+	fmt.Fprintln(out, "Self-test passed")
+	return true
+}
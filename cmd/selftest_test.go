@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+)
+
+// mockSelfTestAPI 自检用的模拟OKX客户端 / Mock OKX client for the self-test
+type mockSelfTestAPI struct {
+	authErr   error
+	placed    []okx.AlgoOrderRequest
+	cancelled []okx.CancelAlgoOrderRequest
+}
+
+func (m *mockSelfTestAPI) GetAccountConfig() (*okx.AccountConfigResponse, error) {
+	if m.authErr != nil {
+		return nil, m.authErr
+	}
+	return &okx.AccountConfigResponse{Code: "0", Data: []okx.AccountConfigData{{PosMode: okx.PosModeLongShort}}}, nil
+}
+
+func (m *mockSelfTestAPI) GetTicker(instId string) (*okx.TickerResponse, error) {
+	return &okx.TickerResponse{Code: "0", Data: []okx.TickerData{{InstId: instId, Last: "50000"}}}, nil
+}
+
+func (m *mockSelfTestAPI) PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	m.placed = append(m.placed, req)
+	return &okx.AlgoOrderResponse{Code: "0", Data: []okx.AlgoOrderResult{{AlgoId: "algo-1", SCode: "0"}}}, nil
+}
+
+func (m *mockSelfTestAPI) CancelAlgoOrders(orders []okx.CancelAlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	m.cancelled = append(m.cancelled, orders...)
+	return &okx.AlgoOrderResponse{Code: "0"}, nil
+}
+
+// writeSelfTestConfig 写入自检用的配置文件 / Write a config file for the self-test
+func writeSelfTestConfig(t *testing.T, dbPath string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := fmt.Sprintf(`
+okx:
+  api_url: "https://www.okx.com"
+  api_key: "test-api-key-123"
+  api_secret: "test-secret-456"
+  passphrase: "test-passphrase"
+monitoring:
+  instruments: ["ETH-USDT-SWAP"]
+database:
+  path: %q
+`, dbPath)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestRunSelfTest(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "selftest.db")
+
+	tests := []struct {
+		name       string
+		configPath string
+		authErr    error
+		expectPass bool
+		expected   []string
+	}{
+		{
+			name:       "all steps pass",
+			configPath: writeSelfTestConfig(t, dbPath),
+			expectPass: true,
+			expected: []string{
+				"[PASS] load configuration",
+				"[PASS] OKX authentication",
+				"[PASS] fetch ticker ETH-USDT-SWAP",
+				"[PASS] place algo order",
+				"[PASS] cancel algo order",
+				"[PASS] database write and read",
+				"Self-test passed",
+			},
+		},
+		{
+			name:       "auth failure skips the exchange steps",
+			configPath: writeSelfTestConfig(t, dbPath),
+			authErr:    errors.New("invalid API key"),
+			expected: []string{
+				"[FAIL] OKX authentication: invalid API key",
+				"[SKIP] fetch ticker ETH-USDT-SWAP",
+				"[SKIP] place algo order",
+				"[SKIP] cancel algo order",
+				"[PASS] database write and read",
+				"Self-test FAILED",
+			},
+		},
+		{
+			name:       "missing config skips everything",
+			configPath: filepath.Join(t.TempDir(), "missing.yaml"),
+			expected: []string{
+				"[FAIL] load configuration",
+				"[SKIP] OKX authentication",
+				"[SKIP] database write and read",
+				"Self-test FAILED",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockSelfTestAPI{authErr: tt.authErr}
+			var out bytes.Buffer
+			passed := runSelfTest(tt.configPath, &out, func(*config.Config) selfTestAPI { return client })
+
+			if passed != tt.expectPass {
+				t.Errorf("expected pass=%v, got %v\n%s", tt.expectPass, passed, out.String())
+			}
+			for _, line := range tt.expected {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("expected output to contain %q, got:\n%s", line, out.String())
+				}
+			}
+			if tt.expectPass {
+				if len(client.placed) != 1 || len(client.cancelled) != 1 {
+					t.Fatalf("expected one placed and one cancelled order, got %d and %d", len(client.placed), len(client.cancelled))
+				}
+				if client.placed[0].PosSide != "short" || client.placed[0].TpTriggerPx != "25000" {
+					t.Errorf("expected a hedge-mode order far from the price, got %+v", client.placed[0])
+				}
+				if client.cancelled[0].AlgoId != "algo-1" || client.cancelled[0].InstId != "ETH-USDT-SWAP" {
+					t.Errorf("expected the placed order to be cancelled, got %+v", client.cancelled[0])
+				}
+			}
+		})
+	}
+
+	// The database write is rolled back, leaving no rows behind
+	db, err := storage.New(dbPath, false, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	balances, err := db.GetLatestAccountBalances()
+	if err != nil {
+		t.Fatalf("failed to read balances: %v", err)
+	}
+	if len(balances) != 0 {
+		t.Errorf("expected no balances left by the self-test, got %d", len(balances))
+	}
+}
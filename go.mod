@@ -3,7 +3,9 @@ module github.com/wTHU1Ew/TenyoJubaku
 go 1.25.0
 
 require (
-	github.com/mattn/go-sqlite3 v1.14.32 // indirect
-	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/shopspring/decimal v1.4.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/tpsl"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// MetricsSource 提供运行指标的服务 / Service reporting runtime metrics
+// 由监控服务实现 / Implemented by the monitoring service
+type MetricsSource interface {
+	GetMetrics() map[string]interface{}
+}
+
+// Dashboard 看板数据 / Dashboard document
+// 由最新存储快照和只读覆盖分析组成，不调用下单接口
+// Composed from the latest stored snapshots and the read-only coverage analysis, never placing orders
+type Dashboard struct {
+	GeneratedAt time.Time               `json:"generated_at"`
+	TotalEquity float64                 `json:"total_equity"` // USD equity of the latest balance snapshot
+	Balances    []models.AccountBalance `json:"balances"`
+	Positions   []DashboardPosition     `json:"positions"`
+	// CoverageRatio is the share of the positions' USD notional covered by TPSL, omitted on CoverageError
+	CoverageRatio *float64 `json:"coverage_ratio,omitempty"`
+	// CoverageError is set when pending orders could not be queried; positions then have no coverage
+	CoverageError string                 `json:"coverage_error,omitempty"`
+	Monitor       map[string]interface{} `json:"monitor,omitempty"` // monitoring service health, omitted when not wired
+}
+
+// DashboardPosition 看板中的持仓 / Position on the dashboard
+type DashboardPosition struct {
+	models.Position
+	Coverage *tpsl.PositionCoverage `json:"coverage,omitempty"`
+}
+
+// handleDashboard 返回看板数据 / Report the dashboard document
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		writeError(w, http.StatusServiceUnavailable, "dashboard not configured")
+		return
+	}
+
+	dashboard, err := s.dashboard()
+	if err != nil {
+		s.logger.Error("Admin dashboard query failed: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dashboard)
+}
+
+// dashboard 组装看板数据 / Compose the dashboard document
+// 覆盖分析失败时仍返回余额和持仓，并在CoverageError中说明
+// A failed coverage analysis still returns balances and positions, explained in CoverageError
+//
+// Returns:
+//   - *Dashboard: 看板数据 / Dashboard document
+//   - error: 查询存储失败时返回错误 / Error when storage cannot be queried
+func (s *Server) dashboard() (*Dashboard, error) {
+	totalEquity, err := s.storage.GetTotalEquity()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := s.storage.GetLatestAccountBalances()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := s.storage.GetLatestPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard := &Dashboard{
+		GeneratedAt: time.Now().UTC(),
+		TotalEquity: totalEquity,
+		Balances:    balances,
+		Positions:   make([]DashboardPosition, len(positions)),
+	}
+	if dashboard.Balances == nil {
+		dashboard.Balances = []models.AccountBalance{}
+	}
+
+	analyzed := make([]*models.Position, len(positions))
+	for i := range positions {
+		dashboard.Positions[i].Position = positions[i]
+		analyzed[i] = &positions[i]
+	}
+	coverage, err := s.scheduler.Manager().AnalyzeCoverage(analyzed)
+	if err != nil {
+		s.logger.Warn("Dashboard coverage analysis failed: %v", err)
+		dashboard.CoverageError = err.Error()
+	} else {
+		for i := range coverage {
+			dashboard.Positions[i].Coverage = &coverage[i]
+		}
+		ratio := tpsl.CoverageRatio(analyzed, coverage)
+		dashboard.CoverageRatio = &ratio
+	}
+
+	if s.monitor != nil {
+		dashboard.Monitor = s.monitor.GetMetrics()
+	}
+	return dashboard, nil
+}
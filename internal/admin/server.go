@@ -0,0 +1,204 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/tpsl"
+)
+
+// shutdownTimeout 关闭HTTP服务的最长等待时间 / Maximum wait for in-flight requests on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Server 管理接口服务 / Admin HTTP API server
+// 提供按需触发TPSL检查、暂停/恢复定时检查、查询覆盖状态和看板数据的接口
+// Serves endpoints to trigger a TPSL check on demand, pause and resume scheduled checks,
+// inspect coverage and read the dashboard
+type Server struct {
+	config    *config.AdminConfig
+	scheduler *tpsl.Scheduler
+	logger    *logger.Logger
+	done      chan struct{}
+
+	storage *storage.Storage // snapshot source of /dashboard, nil until SetDashboard
+	monitor MetricsSource    // health reported on /dashboard, optional
+}
+
+// New 创建管理接口服务 / Create admin HTTP API server
+//
+// Parameters:
+//   - config: Admin configuration
+//   - scheduler: TPSL scheduler whose manager serves the requests
+//   - logger: Logger instance
+//
+// Returns:
+//   - *Server: 管理接口服务实例 / Admin server instance
+func New(config *config.AdminConfig, scheduler *tpsl.Scheduler, logger *logger.Logger) *Server {
+	return &Server{
+		config:    config,
+		scheduler: scheduler,
+		logger:    logger,
+		done:      make(chan struct{}),
+	}
+}
+
+// SetDashboard 设置看板数据来源 / Set dashboard data sources
+// 未设置存储时/dashboard返回503
+// /dashboard responds 503 until a storage is set
+//
+// Parameters:
+//   - storage: Storage holding the latest balance and position snapshots
+//   - monitor: Monitoring service whose metrics report health, nil to omit health
+func (s *Server) SetDashboard(storage *storage.Storage, monitor MetricsSource) {
+	s.storage = storage
+	s.monitor = monitor
+}
+
+// Handler 返回带鉴权的HTTP处理器 / Return the authenticated HTTP handler
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tpsl/check", s.handleCheck)
+	mux.HandleFunc("POST /tpsl/pause", s.handlePause)
+	mux.HandleFunc("POST /tpsl/resume", s.handleResume)
+	mux.HandleFunc("GET /tpsl/coverage", s.handleCoverage)
+	mux.HandleFunc("GET /tpsl/metrics", s.handleMetrics)
+	mux.HandleFunc("GET /dashboard", s.handleDashboard)
+	return s.authenticate(mux)
+}
+
+// Start 启动管理接口服务 / Start admin HTTP API server
+// 监听失败时立即返回错误；之后在后台处理请求，ctx取消后关闭
+// Returns immediately with an error if the address cannot be bound; requests are then
+// served in the background until ctx is cancelled
+//
+// Parameters:
+//   - ctx: 控制服务生命周期的上下文 / Context controlling the server lifetime
+//
+// Returns:
+//   - error: 监听地址失败时返回错误 / Error when the listen address cannot be bound
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.ListenAddr, err)
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warn("Admin API shutdown error: %v", err)
+		}
+	}()
+
+	go func() {
+		defer close(s.done)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Admin API server error: %v", err)
+		}
+		s.logger.Info("Admin API stopped")
+	}()
+
+	s.logger.Info("Admin API listening on %s", listener.Addr())
+	return nil
+}
+
+// Done 返回服务退出时关闭的通道 / Return channel closed when the server has exited
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// authenticate 校验Bearer令牌 / Require the configured bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if s.config.Token == "" || subtle.ConstantTimeCompare(got, expected) != 1 {
+			s.logger.Warn("Rejected admin API request %s %s from %s: invalid token", r.Method, r.URL.Path, r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCheck 立即执行TPSL检查 / Run a TPSL check immediately
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("TPSL check requested via admin API from %s", r.RemoteAddr)
+
+	summary, err := s.scheduler.RunCheck()
+	if err != nil {
+		s.logger.Error("Admin-triggered TPSL check failed: %v", err)
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handlePause 暂停定时TPSL检查 / Pause scheduled TPSL checks
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("TPSL pause requested via admin API from %s", r.RemoteAddr)
+	s.scheduler.Pause()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.scheduler.Paused()})
+}
+
+// handleResume 恢复定时TPSL检查 / Resume scheduled TPSL checks
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("TPSL resume requested via admin API from %s", r.RemoteAddr)
+	s.scheduler.Resume()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.scheduler.Paused()})
+}
+
+// handleCoverage 返回当前持仓的覆盖状态 / Report coverage of current positions
+func (s *Server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	coverage, err := s.scheduler.Coverage()
+	if err != nil {
+		s.logger.Error("Admin coverage query failed: %v", err)
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, coverage)
+}
+
+// handleMetrics 返回TPSL指标 / Report TPSL metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.Manager().GetMetrics())
+}
+
+// statusFor 将错误映射为HTTP状态码 / Map an error to an HTTP status code
+// 快照过期是暂时状态，返回503；其余返回502（上游OKX或数据库失败）
+// A stale snapshot is temporary (503); anything else is an upstream failure (502)
+func statusFor(err error) int {
+	if errors.Is(err, tpsl.ErrSnapshotStale) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// writeJSON 写入JSON响应 / Write a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入JSON错误响应 / Write a JSON error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
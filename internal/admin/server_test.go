@@ -0,0 +1,268 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/tpsl"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+const testToken = "s3cret"
+
+// newTestServer creates an admin server whose scheduler reads live positions from a mock OKX API
+// holding one uncovered 3-contract long BTC swap position
+func newTestServer(t *testing.T) (*Server, *int) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	placed := 0
+
+	okxServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross"}]}`))
+		case "/api/v5/trade/orders-algo-pending":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/account/max-avail-size":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","availBuy":"10","availSell":"10"}]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+		case "/api/v5/trade/order-algo":
+			placed++
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","tickSz":"0.1","lotSz":"0.01"}]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(okxServer.Close)
+
+	db, err := storage.New(filepath.Join(tmpDir, "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	log, err := logger.New(filepath.Join(tmpDir, "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	tpslCfg := &config.TPSLConfig{
+		VolatilityPct:   0.01,
+		ProfitLossRatio: 5.0,
+		PriceBufferPct:  0.001,
+		PositionSource:  "live",
+	}
+	client := okx.New(okxServer.URL, "key", "secret", "pass", 5, 0, false)
+	scheduler := tpsl.NewScheduler(tpslCfg, db, client, log)
+
+	return New(&config.AdminConfig{Token: testToken}, scheduler, log), &placed
+}
+
+// doRequest sends a request through the admin handler
+func doRequest(server *Server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTPSLCheckEndpoint(t *testing.T) {
+	server, placed := newTestServer(t)
+
+	rec := doRequest(server, "POST", "/tpsl/check", testToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var summary tpsl.CoverageSummary
+	if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if summary.TotalChecked != 1 || summary.NotCovered != 1 || summary.OrdersPlaced != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if *placed != 2 {
+		t.Errorf("expected TP and SL placed, got %d order-algo requests", *placed)
+	}
+}
+
+func TestTPSLCoverageEndpoint(t *testing.T) {
+	server, placed := newTestServer(t)
+
+	rec := doRequest(server, "GET", "/tpsl/coverage", testToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var coverage []tpsl.PositionCoverage
+	if err := json.NewDecoder(rec.Body).Decode(&coverage); err != nil {
+		t.Fatalf("failed to decode coverage: %v", err)
+	}
+	if len(coverage) != 1 {
+		t.Fatalf("expected 1 position, got %d", len(coverage))
+	}
+	if coverage[0].Instrument != "BTC-USDT-SWAP" || coverage[0].Status != "uncovered" || coverage[0].UncoveredSize != 3 {
+		t.Errorf("unexpected coverage: %+v", coverage[0])
+	}
+	if *placed != 0 {
+		t.Errorf("coverage query must not place orders, got %d order-algo requests", *placed)
+	}
+}
+
+func TestTPSLPauseResumeEndpoints(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for _, step := range []struct {
+		path   string
+		paused bool
+	}{
+		{"/tpsl/pause", true},
+		{"/tpsl/pause", true}, // Pausing twice is harmless
+		{"/tpsl/resume", false},
+	} {
+		rec := doRequest(server, "POST", step.path, testToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", step.path, rec.Code, rec.Body.String())
+		}
+		var state map[string]bool
+		if err := json.NewDecoder(rec.Body).Decode(&state); err != nil {
+			t.Fatalf("%s: failed to decode state: %v", step.path, err)
+		}
+		if state["paused"] != step.paused || server.scheduler.Paused() != step.paused {
+			t.Errorf("%s: expected paused=%v, got response %v scheduler %v", step.path, step.paused, state, server.scheduler.Paused())
+		}
+	}
+}
+
+func TestAdminAuthAndRouting(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		expectStatus int
+	}{
+		{"missing token", "POST", "/tpsl/check", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/tpsl/coverage", "wrong", http.StatusUnauthorized},
+		{"wrong method", "GET", "/tpsl/check", testToken, http.StatusMethodNotAllowed},
+		{"unknown path", "GET", "/tpsl/unknown", testToken, http.StatusNotFound},
+		{"metrics", "GET", "/tpsl/metrics", testToken, http.StatusOK},
+		{"pause without token", "POST", "/tpsl/pause", "", http.StatusUnauthorized},
+		{"resume wrong method", "GET", "/tpsl/resume", testToken, http.StatusMethodNotAllowed},
+		{"dashboard without token", "GET", "/dashboard", "", http.StatusUnauthorized},
+		{"dashboard not configured", "GET", "/dashboard", testToken, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(server, tt.method, tt.path, tt.token)
+			if rec.Code != tt.expectStatus {
+				t.Errorf("expected %d, got %d", tt.expectStatus, rec.Code)
+			}
+		})
+	}
+}
+
+// fakeMonitor reports fixed monitoring metrics
+type fakeMonitor map[string]interface{}
+
+func (f fakeMonitor) GetMetrics() map[string]interface{} { return f }
+
+func TestDashboardEndpoint(t *testing.T) {
+	server, placed := newTestServer(t)
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "dashboard.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, b := range []models.AccountBalance{
+		{Timestamp: now, Currency: "USDT", Balance: 1000, Available: 900, Frozen: 100, Equity: 1000},
+		{Timestamp: now, Currency: "BTC", Balance: 0.01, Available: 0.01, Equity: 500},
+	} {
+		if err := db.InsertAccountBalance(&b); err != nil {
+			t.Fatalf("failed to insert balance: %v", err)
+		}
+	}
+	position := &models.Position{
+		Timestamp:     now,
+		Instrument:    "BTC-USDT-SWAP",
+		PositionSide:  models.PositionSideLong,
+		PositionSize:  3,
+		AveragePrice:  50000,
+		UnrealizedPnL: 42.5,
+		MarginMode:    models.MarginModeCross,
+		NotionalUSD:   150000,
+	}
+	if err := db.InsertPosition(position); err != nil {
+		t.Fatalf("failed to insert position: %v", err)
+	}
+	server.SetDashboard(db, fakeMonitor{"success_count": 7, "consecutive_failures": 0})
+
+	rec := doRequest(server, "GET", "/dashboard", testToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Decode generically so the test pins the JSON field names a frontend relies on
+	var doc map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode dashboard: %v", err)
+	}
+	for _, key := range []string{"generated_at", "total_equity", "balances", "positions", "monitor"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("expected key %q in dashboard, got %v", key, doc)
+		}
+	}
+	if _, ok := doc["coverage_error"]; ok {
+		t.Errorf("expected no coverage_error, got %v", doc["coverage_error"])
+	}
+	if doc["total_equity"] != 1500.0 {
+		t.Errorf("expected total_equity 1500, got %v", doc["total_equity"])
+	}
+	if balances, _ := doc["balances"].([]interface{}); len(balances) != 2 {
+		t.Errorf("expected 2 balances, got %v", doc["balances"])
+	}
+	if monitor, _ := doc["monitor"].(map[string]interface{}); monitor["success_count"] != 7.0 {
+		t.Errorf("expected monitor success_count 7, got %v", doc["monitor"])
+	}
+
+	positions, _ := doc["positions"].([]interface{})
+	if len(positions) != 1 {
+		t.Fatalf("expected 1 position, got %v", doc["positions"])
+	}
+	p, _ := positions[0].(map[string]interface{})
+	if p["instrument"] != "BTC-USDT-SWAP" || p["unrealized_pnl"] != 42.5 {
+		t.Errorf("unexpected position: %v", p)
+	}
+	coverage, _ := p["coverage"].(map[string]interface{})
+	if coverage["status"] != "uncovered" || coverage["uncovered_size"] != 3.0 {
+		t.Errorf("expected uncovered coverage of size 3, got %v", p["coverage"])
+	}
+	if doc["coverage_ratio"] != 0.0 {
+		t.Errorf("expected coverage_ratio 0 with the only position uncovered, got %v", doc["coverage_ratio"])
+	}
+
+	if *placed != 0 {
+		t.Errorf("dashboard must not place orders, got %d order-algo requests", *placed)
+	}
+}
@@ -0,0 +1,90 @@
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+)
+
+// Alerter 告警器 / Alerter
+// 以WARN级别记录告警，并按告警键去重，持续存在的状况不会每个周期重复告警
+// Records alerts at WARN level and deduplicates them per key, so a persistent
+// condition doesn't repeat on every cycle
+type Alerter struct {
+	logger         *logger.Logger
+	repeatInterval time.Duration
+	now            func() time.Time
+
+	mu     sync.Mutex
+	active map[string]time.Time // alert key -> last time it was emitted
+}
+
+// New 创建告警器 / Create alerter
+//
+// Parameters:
+//   - logger: Logger instance used to emit alerts
+//   - repeatInterval: 同一告警键重复告警的最小间隔 / Minimum interval before the same alert key fires again
+//
+// Returns:
+//   - *Alerter: 告警器实例 / Alerter instance
+func New(logger *logger.Logger, repeatInterval time.Duration) *Alerter {
+	return &Alerter{
+		logger:         logger,
+		repeatInterval: repeatInterval,
+		now:            time.Now,
+		active:         make(map[string]time.Time),
+	}
+}
+
+// Alert 发出告警 / Emit alert
+// 同一告警键在repeatInterval内只告警一次
+// The same alert key fires at most once per repeatInterval
+//
+// Parameters:
+//   - key: 告警键，标识告警的状况 / Alert key identifying the condition (e.g., "margin_ratio")
+//   - format: 告警消息格式 / Alert message format
+//   - args: 格式化参数 / Format arguments
+//
+// Returns:
+//   - bool: 是否实际发出告警 / Whether the alert was actually emitted (false if deduplicated)
+func (a *Alerter) Alert(key, format string, args ...interface{}) bool {
+	a.mu.Lock()
+	now := a.now()
+	last, ok := a.active[key]
+	if ok && now.Sub(last) < a.repeatInterval {
+		a.mu.Unlock()
+		return false
+	}
+	a.active[key] = now
+	a.mu.Unlock()
+
+	a.logger.Warn("ALERT [%s]: %s", key, fmt.Sprintf(format, args...))
+	return true
+}
+
+// Resolve 解除告警 / Resolve alert
+// 状况恢复后调用，下次出现时立即告警，并记录恢复日志
+// Call once the condition clears so the next occurrence alerts immediately; logs the recovery
+//
+// Parameters:
+//   - key: 告警键 / Alert key
+func (a *Alerter) Resolve(key string) {
+	a.mu.Lock()
+	_, ok := a.active[key]
+	delete(a.active, key)
+	a.mu.Unlock()
+
+	if ok {
+		a.logger.Info("ALERT RESOLVED [%s]", key)
+	}
+}
+
+// IsActive 告警是否处于活动状态 / Whether an alert is active
+func (a *Alerter) IsActive(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.active[key]
+	return ok
+}
@@ -0,0 +1,61 @@
+package alert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+)
+
+func TestAlertDeduplication(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.log")
+	log, err := logger.New(logPath, logger.INFO, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	alerter := New(log, 10*time.Minute)
+	alerter.now = func() time.Time { return now }
+
+	if !alerter.Alert("margin_ratio", "margin ratio %.2f", 1.5) {
+		t.Error("first alert should fire")
+	}
+	if alerter.Alert("margin_ratio", "margin ratio %.2f", 1.4) {
+		t.Error("repeated alert within interval should be suppressed")
+	}
+	if !alerter.Alert("liq:BTC-USDT-SWAP", "near liquidation") {
+		t.Error("alert with a different key should fire")
+	}
+
+	// Repeat interval elapsed
+	now = now.Add(11 * time.Minute)
+	if !alerter.Alert("margin_ratio", "margin ratio %.2f", 1.3) {
+		t.Error("alert should fire again after repeat interval")
+	}
+
+	// Resolved alerts fire immediately on next occurrence
+	alerter.Resolve("margin_ratio")
+	if alerter.IsActive("margin_ratio") {
+		t.Error("resolved alert should not be active")
+	}
+	if !alerter.Alert("margin_ratio", "margin ratio %.2f", 1.2) {
+		t.Error("alert should fire after being resolved")
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	if got := strings.Count(string(content), "ALERT [margin_ratio]"); got != 3 {
+		t.Errorf("expected 3 margin_ratio alerts in log, got %d", got)
+	}
+	if !strings.Contains(string(content), "[WARN]") {
+		t.Error("alerts should be logged at WARN level")
+	}
+}
@@ -0,0 +1,78 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时钟 / Clock
+// 依赖时间的逻辑通过Clock读取时间和等待，测试中可替换为Fake以获得确定的结果
+// Time-dependent logic reads the time and waits through a Clock, so tests can swap in a Fake
+// and run deterministically
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// Real 系统时钟 / System clock
+type Real struct{}
+
+// Now 返回当前时间 / Return the current time
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep 阻塞等待d / Block for d
+func (Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Fake 测试用时钟 / Clock for tests
+// 时间只在Advance或Sleep时前进；Sleep不阻塞，立即前移时间并记录等待时长
+// Time only moves on Advance or Sleep; Sleep never blocks, it moves the time forward at once and
+// records the duration
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// NewFake 创建测试用时钟 / Create a clock for tests
+//
+// Parameters:
+//   - start: 初始时间 / Initial time
+//
+// Returns:
+//   - *Fake: 测试用时钟 / Clock for tests
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now 返回当前模拟时间 / Return the current fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Sleep 记录等待时长并前移时间 / Record the wait and move the time forward
+func (f *Fake) Sleep(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sleeps = append(f.sleeps, d)
+	f.now = f.now.Add(d)
+}
+
+// Advance 前移时间 / Move the time forward
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Sleeps 返回Sleep调用的等待时长 / Return the durations passed to Sleep
+func (f *Fake) Sleeps() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.sleeps...)
+}
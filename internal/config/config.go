@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,23 +17,73 @@ type Config struct {
 	Database   DatabaseConfig   `yaml:"database"`
 	Logging    LoggingConfig    `yaml:"logging"`
 	TPSL       TPSLConfig       `yaml:"tpsl"`
+	Alert      AlertConfig      `yaml:"alert"`
+	Shutdown   ShutdownConfig   `yaml:"shutdown"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Watchdog   WatchdogConfig   `yaml:"watchdog"`
 }
 
 // OKXConfig OKX API配置 / OKX API configuration
 type OKXConfig struct {
-	APIURL      string `yaml:"api_url"`
-	APIKey      string `yaml:"api_key"`
-	APISecret   string `yaml:"api_secret"`
-	Passphrase  string `yaml:"passphrase"`
-	Timeout     int    `yaml:"timeout"`
-	MaxRetries  int    `yaml:"max_retries"`
-	DebugEnable bool   `yaml:"debug_enable"`
+	APIURL           string `yaml:"api_url"`
+	APIKey           string `yaml:"api_key"`
+	APISecret        string `yaml:"api_secret"`
+	Passphrase       string `yaml:"passphrase"`
+	Timeout          int    `yaml:"timeout"`
+	MaxRetries       int    `yaml:"max_retries"`
+	MaxBackoff       int    `yaml:"max_backoff"`
+	DebugEnable      bool   `yaml:"debug_enable"`
+	WSEnabled        bool   `yaml:"ws_enabled"`
+	WSPublicURL      string `yaml:"ws_public_url"`
+	WSPrivateEnabled bool   `yaml:"ws_private_enabled"`
+	WSPrivateURL     string `yaml:"ws_private_url"`
+
+	BaseBackoff float64 `yaml:"base_backoff"`
+	// JitterFraction is a pointer so an explicit 0 (no jitter) differs from unset (full jitter)
+	JitterFraction *float64 `yaml:"jitter_fraction"`
+	// MaintenanceBackoff is the wait in seconds before retrying an OKX maintenance response
+	MaintenanceBackoff int `yaml:"maintenance_backoff"`
+	// RequestTimeouts overrides Timeout (seconds) for individual endpoint paths
+	RequestTimeouts map[string]int `yaml:"request_timeouts"`
+
+	// SimulatedTrading sends every request to OKX demo trading, which needs demo API keys
+	SimulatedTrading bool `yaml:"simulated_trading"`
+
+	// FallbackURLs are other OKX domains tried in order once APIURL fails FailoverThreshold
+	// request attempts in a row
+	FallbackURLs      []string `yaml:"fallback_urls"`
+	FailoverThreshold int      `yaml:"failover_threshold"`
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout (seconds) tune the HTTP connection
+	// pool so a warm connection to OKX survives between polling cycles
+	MaxIdleConns        int `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     int `yaml:"idle_conn_timeout"`
+
+	// Secret files (e.g., Docker/Kubernetes secret mounts) take precedence over the inline values
+	APIKeyFile     string `yaml:"api_key_file"`
+	APISecretFile  string `yaml:"api_secret_file"`
+	PassphraseFile string `yaml:"passphrase_file"`
 }
 
 // MonitoringConfig 监控配置 / Monitoring configuration
 type MonitoringConfig struct {
-	Interval int  `yaml:"interval"`
-	Enabled  bool `yaml:"enabled"`
+	Interval         Seconds  `yaml:"interval"`
+	Enabled          bool     `yaml:"enabled"`
+	MarginRatioAlert float64  `yaml:"margin_ratio_alert"`
+	LiqDistanceAlert float64  `yaml:"liq_distance_alert"`
+	PnLSwingAlertUSD float64  `yaml:"pnl_swing_alert_usd"`
+	PnLSwingAlertPct float64  `yaml:"pnl_swing_alert_pct"`
+	Instruments      []string `yaml:"instruments"`
+	// MaxConsecutiveFailures stops the service after this many failed cycles in a row, 0 never stops
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures"`
+	// BalanceChangeAlertUSD and BalanceChangeAlertPct alert on balance changes not explained by PnL, 0 disables
+	BalanceChangeAlertUSD float64 `yaml:"balance_change_alert_usd"`
+	BalanceChangeAlertPct float64 `yaml:"balance_change_alert_pct"`
+	// SyncBills stores account bills (fees, funding, realized PnL) every cycle for reporting
+	SyncBills bool `yaml:"sync_bills"`
+	// StartupJitterSeconds delays the first cycle by a random amount up to this, 0 disables
+	StartupJitterSeconds int `yaml:"startup_jitter_seconds"`
 }
 
 // DatabaseConfig 数据库配置 / Database configuration
@@ -40,6 +92,10 @@ type DatabaseConfig struct {
 	WALMode      bool   `yaml:"wal_mode"`
 	MaxOpenConns int    `yaml:"max_open_conns"`
 	MaxIdleConns int    `yaml:"max_idle_conns"`
+	// MaintenanceIntervalHours is a pointer so an explicit 0 (never) differs from unset (default)
+	MaintenanceIntervalHours *int `yaml:"maintenance_interval_hours"`
+	// BusyTimeoutMs is how long a write waits for a lock held by another connection
+	BusyTimeoutMs int `yaml:"busy_timeout_ms"`
 }
 
 // LoggingConfig 日志配置 / Logging configuration
@@ -51,14 +107,118 @@ type LoggingConfig struct {
 	MaxBackups int    `yaml:"max_backups"`
 	Compress   bool   `yaml:"compress"`
 	Console    bool   `yaml:"console"`
+
+	// Async 异步写入日志，调用方不阻塞于磁盘I/O / Write logs asynchronously so callers do not block on disk I/O
+	Async bool `yaml:"async"`
+	// AsyncQueueSize 异步队列容量（条目数）/ Async queue capacity in entries
+	AsyncQueueSize int `yaml:"async_queue_size"`
+	// AsyncOverflow 队列满时的处理方式: block或drop / Behaviour when the queue is full: block or drop
+	AsyncOverflow string `yaml:"async_overflow"`
+	// MaskKeys 额外的敏感关键词，与默认列表合并 / Extra sensitive keywords merged with the default list
+	MaskKeys []string `yaml:"mask_keys"`
+
+	// RotateAt 每天轮转日志的本地时刻"HH:MM"，为空时不按时刻轮转 / Local time of day "HH:MM" to rotate daily, empty disables
+	RotateAt string `yaml:"rotate_at"`
+	// RotateIntervalHours 按固定间隔轮转日志（小时），0表示不启用 / Rotate at a fixed interval in hours, 0 disables
+	RotateIntervalHours int `yaml:"rotate_interval_hours"`
+}
+
+// AlertConfig 告警配置 / Alert configuration
+type AlertConfig struct {
+	RepeatInterval int `yaml:"repeat_interval"`
+}
+
+// ShutdownConfig 关闭配置 / Shutdown configuration
+type ShutdownConfig struct {
+	GracePeriod int `yaml:"grace_period"`
+}
+
+// WatchdogConfig 监控看门狗配置 / Monitoring watchdog configuration
+type WatchdogConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Timeout int    `yaml:"timeout"`
+	Action  string `yaml:"action"`
+}
+
+// AdminConfig 管理接口配置 / Admin HTTP API configuration
+type AdminConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	ListenAddr string `yaml:"listen_addr"`
+	Token      string `yaml:"token"`
 }
 
 // TPSLConfig TPSL管理配置 / TPSL management configuration
 type TPSLConfig struct {
-	Enabled         bool    `yaml:"enabled"`
-	CheckInterval   int     `yaml:"check_interval"`
-	VolatilityPct   float64 `yaml:"volatility_pct"`
-	ProfitLossRatio float64 `yaml:"profit_loss_ratio"`
+	Enabled          bool    `yaml:"enabled"`
+	CheckInterval    Seconds `yaml:"check_interval"`
+	VolatilityPct    float64 `yaml:"volatility_pct"`
+	ProfitLossRatio  float64 `yaml:"profit_loss_ratio"`
+	MaxSnapshotAge   int     `yaml:"max_snapshot_age"`
+	PositionSource   string  `yaml:"position_source"`
+	PriceBufferPct   float64 `yaml:"price_buffer_pct"`
+	LiqBufferPct     float64 `yaml:"liq_buffer_pct"`
+	MaxSpreadPct     float64 `yaml:"max_spread_pct"`
+	SLMode           string  `yaml:"sl_mode"`
+	RiskPerTradeUSD  float64 `yaml:"risk_per_trade_usd"`
+	OrderMaxAgeHours int     `yaml:"order_max_age_hours"`
+	// PriceCacheTTL is a pointer so an explicit 0 (no caching) differs from unset (default TTL)
+	PriceCacheTTL *float64 `yaml:"price_cache_ttl"`
+	// ReduceOnly is a pointer so an explicit false differs from unset (default true)
+	ReduceOnly *bool `yaml:"reduce_only"`
+	// UseCloseFraction places one full-position TP/SL order with closeFraction instead of sized orders
+	UseCloseFraction bool `yaml:"use_close_fraction"`
+	// TPTriggerPxType and SLTriggerPxType choose the price (last, index or mark) each leg triggers on
+	TPTriggerPxType string `yaml:"tp_trigger_px_type"`
+	SLTriggerPxType string `yaml:"sl_trigger_px_type"`
+	// OrderTag is the OKX broker tag attached to every order, empty for none
+	OrderTag string `yaml:"order_tag"`
+	// ClientOrderIds sets a deterministic algoClOrdId per instrument, side, leg, size, trigger and UTC day
+	ClientOrderIds bool `yaml:"client_order_ids"`
+	// TPTrailDistancePct trails TP and SL this fraction around the high-water mark once price
+	// passes entry by TPTrailActivationPct, 0 disables
+	TPTrailDistancePct   float64 `yaml:"tp_trail_distance_pct"`
+	TPTrailActivationPct float64 `yaml:"tp_trail_activation_pct"`
+	// SLTightenAfterHours multiplies the stop distance of positions open longer than this by
+	// SLTightenFactor, 0 disables
+	SLTightenAfterHours int     `yaml:"sl_tighten_after_hours"`
+	SLTightenFactor     float64 `yaml:"sl_tighten_factor"`
+	// NewPositionGraceSeconds defers the first placement for positions opened less than this
+	// long ago so a multi-fill entry settles its average price, 0 disables
+	NewPositionGraceSeconds int `yaml:"new_position_grace_seconds"`
+	// VerifyPlacement re-queries pending algo orders after a run that placed orders and alerts
+	// when a placed order is not live or covers less than placed
+	VerifyPlacement bool `yaml:"verify_placement"`
+
+	MinUncoveredFraction   float64 `yaml:"min_uncovered_fraction"`
+	UnpairedAction         string  `yaml:"unpaired_action"`
+	MaxOrdersPerInstrument int     `yaml:"max_orders_per_instrument"`
+	AllowPartialCoverage   bool    `yaml:"allow_partial_coverage"`
+
+	// ResidualAction is ignore (leave it unprotected) or close (reduce-only market order) for
+	// residuals below MinUncoveredFraction
+	ResidualAction string `yaml:"residual_action"`
+
+	// MaxNotionalUSD caps a position's USD notional, 0 disables; per-instrument caps override it
+	MaxNotionalUSD             float64            `yaml:"max_notional_usd"`
+	MaxNotionalUSDByInstrument map[string]float64 `yaml:"max_notional_usd_by_instrument"`
+	// NotionalCapAction is alert (keep protecting the position) or refuse (place no TPSL) above the cap
+	NotionalCapAction string `yaml:"notional_cap_action"`
+
+	// Mode chooses the legs placed: tp_sl (both), sl_only or tp_only; coverage counts only those legs
+	Mode string `yaml:"mode"`
+
+	// MaxMarginRisk caps the fraction of margin a filled stop loses (stop distance / entry × leverage),
+	// 0 disables; MarginRiskAction is alert or refuse (place no TPSL) above it
+	MaxMarginRisk    float64 `yaml:"max_margin_risk"`
+	MarginRiskAction string  `yaml:"margin_risk_action"`
+
+	// UseLimitOrders executes TP/SL as a limit order at the trigger, moved LimitOrderOffsetPct
+	// in the closing direction, instead of at market; a limit TP/SL may not fill
+	UseLimitOrders      bool    `yaml:"use_limit_orders"`
+	LimitOrderOffsetPct float64 `yaml:"limit_order_offset_pct"`
+
+	IncludeInstruments []string `yaml:"include_instruments"`
+	ExcludeInstruments []string `yaml:"exclude_instruments"`
 }
 
 // Load 加载配置文件 / Load configuration from file
@@ -94,6 +254,11 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// Read credentials from secret files
+	if err := cfg.OKX.loadSecretFiles(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -102,6 +267,40 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// loadSecretFiles 从密钥文件读取凭证 / Read credentials from secret files
+// 设置了*_file字段时读取对应文件（去除首尾空白）并覆盖内联值
+// When a *_file field is set, the referenced file is read (whitespace trimmed) and overrides the inline value
+//
+// Returns:
+//   - error: 文件不存在、无法读取或为空时返回错误 / Error if a file is missing, unreadable or empty
+func (c *OKXConfig) loadSecretFiles() error {
+	secrets := []struct {
+		key   string
+		path  string
+		value *string
+	}{
+		{"okx.api_key_file", c.APIKeyFile, &c.APIKey},
+		{"okx.api_secret_file", c.APISecretFile, &c.APISecret},
+		{"okx.passphrase_file", c.PassphraseFile, &c.Passphrase},
+	}
+
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", secret.key, err)
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return fmt.Errorf("%s %s is empty", secret.key, secret.path)
+		}
+		*secret.value = value
+	}
+	return nil
+}
+
 // Validate 验证配置 / Validate configuration
 // 验证所有配置项的有效性，并为未设置的项应用默认值
 // Validate all configuration items and apply default values for unset items
@@ -129,11 +328,144 @@ func (c *Config) Validate() error {
 	if c.OKX.MaxRetries < 0 {
 		c.OKX.MaxRetries = 3 // Default max retries
 	}
+	if c.OKX.MaxBackoff <= 0 {
+		c.OKX.MaxBackoff = 30 // Default 30 seconds
+	}
+	if c.OKX.BaseBackoff <= 0 {
+		c.OKX.BaseBackoff = 1 // Default 1 second
+	}
+	if c.OKX.BaseBackoff > float64(c.OKX.MaxBackoff) {
+		return fmt.Errorf("okx.base_backoff must not exceed okx.max_backoff (%d), got %f", c.OKX.MaxBackoff, c.OKX.BaseBackoff)
+	}
+	if c.OKX.JitterFraction == nil {
+		jitter := 1.0 // Default full jitter
+		c.OKX.JitterFraction = &jitter
+	}
+	if *c.OKX.JitterFraction < 0 || *c.OKX.JitterFraction > 1 {
+		return fmt.Errorf("okx.jitter_fraction must be between 0 and 1, got %f", *c.OKX.JitterFraction)
+	}
+	if c.OKX.MaintenanceBackoff <= 0 {
+		c.OKX.MaintenanceBackoff = 60 // Default 1 minute
+	}
+	for _, url := range c.OKX.FallbackURLs {
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return fmt.Errorf("okx.fallback_urls entries must be base URLs like https://aws.okx.com, got %q", url)
+		}
+	}
+	if c.OKX.FailoverThreshold < 0 {
+		return fmt.Errorf("okx.failover_threshold must be non-negative, got %d", c.OKX.FailoverThreshold)
+	}
+	if c.OKX.FailoverThreshold == 0 {
+		c.OKX.FailoverThreshold = 3 // Default 3 consecutive failures
+	}
+	if c.OKX.MaxIdleConns < 0 {
+		return fmt.Errorf("okx.max_idle_conns must be non-negative, got %d", c.OKX.MaxIdleConns)
+	}
+	if c.OKX.MaxIdleConns == 0 {
+		c.OKX.MaxIdleConns = 10 // Default 10
+	}
+	if c.OKX.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("okx.max_idle_conns_per_host must be non-negative, got %d", c.OKX.MaxIdleConnsPerHost)
+	}
+	if c.OKX.MaxIdleConnsPerHost == 0 {
+		c.OKX.MaxIdleConnsPerHost = 4 // Default 4, covering the monitor and TPSL checks running at once
+	}
+	if c.OKX.IdleConnTimeout < 0 {
+		return fmt.Errorf("okx.idle_conn_timeout must be non-negative, got %d", c.OKX.IdleConnTimeout)
+	}
+	if c.OKX.IdleConnTimeout == 0 {
+		c.OKX.IdleConnTimeout = 120 // Default 2 minutes, longer than the usual 60s polling interval
+	}
+	for path, timeout := range c.OKX.RequestTimeouts {
+		if !strings.HasPrefix(path, "/api/") || strings.Contains(path, "?") {
+			return fmt.Errorf("okx.request_timeouts key must be an endpoint path like /api/v5/trade/order-algo, got %q", path)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("okx.request_timeouts[%s] must be positive, got %d", path, timeout)
+		}
+	}
+	if c.OKX.WSPublicURL == "" {
+		c.OKX.WSPublicURL = "wss://ws.okx.com:8443/ws/v5/public"
+	}
+	if c.OKX.WSPrivateURL == "" {
+		c.OKX.WSPrivateURL = "wss://ws.okx.com:8443/ws/v5/private"
+	}
 
 	// Validate monitoring configuration
 	if c.Monitoring.Interval <= 0 {
 		c.Monitoring.Interval = 60 // Default 60 seconds
 	}
+	if c.Monitoring.MarginRatioAlert <= 0 {
+		c.Monitoring.MarginRatioAlert = 3.0 // Default 300%
+	}
+	if c.Monitoring.LiqDistanceAlert <= 0 {
+		c.Monitoring.LiqDistanceAlert = 0.05 // Default 5%
+	}
+	if c.Monitoring.LiqDistanceAlert >= 1.0 {
+		return fmt.Errorf("monitoring.liq_distance_alert must be between 0 and 1, got %f", c.Monitoring.LiqDistanceAlert)
+	}
+	if c.Monitoring.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf("monitoring.max_consecutive_failures must be non-negative (0 disables), got %d", c.Monitoring.MaxConsecutiveFailures)
+	}
+	if c.Monitoring.StartupJitterSeconds < 0 {
+		return fmt.Errorf("monitoring.startup_jitter_seconds must be non-negative (0 disables), got %d", c.Monitoring.StartupJitterSeconds)
+	}
+	if c.Monitoring.PnLSwingAlertUSD < 0 {
+		return fmt.Errorf("monitoring.pnl_swing_alert_usd must be non-negative (0 disables), got %f", c.Monitoring.PnLSwingAlertUSD)
+	}
+	if c.Monitoring.PnLSwingAlertPct < 0 {
+		return fmt.Errorf("monitoring.pnl_swing_alert_pct must be non-negative (0 disables), got %f", c.Monitoring.PnLSwingAlertPct)
+	}
+	if c.Monitoring.BalanceChangeAlertUSD < 0 {
+		return fmt.Errorf("monitoring.balance_change_alert_usd must be non-negative (0 disables), got %f", c.Monitoring.BalanceChangeAlertUSD)
+	}
+	if c.Monitoring.BalanceChangeAlertPct < 0 {
+		return fmt.Errorf("monitoring.balance_change_alert_pct must be non-negative (0 disables), got %f", c.Monitoring.BalanceChangeAlertPct)
+	}
+	if err := normalizeInstruments(c.Monitoring.Instruments); err != nil {
+		return fmt.Errorf("invalid monitoring.instruments: %w", err)
+	}
+
+	// Validate alert configuration
+	if c.Alert.RepeatInterval <= 0 {
+		c.Alert.RepeatInterval = 1800 // Default 30 minutes
+	}
+
+	// Validate shutdown configuration
+	if c.Shutdown.GracePeriod <= 0 {
+		c.Shutdown.GracePeriod = 30 // Default 30 seconds
+	}
+
+	// Validate watchdog configuration
+	if c.Watchdog.Action == "" {
+		c.Watchdog.Action = "alert" // Default to the non-destructive action
+	}
+	c.Watchdog.Action = strings.ToLower(c.Watchdog.Action)
+	if c.Watchdog.Action != "alert" && c.Watchdog.Action != "cancel" && c.Watchdog.Action != "close" {
+		return fmt.Errorf("invalid watchdog.action: %s (must be alert, cancel or close)", c.Watchdog.Action)
+	}
+	// The timeout only matters to a running watchdog, so a disabled one never rejects the interval
+	if c.Watchdog.Enabled {
+		if c.Watchdog.Timeout <= 0 {
+			c.Watchdog.Timeout = 900 // Default 15 minutes
+		}
+		if c.Watchdog.Timeout <= int(c.Monitoring.Interval) {
+			return fmt.Errorf("watchdog.timeout must be greater than monitoring.interval (%d), got %d", c.Monitoring.Interval, c.Watchdog.Timeout)
+		}
+		// The watchdog measures from process start until the first cycle, which the jitter delays
+		if c.Monitoring.StartupJitterSeconds+int(c.Monitoring.Interval) >= c.Watchdog.Timeout {
+			return fmt.Errorf("monitoring.startup_jitter_seconds plus monitoring.interval (%d) must be less than watchdog.timeout (%d), got %d",
+				c.Monitoring.Interval, c.Watchdog.Timeout, c.Monitoring.StartupJitterSeconds)
+		}
+	}
+
+	// Validate admin configuration
+	if c.Admin.ListenAddr == "" {
+		c.Admin.ListenAddr = "127.0.0.1:8081" // Default to loopback only
+	}
+	if c.Admin.Enabled && c.Admin.Token == "" {
+		return fmt.Errorf("admin.token is required when admin API is enabled")
+	}
 
 	// Validate database configuration
 	if c.Database.Path == "" {
@@ -145,6 +477,19 @@ func (c *Config) Validate() error {
 	if c.Database.MaxIdleConns <= 0 {
 		c.Database.MaxIdleConns = 1
 	}
+	if c.Database.MaintenanceIntervalHours == nil {
+		hours := 24 // Default daily
+		c.Database.MaintenanceIntervalHours = &hours
+	}
+	if *c.Database.MaintenanceIntervalHours < 0 {
+		return fmt.Errorf("database.maintenance_interval_hours must be non-negative, got %d", *c.Database.MaintenanceIntervalHours)
+	}
+	if c.Database.BusyTimeoutMs < 0 {
+		return fmt.Errorf("database.busy_timeout_ms must be non-negative, got %d", c.Database.BusyTimeoutMs)
+	}
+	if c.Database.BusyTimeoutMs == 0 {
+		c.Database.BusyTimeoutMs = 5000
+	}
 
 	// Validate logging configuration
 	if c.Logging.FilePath == "" {
@@ -169,6 +514,27 @@ func (c *Config) Validate() error {
 	if c.Logging.MaxBackups < 0 {
 		c.Logging.MaxBackups = 10
 	}
+	if c.Logging.AsyncQueueSize <= 0 {
+		c.Logging.AsyncQueueSize = 1024
+	}
+	if c.Logging.AsyncOverflow == "" {
+		c.Logging.AsyncOverflow = "block"
+	}
+	c.Logging.AsyncOverflow = strings.ToLower(c.Logging.AsyncOverflow)
+	if c.Logging.AsyncOverflow != "block" && c.Logging.AsyncOverflow != "drop" {
+		return fmt.Errorf("invalid logging.async_overflow: %s (must be block or drop)", c.Logging.AsyncOverflow)
+	}
+	if c.Logging.RotateAt != "" {
+		if _, err := time.Parse("15:04", c.Logging.RotateAt); err != nil {
+			return fmt.Errorf("invalid logging.rotate_at: %s (must be HH:MM)", c.Logging.RotateAt)
+		}
+	}
+	if c.Logging.RotateIntervalHours < 0 {
+		return fmt.Errorf("logging.rotate_interval_hours must be non-negative (0 disables), got %d", c.Logging.RotateIntervalHours)
+	}
+	if c.Logging.RotateAt != "" && c.Logging.RotateIntervalHours > 0 {
+		return fmt.Errorf("logging.rotate_at cannot be combined with logging.rotate_interval_hours: choose a daily time or an interval")
+	}
 
 	// Validate TPSL configuration
 	// Set defaults if not specified
@@ -181,6 +547,45 @@ func (c *Config) Validate() error {
 	if c.TPSL.ProfitLossRatio == 0 {
 		c.TPSL.ProfitLossRatio = 5.0 // Default 5:1
 	}
+	if c.TPSL.MaxSnapshotAge <= 0 {
+		c.TPSL.MaxSnapshotAge = 300 // Default 5 minutes
+	}
+	if c.TPSL.PositionSource == "" {
+		c.TPSL.PositionSource = "db" // Default to stored snapshots
+	}
+	if c.TPSL.SLMode == "" {
+		c.TPSL.SLMode = "percent" // Default to fixed percent of entry
+	}
+	if c.TPSL.UnpairedAction == "" {
+		c.TPSL.UnpairedAction = "leave" // Default to not touching the lone order
+	}
+	if c.TPSL.Mode == "" {
+		c.TPSL.Mode = "tp_sl" // Default to protecting both sides
+	}
+	if c.TPSL.ResidualAction == "" {
+		c.TPSL.ResidualAction = "ignore" // Default to leaving small residuals alone
+	}
+	if c.TPSL.NotionalCapAction == "" {
+		c.TPSL.NotionalCapAction = "alert" // Default to alerting while still protecting the position
+	}
+	if c.TPSL.MarginRiskAction == "" {
+		c.TPSL.MarginRiskAction = "alert" // Default to alerting while still protecting the position
+	}
+	if c.TPSL.SLTightenAfterHours > 0 && c.TPSL.SLTightenFactor == 0 {
+		c.TPSL.SLTightenFactor = 0.5 // Default to halving the stop distance
+	}
+	if c.TPSL.TPTriggerPxType == "" {
+		c.TPSL.TPTriggerPxType = "last" // Default to last traded price
+	}
+	if c.TPSL.SLTriggerPxType == "" {
+		c.TPSL.SLTriggerPxType = "last"
+	}
+	if c.TPSL.PriceBufferPct == 0 {
+		c.TPSL.PriceBufferPct = 0.001 // Default 0.1%
+	}
+	if c.TPSL.LiqBufferPct == 0 {
+		c.TPSL.LiqBufferPct = 0.005 // Default 0.5%
+	}
 
 	// Validate TPSL parameters
 	if c.TPSL.VolatilityPct <= 0 || c.TPSL.VolatilityPct > 1.0 {
@@ -189,10 +594,222 @@ func (c *Config) Validate() error {
 	if c.TPSL.ProfitLossRatio <= 0 {
 		return fmt.Errorf("tpsl.profit_loss_ratio must be positive, got %f", c.TPSL.ProfitLossRatio)
 	}
+	if c.TPSL.PriceBufferPct <= 0 || c.TPSL.PriceBufferPct > 0.05 {
+		return fmt.Errorf("tpsl.price_buffer_pct must be between 0 and 0.05, got %f", c.TPSL.PriceBufferPct)
+	}
+	if c.TPSL.LiqBufferPct <= 0 || c.TPSL.LiqBufferPct > 0.5 {
+		return fmt.Errorf("tpsl.liq_buffer_pct must be between 0 and 0.5, got %f", c.TPSL.LiqBufferPct)
+	}
+	if c.TPSL.MaxSpreadPct < 0 || c.TPSL.MaxSpreadPct >= 1.0 {
+		return fmt.Errorf("tpsl.max_spread_pct must be between 0 and 1 (0 disables), got %f", c.TPSL.MaxSpreadPct)
+	}
+	if c.TPSL.TPTrailDistancePct < 0 || c.TPSL.TPTrailDistancePct >= 1.0 {
+		return fmt.Errorf("tpsl.tp_trail_distance_pct must be between 0 and 1 (0 disables), got %f", c.TPSL.TPTrailDistancePct)
+	}
+	if c.TPSL.TPTrailActivationPct < 0 || c.TPSL.TPTrailActivationPct >= 1.0 {
+		return fmt.Errorf("tpsl.tp_trail_activation_pct must be in [0, 1), got %f", c.TPSL.TPTrailActivationPct)
+	}
+	if c.TPSL.NewPositionGraceSeconds < 0 {
+		return fmt.Errorf("tpsl.new_position_grace_seconds must be non-negative (0 disables), got %d", c.TPSL.NewPositionGraceSeconds)
+	}
+	if c.TPSL.SLTightenAfterHours < 0 {
+		return fmt.Errorf("tpsl.sl_tighten_after_hours must be non-negative (0 disables), got %d", c.TPSL.SLTightenAfterHours)
+	}
+	if c.TPSL.SLTightenAfterHours > 0 && (c.TPSL.SLTightenFactor <= 0 || c.TPSL.SLTightenFactor >= 1.0) {
+		return fmt.Errorf("tpsl.sl_tighten_factor must be between 0 and 1 (exclusive), got %f", c.TPSL.SLTightenFactor)
+	}
+	if c.TPSL.LimitOrderOffsetPct < 0 || c.TPSL.LimitOrderOffsetPct >= 0.1 {
+		return fmt.Errorf("tpsl.limit_order_offset_pct must be in [0, 0.1), got %f", c.TPSL.LimitOrderOffsetPct)
+	}
+	if c.TPSL.MinUncoveredFraction < 0 || c.TPSL.MinUncoveredFraction >= 1.0 {
+		return fmt.Errorf("tpsl.min_uncovered_fraction must be in [0, 1), got %f", c.TPSL.MinUncoveredFraction)
+	}
+	if c.TPSL.ReduceOnly == nil {
+		reduceOnly := true // Default reduce-only
+		c.TPSL.ReduceOnly = &reduceOnly
+	}
+	if c.TPSL.UseCloseFraction && !*c.TPSL.ReduceOnly {
+		return fmt.Errorf("tpsl.use_close_fraction requires tpsl.reduce_only")
+	}
+	if c.TPSL.PriceCacheTTL == nil {
+		ttl := 2.0 // Default 2 seconds
+		c.TPSL.PriceCacheTTL = &ttl
+	}
+	if *c.TPSL.PriceCacheTTL < 0 {
+		return fmt.Errorf("tpsl.price_cache_ttl must be non-negative (0 disables), got %f", *c.TPSL.PriceCacheTTL)
+	}
+	if c.TPSL.OrderMaxAgeHours < 0 {
+		return fmt.Errorf("tpsl.order_max_age_hours must be non-negative (0 disables), got %d", c.TPSL.OrderMaxAgeHours)
+	}
+	if c.TPSL.MaxOrdersPerInstrument < 0 {
+		return fmt.Errorf("tpsl.max_orders_per_instrument must be non-negative (0 disables), got %d", c.TPSL.MaxOrdersPerInstrument)
+	}
 	if c.TPSL.CheckInterval <= 0 {
 		return fmt.Errorf("tpsl.check_interval must be positive, got %d", c.TPSL.CheckInterval)
 	}
+	c.TPSL.SLMode = strings.ToLower(c.TPSL.SLMode)
+	if c.TPSL.SLMode != "percent" && c.TPSL.SLMode != "risk" {
+		return fmt.Errorf("invalid tpsl.sl_mode: %s (must be percent or risk)", c.TPSL.SLMode)
+	}
+	c.TPSL.UnpairedAction = strings.ToLower(c.TPSL.UnpairedAction)
+	if c.TPSL.UnpairedAction != "leave" && c.TPSL.UnpairedAction != "add_missing" && c.TPSL.UnpairedAction != "replace_both" {
+		return fmt.Errorf("invalid tpsl.unpaired_action: %s (must be leave, add_missing or replace_both)", c.TPSL.UnpairedAction)
+	}
+	c.TPSL.ResidualAction = strings.ToLower(c.TPSL.ResidualAction)
+	if c.TPSL.ResidualAction != "ignore" && c.TPSL.ResidualAction != "close" {
+		return fmt.Errorf("invalid tpsl.residual_action: %s (must be ignore or close)", c.TPSL.ResidualAction)
+	}
+	if c.TPSL.MaxNotionalUSD < 0 {
+		return fmt.Errorf("tpsl.max_notional_usd must be non-negative (0 disables), got %f", c.TPSL.MaxNotionalUSD)
+	}
+	for instId, limit := range c.TPSL.MaxNotionalUSDByInstrument {
+		if limit < 0 {
+			return fmt.Errorf("tpsl.max_notional_usd_by_instrument.%s must be non-negative (0 disables), got %f", instId, limit)
+		}
+	}
+	c.TPSL.Mode = strings.ToLower(c.TPSL.Mode)
+	if c.TPSL.Mode != "tp_sl" && c.TPSL.Mode != "sl_only" && c.TPSL.Mode != "tp_only" {
+		return fmt.Errorf("invalid tpsl.mode: %s (must be tp_sl, sl_only or tp_only)", c.TPSL.Mode)
+	}
+	c.TPSL.NotionalCapAction = strings.ToLower(c.TPSL.NotionalCapAction)
+	if c.TPSL.NotionalCapAction != "alert" && c.TPSL.NotionalCapAction != "refuse" {
+		return fmt.Errorf("invalid tpsl.notional_cap_action: %s (must be alert or refuse)", c.TPSL.NotionalCapAction)
+	}
+	if c.TPSL.MaxMarginRisk < 0 {
+		return fmt.Errorf("tpsl.max_margin_risk must be non-negative (0 disables), got %f", c.TPSL.MaxMarginRisk)
+	}
+	c.TPSL.MarginRiskAction = strings.ToLower(c.TPSL.MarginRiskAction)
+	if c.TPSL.MarginRiskAction != "alert" && c.TPSL.MarginRiskAction != "refuse" {
+		return fmt.Errorf("invalid tpsl.margin_risk_action: %s (must be alert or refuse)", c.TPSL.MarginRiskAction)
+	}
+	c.TPSL.TPTriggerPxType = strings.ToLower(c.TPSL.TPTriggerPxType)
+	if !isTriggerPxType(c.TPSL.TPTriggerPxType) {
+		return fmt.Errorf("invalid tpsl.tp_trigger_px_type: %s (must be last, index or mark)", c.TPSL.TPTriggerPxType)
+	}
+	c.TPSL.SLTriggerPxType = strings.ToLower(c.TPSL.SLTriggerPxType)
+	if !isTriggerPxType(c.TPSL.SLTriggerPxType) {
+		return fmt.Errorf("invalid tpsl.sl_trigger_px_type: %s (must be last, index or mark)", c.TPSL.SLTriggerPxType)
+	}
+	if c.TPSL.SLMode == "risk" && c.TPSL.RiskPerTradeUSD <= 0 {
+		return fmt.Errorf("tpsl.risk_per_trade_usd must be positive when sl_mode is risk, got %f", c.TPSL.RiskPerTradeUSD)
+	}
+	if err := normalizeInstruments(c.TPSL.IncludeInstruments); err != nil {
+		return fmt.Errorf("invalid tpsl.include_instruments: %w", err)
+	}
+	if err := normalizeInstruments(c.TPSL.ExcludeInstruments); err != nil {
+		return fmt.Errorf("invalid tpsl.exclude_instruments: %w", err)
+	}
+	if !orderTagPattern.MatchString(c.TPSL.OrderTag) {
+		return fmt.Errorf("invalid tpsl.order_tag: %s (must be up to 16 letters or digits)", c.TPSL.OrderTag)
+	}
+	c.TPSL.PositionSource = strings.ToLower(c.TPSL.PositionSource)
+	if c.TPSL.PositionSource != "db" && c.TPSL.PositionSource != "live" {
+		return fmt.Errorf("invalid tpsl.position_source: %s (must be db or live)", c.TPSL.PositionSource)
+	}
+	if err := c.TPSL.validateModes(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// tpslModeConflict 互斥的TPSL选项组合 / A pair of mutually exclusive TPSL options
+type tpslModeConflict struct {
+	first, second string // option names as written in the config file
+	reason        string
+	conflicts     func(c *TPSLConfig) bool
+}
+
+// tpslModeConflicts 所有互斥的TPSL选项组合 / Every mutually exclusive pair of TPSL options
+var tpslModeConflicts = []tpslModeConflict{
+	{
+		first: "use_limit_orders", second: "tp_trail_distance_pct",
+		reason: "trailing amends only the triggers, leaving the limit prices behind",
+		conflicts: func(c *TPSLConfig) bool {
+			return c.UseLimitOrders && c.TPTrailDistancePct > 0
+		},
+	},
+	{
+		first: "use_limit_orders", second: "sl_tighten_after_hours",
+		reason: "tightening amends only the stop trigger, leaving its limit price behind",
+		conflicts: func(c *TPSLConfig) bool {
+			return c.UseLimitOrders && c.SLTightenAfterHours > 0
+		},
+	},
+	{
+		first: "use_limit_orders", second: "use_close_fraction",
+		reason: "OKX executes closeFraction orders at market only and rejects a limit order price",
+		conflicts: func(c *TPSLConfig) bool {
+			return c.UseLimitOrders && c.UseCloseFraction
+		},
+	},
+	{
+		first: "mode", second: "tp_trail_distance_pct",
+		reason: "trailing moves both legs, so it needs mode tp_sl",
+		conflicts: func(c *TPSLConfig) bool {
+			return c.Mode != "" && c.Mode != "tp_sl" && c.TPTrailDistancePct > 0
+		},
+	},
+	{
+		first: "mode", second: "sl_tighten_after_hours",
+		reason: "mode tp_only places no stop-loss to tighten",
+		conflicts: func(c *TPSLConfig) bool {
+			return c.Mode == "tp_only" && c.SLTightenAfterHours > 0
+		},
+	},
+	{
+		first: "order_max_age_hours", second: "tp_trail_distance_pct",
+		reason: "replacing an expired order resets the trailed stop to its untrailed price, giving up locked-in profit",
+		conflicts: func(c *TPSLConfig) bool {
+			return c.OrderMaxAgeHours > 0 && c.TPTrailDistancePct > 0
+		},
+	},
+}
+
+// validateModes 拒绝互斥的TPSL选项组合 / Reject mutually exclusive TPSL options
+// 这些组合单独有效，但一起使用时其中一个会悄悄破坏另一个的效果
+// Each option is valid on its own, but together one silently undoes the other
+//
+// Returns:
+//   - error: 第一个冲突的组合 / The first conflicting pair
+func (c *TPSLConfig) validateModes() error {
+	for _, conflict := range tpslModeConflicts {
+		if conflict.conflicts(c) {
+			return fmt.Errorf("tpsl.%s cannot be combined with tpsl.%s: %s", conflict.first, conflict.second, conflict.reason)
+		}
+	}
+	return nil
+}
 
+// instrumentPattern OKX交易对ID格式 / OKX instrument ID format
+// 例如 / e.g., BTC-USDT, BTC-USDT-SWAP, BTC-USD-250328, BTC-USD-250328-100000-C
+var instrumentPattern = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)+$`)
+
+// orderTagPattern OKX订单标签格式，允许为空 / OKX order tag format, empty allowed
+var orderTagPattern = regexp.MustCompile(`^[A-Za-z0-9]{0,16}$`)
+
+// isTriggerPxType 判断是否为OKX支持的触发价格类型 / Check for a trigger price type OKX accepts
+func isTriggerPxType(s string) bool {
+	return s == "last" || s == "index" || s == "mark"
+}
+
+// normalizeInstruments 规范化并验证交易对列表 / Normalize and validate instrument list
+// 去除空白并转为大写，原地修改列表
+// Trim whitespace and upper-case each entry in place
+//
+// Parameters:
+//   - instruments: 交易对ID列表 / List of instrument IDs
+//
+// Returns:
+//   - error: 存在格式错误的交易对ID时返回错误 / Error on a malformed instrument ID
+func normalizeInstruments(instruments []string) error {
+	for i, instId := range instruments {
+		instId = strings.ToUpper(strings.TrimSpace(instId))
+		if !instrumentPattern.MatchString(instId) {
+			return fmt.Errorf("malformed instrument ID %q (expected e.g. BTC-USDT-SWAP)", instruments[i])
+		}
+		instruments[i] = instId
+	}
 	return nil
 }
 
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoad(t *testing.T) {
@@ -113,6 +116,90 @@ logging:
 	}
 }
 
+func TestLoadSecretFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	keyFile := writeFile("api_key", "file-api-key\n")
+	secretFile := writeFile("api_secret", "  file-secret  \n")
+	passFile := writeFile("passphrase", "file-passphrase")
+	emptyFile := writeFile("empty", " \n")
+
+	tests := []struct {
+		name           string
+		files          string
+		expectError    bool
+		errorMsg       string
+		expectKey      string
+		expectSecret   string
+		expectPassword string
+	}{
+		{
+			name:           "files override inline values",
+			files:          "  api_key_file: \"" + keyFile + "\"\n  api_secret_file: \"" + secretFile + "\"\n  passphrase_file: \"" + passFile + "\"\n",
+			expectKey:      "file-api-key",
+			expectSecret:   "file-secret",
+			expectPassword: "file-passphrase",
+		},
+		{
+			name:           "only some credentials from files",
+			files:          "  api_secret_file: \"" + secretFile + "\"\n",
+			expectKey:      "inline-api-key",
+			expectSecret:   "file-secret",
+			expectPassword: "inline-passphrase",
+		},
+		{
+			name:        "missing file",
+			files:       "  api_key_file: \"" + filepath.Join(tmpDir, "missing") + "\"\n",
+			expectError: true,
+			errorMsg:    "failed to read okx.api_key_file",
+		},
+		{
+			name:        "empty file",
+			files:       "  passphrase_file: \"" + emptyFile + "\"\n",
+			expectError: true,
+			errorMsg:    "okx.passphrase_file " + emptyFile + " is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := writeFile("config_"+tt.name+".yaml", `
+okx:
+  api_url: "https://www.okx.com"
+  api_key: "inline-api-key"
+  api_secret: "inline-secret"
+  passphrase: "inline-passphrase"
+`+tt.files)
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				if !contains(err.Error(), tt.errorMsg) {
+					t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.OKX.APIKey != tt.expectKey || cfg.OKX.APISecret != tt.expectSecret || cfg.OKX.Passphrase != tt.expectPassword {
+				t.Errorf("expected credentials %q/%q/%q, got %q/%q/%q", tt.expectKey, tt.expectSecret, tt.expectPassword,
+					cfg.OKX.APIKey, cfg.OKX.APISecret, cfg.OKX.Passphrase)
+			}
+		})
+	}
+}
+
 func TestConfigValidate(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -214,7 +301,7 @@ func TestConfigValidate(t *testing.T) {
 			errorMsg:    "profit_loss_ratio must be positive",
 		},
 		{
-			name: "TPSL defaults applied",
+			name: "invalid price_buffer_pct too high",
 			config: Config{
 				OKX: OKXConfig{
 					APIURL:     "https://www.okx.com",
@@ -222,32 +309,914 @@ func TestConfigValidate(t *testing.T) {
 					APISecret:  "valid-secret",
 					Passphrase: "valid-passphrase",
 				},
-				// TPSL not set - should use defaults
+				TPSL: TPSLConfig{
+					PriceBufferPct: 0.5,
+				},
 			},
-			expectError: false,
+			expectError: true,
+			errorMsg:    "price_buffer_pct must be between 0 and 0.05",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.config.Validate()
-
-			if tt.expectError {
-				if err == nil {
-					t.Errorf("expected error but got none")
-				} else if tt.errorMsg != "" && !contains(err.Error(), tt.errorMsg) {
-					t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
-				}
-			} else {
-				if err != nil {
-					t.Errorf("unexpected error: %v", err)
-				}
-				// Check defaults were applied
-				if tt.config.OKX.Timeout == 0 && tt.config.OKX.Timeout != 30 {
-					t.Error("default timeout not applied")
-				}
-			}
-		})
+		{
+			name: "malformed monitoring instruments",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					Instruments: []string{"btc-usdt-swap", "BTC_USDT"},
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid monitoring.instruments",
+		},
+		{
+			name: "negative pnl swing alert",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					PnLSwingAlertUSD: -100,
+				},
+			},
+			expectError: true,
+			errorMsg:    "monitoring.pnl_swing_alert_usd must be non-negative",
+		},
+		{
+			name: "negative max consecutive failures",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					MaxConsecutiveFailures: -1,
+				},
+			},
+			expectError: true,
+			errorMsg:    "monitoring.max_consecutive_failures must be non-negative",
+		},
+		{
+			name: "malformed exclude_instruments",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					ExcludeInstruments: []string{"BTC-USDT-SWAP", "BTC USDT"},
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.exclude_instruments",
+		},
+		{
+			name: "risk sl_mode without risk amount",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					SLMode: "risk",
+				},
+			},
+			expectError: true,
+			errorMsg:    "risk_per_trade_usd must be positive",
+		},
+		{
+			name: "invalid position_source",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					PositionSource: "cache",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.position_source",
+		},
+		{
+			name: "invalid min_uncovered_fraction",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					MinUncoveredFraction: 1.0,
+				},
+			},
+			expectError: true,
+			errorMsg:    "min_uncovered_fraction must be in [0, 1)",
+		},
+		{
+			name: "negative per-instrument max_notional_usd",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					MaxNotionalUSDByInstrument: map[string]float64{"BTC-USDT-SWAP": -1},
+				},
+			},
+			expectError: true,
+			errorMsg:    "max_notional_usd_by_instrument.BTC-USDT-SWAP must be non-negative",
+		},
+		{
+			name: "invalid notional_cap_action",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					NotionalCapAction: "close",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.notional_cap_action",
+		},
+		{
+			name: "negative max_margin_risk",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					MaxMarginRisk: -0.5,
+				},
+			},
+			expectError: true,
+			errorMsg:    "tpsl.max_margin_risk must be non-negative",
+		},
+		{
+			name: "invalid margin_risk_action",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					MaxMarginRisk:    0.5,
+					MarginRiskAction: "close",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.margin_risk_action",
+		},
+		{
+			name: "invalid residual_action",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					MinUncoveredFraction: 0.02,
+					ResidualAction:       "protect",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.residual_action",
+		},
+		{
+			name: "negative tp_trail_distance_pct",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					TPTrailDistancePct: -0.01,
+				},
+			},
+			expectError: true,
+			errorMsg:    "tp_trail_distance_pct must be between 0 and 1",
+		},
+		{
+			name: "sl tighten factor out of range",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					SLTightenAfterHours: 48,
+					SLTightenFactor:     1.5,
+				},
+			},
+			expectError: true,
+			errorMsg:    "sl_tighten_factor must be between 0 and 1",
+		},
+		{
+			name: "invalid tpsl mode",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					Mode: "tp_only_please",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.mode",
+		},
+		{
+			name: "limit order offset too large",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					UseLimitOrders:      true,
+					LimitOrderOffsetPct: 0.2,
+				},
+			},
+			expectError: true,
+			errorMsg:    "limit_order_offset_pct must be in [0, 0.1)",
+		},
+		{
+			name: "limit orders with trailing",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					UseLimitOrders:     true,
+					TPTrailDistancePct: 0.01,
+				},
+			},
+			expectError: true,
+			errorMsg:    "use_limit_orders cannot be combined",
+		},
+		{
+			name: "liquidation buffer out of range",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					LiqBufferPct: 0.8,
+				},
+			},
+			expectError: true,
+			errorMsg:    "liq_buffer_pct must be between 0 and 0.5",
+		},
+		{
+			name: "invalid unpaired action",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					UnpairedAction: "close",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.unpaired_action",
+		},
+		{
+			name: "negative price cache ttl",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					PriceCacheTTL: floatPtr(-1),
+				},
+			},
+			expectError: true,
+			errorMsg:    "tpsl.price_cache_ttl must be non-negative",
+		},
+		{
+			name: "negative max orders per instrument",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					MaxOrdersPerInstrument: -1,
+				},
+			},
+			expectError: true,
+			errorMsg:    "tpsl.max_orders_per_instrument must be non-negative",
+		},
+		{
+			name: "invalid async overflow",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Logging: LoggingConfig{
+					Async:         true,
+					AsyncOverflow: "spill",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid logging.async_overflow",
+		},
+		{
+			name: "long interval with the watchdog disabled",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					Interval: 1200,
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "watchdog timeout not above the interval",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					Interval: 1200,
+				},
+				Watchdog: WatchdogConfig{
+					Enabled: true,
+				},
+			},
+			expectError: true,
+			errorMsg:    "watchdog.timeout must be greater than monitoring.interval (1200), got 900",
+		},
+		{
+			name: "startup jitter reaching the watchdog timeout",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					Interval:             60,
+					StartupJitterSeconds: 840,
+				},
+				Watchdog: WatchdogConfig{
+					Enabled: true,
+					Timeout: 900,
+				},
+			},
+			expectError: true,
+			errorMsg:    "monitoring.startup_jitter_seconds plus monitoring.interval (60) must be less than watchdog.timeout (900)",
+		},
+		{
+			name: "negative idle connection timeout",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:          "https://www.okx.com",
+					APIKey:          "valid-key",
+					APISecret:       "valid-secret",
+					Passphrase:      "valid-passphrase",
+					IdleConnTimeout: -1,
+				},
+			},
+			expectError: true,
+			errorMsg:    "okx.idle_conn_timeout must be non-negative",
+		},
+		{
+			name: "fallback url without scheme",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:       "https://www.okx.com",
+					APIKey:       "valid-key",
+					APISecret:    "valid-secret",
+					Passphrase:   "valid-passphrase",
+					FallbackURLs: []string{"aws.okx.com"},
+				},
+			},
+			expectError: true,
+			errorMsg:    "okx.fallback_urls entries must be base URLs",
+		},
+		{
+			name: "negative startup jitter",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					StartupJitterSeconds: -5,
+				},
+			},
+			expectError: true,
+			errorMsg:    "monitoring.startup_jitter_seconds must be non-negative",
+		},
+		{
+			name: "negative busy timeout",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Database: DatabaseConfig{
+					BusyTimeoutMs: -1,
+				},
+			},
+			expectError: true,
+			errorMsg:    "database.busy_timeout_ms must be non-negative",
+		},
+		{
+			name: "negative new position grace",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					NewPositionGraceSeconds: -1,
+				},
+			},
+			expectError: true,
+			errorMsg:    "tpsl.new_position_grace_seconds must be non-negative",
+		},
+		{
+			name: "invalid log rotation time",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Logging: LoggingConfig{
+					RotateAt: "25:00",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid logging.rotate_at",
+		},
+		{
+			name: "log rotation time and interval both set",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Logging: LoggingConfig{
+					RotateAt:            "00:00",
+					RotateIntervalHours: 6,
+				},
+			},
+			expectError: true,
+			errorMsg:    "logging.rotate_at cannot be combined with logging.rotate_interval_hours",
+		},
+		{
+			name: "invalid order tag",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					OrderTag: "broker-tag",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.order_tag",
+		},
+		{
+			name: "negative balance change alert",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Monitoring: MonitoringConfig{
+					BalanceChangeAlertUSD: -1,
+				},
+			},
+			expectError: true,
+			errorMsg:    "monitoring.balance_change_alert_usd must be non-negative",
+		},
+		{
+			name: "invalid sl trigger price type",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					TPTriggerPxType: "Mark",
+					SLTriggerPxType: "bid",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid tpsl.sl_trigger_px_type: bid",
+		},
+		{
+			name: "close fraction without reduce-only",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				TPSL: TPSLConfig{
+					UseCloseFraction: true,
+					ReduceOnly:       boolPtr(false),
+				},
+			},
+			expectError: true,
+			errorMsg:    "tpsl.use_close_fraction requires tpsl.reduce_only",
+		},
+		{
+			name: "request timeout not positive",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:          "https://www.okx.com",
+					APIKey:          "valid-key",
+					APISecret:       "valid-secret",
+					Passphrase:      "valid-passphrase",
+					RequestTimeouts: map[string]int{"/api/v5/trade/order-algo": 0},
+				},
+			},
+			expectError: true,
+			errorMsg:    "okx.request_timeouts[/api/v5/trade/order-algo] must be positive",
+		},
+		{
+			name: "request timeout key not a path",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:          "https://www.okx.com",
+					APIKey:          "valid-key",
+					APISecret:       "valid-secret",
+					Passphrase:      "valid-passphrase",
+					RequestTimeouts: map[string]int{"order-algo": 5},
+				},
+			},
+			expectError: true,
+			errorMsg:    "okx.request_timeouts key must be an endpoint path",
+		},
+		{
+			name: "jitter fraction out of range",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:         "https://www.okx.com",
+					APIKey:         "valid-key",
+					APISecret:      "valid-secret",
+					Passphrase:     "valid-passphrase",
+					JitterFraction: floatPtr(1.5),
+				},
+			},
+			expectError: true,
+			errorMsg:    "okx.jitter_fraction must be between 0 and 1",
+		},
+		{
+			name: "base backoff above max backoff",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:      "https://www.okx.com",
+					APIKey:      "valid-key",
+					APISecret:   "valid-secret",
+					Passphrase:  "valid-passphrase",
+					BaseBackoff: 60,
+					MaxBackoff:  30,
+				},
+			},
+			expectError: true,
+			errorMsg:    "okx.base_backoff must not exceed okx.max_backoff",
+		},
+		{
+			name: "invalid watchdog action",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Watchdog: WatchdogConfig{
+					Action: "flatten",
+				},
+			},
+			expectError: true,
+			errorMsg:    "invalid watchdog.action",
+		},
+		{
+			name: "admin enabled without token",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Admin: AdminConfig{
+					Enabled: true,
+				},
+			},
+			expectError: true,
+			errorMsg:    "admin.token is required",
+		},
+		{
+			name: "negative maintenance interval",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Database: DatabaseConfig{
+					MaintenanceIntervalHours: intPtr(-1),
+				},
+			},
+			expectError: true,
+			errorMsg:    "database.maintenance_interval_hours must be non-negative",
+		},
+		{
+			name: "TPSL defaults applied",
+			config: Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				// TPSL not set - should use defaults
+			},
+			expectError: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				} else if tt.errorMsg != "" && !contains(err.Error(), tt.errorMsg) {
+					t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				// Check defaults were applied
+				if tt.config.OKX.Timeout == 0 && tt.config.OKX.Timeout != 30 {
+					t.Error("default timeout not applied")
+				}
+			}
+		})
+	}
+}
+
+func TestMaintenanceIntervalDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		hours    *int
+		expected int
+	}{
+		{"unset uses daily default", nil, 24},
+		{"explicit zero disables", intPtr(0), 0},
+		{"explicit value kept", intPtr(6), 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				OKX: OKXConfig{
+					APIURL:     "https://www.okx.com",
+					APIKey:     "valid-key",
+					APISecret:  "valid-secret",
+					Passphrase: "valid-passphrase",
+				},
+				Database: DatabaseConfig{MaintenanceIntervalHours: tt.hours},
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := *cfg.Database.MaintenanceIntervalHours; got != tt.expected {
+				t.Errorf("expected maintenance interval %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+// intPtr returns a pointer to v
+func intPtr(v int) *int {
+	return &v
+}
+
+// boolPtr returns a pointer to v
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+// floatPtr returns a pointer to v
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestNormalizeInstruments(t *testing.T) {
+	instruments := []string{" btc-usdt-swap ", "ETH-USD-250328", "BTC-USD-250328-100000-C"}
+	if err := normalizeInstruments(instruments); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if instruments[0] != "BTC-USDT-SWAP" {
+		t.Errorf("expected normalized BTC-USDT-SWAP, got %q", instruments[0])
+	}
+
+	for _, bad := range []string{"", "BTC", "BTC--USDT", "BTC_USDT"} {
+		if err := normalizeInstruments([]string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestIntervalDurations(t *testing.T) {
+	tests := []struct {
+		name          string
+		yaml          string
+		expectMonitor time.Duration
+		expectCheck   time.Duration
+		errorMsg      string
+	}{
+		{
+			name:          "integer seconds",
+			yaml:          "monitoring:\n  interval: 60\ntpsl:\n  check_interval: 300\n",
+			expectMonitor: time.Minute,
+			expectCheck:   5 * time.Minute,
+		},
+		{
+			name:          "duration strings",
+			yaml:          "monitoring:\n  interval: \"1m\"\ntpsl:\n  check_interval: 1h30m\n",
+			expectMonitor: time.Minute,
+			expectCheck:   90 * time.Minute,
+		},
+		{
+			name:     "invalid duration",
+			yaml:     "monitoring:\n  interval: soon\n",
+			errorMsg: "invalid duration",
+		},
+		{
+			name:     "non-positive duration",
+			yaml:     "tpsl:\n  check_interval: -5m\n",
+			errorMsg: "must be positive",
+		},
+		{
+			name:     "fractional seconds",
+			yaml:     "monitoring:\n  interval: 1500ms\n",
+			errorMsg: "whole number of seconds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			err := yaml.Unmarshal([]byte(tt.yaml), &cfg)
+			if tt.errorMsg != "" {
+				if err == nil || !contains(err.Error(), tt.errorMsg) {
+					t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := cfg.Monitoring.Interval.Duration(); got != tt.expectMonitor {
+				t.Errorf("expected monitoring interval %v, got %v", tt.expectMonitor, got)
+			}
+			if got := cfg.TPSL.CheckInterval.Duration(); got != tt.expectCheck {
+				t.Errorf("expected check interval %v, got %v", tt.expectCheck, got)
+			}
+		})
+	}
+}
+
+func TestTPSLValidateModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   TPSLConfig
+		errorMsg string // empty when the combination is valid
+	}{
+		{"defaults", TPSLConfig{}, ""},
+		{"limit orders alone", TPSLConfig{UseLimitOrders: true, LimitOrderOffsetPct: 0.005}, ""},
+		{"trailing with stop tightening", TPSLConfig{TPTrailDistancePct: 0.01, SLTightenAfterHours: 48}, ""},
+		{"order max age with stop tightening", TPSLConfig{OrderMaxAgeHours: 24, SLTightenAfterHours: 48}, ""},
+		{"limit orders with trailing", TPSLConfig{UseLimitOrders: true, TPTrailDistancePct: 0.01},
+			"tpsl.use_limit_orders cannot be combined with tpsl.tp_trail_distance_pct"},
+		{"limit orders with stop tightening", TPSLConfig{UseLimitOrders: true, SLTightenAfterHours: 48},
+			"tpsl.use_limit_orders cannot be combined with tpsl.sl_tighten_after_hours"},
+		{"limit orders with close fraction", TPSLConfig{UseLimitOrders: true, UseCloseFraction: true},
+			"tpsl.use_limit_orders cannot be combined with tpsl.use_close_fraction"},
+		{"order max age with trailing", TPSLConfig{OrderMaxAgeHours: 24, TPTrailDistancePct: 0.01},
+			"tpsl.order_max_age_hours cannot be combined with tpsl.tp_trail_distance_pct"},
+		{"sl_only with stop tightening", TPSLConfig{Mode: "sl_only", SLTightenAfterHours: 48}, ""},
+		{"single-leg mode with trailing", TPSLConfig{Mode: "sl_only", TPTrailDistancePct: 0.01},
+			"tpsl.mode cannot be combined with tpsl.tp_trail_distance_pct"},
+		{"tp_only with stop tightening", TPSLConfig{Mode: "tp_only", SLTightenAfterHours: 48},
+			"tpsl.mode cannot be combined with tpsl.sl_tighten_after_hours"},
+	}
+
+	covered := 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateModes()
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errorMsg, err)
+			}
+		})
+		if tt.errorMsg != "" {
+			covered++
+		}
+	}
+
+	// Every enumerated conflict needs a case above
+	if covered != len(tpslModeConflicts) {
+		t.Errorf("expected a test case for each of the %d conflicts, got %d", len(tpslModeConflicts), covered)
 	}
 }
 
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Seconds 以秒为单位的间隔 / Interval in whole seconds
+// YAML中可写为整数秒（60）或时长字符串（"1m"、"1h30m"），整数写法保持向后兼容
+// Written in YAML as an integer number of seconds (60) or a duration string ("1m", "1h30m");
+// the integer form keeps existing configs working
+type Seconds int
+
+// UnmarshalYAML 解析整数秒或时长字符串 / Parse an integer of seconds or a duration string
+// 时长字符串必须为正数且为整秒；整数按原样保留，由Validate处理默认值
+// Duration strings must be positive whole seconds; integers are kept as is for Validate to default
+//
+// Parameters:
+//   - value: YAML节点 / YAML node
+//
+// Returns:
+//   - error: 既不是整数也不是有效时长时返回错误 / Error when the value is neither an integer nor a valid duration
+func (s *Seconds) UnmarshalYAML(value *yaml.Node) error {
+	var n int
+	if err := value.Decode(&n); err == nil {
+		*s = Seconds(n)
+		return nil
+	}
+
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return fmt.Errorf("line %d: interval must be seconds or a duration string, got %q", value.Line, value.Value)
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q: %w", value.Line, raw, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("line %d: duration %q must be positive", value.Line, raw)
+	}
+	if d%time.Second != 0 {
+		return fmt.Errorf("line %d: duration %q must be a whole number of seconds", value.Line, raw)
+	}
+
+	*s = Seconds(d / time.Second)
+	return nil
+}
+
+// Duration 转换为time.Duration / Convert to a time.Duration
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(s) * time.Second
+}
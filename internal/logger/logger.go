@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -58,6 +60,20 @@ type Logger struct {
 	level      Level
 	fileWriter io.Writer
 	consoleOut bool
+
+	// console 控制台输出目标，默认stdout / Console destination, stdout by default
+	console io.Writer
+
+	// maskPatterns 敏感数据匹配模式 / Sensitive data match patterns
+	maskPatterns []string
+
+	// Async mode; queue is nil in synchronous mode
+	mu         sync.RWMutex
+	queue      chan string
+	dropOnFull bool
+	closed     bool
+	done       chan struct{}
+	dropped    atomic.Uint64
 }
 
 // New 创建新的日志记录器 / Create new logger instance
@@ -94,9 +110,11 @@ func New(filePath string, level Level, maxSize, maxAge, maxBackups int, compress
 	}
 
 	return &Logger{
-		level:      level,
-		fileWriter: fileWriter,
-		consoleOut: console,
+		level:        level,
+		fileWriter:   fileWriter,
+		consoleOut:   console,
+		console:      os.Stdout,
+		maskPatterns: defaultMaskPatterns,
 	}, nil
 }
 
@@ -110,10 +128,31 @@ func (l *Logger) log(level Level, format string, args ...interface{}) {
 	message := fmt.Sprintf(format, args...)
 
 	// Mask sensitive data
-	message = maskSensitiveData(message)
+	message = maskWithPatterns(message, l.maskPatterns)
 
 	logEntry := fmt.Sprintf("[%s] [%s] %s\n", timestamp, level.String(), message)
 
+	l.mu.RLock()
+	if l.queue != nil && !l.closed {
+		if l.dropOnFull {
+			select {
+			case l.queue <- logEntry:
+			default:
+				l.dropped.Add(1)
+			}
+		} else {
+			l.queue <- logEntry
+		}
+		l.mu.RUnlock()
+		return
+	}
+	l.mu.RUnlock()
+
+	l.write(logEntry)
+}
+
+// write 输出一条日志到文件和控制台 / Write one entry to the file and console
+func (l *Logger) write(logEntry string) {
 	// Write to file
 	if l.fileWriter != nil {
 		l.fileWriter.Write([]byte(logEntry))
@@ -121,8 +160,71 @@ func (l *Logger) log(level Level, format string, args ...interface{}) {
 
 	// Write to console if enabled
 	if l.consoleOut {
-		fmt.Print(logEntry)
+		fmt.Fprint(l.console, logEntry)
+	}
+}
+
+// SetConsoleWriter 设置控制台输出目标 / Set the console destination
+// 用于stdout保留给程序输出时（如单次运行模式打印的JSON摘要），将控制台日志改写到stderr。
+// 必须在记录任何日志之前调用
+// Used to move console logging to stderr when stdout is reserved for program output (e.g.
+// the JSON summary printed in single-run mode). Must be called before anything is logged
+//
+// Parameters:
+//   - w: 控制台日志的输出目标 / Destination for console log entries
+func (l *Logger) SetConsoleWriter(w io.Writer) {
+	l.console = w
+}
+
+// SetMaskKeys 添加额外的敏感关键词 / Add extra sensitive keywords
+// 与默认关键词合并后重新编译匹配集合，关键词不区分大小写。必须在记录任何日志之前调用
+// Merged with the default keywords and the match set recompiled; keywords are matched
+// case-insensitively. Must be called before anything is logged
+//
+// Parameters:
+//   - keys: 额外的敏感关键词（如 "x-signature"）/ Extra sensitive keywords (e.g. "x-signature")
+func (l *Logger) SetMaskKeys(keys []string) {
+	merged := make([]string, 0, len(defaultSensitiveKeys)+len(keys))
+	merged = append(merged, defaultSensitiveKeys...)
+	merged = append(merged, keys...)
+	l.maskPatterns = compileMaskPatterns(merged)
+}
+
+// SetAsync 启用异步写入模式 / Enable asynchronous write mode
+// 日志条目进入有界队列，由专用协程写入文件和控制台，调用方不再阻塞于磁盘I/O。
+// 必须在记录任何日志之前调用，重复调用无效
+// Entries go into a bounded queue drained by a dedicated goroutine, so callers no longer
+// block on disk I/O. Must be called before anything is logged; later calls are ignored
+//
+// Parameters:
+//   - queueSize: 队列容量（条目数）/ Queue capacity in entries
+//   - dropOnFull: 队列满时丢弃新条目而非阻塞 / Drop new entries instead of blocking when the queue is full
+func (l *Logger) SetAsync(queueSize int, dropOnFull bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.queue != nil || l.closed {
+		return
+	}
+	if queueSize <= 0 {
+		queueSize = 1
 	}
+	l.queue = make(chan string, queueSize)
+	l.dropOnFull = dropOnFull
+	l.done = make(chan struct{})
+	go l.drain()
+}
+
+// drain 异步写入协程 / Async writer goroutine
+func (l *Logger) drain() {
+	defer close(l.done)
+	for logEntry := range l.queue {
+		l.write(logEntry)
+	}
+}
+
+// Dropped 返回异步模式下因队列满而丢弃的条目数 / Entries dropped because the async queue was full
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
 }
 
 // Debug 调试日志 / Debug log
@@ -146,7 +248,24 @@ func (l *Logger) Error(format string, args ...interface{}) {
 }
 
 // Close 关闭日志记录器 / Close logger and flush buffers
+// 异步模式下先写完队列中剩余的条目；之后的日志同步写入
+// In async mode the remaining queued entries are written first; later entries are written synchronously
 func (l *Logger) Close() error {
+	l.mu.Lock()
+	queue, done := l.queue, l.done
+	alreadyClosed := l.closed
+	l.closed = true
+	l.mu.Unlock()
+
+	if queue != nil && !alreadyClosed {
+		close(queue)
+		<-done
+		if dropped := l.dropped.Load(); dropped > 0 {
+			l.write(fmt.Sprintf("[%s] [%s] %d log entries dropped because the async queue was full\n",
+				time.Now().UTC().Format("2006-01-02 15:04:05.000"), WARN.String(), dropped))
+		}
+	}
+
 	if closer, ok := l.fileWriter.(io.Closer); ok {
 		return closer.Close()
 	}
@@ -176,42 +295,65 @@ func (l *Logger) Close() error {
 //     例如: "api_key=abcd1234567890" → "api_key=abcd****"
 //     Example: "api_key=abcd1234567890" → "api_key=abcd****"
 func maskSensitiveData(message string) string {
-	// List of sensitive keywords to mask
-	sensitiveKeys := []string{
-		"api_key", "apikey", "api-key",
-		"api_secret", "apisecret", "api-secret", "secret",
-		"passphrase", "password", "pwd",
-		"token", "auth",
-		"OK-ACCESS-KEY", "OK-ACCESS-SECRET", "OK-ACCESS-SIGN", "OK-ACCESS-PASSPHRASE",
-	}
+	return maskWithPatterns(message, defaultMaskPatterns)
+}
 
-	result := message
-	for _, key := range sensitiveKeys {
+// defaultSensitiveKeys 默认敏感关键词列表 / Default list of sensitive keywords to mask
+var defaultSensitiveKeys = []string{
+	"api_key", "apikey", "api-key",
+	"api_secret", "apisecret", "api-secret", "secret",
+	"passphrase", "password", "pwd",
+	"token", "auth",
+	"OK-ACCESS-KEY", "OK-ACCESS-SECRET", "OK-ACCESS-SIGN", "OK-ACCESS-PASSPHRASE",
+}
+
+// defaultMaskPatterns 默认关键词对应的匹配模式 / Match patterns for the default keywords
+var defaultMaskPatterns = compileMaskPatterns(defaultSensitiveKeys)
+
+// compileMaskPatterns 将关键词编译为小写匹配模式 / Compile keywords into lowercase match patterns
+// 每个关键词生成"key="、"key:"和"key: "三种模式，重复和空白关键词被忽略
+// Each keyword yields "key=", "key:" and "key: "; duplicate and blank keywords are ignored
+//
+// Parameters:
+//   - keys: 敏感关键词 / Sensitive keywords
+//
+// Returns:
+//   - []string: 小写匹配模式 / Lowercase match patterns
+func compileMaskPatterns(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	patterns := make([]string, 0, len(keys)*3)
+	for _, key := range keys {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
 		// Pattern: key=value or key:value or key: value
 		// Replace with key=****
-		patterns := []string{
-			key + "=",
-			key + ":",
-			key + ": ",
-		}
+		patterns = append(patterns, key+"=", key+":", key+": ")
+	}
+	return patterns
+}
+
+// maskWithPatterns 按给定模式屏蔽敏感数据 / Mask sensitive data using the given patterns
+func maskWithPatterns(message string, patterns []string) string {
+	result := message
+	for _, pattern := range patterns {
+		if idx := strings.Index(strings.ToLower(result), pattern); idx != -1 {
+			// Find the start of the value
+			valueStart := idx + len(pattern)
+			if valueStart < len(result) {
+				// Find the end of the value (space, comma, newline, or end of string)
+				valueEnd := valueStart
+				for valueEnd < len(result) && result[valueEnd] != ' ' && result[valueEnd] != ',' && result[valueEnd] != '\n' && result[valueEnd] != '"' && result[valueEnd] != '}' {
+					valueEnd++
+				}
 
-		for _, pattern := range patterns {
-			if idx := strings.Index(strings.ToLower(result), strings.ToLower(pattern)); idx != -1 {
-				// Find the start of the value
-				valueStart := idx + len(pattern)
-				if valueStart < len(result) {
-					// Find the end of the value (space, comma, newline, or end of string)
-					valueEnd := valueStart
-					for valueEnd < len(result) && result[valueEnd] != ' ' && result[valueEnd] != ',' && result[valueEnd] != '\n' && result[valueEnd] != '"' && result[valueEnd] != '}' {
-						valueEnd++
-					}
-
-					if valueEnd > valueStart {
-						// Mask the value, showing only first 4 characters
-						value := result[valueStart:valueEnd]
-						masked := maskValue(value)
-						result = result[:valueStart] + masked + result[valueEnd:]
-					}
+				if valueEnd > valueStart {
+					// Mask the value, showing only first 4 characters
+					value := result[valueStart:valueEnd]
+					masked := maskValue(value)
+					result = result[:valueStart] + masked + result[valueEnd:]
 				}
 			}
 		}
@@ -1,11 +1,14 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
 )
 
 func TestNew(t *testing.T) {
@@ -262,3 +265,185 @@ func TestConnectionStatusLogging(t *testing.T) {
 		t.Error("connection failure should be ERROR level")
 	}
 }
+
+func TestAsyncFlushOnClose(t *testing.T) {
+	tests := []struct {
+		name       string
+		queueSize  int
+		dropOnFull bool
+	}{
+		{"block on full", 4, false},
+		{"large queue with drop", 10000, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "test.log")
+
+			logger, err := New(logPath, INFO, 10, 7, 3, false, false)
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			logger.SetAsync(tt.queueSize, tt.dropOnFull)
+
+			const messages = 1000
+			for i := 0; i < messages; i++ {
+				logger.Info("async message %d", i)
+			}
+			if err := logger.Close(); err != nil {
+				t.Fatalf("failed to close logger: %v", err)
+			}
+
+			content, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatalf("failed to read log file: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			if len(lines) != messages {
+				t.Fatalf("expected %d lines after Close, got %d", messages, len(lines))
+			}
+			for i, line := range lines {
+				if !strings.HasSuffix(line, fmt.Sprintf("async message %d", i)) {
+					t.Errorf("line %d out of order: %s", i, line)
+					break
+				}
+			}
+			if logger.Dropped() != 0 {
+				t.Errorf("expected no dropped entries, got %d", logger.Dropped())
+			}
+		})
+	}
+}
+
+func TestSetMaskKeys(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+
+	logger, err := New(logPath, INFO, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	logger.SetMaskKeys([]string{"X-Signature", " ", "x-signature"})
+
+	logger.Info("sending alert x-signature=hook1234567890 to channel")
+	logger.Info("headers X-SIGNATURE: caps9876543210")
+	logger.Info("api_key=abcd1234567890 still masked")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("failed to close logger: %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	contentStr := string(content)
+
+	for _, secret := range []string{"hook1234567890", "caps9876543210", "abcd1234567890"} {
+		if strings.Contains(contentStr, secret) {
+			t.Errorf("expected %s to be masked, got: %s", secret, contentStr)
+		}
+	}
+	for _, masked := range []string{"x-signature=hook****", "X-SIGNATURE: caps****", "api_key=abcd****"} {
+		if !strings.Contains(contentStr, masked) {
+			t.Errorf("expected %q in log, got: %s", masked, contentStr)
+		}
+	}
+
+	// Custom keys are not masked by a logger without them
+	if got := maskSensitiveData("x-signature=hook1234567890"); got != "x-signature=hook1234567890" {
+		t.Errorf("default masking should not include custom keys, got %s", got)
+	}
+}
+
+func TestSetConsoleWriter(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+
+	logger, err := New(logPath, INFO, 10, 7, 3, false, true)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	var console strings.Builder
+	logger.SetConsoleWriter(&console)
+
+	logger.Info("redirected console entry")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("failed to close logger: %v", err)
+	}
+
+	if !strings.Contains(console.String(), "[INFO] redirected console entry") {
+		t.Errorf("expected entry on the console writer, got: %q", console.String())
+	}
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "redirected console entry") {
+		t.Errorf("expected entry in the log file as well, got: %s", content)
+	}
+}
+
+func TestSetTimeRotation(t *testing.T) {
+	start := time.Date(2026, 3, 1, 23, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		at       string
+		interval time.Duration
+		before   time.Duration // advance that must not rotate yet
+		after    time.Duration // further advance that must rotate
+	}{
+		{"daily at midnight", "00:00", 0, 59 * time.Minute, time.Minute},
+		{"every six hours", "", 6 * time.Hour, 5 * time.Hour, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logger, err := New(filepath.Join(dir, "app.log"), INFO, 10, 7, 3, false, false)
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			defer logger.Close()
+
+			clk := clock.NewFake(start)
+			if err := logger.SetTimeRotation(tt.at, tt.interval, clk); err != nil {
+				t.Fatalf("SetTimeRotation() error = %v", err)
+			}
+			countFiles := func() int {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatalf("failed to read log directory: %v", err)
+				}
+				return len(entries)
+			}
+
+			logger.Info("first period")
+			clk.Advance(tt.before)
+			logger.Info("still first period")
+			if n := countFiles(); n != 1 {
+				t.Fatalf("expected 1 log file before the rotation time, got %d", n)
+			}
+
+			clk.Advance(tt.after)
+			logger.Info("second period")
+			if n := countFiles(); n != 2 {
+				t.Fatalf("expected a new log file after the rotation time, got %d files", n)
+			}
+			content, err := os.ReadFile(filepath.Join(dir, "app.log"))
+			if err != nil {
+				t.Fatalf("failed to read log file: %v", err)
+			}
+			if strings.Contains(string(content), "first period") || !strings.Contains(string(content), "second period") {
+				t.Errorf("expected only the second period in the current file, got:\n%s", content)
+			}
+		})
+	}
+
+	logger, err := New(filepath.Join(t.TempDir(), "app.log"), INFO, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	if err := logger.SetTimeRotation("7pm", 0, nil); err == nil {
+		t.Error("expected an error for a malformed rotation time")
+	}
+}
@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// SetTimeRotation 启用按时间轮转 / Enable time-based rotation
+// 在每天的固定时刻或每隔固定时长轮转日志文件，与按大小轮转同时生效。
+// 轮转在到期后的第一次写入时发生。必须在记录任何日志之前调用
+// Rotates the log file daily at a fixed time of day or at a fixed interval, in addition to the
+// size-based rotation. The rotation happens on the first write after it is due. Must be called
+// before anything is logged
+//
+// Parameters:
+//   - at: 每天轮转的本地时刻"HH:MM"，为空时按interval轮转 / Local time of day "HH:MM" to rotate daily, empty to use interval
+//   - interval: 轮转间隔，at非空时忽略 / Rotation interval, ignored when at is set
+//   - clk: 时钟，nil表示系统时钟 / Clock, nil for the system clock
+//
+// Returns:
+//   - error: 时刻格式无效、两者都未设置或日志未写入文件时返回错误
+//     Error when the time of day is malformed, neither is set, or the logger has no log file
+func (l *Logger) SetTimeRotation(at string, interval time.Duration, clk clock.Clock) error {
+	file, ok := l.fileWriter.(*lumberjack.Logger)
+	if !ok {
+		return fmt.Errorf("time-based rotation needs a rotating log file")
+	}
+	if clk == nil {
+		clk = clock.Real{}
+	}
+
+	rotator := &timeRotator{file: file, clock: clk}
+	switch {
+	case at != "":
+		tod, err := time.Parse("15:04", at)
+		if err != nil {
+			return fmt.Errorf("invalid rotation time %q (must be HH:MM): %w", at, err)
+		}
+		rotator.next = nextDaily(clk.Now(), tod.Hour(), tod.Minute())
+		rotator.advance = func(now time.Time) time.Time { return nextDaily(now, tod.Hour(), tod.Minute()) }
+	case interval > 0:
+		rotator.next = clk.Now().Add(interval)
+		rotator.advance = func(now time.Time) time.Time {
+			next := rotator.next
+			for !next.After(now) {
+				next = next.Add(interval)
+			}
+			return next
+		}
+	default:
+		return fmt.Errorf("a rotation time of day or a positive interval is required")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fileWriter = rotator
+	return nil
+}
+
+// timeRotator 按时间触发轮转的文件写入器 / File writer that also rotates on a schedule
+type timeRotator struct {
+	mu      sync.Mutex
+	file    *lumberjack.Logger
+	clock   clock.Clock
+	next    time.Time                 // next scheduled rotation
+	advance func(time.Time) time.Time // next rotation after the given time
+}
+
+// Write 写入日志，到期时先轮转 / Write an entry, rotating first when a rotation is due
+func (r *timeRotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := r.clock.Now(); !now.Before(r.next) {
+		// On failure lumberjack keeps writing to the current file; retry at the next rotation
+		r.file.Rotate()
+		r.next = r.advance(now)
+	}
+	return r.file.Write(p)
+}
+
+// Close 关闭日志文件 / Close the log file
+func (r *timeRotator) Close() error {
+	return r.file.Close()
+}
+
+// nextDaily 返回now之后下一个hour:minute时刻 / Return the next hour:minute after now
+// 使用now所在时区，按日历日前进以正确处理夏令时
+// Uses now's location and steps by calendar day so DST changes are handled
+func nextDaily(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, now.Location())
+	}
+	return next
+}
@@ -0,0 +1,20 @@
+package monitor
+
+import "github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+
+// OKXAPI 监控服务和看门狗使用的OKX接口 / OKX API used by the monitor and watchdog
+// 由*okx.Client实现；测试中可替换为模拟实现，无需真实HTTP请求
+// Implemented by *okx.Client; tests substitute a mock so no real HTTP is needed
+type OKXAPI interface {
+	GetAccountBalance() (*okx.AccountBalanceResponse, error)
+	GetPositions() (*okx.PositionsResponse, error)
+	GetFundingRate(instId string) (*okx.FundingRateResponse, error)
+	GetBillsHistory(instType, billType, after string, limit int) (*okx.BillsResponse, error)
+	GetPendingAlgoOrders(ordType string) (*okx.PendingAlgoOrdersResponse, error)
+	CancelAlgoOrders(orders []okx.CancelAlgoOrderRequest) (*okx.AlgoOrderResponse, error)
+	ClosePosition(instId, mgnMode, posSide string) (*okx.ClosePositionResponse, error)
+	HealthCheck() error
+	Stats() okx.RetryStats
+}
+
+var _ OKXAPI = (*okx.Client)(nil)
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// Bill pagination limits for one sync
+const (
+	billsPageSize    = 100 // bills requested per page, the OKX maximum
+	maxBillPagesSync = 10  // pages fetched per cycle, a backlog beyond this is left behind
+)
+
+// syncBillsHistory 同步账户账单流水 / Sync account bills into storage
+// 从最新一页开始向更早的记录翻页，遇到已存储的账单或最后一页时停止。
+// 失败仅记录警告，不影响监控周期
+// Pages from the newest bills towards older ones and stops at the first page containing a
+// bill that is already stored, or at the last page. Failures are only logged and don't fail
+// the cycle
+func (m *Monitor) syncBillsHistory() {
+	after := ""
+	total := 0
+	for page := 0; page < maxBillPagesSync; page++ {
+		resp, err := m.okxClient.GetBillsHistory("", "", after, billsPageSize)
+		if err != nil {
+			m.logger.Warn("Failed to get account bills: %v", err)
+			return
+		}
+
+		bills, reachedStored := m.newBills(resp.Data)
+		if len(bills) > 0 {
+			inserted, err := m.storage.InsertBills(bills)
+			if err != nil {
+				m.logger.Warn("Failed to store account bills: %v", err)
+				return
+			}
+			total += inserted
+		}
+
+		if reachedStored || len(resp.Data) < billsPageSize {
+			break
+		}
+		after = resp.Data[len(resp.Data)-1].BillId
+	}
+
+	if total > 0 {
+		m.logger.Info("Stored %d new account bills", total)
+	}
+}
+
+// newBills 转换一页账单，排除已存储的账单 / Convert a page of bills, leaving out stored ones
+//
+// Parameters:
+//   - page: OKX返回的一页账单，按时间倒序 / Page of bills returned by OKX, newest first
+//
+// Returns:
+//   - []models.Bill: 尚未存储的账单 / Bills not stored yet
+//   - bool: 本页是否包含已存储的账单 / Whether the page contains a stored bill
+func (m *Monitor) newBills(page []okx.BillData) ([]models.Bill, bool) {
+	var bills []models.Bill
+	reachedStored := false
+	for _, raw := range page {
+		stored, err := m.storage.HasBill(raw.BillId)
+		if err != nil {
+			m.logger.Warn("Failed to look up bill %s: %v", raw.BillId, err)
+		} else if stored {
+			reachedStored = true
+			continue
+		}
+
+		bill, err := okx.BillFromOKX(raw)
+		if err != nil {
+			m.logger.Warn("Skipping bill: %v", err)
+			continue
+		}
+		bills = append(bills, *bill)
+	}
+	return bills, reachedStored
+}
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// recordPositionEvents 记录本周期的持仓变化 / Record position changes seen in this cycle
+// 与上一周期持有的持仓比较并写入事件。上一周期的持仓在首次调用时从事件日志恢复，
+// 因此重启不会重复记录开仓或平仓；没有事件日志时（首次运行）所有持仓都记为opened
+// Compares against the positions held in the previous cycle and stores the resulting events.
+// On the first call those are restored from the event log, so a restart does not record opens
+// or closes again; without an event log (the first run) every position is recorded as opened
+//
+// Parameters:
+//   - timestamp: 本周期快照时间戳 / Snapshot timestamp of this cycle
+//   - held: 本周期持有的持仓 / Positions held in this cycle
+func (m *Monitor) recordPositionEvents(timestamp time.Time, held []*models.Position) {
+	if m.lastHeld == nil {
+		previous, err := m.heldFromEventLog()
+		if err != nil {
+			m.logger.Warn("Failed to load the position event log, skipping position events this cycle: %v", err)
+			return
+		}
+		m.lastHeld = previous
+	}
+
+	events := diffPositions(m.lastHeld, held, timestamp)
+
+	m.lastHeld = make(map[string]models.Position, len(held))
+	for _, position := range held {
+		m.lastHeld[positionKey(position)] = *position
+	}
+
+	if len(events) == 0 {
+		return
+	}
+	for _, event := range events {
+		m.logger.Info("Position %s %s %s: size %.8f → %.8f",
+			event.Instrument, event.PositionSide, event.EventType, event.PreviousSize, event.Size)
+	}
+	m.storeRecord("position events", func() error { return m.storage.InsertPositionEvents(events) })
+}
+
+// heldFromEventLog 根据事件日志恢复持有的持仓 / Restore held positions from the event log
+// 最新事件不是closed的持仓视为仍持有 / A position whose latest event is not closed counts as held
+//
+// Returns:
+//   - map[string]models.Position: 按交易对和方向索引的持仓 / Positions keyed by instrument and side
+//   - error: 查询失败时返回错误 / Error on query failure
+func (m *Monitor) heldFromEventLog() (map[string]models.Position, error) {
+	events, err := m.storage.GetLastPositionEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]models.Position, len(events))
+	for _, event := range events {
+		if event.EventType == models.PositionEventClosed {
+			continue
+		}
+		position := models.Position{
+			Timestamp:    event.Timestamp,
+			Instrument:   event.Instrument,
+			PositionSide: event.PositionSide,
+			PositionSize: event.Size,
+			AveragePrice: event.AveragePrice,
+		}
+		held[positionKey(&position)] = position
+	}
+	return held, nil
+}
+
+// diffPositions 比较相邻两次快照得出持仓变化 / Derive position changes from consecutive snapshots
+// 单向持仓模式下方向反转（仓位正负号改变）记为平仓后再开仓
+// A reversal in net mode (the size changing sign) is recorded as a close followed by an open
+//
+// Parameters:
+//   - previous: 上一快照的持仓，按交易对和方向索引 / Previous snapshot keyed by instrument and side
+//   - current: 本次快照的持仓 / Positions in this snapshot
+//   - timestamp: 本次快照时间戳 / Timestamp of this snapshot
+//
+// Returns:
+//   - []models.PositionEvent: 持仓变化事件，平仓事件按交易对排序排在最后
+//     Position events, with closes of positions no longer held last, sorted by instrument
+func diffPositions(previous map[string]models.Position, current []*models.Position, timestamp time.Time) []models.PositionEvent {
+	var events []models.PositionEvent
+	event := func(position *models.Position, eventType models.PositionEventType, previousSize, size float64) {
+		events = append(events, models.PositionEvent{
+			Timestamp:    timestamp,
+			Instrument:   position.Instrument,
+			PositionSide: position.PositionSide,
+			EventType:    eventType,
+			PreviousSize: previousSize,
+			Size:         size,
+			AveragePrice: position.AveragePrice,
+		})
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, cur := range current {
+		key := positionKey(cur)
+		seen[key] = true
+
+		prev, ok := previous[key]
+		switch {
+		case !ok:
+			event(cur, models.PositionEventOpened, 0, cur.PositionSize)
+		case prev.PositionSize*cur.PositionSize < 0:
+			event(&prev, models.PositionEventClosed, prev.PositionSize, 0)
+			event(cur, models.PositionEventOpened, 0, cur.PositionSize)
+		case math.Abs(cur.PositionSize) > math.Abs(prev.PositionSize):
+			event(cur, models.PositionEventIncreased, prev.PositionSize, cur.PositionSize)
+		case math.Abs(cur.PositionSize) < math.Abs(prev.PositionSize):
+			event(cur, models.PositionEventDecreased, prev.PositionSize, cur.PositionSize)
+		}
+	}
+
+	var closed []string
+	for key := range previous {
+		if !seen[key] {
+			closed = append(closed, key)
+		}
+	}
+	sort.Strings(closed)
+	for _, key := range closed {
+		prev := previous[key]
+		event(&prev, models.PositionEventClosed, prev.PositionSize, 0)
+	}
+	return events
+}
@@ -1,10 +1,18 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/rand"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
@@ -13,35 +21,78 @@ import (
 
 // Monitor 监控服务 / Monitoring service
 type Monitor struct {
-	okxClient     *okx.Client
-	storage       *storage.Storage
-	logger        *logger.Logger
-	interval      time.Duration
-	stopChan      chan struct{}
-	lastSuccess   time.Time
-	errorCount    int64
-	successCount  int64
+	okxClient   OKXAPI
+	storage     *storage.Storage
+	logger      *logger.Logger
+	alerter     *alert.Alerter
+	interval    time.Duration
+	marginAlert float64         // margin ratio below which to alert (1.0 = 100%)
+	liqAlert    float64         // fraction of mark price to liquidation below which to alert
+	pnlSwingUSD float64         // unrealized PnL change between snapshots that alerts, 0 disables
+	pnlSwingPct float64         // unrealized PnL change relative to the previous PnL that alerts, 0 disables
+	balanceUSD  float64         // unexplained balance change in USD between snapshots that alerts, 0 disables
+	balancePct  float64         // unexplained balance change relative to the previous balance that alerts, 0 disables
+	instruments map[string]bool // instruments whose positions are stored, empty means all
+	syncBills   bool            // whether account bills are stored each cycle
+	maintenance time.Duration   // interval between database maintenance runs, 0 means never
+	maxFailures int             // consecutive failed cycles after which Start returns, 0 means never
+	jitter      time.Duration   // upper bound of the random delay before the first API call, 0 means none
+	clock       clock.Clock     // snapshot timestamps and last success, shared with the watchdog
+	done        chan struct{}
+
+	// Failed database writes, only touched by the goroutine running cycles
+	buffered      []bufferedWrite // writes kept for retry in the next cycle, oldest first
+	writeFailures int             // writes that failed in the current cycle
+	lastWriteErr  error           // most recent write error in the current cycle
+
+	// Positions held in the previous cycle, diffed for position events; nil until restored
+	// from the event log, only touched by the goroutine running cycles
+	lastHeld map[string]models.Position
+
+	mu                  sync.Mutex // guards metrics below
+	lastSuccess         time.Time
+	errorCount          int64
+	successCount        int64
+	consecutiveFailures int
 }
 
 // New 创建新的监控服务 / Create new monitoring service
 // 初始化监控服务，配置OKX客户端、存储层、日志和轮询间隔
-// Initialize monitoring service with OKX client, storage layer, logger, and polling interval
+// Initialize monitoring service with OKX client, storage layer, logger, alerter, and monitoring config
 //
 // Parameters:
 //   - okxClient: OKX API client instance for fetching account data
 //   - storage: Database storage layer instance for persisting data
 //   - logger: Logger instance for logging operations
-//   - intervalSeconds: Monitoring polling interval in seconds (e.g., 60 for 1 minute)
+//   - alerter: Alerter for liquidation-risk alerts
+//   - cfg: Monitoring configuration (polling interval and alert thresholds)
 //
 // Returns:
 //   - *Monitor: 已配置的监控服务实例 / Configured monitoring service instance ready to start
-func New(okxClient *okx.Client, storage *storage.Storage, logger *logger.Logger, intervalSeconds int) *Monitor {
+func New(okxClient OKXAPI, storage *storage.Storage, logger *logger.Logger, alerter *alert.Alerter, cfg *config.MonitoringConfig) *Monitor {
+	instruments := make(map[string]bool, len(cfg.Instruments))
+	for _, instId := range cfg.Instruments {
+		instruments[instId] = true
+	}
+
 	return &Monitor{
-		okxClient: okxClient,
-		storage:   storage,
-		logger:    logger,
-		interval:  time.Duration(intervalSeconds) * time.Second,
-		stopChan:  make(chan struct{}),
+		okxClient:   okxClient,
+		storage:     storage,
+		logger:      logger,
+		alerter:     alerter,
+		interval:    cfg.Interval.Duration(),
+		marginAlert: cfg.MarginRatioAlert,
+		liqAlert:    cfg.LiqDistanceAlert,
+		pnlSwingUSD: cfg.PnLSwingAlertUSD,
+		pnlSwingPct: cfg.PnLSwingAlertPct,
+		balanceUSD:  cfg.BalanceChangeAlertUSD,
+		balancePct:  cfg.BalanceChangeAlertPct,
+		instruments: instruments,
+		syncBills:   cfg.SyncBills,
+		maxFailures: cfg.MaxConsecutiveFailures,
+		jitter:      time.Duration(cfg.StartupJitterSeconds) * time.Second,
+		clock:       clock.Real{},
+		done:        make(chan struct{}),
 	}
 }
 
@@ -50,17 +101,38 @@ func New(okxClient *okx.Client, storage *storage.Storage, logger *logger.Logger,
 // Start continuous monitoring loop, fetch and store account data at configured interval
 //
 // 监控流程 / Monitoring Flow:
-// 1. 执行健康检查（验证OKX API和数据库连接）/ Perform health check (verify OKX API and DB connectivity)
-// 2. 启动定时器，按interval间隔执行 / Start ticker, execute at interval
-// 3. 每个周期: 获取余额 → 获取持仓 → 存储数据 / Each cycle: fetch balance → fetch positions → store data
-// 4. 监听停止信号，优雅退出 / Listen for stop signal, graceful exit
+// 1. 等待随机启动延迟（如已配置）/ Wait the random startup delay, if configured
+// 2. 执行健康检查（验证OKX API和数据库连接）/ Perform health check (verify OKX API and DB connectivity)
+// 3. 启动定时器，按interval间隔执行 / Start ticker, execute at interval
+// 4. 每个周期: 获取余额 → 获取持仓 → 存储数据 / Each cycle: fetch balance → fetch positions → store data
+// 5. ctx取消后完成进行中的周期再退出 / On ctx cancellation, finish the in-progress cycle and exit
+//
+// Parameters:
+//   - ctx: 控制服务生命周期的上下文 / Context controlling the service lifetime
 //
 // Returns:
-//   - error: 初始健康检查失败时返回错误 / Error on initial health check failure
-//     监控过程中的错误会被记录但不会停止服务 / Errors during monitoring are logged but don't stop service
-func (m *Monitor) Start() error {
+//   - error: 初始健康检查失败或连续失败周期达到阈值时返回错误
+//     Error on initial health check failure or once consecutive failed cycles reach the threshold
+//     低于阈值的错误会被记录但不会停止服务 / Errors below the threshold are logged but don't stop service
+func (m *Monitor) Start(ctx context.Context) error {
+	defer close(m.done)
+
 	m.logger.Info("Starting monitoring service with interval: %v", m.interval)
 
+	// Stagger instances started together so they don't all call OKX at the same instant
+	if m.jitter > 0 {
+		delay := startupDelay(m.jitter)
+		m.logger.Info("Delaying startup by %v (startup_jitter_seconds %v)", delay, m.jitter)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			m.logger.Info("Monitoring service stopped")
+			return nil
+		}
+	}
+
 	// Perform initial health check
 	if err := m.healthCheck(); err != nil {
 		return fmt.Errorf("initial health check failed: %w", err)
@@ -70,30 +142,164 @@ func (m *Monitor) Start() error {
 	ticker := time.NewTicker(m.interval)
 	defer ticker.Stop()
 
+	// Maintenance runs from the same loop so it never overlaps a fetch cycle
+	var maintenanceC <-chan time.Time
+	if m.maintenance > 0 {
+		maintenanceTicker := time.NewTicker(m.maintenance)
+		defer maintenanceTicker.Stop()
+		maintenanceC = maintenanceTicker.C
+		m.logger.Info("Database maintenance scheduled every %v", m.maintenance)
+	}
+
 	for {
 		select {
 		case <-ticker.C:
-			m.logger.Debug("Monitoring cycle started")
-			if err := m.fetchAndStore(); err != nil {
-				m.errorCount++
-				m.logger.Error("Monitoring cycle failed (error count: %d): %v", m.errorCount, err)
-			} else {
-				m.successCount++
-				m.lastSuccess = time.Now()
-				m.logger.Info("Monitoring cycle completed successfully (success count: %d)", m.successCount)
+			// A tick and cancellation may be ready together; don't start a new cycle after shutdown
+			if ctx.Err() != nil {
+				m.logger.Info("Monitoring service stopped")
+				return nil
 			}
+			if err := m.runCycle(); err != nil {
+				return err
+			}
+
+		case <-maintenanceC:
+			if ctx.Err() != nil {
+				m.logger.Info("Monitoring service stopped")
+				return nil
+			}
+			m.runMaintenance()
 
-		case <-m.stopChan:
+		case <-ctx.Done():
 			m.logger.Info("Monitoring service stopped")
 			return nil
 		}
 	}
 }
 
-// Stop 停止监控服务 / Stop monitoring service
-func (m *Monitor) Stop() {
-	m.logger.Info("Stopping monitoring service...")
-	close(m.stopChan)
+// startupDelay 随机选择启动延迟 / Pick a random startup delay
+//
+// Parameters:
+//   - bound: 延迟上限 / Upper bound of the delay
+//
+// Returns:
+//   - time.Duration: [0, bound]内均匀分布的延迟，按毫秒取整 / Delay uniform in [0, bound], in whole milliseconds
+func startupDelay(bound time.Duration) time.Duration {
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(bound.Milliseconds()+1)) * time.Millisecond
+}
+
+// SetMaintenanceInterval 设置数据库维护间隔 / Set database maintenance interval
+// 必须在Start之前调用；0表示从不维护
+// Must be called before Start; 0 means never run maintenance
+//
+// Parameters:
+//   - interval: 两次维护之间的间隔 / Interval between maintenance runs
+func (m *Monitor) SetMaintenanceInterval(interval time.Duration) {
+	m.maintenance = interval
+}
+
+// SetClock 设置时钟 / Set clock
+// 必须在Start和NewWatchdog之前调用；nil保持当前时钟
+// Must be called before Start and NewWatchdog; nil keeps the current clock
+//
+// Parameters:
+//   - clk: 快照时间戳和最近成功时间使用的时钟 / Clock for snapshot timestamps and last success
+func (m *Monitor) SetClock(clk clock.Clock) {
+	if clk != nil {
+		m.clock = clk
+	}
+}
+
+// Done 返回服务退出时关闭的通道 / Return channel closed when the service has exited
+// 用于关闭时等待进行中的周期完成 / Used on shutdown to wait for the in-progress cycle to finish
+func (m *Monitor) Done() <-chan struct{} {
+	return m.done
+}
+
+// okxMaintenanceAlertKey OKX维护告警键 / Alert key for OKX maintenance
+const okxMaintenanceAlertKey = "okx_maintenance"
+
+// monitorFailuresAlertKey 连续失败告警键 / Alert key for consecutive failed cycles
+const monitorFailuresAlertKey = "monitor_failures"
+
+// RunOnce 执行一次监控周期并更新指标 / Run one monitoring cycle and update metrics
+// 获取并存储余额、持仓和保证金，更新成功/失败计数和最近成功时间。
+// Start的定时循环每个周期调用此方法，也可用于单次运行或嵌入其他程序
+// Fetch and store balances, positions and margin, then update the success/error counts and last
+// success time. Start's ticker loop calls this every cycle; it can also be called directly for a
+// single run or when embedding the monitor
+//
+// Returns:
+//   - error: 本次周期失败时返回错误，包括OKX维护（不计入连续失败）
+//     Error when this cycle failed, including OKX maintenance (not counted as a consecutive failure)
+func (m *Monitor) RunOnce() error {
+	m.logger.Debug("Monitoring cycle started")
+	err := m.fetchAndStore()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.errorCount++
+		if okx.IsMaintenance(err) {
+			// Expected to last a while, alert once instead of on every failed cycle
+			if !m.alerter.IsActive(okxMaintenanceAlertKey) {
+				m.alerter.Alert(okxMaintenanceAlertKey, "OKX in maintenance, monitoring resumes once calls succeed: %v", err)
+			}
+			m.logger.Warn("Monitoring cycle skipped, OKX in maintenance (error count: %d)", m.errorCount)
+			return err
+		}
+		m.consecutiveFailures++
+		m.logger.Error("Monitoring cycle failed (error count: %d, consecutive: %d): %v", m.errorCount, m.consecutiveFailures, err)
+		return err
+	}
+	m.alerter.Resolve(okxMaintenanceAlertKey)
+	m.consecutiveFailures = 0
+	m.successCount++
+	m.lastSuccess = m.clock.Now()
+	m.logger.Info("Monitoring cycle completed successfully (success count: %d)", m.successCount)
+	return nil
+}
+
+// runCycle 执行一次定时监控周期 / Run one scheduled monitoring cycle
+// 连续失败周期达到maxFailures时告警并返回错误；OKX维护导致的失败不计入
+// Alerts and returns an error once consecutive failed cycles reach maxFailures; failures caused
+// by OKX maintenance are not counted
+//
+// Returns:
+//   - error: 连续失败达到阈值时返回最后一次错误 / The last error once consecutive failures reach the threshold
+func (m *Monitor) runCycle() error {
+	err := m.RunOnce()
+	if err == nil || okx.IsMaintenance(err) {
+		return nil
+	}
+
+	m.mu.Lock()
+	failures := m.consecutiveFailures
+	m.mu.Unlock()
+	if m.maxFailures > 0 && failures >= m.maxFailures {
+		m.alerter.Alert(monitorFailuresAlertKey, "monitoring failed %d consecutive cycles, stopping: %v", failures, err)
+		return fmt.Errorf("monitoring failed %d consecutive cycles: %w", failures, err)
+	}
+	return nil
+}
+
+// runMaintenance 执行数据库维护并记录回收的空间 / Run database maintenance and log reclaimed space
+// 失败仅记录错误，不影响监控 / Failures are only logged and don't affect monitoring
+func (m *Monitor) runMaintenance() {
+	m.logger.Info("Running database maintenance (VACUUM and WAL checkpoint)")
+	start := m.clock.Now()
+
+	reclaimed, err := m.storage.Maintenance()
+	if err != nil {
+		m.logger.Error("Database maintenance failed: %v", err)
+		return
+	}
+
+	m.logger.Info("Database maintenance completed in %v, reclaimed %.2f MB",
+		m.clock.Now().Sub(start).Truncate(time.Millisecond), float64(reclaimed)/(1024*1024))
 }
 
 // healthCheck 健康检查 / Perform health check
@@ -119,7 +325,14 @@ func (m *Monitor) healthCheck() error {
 }
 
 // fetchAndStore 获取并存储数据 / Fetch and store account data
+// 数据库写入失败不会中止周期：失败的记录被缓存并在下个周期重试，同时发出存储降级告警
+// A failed database write does not abort the cycle: the record is buffered and retried in the
+// next cycle, and a storage degraded alert is raised
 func (m *Monitor) fetchAndStore() error {
+	m.writeFailures, m.lastWriteErr = 0, nil
+	m.retryBufferedWrites()
+	defer m.reportStorageHealth()
+
 	// Fetch account balances
 	if err := m.fetchAndStoreBalances(); err != nil {
 		return fmt.Errorf("failed to fetch balances: %w", err)
@@ -130,9 +343,88 @@ func (m *Monitor) fetchAndStore() error {
 		return fmt.Errorf("failed to fetch positions: %w", err)
 	}
 
+	if m.syncBills {
+		m.syncBillsHistory()
+	}
+
 	return nil
 }
 
+// storageDegradedAlertKey 数据库写入失败告警键 / Alert key for failing database writes
+const storageDegradedAlertKey = "storage_degraded"
+
+// maxBufferedWrites 缓存待重试写入的上限，超出时丢弃最旧的 / Failed writes kept for retry, the oldest are dropped beyond this
+const maxBufferedWrites = 1000
+
+// bufferedWrite 待重试的数据库写入 / Database write waiting to be retried
+type bufferedWrite struct {
+	desc  string // what is written, for logs
+	write func() error
+}
+
+// storeRecord 写入一条记录，失败时缓存待重试 / Write one record, buffering it for retry on failure
+//
+// Parameters:
+//   - desc: 记录描述，用于日志 / Record description for logs
+//   - write: 执行写入的函数 / Function performing the write
+//
+// Returns:
+//   - bool: 是否写入成功 / Whether the write succeeded
+func (m *Monitor) storeRecord(desc string, write func() error) bool {
+	err := write()
+	if err == nil {
+		return true
+	}
+
+	m.logger.Error("Failed to store %s, buffering for retry: %v", desc, err)
+	m.writeFailures++
+	m.lastWriteErr = err
+	m.buffered = append(m.buffered, bufferedWrite{desc: desc, write: write})
+	if dropped := len(m.buffered) - maxBufferedWrites; dropped > 0 {
+		m.logger.Warn("Write retry buffer full, dropping %d oldest records", dropped)
+		m.buffered = m.buffered[dropped:]
+	}
+	return false
+}
+
+// retryBufferedWrites 重试之前失败的写入 / Retry previously failed writes
+// 按原顺序重试，首次失败即停止，剩余记录留待下个周期
+// Retried in their original order; the first failure stops the retry and the rest wait for
+// the next cycle
+func (m *Monitor) retryBufferedWrites() {
+	if len(m.buffered) == 0 {
+		return
+	}
+
+	retried := 0
+	for _, w := range m.buffered {
+		if err := w.write(); err != nil {
+			m.logger.Warn("Retrying buffered write of %s failed, %d records still buffered: %v", w.desc, len(m.buffered)-retried, err)
+			m.writeFailures++
+			m.lastWriteErr = err
+			break
+		}
+		retried++
+	}
+	if retried > 0 {
+		m.logger.Info("Stored %d buffered records", retried)
+	}
+	m.buffered = m.buffered[retried:]
+}
+
+// reportStorageHealth 根据本周期写入结果告警或解除告警 / Raise or resolve the storage alert based on this cycle's writes
+// 所有缓存的记录都写入后才解除告警 / The alert resolves only once every buffered record is written
+func (m *Monitor) reportStorageHealth() {
+	if m.writeFailures > 0 {
+		m.alerter.Alert(storageDegradedAlertKey, "database writes failing, %d failed this cycle and %d records buffered for retry: %v",
+			m.writeFailures, len(m.buffered), m.lastWriteErr)
+		return
+	}
+	if len(m.buffered) == 0 {
+		m.alerter.Resolve(storageDegradedAlertKey)
+	}
+}
+
 // fetchAndStoreBalances 获取并存储账户余额 / Fetch and store account balances
 // 从OKX API获取账户余额，解析并存储到数据库
 // Fetch account balances from OKX API, parse and store to database
@@ -141,9 +433,11 @@ func (m *Monitor) fetchAndStore() error {
 // 1. 调用OKX API获取余额数据 / Call OKX API to get balance data
 // 2. 遍历所有币种的余额详情 / Iterate through all currency balance details
 // 3. 过滤：仅记录BTC、ETH、USDT / Filter: only record BTC, ETH, USDT
-// 4. 解析字符串金额为浮点数 / Parse string amounts to float64
+// 4. 按账户模式选择余额字段并解析，见okx.BalanceFromOKX / Pick balance fields by account mode and parse them, see okx.BalanceFromOKX
 // 5. 创建AccountBalance模型并验证 / Create AccountBalance model and validate
 // 6. 写入数据库 / Write to database
+// 7. 记录账户保证金率并检查强平风险 / Record account margin ratio and check liquidation risk
+// 8. 与上一快照比较余额，检查无法由盈亏解释的变化 / Compare with the previous snapshot for changes PnL does not explain
 //
 // Returns:
 //   - error: API调用失败、数据解析失败或数据库写入失败时返回错误
@@ -160,8 +454,9 @@ func (m *Monitor) fetchAndStoreBalances() error {
 	m.logger.Debug("Received account balance response from OKX API")
 
 	// Parse and store balances
-	timestamp := time.Now().UTC()
+	timestamp := m.clock.Now().UTC()
 	storedCount := 0
+	previous := m.previousBalances()
 
 	if len(resp.Data) == 0 {
 		m.logger.Warn("No account data in balance response")
@@ -169,54 +464,32 @@ func (m *Monitor) fetchAndStoreBalances() error {
 	}
 
 	for _, account := range resp.Data {
+		m.storeAccountMargin(account, timestamp)
+
 		for _, detail := range account.Details {
 			// Filter: only record BTC, ETH, and USDT
 			if detail.Ccy != "BTC" && detail.Ccy != "ETH" && detail.Ccy != "USDT" {
 				continue
 			}
 
-			// Parse balance values
-			balance, err := strconv.ParseFloat(detail.Eq, 64)
+			balanceModel, err := okx.BalanceFromOKX(&account, detail)
 			if err != nil {
-				m.logger.Warn("Failed to parse balance for %s: %v", detail.Ccy, err)
+				m.logger.Warn("Skipping balance: %v", err)
 				continue
 			}
+			balanceModel.Timestamp = timestamp
 
-			available, err := strconv.ParseFloat(detail.AvailBal, 64)
-			if err != nil {
-				m.logger.Warn("Failed to parse available balance for %s: %v", detail.Ccy, err)
-				continue
-			}
-
-			frozen, err := strconv.ParseFloat(detail.FrozenBal, 64)
-			if err != nil {
-				m.logger.Warn("Failed to parse frozen balance for %s: %v", detail.Ccy, err)
-				frozen = 0 // Default to 0 if parse fails
-			}
-
-			equity, err := strconv.ParseFloat(detail.EqUsd, 64)
-			if err != nil {
-				equity = 0 // Default to 0 if parse fails
-			}
-
-			// Create balance model
-			balanceModel := &models.AccountBalance{
-				Timestamp: timestamp,
-				Currency:  detail.Ccy,
-				Balance:   balance,
-				Available: available,
-				Frozen:    frozen,
-				Equity:    equity,
+			if prev, ok := previous[detail.Ccy]; ok {
+				m.checkBalanceChange(&prev, balanceModel)
 			}
 
 			// Insert into database
-			if err := m.storage.InsertAccountBalance(balanceModel); err != nil {
-				m.logger.Error("Failed to insert balance for %s: %v", detail.Ccy, err)
-				return err
+			if !m.storeRecord("balance for "+detail.Ccy, func() error { return m.storage.InsertAccountBalance(balanceModel) }) {
+				continue
 			}
 
 			storedCount++
-			m.logger.Debug("Stored balance for %s: %.8f", detail.Ccy, balance)
+			m.logger.Debug("Stored balance for %s: %.8f", detail.Ccy, balanceModel.Balance)
 		}
 	}
 
@@ -224,6 +497,212 @@ func (m *Monitor) fetchAndStoreBalances() error {
 	return nil
 }
 
+// storeAccountMargin 存储账户保证金率并检查告警 / Store account margin ratio and check alert
+// 无杠杆持仓时OKX返回空的mgnRatio，此时记录为0且不告警
+// OKX returns an empty mgnRatio without leveraged positions; it is then stored as 0 and never alerts
+//
+// 写入失败时缓存待重试，告警检查照常进行 / A failed write is buffered for retry and the alert is still checked
+//
+// Parameters:
+//   - account: OKX账户余额数据 / OKX account balance data
+//   - timestamp: 本周期时间戳 / Timestamp of this cycle
+func (m *Monitor) storeAccountMargin(account okx.AccountBalanceData, timestamp time.Time) {
+	margin := &models.AccountMargin{
+		Timestamp:         timestamp,
+		TotalEquity:       okx.ParseOptionalFloat(account.TotalEq),
+		MarginRatio:       okx.ParseOptionalFloat(account.MgnRatio),
+		InitialMargin:     okx.ParseOptionalFloat(account.Imr),
+		MaintenanceMargin: okx.ParseOptionalFloat(account.Mmr),
+	}
+
+	if m.storeRecord("account margin", func() error { return m.storage.InsertAccountMargin(margin) }) {
+		m.logger.Debug("Stored account margin: ratio=%.4f, equity=%.2f", margin.MarginRatio, margin.TotalEquity)
+	}
+
+	if marginRatioDangerous(margin.MarginRatio, m.marginAlert) {
+		m.alerter.Alert("margin_ratio", "account margin ratio %.2f%% is below threshold %.2f%% (liquidation at 100%%)",
+			margin.MarginRatio*100, m.marginAlert*100)
+	} else {
+		m.alerter.Resolve("margin_ratio")
+	}
+}
+
+// previousBalances 获取上一余额快照 / Get the previous balance snapshot
+// 未启用余额变化告警时不查询；查询失败仅记录警告，本周期不比较
+// Not queried when balance change alerts are disabled; a query failure is only logged and skips
+// the comparison for this cycle
+//
+// Returns:
+//   - map[string]models.AccountBalance: 按币种索引的上一快照余额 / Previous snapshot keyed by currency
+func (m *Monitor) previousBalances() map[string]models.AccountBalance {
+	if m.balanceUSD <= 0 && m.balancePct <= 0 {
+		return nil
+	}
+
+	balances, err := m.storage.GetLatestAccountBalances()
+	if err != nil {
+		m.logger.Warn("Failed to load previous balance snapshot, skipping balance change check: %v", err)
+		return nil
+	}
+
+	previous := make(map[string]models.AccountBalance, len(balances))
+	for _, balance := range balances {
+		previous[balance.Currency] = balance
+	}
+	return previous
+}
+
+// checkBalanceChange 检查无法由盈亏解释的余额变化 / Check for a balance change PnL does not explain
+// 通常表示充值、提现或划转；同一事件只告警一次，下一个无此类变化的快照解除告警
+// Usually a deposit, withdrawal or transfer; each event alerts once and the next snapshot without
+// such a change resolves the alert
+//
+// Parameters:
+//   - prev: 上一快照中的余额 / Balance in the previous snapshot
+//   - cur: 本周期的余额 / Balance in this cycle
+func (m *Monitor) checkBalanceChange(prev, cur *models.AccountBalance) {
+	key := "balance_change:" + cur.Currency
+
+	change := unexplainedBalanceChange(prev, cur)
+	changeUSD := 0.0
+	if cur.Balance > 0 {
+		changeUSD = change * cur.Equity / cur.Balance
+	}
+	exceeded := (m.balanceUSD > 0 && math.Abs(changeUSD) >= m.balanceUSD) ||
+		(m.balancePct > 0 && prev.Balance > 0 && math.Abs(change)/prev.Balance >= m.balancePct)
+	if !exceeded {
+		m.alerter.Resolve(key)
+		return
+	}
+	if m.alerter.IsActive(key) {
+		return // Already alerted for this event
+	}
+
+	m.alerter.Alert(key, "%s balance changed %+.8f (%.8f → %.8f, about %+.2f USD) since %s, not explained by PnL: possible deposit, withdrawal or transfer",
+		cur.Currency, change, prev.Balance, cur.Balance, changeUSD, prev.Timestamp.Format(time.RFC3339))
+}
+
+// unexplainedBalanceChange 计算无法由盈亏解释的余额变化 / Compute the balance change PnL does not explain
+// 取总变化与扣除未实现盈亏变化后的变化中绝对值较小者：价格变动改变未实现盈亏，平仓将其转为已实现而总余额不变，
+// 两种情况都不计入
+// The smaller in magnitude of the whole change and the change minus the change in unrealized PnL:
+// price moves change unrealized PnL, and closing a position realizes it without changing the
+// balance, so neither counts
+func unexplainedBalanceChange(prev, cur *models.AccountBalance) float64 {
+	change := cur.Balance - prev.Balance
+	excludingPnL := change - (cur.UnrealizedPnL - prev.UnrealizedPnL)
+	if math.Abs(excludingPnL) < math.Abs(change) {
+		return excludingPnL
+	}
+	return change
+}
+
+// checkLiquidationRisk 检查持仓强平距离 / Check position distance to liquidation
+// 标记价格距强平价格的比例低于阈值时告警
+// Alert when the mark price is within the configured fraction of the liquidation price
+//
+// Parameters:
+//   - pos: OKX持仓数据 / OKX position data
+func (m *Monitor) checkLiquidationRisk(pos okx.PositionData) {
+	key := fmt.Sprintf("liquidation:%s:%s", pos.InstId, pos.PosSide)
+
+	distance, ok := liquidationDistance(okx.ParseOptionalFloat(pos.MarkPx), okx.ParseOptionalFloat(pos.LiqPx))
+	if !ok || distance >= m.liqAlert {
+		m.alerter.Resolve(key)
+		return
+	}
+
+	m.alerter.Alert(key, "%s %s mark price %s is %.2f%% from liquidation price %s (threshold %.2f%%)",
+		pos.InstId, pos.PosSide, pos.MarkPx, distance*100, pos.LiqPx, m.liqAlert*100)
+}
+
+// previousPositions 获取上一持仓快照 / Get the previous position snapshot
+// 未启用盈亏波动告警时不查询；查询失败仅记录警告，本周期不比较
+// Not queried when PnL swing alerts are disabled; a query failure is only logged and skips
+// the comparison for this cycle
+//
+// Parameters:
+//   - timestamp: 本周期时间戳，尚未写入 / Timestamp of this cycle, not yet stored
+//
+// Returns:
+//   - map[string]models.Position: 按交易对和方向索引的上一快照持仓 / Previous snapshot keyed by instrument and side
+func (m *Monitor) previousPositions(timestamp time.Time) map[string]models.Position {
+	if m.pnlSwingUSD <= 0 && m.pnlSwingPct <= 0 {
+		return nil
+	}
+
+	positions, err := m.storage.GetPositionsAsOf(timestamp)
+	if err != nil {
+		m.logger.Warn("Failed to load previous position snapshot, skipping PnL swing check: %v", err)
+		return nil
+	}
+
+	previous := make(map[string]models.Position, len(positions))
+	for _, position := range positions {
+		previous[positionKey(&position)] = position
+	}
+	return previous
+}
+
+// checkPnLSwing 检查未实现盈亏波动 / Check unrealized PnL swing
+// 与上一快照相比变化超过阈值时告警；持续恶化的持仓按告警重复间隔提醒，而非每个周期
+// Alert when the change since the previous snapshot exceeds a threshold; a steadily worsening
+// position alerts at the alert repeat interval rather than every cycle
+//
+// Parameters:
+//   - prev: 上一快照中的持仓 / Position in the previous snapshot
+//   - cur: 本周期的持仓 / Position in this cycle
+func (m *Monitor) checkPnLSwing(prev, cur *models.Position) {
+	key := fmt.Sprintf("pnl_swing:%s:%s", cur.Instrument, cur.PositionSide)
+
+	if !pnlSwingExceeded(prev.UnrealizedPnL, cur.UnrealizedPnL, m.pnlSwingUSD, m.pnlSwingPct) {
+		m.alerter.Resolve(key)
+		return
+	}
+
+	m.alerter.Alert(key, "%s %s unrealized PnL moved %+.2f (%.2f → %.2f) since %s",
+		cur.Instrument, cur.PositionSide, cur.UnrealizedPnL-prev.UnrealizedPnL,
+		prev.UnrealizedPnL, cur.UnrealizedPnL, prev.Timestamp.Format(time.RFC3339))
+}
+
+// pnlSwingExceeded 判断盈亏变化是否超过阈值 / Check whether a PnL change exceeds a threshold
+// 超过绝对阈值或相对上一盈亏的百分比阈值之一即为true；阈值为0时不检查，上一盈亏为0时不检查百分比
+// True when the change exceeds either the absolute threshold or the percentage of the previous PnL;
+// a 0 threshold is not checked, and the percentage is not checked when the previous PnL is 0
+func pnlSwingExceeded(prev, cur, absThreshold, pctThreshold float64) bool {
+	change := math.Abs(cur - prev)
+	if absThreshold > 0 && change >= absThreshold {
+		return true
+	}
+	return pctThreshold > 0 && prev != 0 && change/math.Abs(prev) >= pctThreshold
+}
+
+// positionKey 持仓的交易对和方向键 / Instrument and side key of a position
+func positionKey(position *models.Position) string {
+	return position.Instrument + ":" + string(position.PositionSide)
+}
+
+// marginRatioDangerous 判断保证金率是否危险 / Check whether margin ratio is dangerous
+// ratio为0表示未知（无杠杆持仓），不视为危险
+// A ratio of 0 means unknown (no leveraged positions) and is never dangerous
+func marginRatioDangerous(ratio, threshold float64) bool {
+	return ratio > 0 && ratio < threshold
+}
+
+// liquidationDistance 计算标记价格到强平价格的距离 / Compute distance from mark price to liquidation price
+// 返回|mark-liq|/mark；任一价格缺失时返回false
+// Returns |mark-liq|/mark; false when either price is missing
+func liquidationDistance(markPx, liqPx float64) (float64, bool) {
+	if markPx <= 0 || liqPx <= 0 {
+		return 0, false
+	}
+	distance := (markPx - liqPx) / markPx
+	if distance < 0 {
+		distance = -distance
+	}
+	return distance, true
+}
+
 // fetchAndStorePositions 获取并存储持仓信息 / Fetch and store positions
 // 从OKX API获取持仓信息，解析并存储到数据库
 // Fetch position information from OKX API, parse and store to database
@@ -235,7 +714,10 @@ func (m *Monitor) fetchAndStoreBalances() error {
 // 4. 解析持仓数值（仓位、价格、盈亏等）/ Parse position values (size, price, PnL, etc.)
 // 5. 跳过零仓位的记录 / Skip records with zero position size
 // 6. 创建Position模型并验证 / Create Position model and validate
-// 7. 写入数据库 / Write to database
+// 7. 检查强平距离 / Check distance to liquidation
+// 8. 与上一快照比较未实现盈亏 / Compare unrealized PnL with the previous snapshot
+// 9. 写入数据库 / Write to database
+// 10. 记录与上一周期相比的持仓变化 / Record position changes since the previous cycle
 //
 // Returns:
 //   - error: API调用失败、数据解析失败或数据库写入失败时返回错误
@@ -251,91 +733,144 @@ func (m *Monitor) fetchAndStorePositions() error {
 
 	m.logger.Debug("Received positions response from OKX API")
 
+	timestamp := m.clock.Now().UTC()
+
 	// Check if there are any positions
 	if len(resp.Data) == 0 {
 		m.logger.Info("No open positions")
+		m.recordPositionEvents(timestamp, nil)
 		return nil
 	}
 
 	// Parse and store positions
-	timestamp := time.Now().UTC()
 	storedCount := 0
+	var held []*models.Position
+	previous := m.previousPositions(timestamp)
 
 	for _, pos := range resp.Data {
-		// Parse position values
-		posSize, err := strconv.ParseFloat(pos.Pos, 64)
-		if err != nil || posSize == 0 {
+		// Convert OKX position data to model
+		positionModel, skip, err := okx.PositionFromOKX(pos)
+		if skip {
 			continue // Skip positions with zero size
 		}
-
-		avgPrice, err := strconv.ParseFloat(pos.AvgPx, 64)
 		if err != nil {
-			m.logger.Warn("Failed to parse average price for %s: %v", pos.InstId, err)
+			m.logger.Warn("Failed to parse position: %v", err)
 			continue
 		}
+		positionModel.Timestamp = timestamp
 
-		upl, err := strconv.ParseFloat(pos.Upl, 64)
-		if err != nil {
-			m.logger.Warn("Failed to parse unrealized PnL for %s: %v", pos.InstId, err)
-			upl = 0
+		// Liquidation risk is checked for every position, even ones that are not stored
+		m.checkLiquidationRisk(pos)
+
+		if !m.isMonitoredInstrument(positionModel.Instrument) {
+			m.logger.Debug("Skipping position for %s: not in monitoring.instruments", pos.InstId)
+			continue
 		}
 
-		margin, err := strconv.ParseFloat(pos.Margin, 64)
-		if err != nil {
-			m.logger.Warn("Failed to parse margin for %s: %v", pos.InstId, err)
-			margin = 0
+		if prev, ok := previous[positionKey(positionModel)]; ok {
+			m.checkPnLSwing(&prev, positionModel)
 		}
 
-		leverage, err := strconv.ParseFloat(pos.Lever, 64)
-		if err != nil {
-			m.logger.Warn("Failed to parse leverage for %s: %v", pos.InstId, err)
-			leverage = 0
+		// Held positions drive funding logs whether or not the write succeeded
+		held = append(held, positionModel)
+
+		// Insert into database
+		if !m.storeRecord("position for "+pos.InstId, func() error { return m.storage.InsertPosition(positionModel) }) {
+			continue
 		}
 
-		// Get margin mode (cross or isolated)
-		marginMode := models.MarginMode(pos.MgnMode)
-		if marginMode == "" {
-			marginMode = models.MarginModeCross // Default to cross if not specified
+		storedCount++
+		m.logger.Debug("Stored position for %s: side=%s, size=%.8f", pos.InstId, positionModel.PositionSide, positionModel.PositionSize)
+	}
+
+	m.logger.Info("Stored %d position records", storedCount)
+
+	// Record opens, closes and size changes since the previous cycle
+	m.recordPositionEvents(timestamp, held)
+
+	// Log funding exposure for held perpetual swaps
+	m.logFundingRates(held)
+
+	return nil
+}
+
+// isMonitoredInstrument 判断是否存储该交易对的持仓 / Whether positions in the instrument are stored
+// 未配置monitoring.instruments时存储所有交易对 / All instruments are stored when monitoring.instruments is empty
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID
+//
+// Returns:
+//   - bool: 是否存储 / Whether to store
+func (m *Monitor) isMonitoredInstrument(instId string) bool {
+	return len(m.instruments) == 0 || m.instruments[instId]
+}
+
+// logFundingRates 记录持仓的资金费率 / Log funding rates for held positions
+// 为每个持有的永续合约查询资金费率并记录，让用户了解持仓成本
+// Query and log the funding rate for each held perpetual swap so users see the carrying cost
+//
+// 资金费率为正时多头向空头支付，为负时空头向多头支付
+// Positive funding means longs pay shorts, negative means shorts pay longs
+// 查询失败仅记录警告，不影响监控周期 / Query failures are only logged and don't fail the cycle
+//
+// Parameters:
+//   - positions: 本周期存储的持仓 / Positions stored in this cycle
+func (m *Monitor) logFundingRates(positions []*models.Position) {
+	seen := make(map[string]bool)
+	for _, position := range positions {
+		if !strings.HasSuffix(position.Instrument, "-SWAP") || seen[position.Instrument] {
+			continue
+		}
+		seen[position.Instrument] = true
+
+		resp, err := m.okxClient.GetFundingRate(position.Instrument)
+		if err != nil {
+			m.logger.Warn("Failed to get funding rate for %s: %v", position.Instrument, err)
+			continue
+		}
+		if len(resp.Data) == 0 {
+			continue
 		}
 
-		// Normalize position side
-		posSide := models.PositionSide(pos.PosSide)
-		if posSide == "" {
-			posSide = models.PositionSideNet // Default for one-way mode
+		data := resp.Data[0]
+		rate, err := strconv.ParseFloat(data.FundingRate, 64)
+		if err != nil {
+			m.logger.Warn("Failed to parse funding rate '%s' for %s: %v", data.FundingRate, position.Instrument, err)
+			continue
 		}
 
-		// Create position model
-		positionModel := &models.Position{
-			Timestamp:     timestamp,
-			Instrument:    pos.InstId,
-			PositionSide:  posSide,
-			PositionSize:  posSize,
-			AveragePrice:  avgPrice,
-			UnrealizedPnL: upl,
-			Margin:        margin,
-			Leverage:      leverage,
-			MarginMode:    marginMode,
+		payer := "longs pay shorts"
+		if rate < 0 {
+			payer = "shorts pay longs"
 		}
 
-		// Insert into database
-		if err := m.storage.InsertPosition(positionModel); err != nil {
-			m.logger.Error("Failed to insert position for %s: %v", pos.InstId, err)
-			return err
+		settleTime := data.FundingTime
+		if ms, err := strconv.ParseInt(data.FundingTime, 10, 64); err == nil {
+			settleTime = time.UnixMilli(ms).UTC().Format(time.RFC3339)
 		}
 
-		storedCount++
-		m.logger.Debug("Stored position for %s: side=%s, size=%.8f", pos.InstId, posSide, posSize)
+		m.logger.Info("Funding rate for %s (%s, size=%.8f): current=%.4f%% (%s), next=%s, settles at %s",
+			position.Instrument, position.PositionSide, position.PositionSize, rate*100, payer, data.NextFundingRate, settleTime)
 	}
-
-	m.logger.Info("Stored %d position records", storedCount)
-	return nil
 }
 
 // GetMetrics 获取监控指标 / Get monitoring metrics
+// 可与运行中的监控周期并发调用，返回同一时刻的一致快照
+// Safe to call concurrently with running cycles, returns a consistent snapshot
 func (m *Monitor) GetMetrics() map[string]interface{} {
+	retries := m.okxClient.Stats()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return map[string]interface{}{
-		"last_success":  m.lastSuccess,
-		"error_count":   m.errorCount,
-		"success_count": m.successCount,
+		"last_success":         m.lastSuccess,
+		"error_count":          m.errorCount,
+		"success_count":        m.successCount,
+		"consecutive_failures": m.consecutiveFailures,
+		"okx_retries":          retries.Retries,
+		"okx_rate_limited":     retries.RateLimited,
+		"okx_backoff":          retries.TotalBackoff,
+		"okx_retries_by_call":  retries.RetriesByCall,
 	}
 }
@@ -0,0 +1,779 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// newTestMonitor creates a monitor backed by a temporary database and a test OKX server
+func newTestMonitor(t *testing.T, handler http.HandlerFunc) *Monitor {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	db, err := storage.New(filepath.Join(tmpDir, "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	log, err := logger.New(filepath.Join(tmpDir, "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	cfg := &config.MonitoringConfig{Interval: 1, MarginRatioAlert: 3.0, LiqDistanceAlert: 0.05}
+	client := okx.New(server.URL, "key", "secret", "pass", 5, 0, false)
+	return New(client, db, log, alert.New(log, time.Minute), cfg)
+}
+
+func TestMarginRatioDangerous(t *testing.T) {
+	tests := []struct {
+		name      string
+		ratio     float64
+		threshold float64
+		expected  bool
+	}{
+		{"unknown ratio", 0, 3.0, false},
+		{"healthy ratio", 12.5, 3.0, false},
+		{"exactly at threshold", 3.0, 3.0, false},
+		{"below threshold", 2.5, 3.0, true},
+		{"near liquidation", 1.05, 3.0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marginRatioDangerous(tt.ratio, tt.threshold); got != tt.expected {
+				t.Errorf("marginRatioDangerous(%v, %v) = %v, want %v", tt.ratio, tt.threshold, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLiquidationDistance(t *testing.T) {
+	tests := []struct {
+		name     string
+		markPx   float64
+		liqPx    float64
+		expected float64
+		expectOk bool
+	}{
+		{"long far from liquidation", 50000, 40000, 0.2, true},
+		{"short far from liquidation", 50000, 60000, 0.2, true},
+		{"long near liquidation", 50000, 48000, 0.04, true},
+		{"no liquidation price", 50000, 0, 0, false},
+		{"no mark price", 0, 40000, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance, ok := liquidationDistance(tt.markPx, tt.liqPx)
+			if ok != tt.expectOk {
+				t.Fatalf("expected ok=%v, got %v", tt.expectOk, ok)
+			}
+			if math.Abs(distance-tt.expected) > 1e-9 {
+				t.Errorf("expected distance %v, got %v", tt.expected, distance)
+			}
+		})
+	}
+}
+
+func TestMonitorShutdownDrainsCycle(t *testing.T) {
+	var balanceCalls int32
+	cycleStarted := make(chan struct{})
+
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/balance":
+			// The first call is the health check, the second is the cycle we shut down during
+			if atomic.AddInt32(&balanceCalls, 1) == 2 {
+				close(cycleStarted)
+				time.Sleep(200 * time.Millisecond)
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"1000","mgnRatio":"","details":[]}]}`))
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	monitor.interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errChan := make(chan error, 1)
+	go func() { errChan <- monitor.Start(ctx) }()
+
+	select {
+	case <-cycleStarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("monitoring cycle did not start")
+	}
+
+	// Signal shutdown while the cycle is still in flight
+	cancel()
+
+	select {
+	case <-monitor.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("monitor did not drain after shutdown")
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metrics := monitor.GetMetrics()
+	if metrics["success_count"] != int64(1) {
+		t.Errorf("expected in-flight cycle to complete, success_count=%v", metrics["success_count"])
+	}
+	if got := atomic.LoadInt32(&balanceCalls); got != 2 {
+		t.Errorf("expected no new cycle after shutdown, got %d balance calls", got)
+	}
+}
+
+func TestFetchAndStorePositionsInstrumentFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruments []string
+		expected    []string
+	}{
+		{"empty list stores all", nil, []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP", "SOL-USDT-SWAP"}},
+		{"configured subset", []string{"BTC-USDT-SWAP", "SOL-USDT-SWAP"}, []string{"BTC-USDT-SWAP", "SOL-USDT-SWAP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v5/account/positions" {
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross"},
+						{"instId":"ETH-USDT-SWAP","posSide":"short","pos":"10","avgPx":"3000","mgnMode":"cross"},
+						{"instId":"SOL-USDT-SWAP","posSide":"long","pos":"5","avgPx":"100","mgnMode":"isolated"}]}`))
+					return
+				}
+				w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+			})
+			for _, instId := range tt.instruments {
+				monitor.instruments[instId] = true
+			}
+
+			if err := monitor.fetchAndStorePositions(); err != nil {
+				t.Fatalf("fetchAndStorePositions() error = %v", err)
+			}
+
+			positions, err := monitor.storage.GetLatestPositions()
+			if err != nil {
+				t.Fatalf("GetLatestPositions() error = %v", err)
+			}
+			if len(positions) != len(tt.expected) {
+				t.Fatalf("expected %d stored positions, got %d", len(tt.expected), len(positions))
+			}
+			for i, p := range positions {
+				if p.Instrument != tt.expected[i] {
+					t.Errorf("position %d: expected %s, got %s", i, tt.expected[i], p.Instrument)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchAndStorePositionsNotional(t *testing.T) {
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v5/account/positions" {
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross","notionalUsd":"1515.5"},
+				{"instId":"ETH-USDT-SWAP","posSide":"net","pos":"-10","avgPx":"3000","mgnMode":"cross","notionalUsd":"-300.25"},
+				{"instId":"SOL-USDT-SWAP","posSide":"long","pos":"5","avgPx":"100","mgnMode":"isolated","notionalUsd":""}]}`))
+			return
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+	})
+
+	if err := monitor.fetchAndStorePositions(); err != nil {
+		t.Fatalf("fetchAndStorePositions() error = %v", err)
+	}
+
+	positions, err := monitor.storage.GetLatestPositions()
+	if err != nil {
+		t.Fatalf("GetLatestPositions() error = %v", err)
+	}
+	expected := map[string]float64{"BTC-USDT-SWAP": 1515.5, "ETH-USDT-SWAP": 300.25, "SOL-USDT-SWAP": 0}
+	if len(positions) != len(expected) {
+		t.Fatalf("expected %d stored positions, got %d", len(expected), len(positions))
+	}
+	for _, p := range positions {
+		if p.NotionalUSD != expected[p.Instrument] {
+			t.Errorf("%s: expected notional %v, got %v", p.Instrument, expected[p.Instrument], p.NotionalUSD)
+		}
+	}
+}
+
+func TestRunCycleOKXMaintenance(t *testing.T) {
+	var maintenance atomic.Bool
+	maintenance.Store(true)
+
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		if maintenance.Load() {
+			w.Write([]byte(`{"code":"50013","msg":"Systems are busy, please try again later"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v5/account/balance":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"1000","mgnRatio":"","details":[]}]}`))
+		default:
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		}
+	})
+
+	monitor.runCycle()
+	monitor.runCycle()
+	if !monitor.alerter.IsActive(okxMaintenanceAlertKey) {
+		t.Error("expected OKX maintenance alert")
+	}
+	if metrics := monitor.GetMetrics(); metrics["error_count"] != int64(2) {
+		t.Errorf("expected 2 failed cycles, got %v", metrics["error_count"])
+	}
+
+	// Normal operation resumes once calls succeed again
+	maintenance.Store(false)
+	monitor.runCycle()
+	if monitor.alerter.IsActive(okxMaintenanceAlertKey) {
+		t.Error("expected maintenance alert to resolve after a successful cycle")
+	}
+	if metrics := monitor.GetMetrics(); metrics["success_count"] != int64(1) {
+		t.Errorf("expected 1 successful cycle, got %v", metrics["success_count"])
+	}
+}
+
+func TestMetricsConcurrentWithCycles(t *testing.T) {
+	var fail atomic.Bool
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v5/account/balance":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"1000","mgnRatio":"","details":[]}]}`))
+		default:
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		}
+	})
+
+	// Metrics are read while cycles update them, as the admin dashboard and watchdog do;
+	// run with -race to catch unsynchronized access
+	const cycles = 10
+	done := make(chan struct{})
+	readers := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { readers <- struct{}{} }()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					metrics := monitor.GetMetrics()
+					_ = metrics["last_success"].(time.Time)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < cycles; i++ {
+		fail.Store(i%2 == 1)
+		monitor.RunOnce()
+	}
+	close(done)
+	for i := 0; i < 4; i++ {
+		<-readers
+	}
+
+	metrics := monitor.GetMetrics()
+	if metrics["success_count"] != int64(cycles/2) || metrics["error_count"] != int64(cycles/2) {
+		t.Errorf("expected %d successes and %d errors, got %v and %v", cycles/2, cycles/2, metrics["success_count"], metrics["error_count"])
+	}
+	if metrics["last_success"].(time.Time).IsZero() {
+		t.Error("expected last_success to be set")
+	}
+}
+
+func TestPnLSwingExceeded(t *testing.T) {
+	tests := []struct {
+		name     string
+		prev     float64
+		cur      float64
+		absUSD   float64
+		pct      float64
+		expected bool
+	}{
+		{"disabled", 100, -5000, 0, 0, false},
+		{"absolute exceeded", 100, -500, 500, 0, true},
+		{"absolute not exceeded", 100, -300, 500, 0, false},
+		{"percentage exceeded", 1000, 400, 0, 0.5, true},
+		{"percentage not exceeded", 1000, 800, 0, 0.5, false},
+		{"percentage skipped at zero previous PnL", 0, 50, 0, 0.5, false},
+		{"either threshold triggers", 1000, 400, 5000, 0.5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pnlSwingExceeded(tt.prev, tt.cur, tt.absUSD, tt.pct); got != tt.expected {
+				t.Errorf("pnlSwingExceeded(%v, %v, %v, %v) = %v, expected %v", tt.prev, tt.cur, tt.absUSD, tt.pct, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchAndStorePositionsPnLSwing(t *testing.T) {
+	var upl atomic.Value
+	upl.Store("100")
+
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v5/account/positions" {
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","upl":"` + upl.Load().(string) + `","mgnMode":"cross"}]}`))
+			return
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+	})
+	monitor.pnlSwingUSD = 500
+	key := "pnl_swing:BTC-USDT-SWAP:long"
+
+	// The first snapshot has nothing to compare against
+	if err := monitor.fetchAndStorePositions(); err != nil {
+		t.Fatalf("fetchAndStorePositions() error = %v", err)
+	}
+	if monitor.alerter.IsActive(key) {
+		t.Error("expected no alert without a previous snapshot")
+	}
+
+	// A $900 drop since the previous snapshot alerts
+	upl.Store("-800")
+	if err := monitor.fetchAndStorePositions(); err != nil {
+		t.Fatalf("fetchAndStorePositions() error = %v", err)
+	}
+	if !monitor.alerter.IsActive(key) {
+		t.Error("expected PnL swing alert")
+	}
+
+	// A small move afterwards resolves the alert
+	upl.Store("-850")
+	if err := monitor.fetchAndStorePositions(); err != nil {
+		t.Fatalf("fetchAndStorePositions() error = %v", err)
+	}
+	if monitor.alerter.IsActive(key) {
+		t.Error("expected PnL swing alert to resolve after a small move")
+	}
+}
+
+func TestRunCycleConsecutiveFailures(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v5/account/balance":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"1000","mgnRatio":"","details":[]}]}`))
+		default:
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		}
+	})
+	monitor.maxFailures = 3
+
+	// Failures below the threshold keep the service running
+	for i := 0; i < 2; i++ {
+		if err := monitor.runCycle(); err != nil {
+			t.Fatalf("cycle %d: expected no error below threshold, got %v", i+1, err)
+		}
+	}
+
+	// A successful cycle resets the count
+	failing.Store(false)
+	if err := monitor.runCycle(); err != nil {
+		t.Fatalf("expected successful cycle, got %v", err)
+	}
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		if err := monitor.runCycle(); err != nil {
+			t.Fatalf("cycle %d after reset: expected no error below threshold, got %v", i+1, err)
+		}
+	}
+	if monitor.alerter.IsActive(monitorFailuresAlertKey) {
+		t.Error("expected no alert below threshold")
+	}
+
+	// The third consecutive failure returns an error and alerts
+	if err := monitor.runCycle(); err == nil {
+		t.Fatal("expected error at threshold")
+	}
+	if !monitor.alerter.IsActive(monitorFailuresAlertKey) {
+		t.Error("expected consecutive failures alert")
+	}
+	if metrics := monitor.GetMetrics(); metrics["consecutive_failures"] != 3 {
+		t.Errorf("expected 3 consecutive failures, got %v", metrics["consecutive_failures"])
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/balance":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"1500","mgnRatio":"","details":[
+				{"ccy":"USDT","eq":"1000","availBal":"900","frozenBal":"100","eqUsd":"1000"},
+				{"ccy":"BTC","eq":"0.01","availBal":"0.01","frozenBal":"0","eqUsd":"500"},
+				{"ccy":"DOGE","eq":"50","availBal":"50","frozenBal":"0","eqUsd":"5"}]}]}`))
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross"},
+				{"instId":"ETH-USDT-SWAP","posSide":"short","pos":"0","avgPx":"3000","mgnMode":"cross"}]}`))
+		case "/api/v5/public/funding-rate":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","fundingRate":"0.0001"}]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	if err := monitor.RunOnce(); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	// Only BTC, ETH and USDT balances are recorded
+	balances, err := monitor.storage.GetLatestAccountBalances()
+	if err != nil {
+		t.Fatalf("GetLatestAccountBalances() error = %v", err)
+	}
+	if len(balances) != 2 || balances[0].Currency != "BTC" || balances[1].Currency != "USDT" {
+		t.Fatalf("expected BTC and USDT balances, got %+v", balances)
+	}
+	if balances[1].Balance != 1000 || balances[1].Available != 900 || balances[1].Frozen != 100 {
+		t.Errorf("unexpected USDT balance: %+v", balances[1])
+	}
+
+	// Zero-size positions are skipped
+	positions, err := monitor.storage.GetLatestPositions()
+	if err != nil {
+		t.Fatalf("GetLatestPositions() error = %v", err)
+	}
+	if len(positions) != 1 || positions[0].Instrument != "BTC-USDT-SWAP" || positions[0].PositionSize != 3 {
+		t.Fatalf("expected one BTC-USDT-SWAP position of size 3, got %+v", positions)
+	}
+
+	metrics := monitor.GetMetrics()
+	if metrics["success_count"] != int64(1) || metrics["error_count"] != int64(0) {
+		t.Errorf("expected one successful cycle, got %v", metrics)
+	}
+}
+
+func TestUnexplainedBalanceChange(t *testing.T) {
+	tests := []struct {
+		name             string
+		prevBal, prevUpl float64
+		curBal, curUpl   float64
+		expected         float64
+	}{
+		{"no change", 10000, 0, 10000, 0, 0},
+		{"withdrawal without positions", 10000, 0, 4000, 0, -6000},
+		{"price move", 10000, 500, 9000, -500, 0},
+		{"position closed at a profit", 10500, 500, 10500, 0, 0},
+		{"deposit while holding", 10000, 500, 15000, 500, 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := &models.AccountBalance{Balance: tt.prevBal, UnrealizedPnL: tt.prevUpl}
+			cur := &models.AccountBalance{Balance: tt.curBal, UnrealizedPnL: tt.curUpl}
+			if got := unexplainedBalanceChange(prev, cur); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetchAndStoreBalancesChangeAlert(t *testing.T) {
+	var eq, upl atomic.Value
+	eq.Store("10000")
+	upl.Store("200")
+
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"` + eq.Load().(string) + `","details":[
+			{"ccy":"USDT","eq":"` + eq.Load().(string) + `","eqUsd":"` + eq.Load().(string) + `","availBal":"5000","frozenBal":"0","upl":"` + upl.Load().(string) + `"}]}]}`))
+	})
+	monitor.balanceUSD = 1000
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	monitor.clock = fake
+	key := "balance_change:USDT"
+
+	steps := []struct {
+		name        string
+		eq, upl     string
+		expectAlert bool
+	}{
+		{"first snapshot has nothing to compare against", "10000", "200", false},
+		{"PnL-driven drop does not alert", "8800", "-1000", false},
+		{"large unexplained drop alerts", "3800", "-1000", true},
+		{"stable balance afterwards resolves", "3790", "-1010", false},
+	}
+
+	for _, step := range steps {
+		eq.Store(step.eq)
+		upl.Store(step.upl)
+		fake.Advance(time.Minute)
+		if err := monitor.fetchAndStoreBalances(); err != nil {
+			t.Fatalf("%s: fetchAndStoreBalances() error = %v", step.name, err)
+		}
+		if got := monitor.alerter.IsActive(key); got != step.expectAlert {
+			t.Errorf("%s: expected alert active=%v, got %v", step.name, step.expectAlert, got)
+		}
+	}
+}
+
+func TestFetchAndStoreStorageDegraded(t *testing.T) {
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/balance":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"totalEq":"10000","details":[
+				{"ccy":"USDT","eq":"10000","eqUsd":"10000","availBal":"5000","frozenBal":"0"}]}]}`))
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"instId":"BTC-USDT-FUTURES","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross"}]}`))
+		default:
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		}
+	})
+
+	// Replace the storage with one whose file a second connection can break
+	dbPath := filepath.Join(t.TempDir(), "degraded.db")
+	db, err := storage.New(dbPath, true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	monitor.storage = db
+
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { raw.Close() })
+	tables := []string{"account_balances", "account_margin", "positions"}
+	for _, table := range tables {
+		if _, err := raw.Exec(`CREATE TRIGGER fail_` + table + ` BEFORE INSERT ON ` + table + ` BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+			t.Fatalf("failed to create trigger: %v", err)
+		}
+	}
+
+	// Every insert fails, yet the cycle completes and alerts
+	if err := monitor.RunOnce(); err != nil {
+		t.Fatalf("expected cycle to complete despite storage failures, got %v", err)
+	}
+	if !monitor.alerter.IsActive(storageDegradedAlertKey) {
+		t.Error("expected storage degraded alert")
+	}
+	if len(monitor.buffered) != 3 {
+		t.Errorf("expected balance, margin and position buffered, got %d", len(monitor.buffered))
+	}
+
+	// Once writes work again the buffered records are stored and the alert resolves
+	for _, table := range tables {
+		if _, err := raw.Exec(`DROP TRIGGER fail_` + table); err != nil {
+			t.Fatalf("failed to drop trigger: %v", err)
+		}
+	}
+	if err := monitor.RunOnce(); err != nil {
+		t.Fatalf("unexpected error after recovery: %v", err)
+	}
+	if monitor.alerter.IsActive(storageDegradedAlertKey) || len(monitor.buffered) != 0 {
+		t.Errorf("expected alert resolved and buffer empty, got active=%v buffered=%d",
+			monitor.alerter.IsActive(storageDegradedAlertKey), len(monitor.buffered))
+	}
+
+	history, err := db.GetPositionHistory("BTC-USDT-FUTURES", time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to load position history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("expected the buffered and the new position snapshot stored, got %d", len(history))
+	}
+}
+
+func TestDiffPositions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	position := func(instId string, side models.PositionSide, size float64) *models.Position {
+		return &models.Position{Instrument: instId, PositionSide: side, PositionSize: size, AveragePrice: 100}
+	}
+	snapshot := func(positions ...*models.Position) map[string]models.Position {
+		m := make(map[string]models.Position, len(positions))
+		for _, p := range positions {
+			m[positionKey(p)] = *p
+		}
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		previous map[string]models.Position
+		current  []*models.Position
+		expected []models.PositionEventType
+	}{
+		{"first run opens everything", nil,
+			[]*models.Position{position("BTC-USDT-SWAP", models.PositionSideLong, 1), position("ETH-USDT-SWAP", models.PositionSideShort, 2)},
+			[]models.PositionEventType{models.PositionEventOpened, models.PositionEventOpened}},
+		{"unchanged size", snapshot(position("BTC-USDT-SWAP", models.PositionSideLong, 1)),
+			[]*models.Position{position("BTC-USDT-SWAP", models.PositionSideLong, 1)}, nil},
+		{"decreased", snapshot(position("BTC-USDT-SWAP", models.PositionSideLong, 3)),
+			[]*models.Position{position("BTC-USDT-SWAP", models.PositionSideLong, 1)},
+			[]models.PositionEventType{models.PositionEventDecreased}},
+		{"net short increased", snapshot(position("BTC-USDT-SWAP", models.PositionSideNet, -1)),
+			[]*models.Position{position("BTC-USDT-SWAP", models.PositionSideNet, -2)},
+			[]models.PositionEventType{models.PositionEventIncreased}},
+		{"net reversal closes then opens", snapshot(position("BTC-USDT-SWAP", models.PositionSideNet, 2)),
+			[]*models.Position{position("BTC-USDT-SWAP", models.PositionSideNet, -1)},
+			[]models.PositionEventType{models.PositionEventClosed, models.PositionEventOpened}},
+		{"gone is closed", snapshot(position("BTC-USDT-SWAP", models.PositionSideLong, 1)), nil,
+			[]models.PositionEventType{models.PositionEventClosed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := diffPositions(tt.previous, tt.current, now)
+			if len(events) != len(tt.expected) {
+				t.Fatalf("expected %d events, got %+v", len(tt.expected), events)
+			}
+			for i, event := range events {
+				if event.EventType != tt.expected[i] {
+					t.Errorf("event %d: expected %s, got %s", i, tt.expected[i], event.EventType)
+				}
+				if !event.Timestamp.Equal(now) {
+					t.Errorf("event %d: expected timestamp %v, got %v", i, now, event.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchAndStorePositionsEvents(t *testing.T) {
+	var positions atomic.Value
+	positions.Store(`{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross"},
+		{"instId":"ETH-USDT-SWAP","posSide":"short","pos":"2","avgPx":"3000","mgnMode":"cross"}`)
+
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v5/account/positions" {
+			w.Write([]byte(`{"code":"0","msg":"","data":[` + positions.Load().(string) + `]}`))
+			return
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+	})
+	start := time.Now().Add(-time.Minute)
+
+	type change struct {
+		instId    string
+		eventType models.PositionEventType
+		prev, cur float64
+	}
+	seen := 0
+	cycle := func(body string) []change {
+		t.Helper()
+		positions.Store(body)
+		if err := monitor.fetchAndStorePositions(); err != nil {
+			t.Fatalf("fetchAndStorePositions() error = %v", err)
+		}
+		events, err := monitor.storage.GetPositionEventsByTimeRange(start, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("GetPositionEventsByTimeRange() error = %v", err)
+		}
+		// Only the events recorded by this cycle
+		events, seen = events[seen:], len(events)
+		var changes []change
+		for _, e := range events {
+			changes = append(changes, change{e.Instrument, e.EventType, e.PreviousSize, e.Size})
+		}
+		return changes
+	}
+	assertChanges := func(step string, got, expected []change) {
+		t.Helper()
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected %+v, got %+v", step, expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("%s: event %d expected %+v, got %+v", step, i, expected[i], got[i])
+			}
+		}
+	}
+
+	// The first snapshot has no history, everything is opened
+	assertChanges("first snapshot", cycle(positions.Load().(string)), []change{
+		{"BTC-USDT-SWAP", models.PositionEventOpened, 0, 3},
+		{"ETH-USDT-SWAP", models.PositionEventOpened, 0, 2},
+	})
+
+	// BTC grows, ETH is closed
+	second := `{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"5","avgPx":"50500","mgnMode":"cross"}`
+	assertChanges("second snapshot", cycle(second), []change{
+		{"BTC-USDT-SWAP", models.PositionEventIncreased, 3, 5},
+		{"ETH-USDT-SWAP", models.PositionEventClosed, 2, 0},
+	})
+
+	// After a restart the event log is the previous state, so nothing is recorded again
+	monitor.lastHeld = nil
+	assertChanges("after restart", cycle(second), nil)
+
+	// No positions at all closes what was left
+	assertChanges("flat", cycle(""), []change{
+		{"BTC-USDT-SWAP", models.PositionEventClosed, 5, 0},
+	})
+
+	all, err := monitor.storage.GetPositionEventsByTimeRange(start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetPositionEventsByTimeRange() error = %v", err)
+	}
+	if len(all) != 5 {
+		t.Errorf("expected 5 events in total, got %d", len(all))
+	}
+}
+
+func TestStartupDelay(t *testing.T) {
+	tests := []struct {
+		name  string
+		bound time.Duration
+	}{
+		{"disabled", 0},
+		{"one second", time.Second},
+		{"thirty seconds", 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				delay := startupDelay(tt.bound)
+				if delay < 0 || delay > tt.bound {
+					t.Fatalf("delay %v outside [0, %v]", delay, tt.bound)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+)
+
+// watchdogAlertKey 看门狗告警键 / Alert key used by the watchdog
+const watchdogAlertKey = "watchdog"
+
+// cancelBatchSize OKX每次撤销算法订单的最大数量 / Maximum algo orders per cancel-algos request
+const cancelBatchSize = 10
+
+// watchdogOrdTypes 看门狗撤销的算法订单类型 / Algo order types cancelled by the watchdog
+var watchdogOrdTypes = []string{"conditional", "oco", "trigger", "move_order_stop"}
+
+// Watchdog 监控看门狗 / Monitoring watchdog (dead man's switch)
+// 监控服务在超时时间内没有成功周期时，按配置告警、撤销算法订单或平仓
+// When the monitor has had no successful cycle within the timeout, alert, cancel algo
+// orders or close positions as configured
+type Watchdog struct {
+	monitor   *Monitor
+	okxClient OKXAPI
+	logger    *logger.Logger
+	alerter   *alert.Alerter
+	timeout   time.Duration
+	action    string
+	clock     clock.Clock // taken from the monitor so both share one time source
+	startedAt time.Time   // reference point while the monitor has never succeeded
+	fired     bool        // action already taken for the current outage
+	done      chan struct{}
+}
+
+// NewWatchdog 创建监控看门狗 / Create monitoring watchdog
+//
+// Parameters:
+//   - monitor: Monitoring service whose last successful cycle is watched
+//   - okxClient: OKX API client used for cancel and close actions
+//   - logger: Logger instance
+//   - alerter: Alerter for watchdog alerts
+//   - cfg: Watchdog configuration (timeout and action)
+//
+// Returns:
+//   - *Watchdog: 看门狗实例 / Watchdog instance
+func NewWatchdog(monitor *Monitor, okxClient OKXAPI, logger *logger.Logger, alerter *alert.Alerter, cfg *config.WatchdogConfig) *Watchdog {
+	return &Watchdog{
+		monitor:   monitor,
+		okxClient: okxClient,
+		logger:    logger,
+		alerter:   alerter,
+		timeout:   time.Duration(cfg.Timeout) * time.Second,
+		action:    cfg.Action,
+		clock:     monitor.clock,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 启动看门狗 / Start watchdog
+// 在后台定期检查监控服务的最近成功时间，ctx取消后退出
+// Periodically check the monitor's last success in the background until ctx is cancelled
+//
+// Parameters:
+//   - ctx: 控制看门狗生命周期的上下文 / Context controlling the watchdog lifetime
+func (w *Watchdog) Start(ctx context.Context) {
+	w.startedAt = w.clock.Now()
+
+	interval := w.timeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	w.logger.Info("Monitoring watchdog started: timeout %v, action %s", w.timeout, w.action)
+
+	go w.run(ctx, interval)
+}
+
+// Done 返回看门狗退出时关闭的通道 / Return channel closed when the watchdog has exited
+func (w *Watchdog) Done() <-chan struct{} {
+	return w.done
+}
+
+// run 运行检查循环 / Run check loop
+func (w *Watchdog) run(ctx context.Context, interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Monitoring watchdog stopped")
+			return
+		case <-ticker.C:
+			if ctx.Err() != nil {
+				w.logger.Info("Monitoring watchdog stopped")
+				return
+			}
+			w.check()
+		}
+	}
+}
+
+// check 检查监控服务是否超时并执行动作 / Check the monitor for a timeout and act on it
+// 每次中断只执行一次动作；动作失败时下次检查重试；监控恢复后重新布防
+// The action runs once per outage; a failed action is retried on the next check,
+// and the watchdog re-arms once the monitor recovers
+func (w *Watchdog) check() {
+	reference, _ := w.monitor.GetMetrics()["last_success"].(time.Time)
+	if reference.IsZero() {
+		reference = w.startedAt
+	}
+
+	silent := w.clock.Now().Sub(reference)
+	if silent < w.timeout {
+		if w.fired {
+			w.logger.Info("Monitoring recovered, watchdog re-armed")
+			w.alerter.Resolve(watchdogAlertKey)
+			w.fired = false
+		}
+		return
+	}
+
+	if w.fired {
+		return
+	}
+
+	w.alerter.Alert(watchdogAlertKey, "No successful monitoring cycle for %v (timeout %v), watchdog action: %s",
+		silent.Truncate(time.Second), w.timeout, w.action)
+
+	if err := w.act(); err != nil {
+		w.logger.Error("Watchdog action %s failed, retrying on next check: %v", w.action, err)
+		return
+	}
+
+	w.fired = true
+}
+
+// act 执行配置的动作 / Perform the configured action
+func (w *Watchdog) act() error {
+	switch w.action {
+	case "cancel":
+		return w.cancelAlgoOrders()
+	case "close":
+		if err := w.cancelAlgoOrders(); err != nil {
+			return err
+		}
+		return w.closePositions()
+	default:
+		return nil // alert only
+	}
+}
+
+// cancelAlgoOrders 撤销所有待处理的算法订单 / Cancel every pending algo order
+func (w *Watchdog) cancelAlgoOrders() error {
+	var orders []okx.CancelAlgoOrderRequest
+	for _, ordType := range watchdogOrdTypes {
+		resp, err := w.okxClient.GetPendingAlgoOrders(ordType)
+		if err != nil {
+			return fmt.Errorf("failed to get pending %s algo orders: %w", ordType, err)
+		}
+		for _, order := range resp.Data {
+			orders = append(orders, okx.CancelAlgoOrderRequest{AlgoId: order.AlgoId, InstId: order.InstId})
+		}
+	}
+
+	for start := 0; start < len(orders); start += cancelBatchSize {
+		end := start + cancelBatchSize
+		if end > len(orders) {
+			end = len(orders)
+		}
+		if _, err := w.okxClient.CancelAlgoOrders(orders[start:end]); err != nil {
+			return fmt.Errorf("failed to cancel algo orders: %w", err)
+		}
+	}
+
+	w.logger.Warn("Watchdog cancelled %d pending algo orders", len(orders))
+	return nil
+}
+
+// closePositions 市价平掉所有持仓 / Close every open position at market
+// 单个持仓平仓失败不影响其他持仓，最后返回失败数量
+// A failure on one position does not stop the others; the failure count is returned at the end
+func (w *Watchdog) closePositions() error {
+	resp, err := w.okxClient.GetPositions()
+	if err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+
+	closed, failed := 0, 0
+	for _, pos := range resp.Data {
+		if okx.ParseOptionalFloat(pos.Pos) == 0 {
+			continue
+		}
+
+		posSide := pos.PosSide
+		if posSide == "net" {
+			posSide = "" // Net mode closes without posSide
+		}
+
+		if _, err := w.okxClient.ClosePosition(pos.InstId, pos.MgnMode, posSide); err != nil {
+			w.logger.Error("Watchdog failed to close %s (%s): %v", pos.InstId, pos.PosSide, err)
+			failed++
+			continue
+		}
+		w.logger.Warn("Watchdog closed position %s (%s), size %s", pos.InstId, pos.PosSide, pos.Pos)
+		closed++
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to close %d of %d positions", failed, closed+failed)
+	}
+	return nil
+}
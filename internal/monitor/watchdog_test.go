@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+)
+
+func TestWatchdogTrigger(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		expectCancel int
+		expectClose  int
+	}{
+		{"alert only", "alert", 0, 0},
+		{"cancel algo orders", "cancel", 1, 0},
+		{"close positions", "close", 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			cancels, closes := 0, 0
+
+			monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				switch r.URL.Path {
+				case "/api/v5/trade/orders-algo-pending":
+					if r.URL.Query().Get("ordType") == "conditional" {
+						w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"sl1","instId":"BTC-USDT-SWAP"}]}`))
+						return
+					}
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/trade/cancel-algos":
+					cancels++
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"sl1","sCode":"0"}]}`))
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","mgnMode":"cross"},
+						{"instId":"ETH-USDT-SWAP","posSide":"long","pos":"0","mgnMode":"cross"}]}`))
+				case "/api/v5/trade/close-position":
+					closes++
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","posSide":"long"}]}`))
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+
+			alerter := alert.New(monitor.logger, time.Minute)
+			watchdog := NewWatchdog(monitor, monitor.okxClient, monitor.logger, alerter,
+				&config.WatchdogConfig{Timeout: 600, Action: tt.action})
+
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			watchdog.clock = fake
+			watchdog.startedAt = fake.Now()
+			monitor.lastSuccess = fake.Now()
+
+			// Within the timeout nothing happens
+			fake.Advance(9 * time.Minute)
+			watchdog.check()
+			if alerter.IsActive(watchdogAlertKey) || cancels != 0 || closes != 0 {
+				t.Fatalf("watchdog fired before timeout")
+			}
+
+			// Past the timeout the configured action runs once
+			fake.Advance(2 * time.Minute)
+			watchdog.check()
+			watchdog.check()
+			if !alerter.IsActive(watchdogAlertKey) {
+				t.Error("expected watchdog alert")
+			}
+			if cancels != tt.expectCancel || closes != tt.expectClose {
+				t.Errorf("expected %d cancels and %d closes, got %d and %d", tt.expectCancel, tt.expectClose, cancels, closes)
+			}
+
+			// A successful cycle re-arms the watchdog
+			monitor.lastSuccess = fake.Now()
+			watchdog.check()
+			if alerter.IsActive(watchdogAlertKey) || watchdog.fired {
+				t.Error("expected watchdog to re-arm after recovery")
+			}
+		})
+	}
+}
+
+func TestWatchdogNeverSucceeded(t *testing.T) {
+	monitor := newTestMonitor(t, func(w http.ResponseWriter, r *http.Request) {})
+	alerter := alert.New(monitor.logger, time.Minute)
+	watchdog := NewWatchdog(monitor, monitor.okxClient, monitor.logger, alerter,
+		&config.WatchdogConfig{Timeout: 600, Action: "alert"})
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	watchdog.clock = fake
+	watchdog.startedAt = fake.Now()
+
+	// Without any successful cycle the timeout counts from watchdog start
+	fake.Advance(5 * time.Minute)
+	watchdog.check()
+	if alerter.IsActive(watchdogAlertKey) {
+		t.Error("watchdog fired before timeout since start")
+	}
+
+	fake.Advance(6 * time.Minute)
+	watchdog.check()
+	if !alerter.IsActive(watchdogAlertKey) {
+		t.Error("expected watchdog alert when monitor never succeeded")
+	}
+}
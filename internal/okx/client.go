@@ -1,15 +1,22 @@
 package okx
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
 )
 
 // Client OKX API客户端 / OKX API client
@@ -19,8 +26,184 @@ type Client struct {
 	apiSecret   string
 	passphrase  string
 	httpClient  *http.Client
+	timeout     time.Duration            // per-request deadline for endpoints without an override
+	timeouts    map[string]time.Duration // per-request deadlines keyed by endpoint path
 	maxRetries  int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	jitter      float64 // fraction of each backoff that is randomized, 1 = full jitter
 	debugEnable bool
+
+	maintenanceBackoff time.Duration // wait before retrying a maintenance response
+	inMaintenance      atomic.Bool   // set by maintenance responses, cleared by the next success
+
+	// simulated marks every request for OKX demo trading, which needs demo API keys
+	simulated bool
+
+	// logger receives the debug dump of requests and responses, nil discards it
+	logger *logger.Logger
+
+	// failover switches between OKX domains, nil when only apiURL is configured
+	failover *failover
+
+	clock clock.Clock // request timestamps and retry backoff sleeps
+
+	statsMu sync.Mutex // guards stats
+	stats   RetryStats
+}
+
+// RetryStats 重试统计 / Retry statistics
+// 用于判断失败主要来自限流还是网络不稳定，以调整重试参数
+// Helps tell whether failures come from rate limits or network flakiness when tuning retries
+type RetryStats struct {
+	Retries       int64            `json:"retries"`          // retries across all requests
+	RetriesByCall map[string]int64 `json:"retries_by_call"`  // retries keyed by "METHOD /path"
+	RateLimited   int64            `json:"rate_limited"`     // 429 responses received
+	TotalBackoff  time.Duration    `json:"total_backoff_ns"` // total time slept between retries
+}
+
+// defaultBaseBackoff 默认首次重试退避时间 / Default backoff before the first retry
+const defaultBaseBackoff = time.Second
+
+// defaultMaxBackoff 默认最大重试退避时间 / Default ceiling for retry backoff
+const defaultMaxBackoff = 30 * time.Second
+
+// defaultMaintenanceBackoff 默认维护期间的重试等待时间 / Default wait before retrying during maintenance
+const defaultMaintenanceBackoff = time.Minute
+
+// Option 客户端可选配置 / Optional client configuration
+type Option func(*Client)
+
+// WithHTTPClient 设置HTTP客户端 / Set HTTP client
+// 用于注入自定义Transport（如测试桩、代理），nil保持默认客户端
+// Used to inject a custom transport (e.g., test stub, proxy), nil keeps the default client
+//
+// Parameters:
+//   - httpClient: HTTP客户端，替换按timeout创建的默认客户端 / HTTP client replacing the default one built from timeout
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithMaxBackoff 设置最大重试退避时间 / Set ceiling for retry backoff
+// 指数退避超过该值后被截断，非正值保持默认30秒
+// Exponential backoff is capped at this value, non-positive values keep the 30s default
+//
+// Parameters:
+//   - d: 最大退避时间 / Maximum backoff duration
+func WithMaxBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.maxBackoff = d
+		}
+	}
+}
+
+// WithBaseBackoff 设置首次重试退避时间 / Set backoff before the first retry
+// 之后每次重试翻倍，非正值保持默认1秒
+// Doubled on each further retry, non-positive values keep the 1s default
+//
+// Parameters:
+//   - d: 首次重试退避时间 / Backoff before the first retry
+func WithBaseBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.baseBackoff = d
+		}
+	}
+}
+
+// WithJitterFraction 设置退避抖动比例 / Set backoff jitter fraction
+// 每次退避在[(1-f)×退避, 退避]内随机取值；1为全抖动（默认），0为固定退避；超出[0, 1]的值被忽略
+// Each backoff is drawn from [(1-f)×backoff, backoff]; 1 is full jitter (default), 0 is a fixed
+// backoff; values outside [0, 1] are ignored
+//
+// Parameters:
+//   - f: 抖动比例 / Jitter fraction
+func WithJitterFraction(f float64) Option {
+	return func(c *Client) {
+		if f >= 0 && f <= 1 {
+			c.jitter = f
+		}
+	}
+}
+
+// WithMaintenanceBackoff 设置维护期间的重试等待时间 / Set wait before retrying during maintenance
+// 维护响应后不使用指数退避，而是固定等待该时间，非正值保持默认1分钟
+// After a maintenance response this fixed wait replaces the exponential backoff,
+// non-positive values keep the 1 minute default
+//
+// Parameters:
+//   - d: 维护重试等待时间 / Wait before retrying a maintenance response
+func WithMaintenanceBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.maintenanceBackoff = d
+		}
+	}
+}
+
+// WithRequestTimeouts 设置按端点的请求超时 / Set per-endpoint request timeouts
+// 键为不含查询参数的端点路径（如"/api/v5/trade/order-algo"），未列出的端点使用客户端超时；
+// 非正值被忽略
+// Keys are endpoint paths without the query (e.g., "/api/v5/trade/order-algo"), endpoints not
+// listed use the client timeout; non-positive values are ignored
+//
+// Parameters:
+//   - timeouts: 端点路径到超时时间的映射 / Map of endpoint path to timeout
+func WithRequestTimeouts(timeouts map[string]time.Duration) Option {
+	return func(c *Client) {
+		for path, d := range timeouts {
+			if d > 0 {
+				c.timeouts[path] = d
+			}
+		}
+	}
+}
+
+// WithClock 设置时钟 / Set clock
+// 用于请求时间戳和重试退避等待，测试中可注入clock.Fake；nil保持系统时钟
+// Used for request timestamps and retry backoff waits, tests can inject a clock.Fake; nil keeps
+// the system clock
+//
+// Parameters:
+//   - clk: 时钟 / Clock
+func WithClock(clk clock.Clock) Option {
+	return func(c *Client) {
+		if clk != nil {
+			c.clock = clk
+		}
+	}
+}
+
+// WithSimulatedTrading 使用OKX模拟盘 / Use OKX demo trading
+// 每个请求添加x-simulated-trading: 1，需要使用模拟盘API密钥；订单不会动用真实资金
+// Adds x-simulated-trading: 1 to every request, which needs demo trading API keys; orders never
+// touch real funds
+//
+// Parameters:
+//   - enabled: 是否使用模拟盘 / Whether to use demo trading
+func WithSimulatedTrading(enabled bool) Option {
+	return func(c *Client) {
+		c.simulated = enabled
+	}
+}
+
+// WithLogger 设置调试输出的日志记录器 / Set the logger for debug output
+// debugEnable开启时请求和响应以DEBUG级别写入该日志，经过屏蔽并写入配置的输出；
+// 未设置时不输出调试信息
+// With debugEnable on, requests and responses are logged at DEBUG level through it, so they are
+// masked and go to the configured sinks; without one no debug output is written
+//
+// Parameters:
+//   - log: 日志记录器 / Logger
+func WithLogger(log *logger.Logger) Option {
+	return func(c *Client) {
+		c.logger = log
+	}
 }
 
 // New 创建新的OKX客户端 / Create new OKX client
@@ -32,24 +215,39 @@ type Client struct {
 //   - apiKey: API key from OKX account settings
 //   - apiSecret: API secret corresponding to the API key
 //   - passphrase: API passphrase set during key creation
-//   - timeout: HTTP request timeout in seconds
+//   - timeout: HTTP request timeout in seconds, applied per attempt unless overridden by WithRequestTimeouts
 //   - maxRetries: Maximum retry attempts on request failure
-//   - debugEnable: Whether to print API responses for debugging
+//   - debugEnable: Whether to log API requests and responses at DEBUG level, see WithLogger
+//   - opts: 可选配置，如WithMaxBackoff、WithBaseBackoff、WithHTTPClient
+//     Optional settings such as WithMaxBackoff, WithBaseBackoff, WithHTTPClient
 //
 // Returns:
 //   - *Client: 配置完成的OKX客户端实例 / Configured OKX client instance ready for API calls
-func New(apiURL, apiKey, apiSecret, passphrase string, timeout, maxRetries int, debugEnable bool) *Client {
-	return &Client{
+func New(apiURL, apiKey, apiSecret, passphrase string, timeout, maxRetries int, debugEnable bool, opts ...Option) *Client {
+	c := &Client{
 		apiURL:      apiURL,
 		apiKey:      apiKey,
 		apiSecret:   apiSecret,
 		passphrase:  passphrase,
-		httpClient:  &http.Client{
-			Timeout: time.Duration(timeout) * time.Second,
-		},
+		// Deadlines are set per request so endpoints can use different timeouts
+		httpClient:  &http.Client{},
+		timeout:     time.Duration(timeout) * time.Second,
+		timeouts:    make(map[string]time.Duration),
 		maxRetries:  maxRetries,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		jitter:      1,
 		debugEnable: debugEnable,
+		stats:       RetryStats{RetriesByCall: make(map[string]int64)},
+
+		maintenanceBackoff: defaultMaintenanceBackoff,
+
+		clock: clock.Real{},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // generateSignature 生成API签名 / Generate API signature
@@ -81,11 +279,18 @@ func New(apiURL, apiKey, apiSecret, passphrase string, timeout, maxRetries int,
 //   - string: Base64编码的HMAC-SHA256签名 / Base64-encoded HMAC-SHA256 signature
 //     用于OK-ACCESS-SIGN请求头 / Used in OK-ACCESS-SIGN request header
 func (c *Client) generateSignature(timestamp, method, requestPath, body string) string {
+	return sign(c.apiSecret, timestamp, method, requestPath, body)
+}
+
+// sign 计算OKX签名 / Compute OKX signature
+// REST请求和WebSocket登录共用的HMAC-SHA256签名算法，详见generateSignature
+// HMAC-SHA256 signature shared by REST requests and WebSocket login, see generateSignature
+func sign(secret, timestamp, method, requestPath, body string) string {
 	// Create prehash string: timestamp + method + requestPath + body
 	prehash := timestamp + method + requestPath + body
 
 	// Calculate HMAC SHA256
-	h := hmac.New(sha256.New, []byte(c.apiSecret))
+	h := hmac.New(sha256.New, []byte(secret))
 	h.Write([]byte(prehash))
 
 	// Encode to base64
@@ -98,9 +303,11 @@ func (c *Client) generateSignature(timestamp, method, requestPath, body string)
 //
 // 重试算法详解 / Retry Algorithm Details:
 // - 初始尝试 + 最多maxRetries次重试 / Initial attempt + up to maxRetries retries
-// - 指数退避策略: 第n次重试等待 2^(n-1) 秒 / Exponential backoff: nth retry waits 2^(n-1) seconds
-//   例如 / Example: 1st retry = 1s, 2nd retry = 2s, 3rd retry = 4s
-// - 仅在可恢复错误时重试（网络错误、429限流）/ Retry only on recoverable errors (network errors, 429 rate limits)
+// - 指数退避策略: 第n次重试等待 baseBackoff*2^(n-1) / Exponential backoff: nth retry waits baseBackoff*2^(n-1)
+//   例如 / Example: 1st retry = 1s, 2nd retry = 2s, 3rd retry = 4s (默认基础值 / default base)
+// - 抖动比例决定从该等待时间中随机扣减的部分 / The jitter fraction sets how much of that wait is randomized away
+// - 仅在可恢复错误时重试（网络错误、429限流、维护）/ Retry only on recoverable errors (network errors, 429 rate limits, maintenance)
+// - 维护响应后固定等待maintenanceBackoff / After a maintenance response wait a fixed maintenanceBackoff
 // - 其他错误立即返回 / Other errors return immediately
 //
 // Parameters:
@@ -128,18 +335,24 @@ func (c *Client) doRequest(method, path string) ([]byte, error) {
 //   - []byte: API响应的原始字节数据 / Raw byte data from API response
 //   - error: 请求失败时返回错误（所有重试均失败后）/ Error on request failure (after all retries exhausted)
 func (c *Client) doRequestWithBody(method, path, body string) ([]byte, error) {
-	url := c.apiURL + path
-
 	var lastErr error
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff: 1s, 2s, 4s
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
-			time.Sleep(backoff)
+			wait := backoffDuration(attempt, c.baseBackoff, c.maxBackoff, c.jitter)
+			if IsMaintenance(lastErr) {
+				// Maintenance lasts minutes, retrying on the short backoff only adds load
+				wait = c.maintenanceBackoff
+			}
+			c.recordRetry(method, path, wait)
+			c.clock.Sleep(wait)
 		}
 
+		// Chosen per attempt, so a retry after a failover goes to the new domain
+		base := c.baseURL()
+		url := base + path
+
 		// Generate timestamp (ISO8601 format)
-		timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+		timestamp := c.clock.Now().UTC().Format("2006-01-02T15:04:05.000Z")
 
 		// Generate signature
 		signature := c.generateSignature(timestamp, method, path, body)
@@ -149,8 +362,10 @@ func (c *Client) doRequestWithBody(method, path, body string) ([]byte, error) {
 		if body != "" {
 			reqBody = strings.NewReader(body)
 		}
-		req, err := http.NewRequest(method, url, reqBody)
+		ctx, cancel := c.requestContext(path)
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 		if err != nil {
+			cancel()
 			lastErr = fmt.Errorf("failed to create request: %w", err)
 			continue
 		}
@@ -161,47 +376,70 @@ func (c *Client) doRequestWithBody(method, path, body string) ([]byte, error) {
 		req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
 		req.Header.Set("OK-ACCESS-PASSPHRASE", c.passphrase)
 		req.Header.Set("Content-Type", "application/json")
+		if c.simulated {
+			req.Header.Set("x-simulated-trading", "1")
+		}
 
 		// Execute request
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
+			cancel()
+			c.recordDomainResult(base, true)
 			lastErr = fmt.Errorf("request failed: %w", err)
 			continue
 		}
 		defer resp.Body.Close()
 
-		// Read response body
+		// Read response body, the deadline covers the read as well
 		respBody, err := io.ReadAll(resp.Body)
+		cancel()
 		if err != nil {
+			c.recordDomainResult(base, true)
 			lastErr = fmt.Errorf("failed to read response body: %w", err)
 			continue
 		}
+		// Maintenance is exchange-wide, switching domains would not help
+		c.recordDomainResult(base, resp.StatusCode >= 500 && maintenanceError(resp.StatusCode, respBody) == nil)
 
-		// Debug: print API response if enabled
-		if c.debugEnable {
-			fmt.Printf("\n=== OKX API Debug ===\n")
-			fmt.Printf("Request: %s %s\n", method, path)
+		// Debug: log the exchange through the logger so it is masked
+		if c.debugEnable && c.logger != nil {
 			if body != "" {
-				fmt.Printf("Request Body: %s\n", body)
+				c.logger.Debug("OKX API request %s %s: %s", method, path, body)
+			}
+			c.logger.Debug("OKX API response %s %s: status %d: %s", method, path, resp.StatusCode, respBody)
+		}
+
+		if err := maintenanceError(resp.StatusCode, respBody); err != nil {
+			c.inMaintenance.Store(true)
+			if method != http.MethodGet && resp.StatusCode != http.StatusServiceUnavailable {
+				// A code in a response means OKX received the request and its outcome is unknown,
+				// resending an order could place it twice; the next check reconciles instead
+				return nil, fmt.Errorf("request failed without retry: %w", err)
 			}
-			fmt.Printf("Status Code: %d\n", resp.StatusCode)
-			fmt.Printf("Response Body: %s\n", string(respBody))
-			fmt.Printf("=====================\n\n")
+			lastErr = err
+			continue
 		}
 
 		// Check status code
 		if resp.StatusCode == http.StatusTooManyRequests {
 			// Rate limited, retry with backoff
+			c.recordRateLimited()
 			lastErr = fmt.Errorf("rate limited (429)")
 			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+			statusErr := newStatusError(resp.StatusCode, respBody)
+			if !statusErr.Retryable() {
+				// Auth and validation failures repeat identically, fail without spending the backoff
+				return nil, fmt.Errorf("request failed without retry: %w", statusErr)
+			}
+			lastErr = statusErr
 			continue
 		}
 
 		// Success
+		c.inMaintenance.Store(false)
 		return respBody, nil
 	}
 
@@ -209,6 +447,146 @@ func (c *Client) doRequestWithBody(method, path, body string) ([]byte, error) {
 	return nil, fmt.Errorf("request failed after %d retries: %w", c.maxRetries, lastErr)
 }
 
+// maintenanceError 识别维护响应 / Recognize a maintenance response
+// HTTP 503或响应码属于maintenanceCodes时返回MaintenanceError
+// Returns a MaintenanceError on HTTP 503 or when the response code is one of maintenanceCodes
+//
+// Parameters:
+//   - statusCode: HTTP状态码 / HTTP status code
+//   - body: 响应体 / Response body
+//
+// Returns:
+//   - error: 维护错误，非维护响应时为nil / Maintenance error, nil for other responses
+func maintenanceError(statusCode int, body []byte) error {
+	var resp struct {
+		Code string `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	json.Unmarshal(body, &resp) // Bodies that aren't JSON simply have no code
+
+	if maintenanceCodes[resp.Code] {
+		return &MaintenanceError{Code: resp.Code, Msg: resp.Msg}
+	}
+	if statusCode == http.StatusServiceUnavailable {
+		return &MaintenanceError{Code: fmt.Sprintf("HTTP %d", statusCode), Msg: resp.Msg}
+	}
+	return nil
+}
+
+// newStatusError 解析非200响应 / Parse a non-200 response
+//
+// Parameters:
+//   - statusCode: HTTP状态码 / HTTP status code
+//   - body: 响应体 / Response body
+//
+// Returns:
+//   - *StatusError: 状态错误 / Status error
+func newStatusError(statusCode int, body []byte) *StatusError {
+	var resp struct {
+		Code string `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	json.Unmarshal(body, &resp) // Bodies that aren't JSON simply have no code
+
+	return &StatusError{StatusCode: statusCode, Code: resp.Code, Msg: resp.Msg, Body: string(body)}
+}
+
+// InMaintenance 判断OKX是否处于维护中 / Whether OKX is in maintenance
+// 收到维护响应后为true，下一次请求成功后恢复为false
+// True after a maintenance response, false again once a request succeeds
+//
+// Returns:
+//   - bool: 是否处于维护中 / Whether OKX is in maintenance
+func (c *Client) InMaintenance() bool {
+	return c.inMaintenance.Load()
+}
+
+// requestContext 创建单次请求的超时上下文 / Create the deadline context for one request attempt
+// 使用端点的超时覆盖值，否则使用客户端超时；超时为0时不设截止时间
+// Uses the endpoint's timeout override, otherwise the client timeout; no deadline when it is 0
+//
+// Parameters:
+//   - path: API端点路径，可包含查询参数 / API endpoint path, may include the query
+//
+// Returns:
+//   - context.Context: 请求上下文 / Request context
+//   - context.CancelFunc: 读取响应后调用以释放资源 / Call after reading the response to release resources
+func (c *Client) requestContext(path string) (context.Context, context.CancelFunc) {
+	timeout := c.timeout
+	if d, ok := c.timeouts[strings.SplitN(path, "?", 2)[0]]; ok {
+		timeout = d
+	}
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// backoffDuration 计算重试退避时间 / Compute retry backoff duration
+// 指数退避（base, 2×base, 4×base...）截断到maxBackoff，再在[(1-jitter)×截断值, 截断值]内随机取值，
+// 避免并发请求同步重试
+// Exponential backoff (base, 2×base, 4×base...) capped at maxBackoff, then drawn at random from
+// [(1-jitter)×capped, capped] so concurrent requests don't retry in lockstep
+//
+// Parameters:
+//   - attempt: 重试次数，从1开始 / Retry attempt number, starting at 1
+//   - base: 首次重试退避时间 / Backoff before the first retry
+//   - maxBackoff: 最大退避时间 / Maximum backoff duration
+//   - jitter: 抖动比例，1为全抖动 / Jitter fraction, 1 is full jitter
+//
+// Returns:
+//   - time.Duration: 本次重试前的等待时间 / Wait before this retry
+func backoffDuration(attempt int, base, maxBackoff time.Duration, jitter float64) time.Duration {
+	capped := maxBackoff
+	// Shifting past 30 bits would overflow and is far beyond any sane cap anyway
+	if shift := attempt - 1; shift < 30 {
+		if exp := base * time.Duration(1<<uint(shift)); exp > 0 && exp < capped {
+			capped = exp
+		}
+	}
+	if capped <= 0 {
+		return 0
+	}
+	spread := time.Duration(float64(capped) * jitter)
+	return capped - spread + time.Duration(rand.Int63n(int64(spread)+1))
+}
+
+// recordRetry 记录一次重试 / Record a retry
+func (c *Client) recordRetry(method, path string, wait time.Duration) {
+	call := method + " " + strings.SplitN(path, "?", 2)[0]
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.Retries++
+	c.stats.RetriesByCall[call]++
+	c.stats.TotalBackoff += wait
+}
+
+// recordRateLimited 记录一次限流响应 / Record a rate-limited response
+func (c *Client) recordRateLimited() {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.RateLimited++
+}
+
+// Stats 获取重试统计 / Get retry statistics
+// 返回自客户端创建以来的累计统计副本
+// Returns a copy of the totals accumulated since the client was created
+//
+// Returns:
+//   - RetryStats: 重试统计 / Retry statistics
+func (c *Client) Stats() RetryStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	stats := c.stats
+	stats.RetriesByCall = make(map[string]int64, len(c.stats.RetriesByCall))
+	for call, n := range c.stats.RetriesByCall {
+		stats.RetriesByCall[call] = n
+	}
+	return stats
+}
+
 // GetAccountBalance 获取账户余额 / Get account balance
 // 从OKX API获取账户余额信息，包含所有币种的余额、可用余额、冻结余额等
 // Fetch account balance information from OKX API, including balance, available, frozen for all currencies
@@ -255,7 +633,22 @@ func (c *Client) GetAccountBalance() (*AccountBalanceResponse, error) {
 //     可能原因包括: 网络错误、认证失败、API错误码非"0"
 //     Possible causes: network error, authentication failure, API error code not "0"
 func (c *Client) GetPositions() (*PositionsResponse, error) {
-	path := "/api/v5/account/positions"
+	return c.GetPositionsFiltered("", "")
+}
+
+// GetPositionsFiltered 按产品类型和交易对获取持仓信息 / Get positions filtered by instrument type and ID
+// 参数为空时不加入查询条件，两者都为空时等同于GetPositions
+// Empty parameters are left out of the query; with both empty this is the same as GetPositions
+//
+// Parameters:
+//   - instType: 产品类型 / Instrument type (e.g., "SWAP", "FUTURES", "MARGIN", "OPTION"), empty for all
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP"), empty for all
+//
+// Returns:
+//   - *PositionsResponse: 持仓响应对象 / Positions response object
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+func (c *Client) GetPositionsFiltered(instType, instId string) (*PositionsResponse, error) {
+	path := "/api/v5/account/positions" + positionsQuery(instType, instId)
 
 	respBody, err := c.doRequest("GET", path)
 	if err != nil {
@@ -276,6 +669,75 @@ func (c *Client) GetPositions() (*PositionsResponse, error) {
 	return &resp, nil
 }
 
+// billsPageLimit 每页账单的最大条数 / Maximum bills per page accepted by OKX
+const billsPageLimit = 100
+
+// GetBillsHistory 获取账户账单流水 / Get account bills
+// 从OKX API获取近7天的账单流水，包含手续费、资金费和已实现盈亏，按时间倒序分页返回
+// Fetch the last 7 days of account bills, including fees, funding and realized PnL,
+// paginated newest first
+//
+// Parameters:
+//   - instType: 产品类型 / Instrument type (e.g., "SWAP"), empty for all
+//   - billType: 账单类型 / Bill type (e.g., BillTypeTrade, BillTypeFundingFee), empty for all
+//   - after: 分页游标，返回早于该账单ID的记录 / Pagination cursor, returns bills older than this bill ID
+//     首页传空字符串，之后传上一页最后一条的BillId / Empty for the first page, then the last BillId of the previous page
+//   - limit: 每页条数 / Bills per page, 0 or above 100 uses 100
+//
+// Returns:
+//   - *BillsResponse: 账单流水响应对象 / Bills response object
+//     Data少于limit条时表示已是最后一页 / Fewer than limit entries in Data means this is the last page
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+func (c *Client) GetBillsHistory(instType, billType, after string, limit int) (*BillsResponse, error) {
+	if limit <= 0 || limit > billsPageLimit {
+		limit = billsPageLimit
+	}
+	params := []string{fmt.Sprintf("limit=%d", limit)}
+	if instType != "" {
+		params = append(params, "instType="+instType)
+	}
+	if billType != "" {
+		params = append(params, "type="+billType)
+	}
+	if after != "" {
+		params = append(params, "after="+after)
+	}
+	path := "/api/v5/account/bills?" + strings.Join(params, "&")
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp BillsResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// positionsQuery 构建持仓查询字符串 / Build the positions query string
+func positionsQuery(instType, instId string) string {
+	var params []string
+	if instType != "" {
+		params = append(params, "instType="+instType)
+	}
+	if instId != "" {
+		params = append(params, "instId="+instId)
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(params, "&")
+}
+
 // HealthCheck 健康检查 / Health check by testing API connectivity
 // 通过尝试获取账户余额来验证API连接和认证是否正常
 // Verify API connectivity and authentication by attempting to fetch account balance
@@ -325,6 +787,41 @@ func (c *Client) GetPendingAlgoOrders(ordType string) (*PendingAlgoOrdersRespons
 	return &resp, nil
 }
 
+// GetAlgoOrder 获取算法订单详情 / Get algo order details
+// 按algoId查询算法订单，包括已触发或已撤销的订单，用于确认订单的最终状态
+// Query an algo order by algoId, including triggered or cancelled ones, to learn its final state
+//
+// Parameters:
+//   - algoId: 算法订单ID / Algo order ID
+//
+// Returns:
+//   - *AlgoOrderDetailsResponse: 算法订单详情响应对象 / Algo order details response object
+//     State字段取值包括 / State values include: live, pause, partially_effective, effective,
+//     canceled, order_failed, partially_failed
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     订单不存在时API返回非"0"错误码 / The API returns a non-"0" code when the order does not exist
+func (c *Client) GetAlgoOrder(algoId string) (*AlgoOrderDetailsResponse, error) {
+	path := "/api/v5/trade/order-algo?algoId=" + algoId
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp AlgoOrderDetailsResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
 // PlaceAlgoOrder 下单算法订单 / Place algo order
 // 向OKX API下单算法订单（如条件单、止盈止损单等）
 // Place algo order to OKX API (e.g., conditional orders, TPSL orders, etc.)
@@ -361,6 +858,65 @@ func (c *Client) PlaceAlgoOrder(req AlgoOrderRequest) (*AlgoOrderResponse, error
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	// Check for order-specific errors first, OKX reports them with a non-zero top-level code
+	if len(resp.Data) > 0 && resp.Data[0].SCode != "" && resp.Data[0].SCode != "0" {
+		return nil, &OrderError{SCode: resp.Data[0].SCode, SMsg: resp.Data[0].SMsg}
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// AmendAlgoOrder 修改算法订单 / Amend algo order
+// 修改未触发的止盈止损单的数量或触发价，仅支持conditional和oco类型
+// Amend size or trigger price of an untriggered TPSL order, only conditional and oco orders are supported
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//   - algoId: 算法订单ID / Algo order ID
+//   - newSz: 新的订单数量，空字符串表示不修改 / New order size, empty to keep unchanged
+//   - newTpTrigger: 新的止盈触发价，空字符串表示不修改 / New take-profit trigger price, empty to keep unchanged
+//   - newSlTrigger: 新的止损触发价，空字符串表示不修改 / New stop-loss trigger price, empty to keep unchanged
+//
+// Returns:
+//   - *AlgoOrderResponse: 算法订单响应对象 / Algo order response object
+//     包含Data字段，其中包含被修改订单的algoId
+//     Contains Data field with algoId of the amended order
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"、订单类型不支持修改
+//     Possible causes: network error, authentication failure, API error code not "0", order type not amendable
+func (c *Client) AmendAlgoOrder(instId, algoId, newSz, newTpTrigger, newSlTrigger string) (*AlgoOrderResponse, error) {
+	path := "/api/v5/trade/amend-algos"
+
+	req := AmendAlgoOrderRequest{
+		InstId:         instId,
+		AlgoId:         algoId,
+		NewSz:          newSz,
+		NewTpTriggerPx: newTpTrigger,
+		NewSlTriggerPx: newSlTrigger,
+	}
+
+	// Marshal request to JSON
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := c.doRequestWithBody("POST", path, string(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp AlgoOrderResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
 	// Check for API error
 	if resp.Code != "0" {
 		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
@@ -368,36 +924,438 @@ func (c *Client) PlaceAlgoOrder(req AlgoOrderRequest) (*AlgoOrderResponse, error
 
 	// Check for order-specific errors
 	if len(resp.Data) > 0 && resp.Data[0].SCode != "" && resp.Data[0].SCode != "0" {
-		return nil, fmt.Errorf("order placement error: code=%s, msg=%s", resp.Data[0].SCode, resp.Data[0].SMsg)
+		return nil, fmt.Errorf("order amend error: code=%s, msg=%s", resp.Data[0].SCode, resp.Data[0].SMsg)
 	}
 
 	return &resp, nil
 }
 
-// GetTicker 获取行情数据 / Get ticker data
-// 从OKX API获取指定交易对的行情数据，包含最新成交价、买卖价等
-// Fetch ticker data for specified instrument from OKX API, including last price, bid/ask prices, etc.
+// CancelAlgoOrders 撤销算法订单 / Cancel algo orders
+// 批量撤销未触发的止盈止损单
+// Cancel untriggered TPSL orders in a batch
 //
 // Parameters:
-//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//   - orders: 待撤销的订单列表 / Orders to cancel, each identified by algoId and instId
 //
 // Returns:
-//   - *TickerResponse: 行情响应对象 / Ticker response object
-//     包含Data字段，其中包含最新价格、买卖价等信息
-//     Contains Data field with last price, bid/ask prices, etc.
+//   - *AlgoOrderResponse: 算法订单响应对象 / Algo order response object
+//     包含Data字段，其中包含被撤销订单的algoId
+//     Contains Data field with algoIds of the cancelled orders
 //   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
-//     可能原因包括: 网络错误、认证失败、API错误码非"0"、交易对不存在
-//     Possible causes: network error, authentication failure, API error code not "0", invalid instrument
-func (c *Client) GetTicker(instId string) (*TickerResponse, error) {
-	path := fmt.Sprintf("/api/v5/market/ticker?instId=%s", instId)
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"、任一订单撤销失败
+//     Possible causes: network error, authentication failure, API error code not "0", any order failed to cancel
+func (c *Client) CancelAlgoOrders(orders []CancelAlgoOrderRequest) (*AlgoOrderResponse, error) {
+	path := "/api/v5/trade/cancel-algos"
 
-	respBody, err := c.doRequest("GET", path)
+	// Marshal request to JSON
+	reqBody, err := json.Marshal(orders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := c.doRequestWithBody("POST", path, string(reqBody))
 	if err != nil {
 		return nil, err
 	}
 
 	// Parse response
-	var resp TickerResponse
+	var resp AlgoOrderResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	// Check for order-specific errors
+	for _, d := range resp.Data {
+		if d.SCode != "" && d.SCode != "0" {
+			return nil, fmt.Errorf("order cancel error: algoId=%s, code=%s, msg=%s", d.AlgoId, d.SCode, d.SMsg)
+		}
+	}
+
+	return &resp, nil
+}
+
+// PlaceOrder 下单普通订单 / Place order
+// 向OKX API下单普通订单，例如按指定数量市价平仓的只减仓订单
+// Place a regular order to OKX API, e.g. a reduce-only market order closing a given size
+//
+// Parameters:
+//   - req: 订单请求对象 / Order request object
+//
+// Returns:
+//   - *OrderResponse: 订单响应对象，Data中包含ordId / Order response object, Data holds the ordId
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"、参数错误
+//     Possible causes: network error, authentication failure, API error code not "0", invalid parameters
+func (c *Client) PlaceOrder(req OrderRequest) (*OrderResponse, error) {
+	path := "/api/v5/trade/order"
+
+	// Marshal request to JSON
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := c.doRequestWithBody("POST", path, string(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp OrderResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for order-specific errors first, OKX reports them with a non-zero top-level code
+	if len(resp.Data) > 0 && resp.Data[0].SCode != "" && resp.Data[0].SCode != "0" {
+		return nil, &OrderError{SCode: resp.Data[0].SCode, SMsg: resp.Data[0].SMsg}
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// ClosePosition 市价平仓 / Close position at market
+// 以市价全部平掉指定持仓，并撤销该持仓上的挂单
+// Close the whole position at market and cancel pending orders on it
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//   - mgnMode: 保证金模式 / Margin mode ("cross" or "isolated")
+//   - posSide: 持仓方向 / Position side ("long" or "short"), empty in net mode
+//
+// Returns:
+//   - *ClosePositionResponse: 平仓响应对象 / Close position response object
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"
+//     Possible causes: network error, authentication failure, API error code not "0"
+func (c *Client) ClosePosition(instId, mgnMode, posSide string) (*ClosePositionResponse, error) {
+	path := "/api/v5/trade/close-position"
+
+	req := ClosePositionRequest{
+		InstId:  instId,
+		MgnMode: mgnMode,
+		PosSide: posSide,
+		AutoCxl: true,
+	}
+
+	// Marshal request to JSON
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := c.doRequestWithBody("POST", path, string(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp ClosePositionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetAccountConfig 获取账户配置 / Get account configuration
+// 从OKX API查询账户配置，包含持仓模式（双向持仓或单向持仓）
+// Query account configuration from OKX API, including position mode (hedge or one-way)
+//
+// Returns:
+//   - *AccountConfigResponse: 账户配置响应对象 / Account configuration response object
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"
+//     Possible causes: network error, authentication failure, API error code not "0"
+func (c *Client) GetAccountConfig() (*AccountConfigResponse, error) {
+	path := "/api/v5/account/config"
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp AccountConfigResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetMaxAvailSize 获取最大可平仓数量 / Get maximum closable size
+// 从OKX API查询只减仓模式下的最大可用数量。OKX的reduceOnly仅适用于杠杆（MARGIN），此时即实际可平仓数量；
+// 对SWAP、FUTURES等衍生品返回的是随保证金变化的可开仓数量，可平仓数量应读取持仓的pos
+// Query the maximum available size in reduce-only mode from OKX API. OKX applies reduceOnly to
+// MARGIN only, where this is the live closable size; for derivatives such as SWAP and FUTURES it
+// is a margin-dependent openable size, so read the position's pos for the closable size instead
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//   - tdMode: 交易模式 / Trade mode ("cross" or "isolated")
+//
+// Returns:
+//   - *MaxAvailSizeResponse: 最大可用数量响应对象 / Maximum available size response object
+//     包含Data字段，其中availBuy/availSell分别为买入/卖出方向的可用数量
+//     Contains Data field with availBuy/availSell for the buy/sell direction
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"
+//     Possible causes: network error, authentication failure, API error code not "0"
+func (c *Client) GetMaxAvailSize(instId, tdMode string) (*MaxAvailSizeResponse, error) {
+	path := fmt.Sprintf("/api/v5/account/max-avail-size?instId=%s&tdMode=%s&reduceOnly=true", instId, tdMode)
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp MaxAvailSizeResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetTicker 获取行情数据 / Get ticker data
+// 从OKX API获取指定交易对的行情数据，包含最新成交价、买卖价等
+// Fetch ticker data for specified instrument from OKX API, including last price, bid/ask prices, etc.
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//
+// Returns:
+//   - *TickerResponse: 行情响应对象 / Ticker response object
+//     包含Data字段，其中包含最新价格、买卖价等信息
+//     Contains Data field with last price, bid/ask prices, etc.
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、认证失败、API错误码非"0"、交易对不存在
+//     Possible causes: network error, authentication failure, API error code not "0", invalid instrument
+func (c *Client) GetTicker(instId string) (*TickerResponse, error) {
+	path := fmt.Sprintf("/api/v5/market/ticker?instId=%s", instId)
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp TickerResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetTickers 批量获取行情数据 / Get tickers in bulk
+// 一次请求获取某一产品类型下所有交易对的行情，替代逐个调用GetTicker
+// Fetch tickers of every instrument of one type in a single call instead of one GetTicker per instrument
+//
+// Parameters:
+//   - instType: 产品类型 / Instrument type ("SPOT", "SWAP", "FUTURES", "OPTION")
+//
+// Returns:
+//   - *TickerResponse: 行情响应对象，每个交易对一条 / Ticker response object, one entry per instrument
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+func (c *Client) GetTickers(instType string) (*TickerResponse, error) {
+	path := fmt.Sprintf("/api/v5/market/tickers?instType=%s", instType)
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp TickerResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetOrderBook 获取深度数据 / Get order book
+// 从OKX API获取指定交易对的买卖盘深度
+// Fetch bid/ask depth for specified instrument from OKX API
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//   - depth: 每侧档位数量 / Number of levels per side (max 400)
+//
+// Returns:
+//   - *OrderBookResponse: 深度响应对象 / Order book response object
+//     包含Data字段，其中包含asks和bids档位
+//     Contains Data field with asks and bids levels
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、API错误码非"0"、交易对不存在
+//     Possible causes: network error, API error code not "0", invalid instrument
+func (c *Client) GetOrderBook(instId string, depth int) (*OrderBookResponse, error) {
+	path := fmt.Sprintf("/api/v5/market/books?instId=%s&sz=%d", instId, depth)
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp OrderBookResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetInstruments 获取交易产品基础信息 / Get instrument metadata
+// 从OKX API获取交易产品的合约面值、乘数、最小变动价位等信息
+// Fetch instrument metadata such as contract value, multiplier and tick size from OKX API
+//
+// Parameters:
+//   - instType: 产品类型 / Instrument type ("SPOT", "MARGIN", "SWAP", "FUTURES", "OPTION")
+//   - instId: 交易对ID，空字符串查询该类型全部产品 / Instrument ID, empty for all instruments of the type
+//
+// Returns:
+//   - *InstrumentsResponse: 交易产品信息响应对象 / Instruments response object
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、API错误码非"0"、交易对不存在
+//     Possible causes: network error, API error code not "0", invalid instrument
+func (c *Client) GetInstruments(instType, instId string) (*InstrumentsResponse, error) {
+	path := "/api/v5/public/instruments?instType=" + instType
+	if instId != "" {
+		path += "&instId=" + instId
+	}
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp InstrumentsResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetPositionTiers 获取仓位档位 / Get position tiers
+// 从OKX API获取各档位的维持保证金率和最大杠杆，用于在LiqPx过期时估算强平价格
+// Fetch the maintenance margin rate and max leverage of each tier from OKX API, used to estimate
+// liquidation when LiqPx may be stale
+//
+// Parameters:
+//   - instType: 产品类型 / Instrument type ("MARGIN", "SWAP", "FUTURES", "OPTION")
+//   - tdMode: 保证金模式 / Margin mode ("cross" or "isolated")
+//   - instId: 交易对ID，衍生品按其交易品种查询 / Instrument ID; derivatives are queried by its instrument family
+//
+// Returns:
+//   - *PositionTiersResponse: 仓位档位响应对象，按档位升序 / Position tiers response, lowest tier first
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、API错误码非"0"、交易对不存在
+//     Possible causes: network error, API error code not "0", invalid instrument
+func (c *Client) GetPositionTiers(instType, tdMode, instId string) (*PositionTiersResponse, error) {
+	path := fmt.Sprintf("/api/v5/public/position-tiers?instType=%s&tdMode=%s", instType, tdMode)
+	if instType == "MARGIN" {
+		path += "&instId=" + instId
+	} else {
+		// Derivatives require the instrument family, e.g. BTC-USDT for BTC-USDT-SWAP
+		parts := strings.SplitN(instId, "-", 3)
+		if len(parts) >= 2 {
+			path += "&instFamily=" + parts[0] + "-" + parts[1]
+		}
+		path += "&instId=" + instId
+	}
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp PositionTiersResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API error
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("API error: code=%s, msg=%s", resp.Code, resp.Msg)
+	}
+
+	return &resp, nil
+}
+
+// GetFundingRate 获取资金费率 / Get funding rate
+// 从OKX API获取永续合约当前及下一期资金费率
+// Fetch current and next funding rate of a perpetual swap from OKX API
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP"), only SWAP instruments have funding
+//
+// Returns:
+//   - *FundingRateResponse: 资金费率响应对象 / Funding rate response object
+//     包含Data字段，其中包含当前费率、下期费率及结算时间
+//     Contains Data field with current rate, next rate and settlement times
+//   - error: API请求失败或响应解析失败时返回错误 / Error on API request failure or response parsing failure
+//     可能原因包括: 网络错误、API错误码非"0"、交易对不是永续合约
+//     Possible causes: network error, API error code not "0", instrument is not a perpetual swap
+func (c *Client) GetFundingRate(instId string) (*FundingRateResponse, error) {
+	path := fmt.Sprintf("/api/v5/public/funding-rate?instId=%s", instId)
+
+	respBody, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var resp FundingRateResponse
 	if err := json.Unmarshal(respBody, &resp); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
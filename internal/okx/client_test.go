@@ -0,0 +1,1168 @@
+package okx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+)
+
+// stubTransport is a RoundTripper that answers every request with the given function
+type stubTransport func(*http.Request) (*http.Response, error)
+
+func (f stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubResponse builds an HTTP response with the given status and body
+func stubResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     make(http.Header),
+	}
+}
+
+// newTestClient creates a client pointed at a test server using the given handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL, "test-key", "test-secret", "test-pass", 5, 0, false)
+}
+
+func TestGetFundingRate(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/public/funding-rate" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("instId"); got != "BTC-USDT-SWAP" {
+			t.Errorf("expected instId BTC-USDT-SWAP, got %s", got)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[{
+			"instType":"SWAP","instId":"BTC-USDT-SWAP",
+			"fundingRate":"0.0001","nextFundingRate":"0.00015",
+			"fundingTime":"1700000000000","nextFundingTime":"1700028800000"}]}`))
+	})
+
+	resp, err := client.GetFundingRate("BTC-USDT-SWAP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("expected 1 funding rate, got %d", len(resp.Data))
+	}
+
+	data := resp.Data[0]
+	if data.FundingRate != "0.0001" {
+		t.Errorf("expected funding rate 0.0001, got %s", data.FundingRate)
+	}
+	if data.NextFundingRate != "0.00015" {
+		t.Errorf("expected next funding rate 0.00015, got %s", data.NextFundingRate)
+	}
+	if data.FundingTime != "1700000000000" || data.NextFundingTime != "1700028800000" {
+		t.Errorf("unexpected funding times: %s, %s", data.FundingTime, data.NextFundingTime)
+	}
+}
+
+func TestGetFundingRateAPIError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"51001","msg":"Instrument ID does not exist","data":[]}`))
+	})
+
+	if _, err := client.GetFundingRate("BTC-USDT"); err == nil {
+		t.Error("expected error for non-zero API code")
+	}
+}
+
+func TestGetPositionTiers(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/public/position-tiers" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("instType") != "SWAP" || query.Get("tdMode") != "cross" || query.Get("instFamily") != "BTC-USDT" || query.Get("instId") != "BTC-USDT-SWAP" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[
+			{"instFamily":"BTC-USDT","instId":"BTC-USDT-SWAP","tier":"1","minSz":"0","maxSz":"2000",
+			 "mmr":"0.004","imr":"0.008","maxLever":"125","optMgnFactor":"","quoteMaxLoan":"","baseMaxLoan":""},
+			{"instFamily":"BTC-USDT","instId":"BTC-USDT-SWAP","tier":"2","minSz":"2001","maxSz":"5000",
+			 "mmr":"0.005","imr":"0.01","maxLever":"100","optMgnFactor":"","quoteMaxLoan":"","baseMaxLoan":""}]}`))
+	})
+
+	resp, err := client.GetPositionTiers("SWAP", "cross", "BTC-USDT-SWAP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 tiers, got %d", len(resp.Data))
+	}
+
+	tier := resp.Data[1]
+	if tier.Tier != "2" || tier.MinSz != "2001" || tier.MaxSz != "5000" {
+		t.Errorf("unexpected tier bounds: %+v", tier)
+	}
+	if tier.Mmr != "0.005" || tier.Imr != "0.01" || tier.MaxLever != "100" {
+		t.Errorf("unexpected tier rates: %+v", tier)
+	}
+}
+
+func TestGetPositionTiersAPIError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"51000","msg":"Parameter instFamily error","data":[]}`))
+	})
+
+	if _, err := client.GetPositionTiers("SWAP", "cross", "BTC"); err == nil {
+		t.Error("expected error for non-zero API code")
+	}
+}
+
+func TestAmendAlgoOrder(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if r.URL.Path != "/api/v5/trade/amend-algos" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req["instId"] != "BTC-USDT-SWAP" || req["algoId"] != "123" || req["newSz"] != "3" {
+			t.Errorf("unexpected request: %v", req)
+		}
+		if _, ok := req["newTpTriggerPx"]; ok {
+			t.Errorf("empty trigger should be omitted: %v", req)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"123","sCode":"0","sMsg":""}]}`))
+	})
+
+	resp, err := client.AmendAlgoOrder("BTC-USDT-SWAP", "123", "3", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].AlgoId != "123" {
+		t.Errorf("unexpected response data: %+v", resp.Data)
+	}
+}
+
+func TestAmendAlgoOrderRejected(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"123","sCode":"51000","sMsg":"Parameter algoId error"}]}`))
+	})
+
+	if _, err := client.AmendAlgoOrder("BTC-USDT-SWAP", "123", "3", "", ""); err == nil {
+		t.Error("expected error for rejected amend")
+	}
+}
+
+func TestCancelAlgoOrders(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if r.URL.Path != "/api/v5/trade/cancel-algos" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		var req []map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if len(req) != 1 || req[0]["algoId"] != "123" || req[0]["instId"] != "BTC-USDT-SWAP" {
+			t.Errorf("unexpected request: %v", req)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"123","sCode":"0","sMsg":""}]}`))
+	})
+
+	resp, err := client.CancelAlgoOrders([]CancelAlgoOrderRequest{{AlgoId: "123", InstId: "BTC-USDT-SWAP"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].AlgoId != "123" {
+		t.Errorf("unexpected response data: %+v", resp.Data)
+	}
+}
+
+func TestClosePosition(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v5/trade/close-position" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req["instId"] != "BTC-USDT-SWAP" || req["mgnMode"] != "cross" || req["autoCxl"] != true {
+			t.Errorf("unexpected request: %v", req)
+		}
+		if _, ok := req["posSide"]; ok {
+			t.Errorf("empty posSide should be omitted: %v", req)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","posSide":"net"}]}`))
+	})
+
+	if _, err := client.ClosePosition("BTC-USDT-SWAP", "cross", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGetPositionsFilteredQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		instType    string
+		instId      string
+		expectQuery string
+	}{
+		{"no filter", "", "", ""},
+		{"inst type only", "SWAP", "", "instType=SWAP"},
+		{"inst id only", "", "BTC-USDT-SWAP", "instId=BTC-USDT-SWAP"},
+		{"both", "SWAP", "BTC-USDT-SWAP", "instType=SWAP&instId=BTC-USDT-SWAP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/account/positions" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				if r.URL.RawQuery != tt.expectQuery {
+					t.Errorf("expected query %q, got %q", tt.expectQuery, r.URL.RawQuery)
+				}
+				w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+			})
+
+			if _, err := client.GetPositionsFiltered(tt.instType, tt.instId); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBackoffDurationCapped(t *testing.T) {
+	maxBackoff := 30 * time.Second
+
+	for attempt := 1; attempt <= 100; attempt++ {
+		for i := 0; i < 20; i++ {
+			backoff := backoffDuration(attempt, time.Second, maxBackoff, 1)
+			if backoff < 0 || backoff > maxBackoff {
+				t.Fatalf("attempt %d: backoff %v outside [0, %v]", attempt, backoff, maxBackoff)
+			}
+		}
+	}
+
+	// Early attempts stay within their exponential window
+	for i := 0; i < 20; i++ {
+		if backoff := backoffDuration(1, time.Second, maxBackoff, 1); backoff > time.Second {
+			t.Fatalf("attempt 1: backoff %v exceeds 1s window", backoff)
+		}
+	}
+}
+
+func TestBackoffDurationJitter(t *testing.T) {
+	maxBackoff := 30 * time.Second
+
+	// Without jitter the full exponential delay is used
+	if backoff := backoffDuration(3, time.Second, maxBackoff, 0); backoff != 4*time.Second {
+		t.Errorf("expected 4s without jitter, got %v", backoff)
+	}
+	if backoff := backoffDuration(10, time.Second, maxBackoff, 0); backoff != maxBackoff {
+		t.Errorf("expected capped %v without jitter, got %v", maxBackoff, backoff)
+	}
+
+	// Half jitter keeps the delay within the upper half of the window
+	for i := 0; i < 50; i++ {
+		backoff := backoffDuration(3, 100*time.Millisecond, maxBackoff, 0.5)
+		if backoff < 200*time.Millisecond || backoff > 400*time.Millisecond {
+			t.Fatalf("backoff %v outside [200ms, 400ms]", backoff)
+		}
+	}
+}
+
+func TestWithMaxBackoff(t *testing.T) {
+	client := New("http://127.0.0.1:0", "key", "secret", "pass", 5, 3, false, WithMaxBackoff(5*time.Second))
+	if client.maxBackoff != 5*time.Second {
+		t.Errorf("expected max backoff 5s, got %v", client.maxBackoff)
+	}
+
+	client = New("http://127.0.0.1:0", "key", "secret", "pass", 5, 3, false)
+	if client.maxBackoff != defaultMaxBackoff {
+		t.Errorf("expected default max backoff %v, got %v", defaultMaxBackoff, client.maxBackoff)
+	}
+}
+
+func TestGetMaxAvailSize(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/account/max-avail-size" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("instId") != "BTC-USDT-SWAP" || query.Get("tdMode") != "cross" || query.Get("reduceOnly") != "true" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","availBuy":"0","availSell":"2"}]}`))
+	})
+
+	resp, err := client.GetMaxAvailSize("BTC-USDT-SWAP", "cross")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].AvailSell != "2" || resp.Data[0].AvailBuy != "0" {
+		t.Errorf("unexpected response data: %+v", resp.Data)
+	}
+}
+
+func TestGetAccountConfig(t *testing.T) {
+	for _, mode := range []string{PosModeLongShort, PosModeNet} {
+		t.Run(mode, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/account/config" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				w.Write([]byte(`{"code":"0","msg":"","data":[{"uid":"1","acctLv":"2","posMode":"` + mode + `"}]}`))
+			})
+
+			resp, err := client.GetAccountConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resp.Data) != 1 || resp.Data[0].PosMode != mode {
+				t.Errorf("expected posMode %s, got %+v", mode, resp.Data)
+			}
+		})
+	}
+}
+
+func TestGenerateSignature(t *testing.T) {
+	client := New("https://www.okx.com", "test-key", "test-secret", "test-pass", 5, 0, false)
+
+	tests := []struct {
+		name        string
+		method      string
+		requestPath string
+		body        string
+		expected    string
+	}{
+		{
+			name:        "GET without body",
+			method:      "GET",
+			requestPath: "/api/v5/account/balance",
+			expected:    "SyvYrH/ib+gXRkyly2mUKQJc3HQ3OufThbbZ+InRNCY=",
+		},
+		{
+			name:        "POST with body",
+			method:      "POST",
+			requestPath: "/api/v5/trade/order-algo",
+			body:        `{"instId":"BTC-USDT-SWAP"}`,
+			expected:    "nV/ridSvUMyN2xQnp8P59Hh2I3WR4IUjrfSa7rPSJ9I=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := client.generateSignature("2023-01-01T12:00:00.000Z", tt.method, tt.requestPath, tt.body)
+			second := client.generateSignature("2023-01-01T12:00:00.000Z", tt.method, tt.requestPath, tt.body)
+			if first != second {
+				t.Errorf("signature not deterministic: %s != %s", first, second)
+			}
+			if first != tt.expected {
+				t.Errorf("expected signature %s, got %s", tt.expected, first)
+			}
+		})
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("OK-ACCESS-KEY") != "test-key" || r.Header.Get("OK-ACCESS-PASSPHRASE") != "test-pass" {
+			t.Errorf("missing credentials headers: %v", r.Header)
+		}
+		timestamp := r.Header.Get("OK-ACCESS-TIMESTAMP")
+		expected := sign("test-secret", timestamp, r.Method, r.URL.RequestURI(), "")
+		if r.Header.Get("OK-ACCESS-SIGN") != expected {
+			t.Errorf("signature header does not match request")
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+	})
+
+	if _, err := client.GetPositions(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSimulatedTradingHeader(t *testing.T) {
+	for _, simulated := range []bool{false, true} {
+		var got string
+		transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+			got = req.Header.Get("x-simulated-trading")
+			return stubResponse(http.StatusOK, `{"code":"0","msg":"","data":[]}`), nil
+		})
+		client := New("https://www.okx.com", "key", "secret", "pass", 5, 0, false,
+			WithHTTPClient(&http.Client{Transport: transport}), WithSimulatedTrading(simulated))
+
+		if _, err := client.GetPositions(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := map[bool]string{false: "", true: "1"}[simulated]; got != want {
+			t.Errorf("simulated=%v: expected x-simulated-trading %q, got %q", simulated, want, got)
+		}
+	}
+}
+
+func TestDebugOutputThroughLogger(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "debug.log")
+	log, err := logger.New(logPath, logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		return stubResponse(http.StatusOK, `{"code":"0","msg":"invalid secret=abcdef123456","data":[]}`), nil
+	})
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 0, true,
+		WithHTTPClient(&http.Client{Transport: transport}), WithLogger(log))
+
+	client.PlaceAlgoOrder(AlgoOrderRequest{InstId: "BTC-USDT-SWAP", Side: "sell", OrdType: "conditional"})
+	log.Close()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"[DEBUG] OKX API request POST /api/v5/trade/order-algo: {\"instId\":\"BTC-USDT-SWAP\"",
+		"[DEBUG] OKX API response POST /api/v5/trade/order-algo: status 200",
+		"secret=abcd****",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "abcdef123456") {
+		t.Errorf("expected the secret to be masked, got:\n%s", out)
+	}
+}
+
+func TestRetryOnRateLimit(t *testing.T) {
+	var calls int32
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return stubResponse(http.StatusTooManyRequests, `{"code":"50011","msg":"Too Many Requests"}`), nil
+		}
+		return stubResponse(http.StatusOK, `{"code":"0","msg":"","data":[]}`), nil
+	})
+
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 3, false,
+		WithHTTPClient(&http.Client{Transport: transport}), WithMaxBackoff(time.Millisecond))
+
+	if _, err := client.GetPositions(); err != nil {
+		t.Fatalf("expected success after retries, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestRetryStats(t *testing.T) {
+	var calls int32
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return stubResponse(http.StatusTooManyRequests, `{"code":"50011","msg":"Too Many Requests"}`), nil
+		}
+		return stubResponse(http.StatusOK, `{"code":"0","msg":"","data":[]}`), nil
+	})
+
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 3, false,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithBaseBackoff(time.Millisecond), WithMaxBackoff(time.Millisecond))
+
+	if _, err := client.GetPositions(); err != nil {
+		t.Fatalf("expected success after retries, got: %v", err)
+	}
+
+	stats := client.Stats()
+	if stats.Retries != 2 {
+		t.Errorf("expected 2 retries, got %d", stats.Retries)
+	}
+	if stats.RateLimited != 2 {
+		t.Errorf("expected 2 rate limited responses, got %d", stats.RateLimited)
+	}
+	if got := stats.RetriesByCall["GET /api/v5/account/positions"]; got != 2 {
+		t.Errorf("expected 2 retries for positions call, got %d (%v)", got, stats.RetriesByCall)
+	}
+	if stats.TotalBackoff > 2*time.Millisecond {
+		t.Errorf("expected total backoff within 2ms, got %v", stats.TotalBackoff)
+	}
+
+	// The returned stats are a copy
+	stats.RetriesByCall["GET /api/v5/account/positions"] = 100
+	if got := client.Stats().RetriesByCall["GET /api/v5/account/positions"]; got != 2 {
+		t.Errorf("expected client stats to be unaffected, got %d", got)
+	}
+}
+
+func TestBackoffScheduleFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	var timestamps []string
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		timestamps = append(timestamps, req.Header.Get("OK-ACCESS-TIMESTAMP"))
+		return stubResponse(http.StatusTooManyRequests, `{"code":"50011","msg":"Too Many Requests"}`), nil
+	})
+
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 4, false,
+		WithHTTPClient(&http.Client{Transport: transport}), WithClock(fake),
+		WithBaseBackoff(time.Second), WithMaxBackoff(4*time.Second), WithJitterFraction(0))
+
+	if _, err := client.GetPositions(); err == nil {
+		t.Fatal("expected error after retries exhausted")
+	}
+
+	// Exponential from the base backoff, capped at the max, without real sleeping
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	sleeps := fake.Sleeps()
+	if len(sleeps) != len(expected) {
+		t.Fatalf("expected %d sleeps, got %v", len(expected), sleeps)
+	}
+	for i := range expected {
+		if sleeps[i] != expected[i] {
+			t.Errorf("sleep %d: expected %v, got %v", i, expected[i], sleeps[i])
+		}
+	}
+	if total := client.Stats().TotalBackoff; total != 11*time.Second {
+		t.Errorf("expected total backoff 11s, got %v", total)
+	}
+
+	// Each attempt is signed with the clock's time after the preceding sleep
+	if len(timestamps) != 5 {
+		t.Fatalf("expected 5 attempts, got %d", len(timestamps))
+	}
+	if want := start.Add(11 * time.Second).Format("2006-01-02T15:04:05.000Z"); timestamps[4] != want {
+		t.Errorf("expected last timestamp %s, got %s", want, timestamps[4])
+	}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v5/account/positions" {
+			// Slow endpoint, only returns once the client gives up
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "key", "secret", "pass", 5, 0, false,
+		WithRequestTimeouts(map[string]time.Duration{"/api/v5/account/positions": 50 * time.Millisecond}))
+
+	start := time.Now()
+	_, err := client.GetPositions()
+	if err == nil {
+		t.Fatal("expected slow request to time out")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected per-request deadline to cancel quickly, took %v", elapsed)
+	}
+
+	// Endpoints without an override use the client timeout
+	if _, err := client.GetPendingAlgoOrders("conditional"); err != nil {
+		t.Errorf("unexpected error on endpoint without override: %v", err)
+	}
+}
+
+func TestMaintenanceBackoff(t *testing.T) {
+	var calls int32
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return stubResponse(http.StatusOK, `{"code":"50013","msg":"Systems are busy, please try again later"}`), nil
+		}
+		return stubResponse(http.StatusOK, `{"code":"0","msg":"","data":[]}`), nil
+	})
+
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 3, false,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithBaseBackoff(time.Millisecond), WithMaxBackoff(time.Millisecond),
+		WithMaintenanceBackoff(40*time.Millisecond))
+
+	// The maintenance code is retried on the extended backoff rather than failing immediately
+	if _, err := client.GetPositions(); err != nil {
+		t.Fatalf("expected success once maintenance ends, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+	if backoff := client.Stats().TotalBackoff; backoff != 80*time.Millisecond {
+		t.Errorf("expected two maintenance backoffs totalling 80ms, got %v", backoff)
+	}
+	if client.InMaintenance() {
+		t.Error("expected maintenance to clear after a successful call")
+	}
+}
+
+func TestMaintenanceCodeNotRetriedForPost(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectCalls int32
+	}{
+		{"request timed out", http.StatusOK, `{"code":"51054","msg":"Request timed out"}`, 1},
+		{"endpoint timeout", http.StatusOK, `{"code":"50004","msg":"API endpoint request timeout"}`, 1},
+		{"HTTP 503 is still retried", http.StatusServiceUnavailable, "maintenance", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				return stubResponse(tt.status, tt.body), nil
+			})
+			client := New("https://www.okx.com", "key", "secret", "pass", 5, 2, false,
+				WithHTTPClient(&http.Client{Transport: transport}), WithMaintenanceBackoff(time.Millisecond))
+
+			_, err := client.PlaceAlgoOrder(AlgoOrderRequest{InstId: "BTC-USDT-SWAP", Side: "sell", OrdType: "conditional"})
+			// Still reported as maintenance so callers back off until the next check
+			if !IsMaintenance(err) {
+				t.Fatalf("expected maintenance error, got: %v", err)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.expectCalls {
+				t.Errorf("expected %d attempts, got %d", tt.expectCalls, got)
+			}
+		})
+	}
+}
+
+func TestMaintenanceExhausted(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		expectCode string
+	}{
+		{"system busy code", http.StatusOK, `{"code":"50013","msg":"Systems are busy"}`, "50013"},
+		{"service unavailable code", http.StatusOK, `{"code":"50001","msg":"Service temporarily unavailable"}`, "50001"},
+		{"HTTP 503 without JSON", http.StatusServiceUnavailable, "maintenance", "HTTP 503"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+				return stubResponse(tt.status, tt.body), nil
+			})
+			client := New("https://www.okx.com", "key", "secret", "pass", 5, 1, false,
+				WithHTTPClient(&http.Client{Transport: transport}), WithMaintenanceBackoff(time.Millisecond))
+
+			_, err := client.GetPositions()
+			if !IsMaintenance(err) {
+				t.Fatalf("expected maintenance error, got: %v", err)
+			}
+			var maintenanceErr *MaintenanceError
+			if errors.As(err, &maintenanceErr) && maintenanceErr.Code != tt.expectCode {
+				t.Errorf("expected code %s, got %s", tt.expectCode, maintenanceErr.Code)
+			}
+			if !client.InMaintenance() {
+				t.Error("expected client to report maintenance")
+			}
+		})
+	}
+
+	// Other API error codes are not treated as maintenance
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		return stubResponse(http.StatusOK, `{"code":"50111","msg":"Invalid OK-ACCESS-KEY"}`), nil
+	})
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 1, false,
+		WithHTTPClient(&http.Client{Transport: transport}))
+	if _, err := client.GetPositions(); err == nil || IsMaintenance(err) {
+		t.Errorf("expected non-maintenance API error, got: %v", err)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport stubTransport
+		errorMsg  string
+	}{
+		{
+			name: "rate limited",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return stubResponse(http.StatusTooManyRequests, ""), nil
+			},
+			errorMsg: "rate limited (429)",
+		},
+		{
+			name: "non-200 status",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return stubResponse(http.StatusInternalServerError, "internal error"), nil
+			},
+			errorMsg: "unexpected status code 500",
+		},
+		{
+			name: "transport error",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection reset")
+			},
+			errorMsg: "connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				return tt.transport(req)
+			})
+
+			client := New("https://www.okx.com", "key", "secret", "pass", 5, 2, false,
+				WithHTTPClient(&http.Client{Transport: transport}), WithMaxBackoff(time.Millisecond))
+
+			_, err := client.GetPositions()
+			if err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) || !strings.Contains(err.Error(), "after 2 retries") {
+				t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
+			}
+			if got := atomic.LoadInt32(&calls); got != 3 {
+				t.Errorf("expected 3 attempts, got %d", got)
+			}
+		})
+	}
+}
+
+func TestRetryClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantCalls int32
+		wantRetry bool
+	}{
+		{"server error is retried", http.StatusInternalServerError, "internal error", 3, true},
+		{"bad gateway is retried", http.StatusBadGateway, "", 3, true},
+		{"request timeout is retried", http.StatusRequestTimeout, "", 3, true},
+		{"invalid signature fails fast", http.StatusUnauthorized, `{"code":"50113","msg":"Invalid Sign"}`, 1, false},
+		{"malformed request fails fast", http.StatusBadRequest, `{"code":"50014","msg":"Parameter instId can not be empty"}`, 1, false},
+		{"insufficient permission fails fast", http.StatusForbidden, `{"code":"50120","msg":"API key doesn't have permission"}`, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				return stubResponse(tt.status, tt.body), nil
+			})
+
+			client := New("https://www.okx.com", "key", "secret", "pass", 5, 2, false,
+				WithHTTPClient(&http.Client{Transport: transport}), WithMaxBackoff(time.Millisecond))
+
+			_, err := client.GetPositions()
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("expected a StatusError, got: %v", err)
+			}
+			if statusErr.StatusCode != tt.status || statusErr.Retryable() != tt.wantRetry {
+				t.Errorf("expected status %d retryable %v, got %d %v", tt.status, tt.wantRetry, statusErr.StatusCode, statusErr.Retryable())
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tt.wantCalls, got)
+			}
+			if got := client.Stats().Retries; got != int64(tt.wantCalls-1) {
+				t.Errorf("expected %d retries, got %d", tt.wantCalls-1, got)
+			}
+		})
+	}
+
+	// The OKX code is available to callers of a failed request
+	transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+		return stubResponse(http.StatusUnauthorized, `{"code":"50113","msg":"Invalid Sign"}`), nil
+	})
+	client := New("https://www.okx.com", "key", "secret", "pass", 5, 2, false, WithHTTPClient(&http.Client{Transport: transport}))
+	_, err := client.GetPositions()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != "50113" || statusErr.Msg != "Invalid Sign" {
+		t.Errorf("expected code 50113 Invalid Sign, got %v", err)
+	}
+}
+
+func TestPlaceAlgoOrderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		errorMsg string
+	}{
+		{
+			name:     "order-level sCode error",
+			response: `{"code":"0","msg":"","data":[{"algoId":"","sCode":"51008","sMsg":"Insufficient balance"}]}`,
+			errorMsg: "order placement error: code=51008, msg=Insufficient balance",
+		},
+		{
+			name:     "sCode error with failed top-level code",
+			response: `{"code":"1","msg":"","data":[{"algoId":"","sCode":"51279","sMsg":"TP trigger price cannot be lower than the last price"}]}`,
+			errorMsg: "order placement error: code=51279",
+		},
+		{
+			name:     "API-level error code",
+			response: `{"code":"50113","msg":"Invalid sign","data":[]}`,
+			errorMsg: "API error: code=50113, msg=Invalid sign",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			})
+
+			_, err := client.PlaceAlgoOrder(AlgoOrderRequest{InstId: "BTC-USDT-SWAP", OrdType: "conditional", Sz: "1"})
+			if err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestOrderErrorTriggerPriceRejected(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"","sCode":"51280","sMsg":"SL trigger price cannot be higher than the last price"}]}`))
+	})
+
+	_, err := client.PlaceAlgoOrder(AlgoOrderRequest{InstId: "BTC-USDT-SWAP", OrdType: "conditional", Sz: "1"})
+	var orderErr *OrderError
+	if !errors.As(err, &orderErr) {
+		t.Fatalf("expected OrderError, got %v", err)
+	}
+	if !orderErr.TriggerPriceRejected() {
+		t.Errorf("expected sCode %s to be a trigger price rejection", orderErr.SCode)
+	}
+
+	if (&OrderError{SCode: "51008"}).TriggerPriceRejected() {
+		t.Error("insufficient balance is not a trigger price rejection")
+	}
+}
+
+func TestPlaceAlgoOrderSuccess(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req AlgoOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.InstId != "BTC-USDT-SWAP" || req.Sz != "1" || !req.ReduceOnly {
+			t.Errorf("unexpected request: %+v", req)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"abc","sCode":"0","sMsg":""}]}`))
+	})
+
+	resp, err := client.PlaceAlgoOrder(AlgoOrderRequest{InstId: "BTC-USDT-SWAP", OrdType: "conditional", Sz: "1", ReduceOnly: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Data[0].AlgoId != "abc" {
+		t.Errorf("expected algoId abc, got %s", resp.Data[0].AlgoId)
+	}
+}
+
+func TestGetOrderBook(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/market/books" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("instId") != "BTC-USDT-SWAP" || r.URL.Query().Get("sz") != "5" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[{
+			"asks":[["50010.5","12","0","3"],["50011","4","0","1"]],
+			"bids":[["49990.5","7","0","2"],["49990","9","0","4"]],
+			"ts":"1700000000000"}]}`))
+	})
+
+	resp, err := client.GetOrderBook("BTC-USDT-SWAP", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("expected 1 order book, got %d", len(resp.Data))
+	}
+
+	book := resp.Data[0]
+	if len(book.Asks) != 2 || len(book.Bids) != 2 {
+		t.Fatalf("expected 2 levels per side, got asks=%d bids=%d", len(book.Asks), len(book.Bids))
+	}
+
+	bid, ask, err := book.BestBidAsk()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bid != 49990.5 || ask != 50010.5 {
+		t.Errorf("expected bid/ask 49990.5/50010.5, got %f/%f", bid, ask)
+	}
+
+	spread, err := book.SpreadPct()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := 20.0 / 50000.5; spread < expected-1e-12 || spread > expected+1e-12 {
+		t.Errorf("expected spread %f, got %f", expected, spread)
+	}
+}
+
+func TestOrderBookEmptySide(t *testing.T) {
+	book := OrderBookData{Asks: [][]string{{"50010", "1", "0", "1"}}}
+	if _, _, err := book.BestBidAsk(); err == nil {
+		t.Error("expected error for empty bids")
+	}
+}
+
+func TestGetInstruments(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/public/instruments" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("instType") != "SWAP" || r.URL.Query().Get("instId") != "BTC-USDT-SWAP" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instType":"SWAP","instId":"BTC-USDT-SWAP",
+			"ctVal":"0.01","ctMult":"1","ctValCcy":"BTC","ctType":"linear","tickSz":"0.1","lotSz":"0.01","minSz":"0.01"}]}`))
+	})
+
+	resp, err := client.GetInstruments("SWAP", "BTC-USDT-SWAP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("expected 1 instrument, got %d", len(resp.Data))
+	}
+
+	inst := resp.Data[0]
+	if inst.TickSz != "0.1" || inst.CtType != "linear" {
+		t.Errorf("unexpected instrument: %+v", inst)
+	}
+	value, err := inst.ContractValue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != 0.01 {
+		t.Errorf("expected contract value 0.01, got %f", value)
+	}
+}
+
+func TestGetTickers(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/market/tickers" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("instType") != "SWAP" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[
+			{"instType":"SWAP","instId":"BTC-USDT-SWAP","last":"50000.1","bidPx":"50000","askPx":"50000.2"},
+			{"instType":"SWAP","instId":"ETH-USDT-SWAP","last":"3000.5","bidPx":"3000.4","askPx":"3000.6"}]}`))
+	})
+
+	resp, err := client.GetTickers("SWAP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 tickers, got %d", len(resp.Data))
+	}
+	if resp.Data[0].InstId != "BTC-USDT-SWAP" || resp.Data[0].Last != "50000.1" {
+		t.Errorf("unexpected first ticker: %+v", resp.Data[0])
+	}
+	if resp.Data[1].InstId != "ETH-USDT-SWAP" || resp.Data[1].Last != "3000.5" {
+		t.Errorf("unexpected second ticker: %+v", resp.Data[1])
+	}
+}
+
+func TestGetAlgoOrder(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/trade/order-algo" || r.Method != "GET" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.URL.Query().Get("algoId"); got != "123" {
+			t.Errorf("expected algoId 123, got %q", got)
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"123","instId":"BTC-USDT-SWAP","state":"effective"}]}`))
+	})
+
+	resp, err := client.GetAlgoOrder("123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].State != "effective" {
+		t.Errorf("expected effective order, got %+v", resp.Data)
+	}
+}
+
+func TestGetBillsHistory(t *testing.T) {
+	var afters []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/account/bills" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("instType") != "SWAP" || query.Get("limit") != "2" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		afters = append(afters, query.Get("after"))
+
+		if query.Get("after") == "" {
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"billId":"103","instType":"SWAP","instId":"BTC-USDT-SWAP","ccy":"USDT","type":"2","subType":"4",
+				 "bal":"1000.5","balChg":"12.5","pnl":"13","fee":"-0.5","ordId":"o1","ts":"1700000300000"},
+				{"billId":"102","instType":"SWAP","instId":"BTC-USDT-SWAP","ccy":"USDT","type":"8","subType":"173",
+				 "bal":"988","balChg":"-0.2","pnl":"0","fee":"0","ordId":"","ts":"1700000200000"}]}`))
+			return
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[
+			{"billId":"101","instType":"SWAP","instId":"ETH-USDT-SWAP","ccy":"USDT","type":"2","subType":"1",
+			 "bal":"988.2","balChg":"-0.1","pnl":"","fee":"-0.1","ordId":"o0","ts":"1700000100000"}]}`))
+	})
+
+	first, err := client.GetBillsHistory("SWAP", "", "", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Data) != 2 {
+		t.Fatalf("expected 2 bills on the first page, got %d", len(first.Data))
+	}
+
+	bill, err := BillFromOKX(first.Data[0])
+	if err != nil {
+		t.Fatalf("unexpected conversion error: %v", err)
+	}
+	if bill.BillID != "103" || bill.Type != BillTypeTrade || bill.PnL != 13 || bill.Fee != -0.5 || bill.BalanceChange != 12.5 {
+		t.Errorf("unexpected trade bill: %+v", bill)
+	}
+	if !bill.Timestamp.Equal(time.UnixMilli(1700000300000)) {
+		t.Errorf("unexpected timestamp: %s", bill.Timestamp)
+	}
+	if first.Data[1].Type != BillTypeFundingFee || first.Data[1].BalChg != "-0.2" {
+		t.Errorf("unexpected funding bill: %+v", first.Data[1])
+	}
+
+	// The last bill of a full page is the cursor for the next, older page
+	second, err := client.GetBillsHistory("SWAP", "", first.Data[len(first.Data)-1].BillId, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(second.Data) != 1 || second.Data[0].BillId != "101" {
+		t.Errorf("unexpected second page: %+v", second.Data)
+	}
+	if len(afters) != 2 || afters[0] != "" || afters[1] != "102" {
+		t.Errorf("expected after cursors [\"\" 102], got %q", afters)
+	}
+}
+
+func TestFailoverToFallbackURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		fallbacks []string
+		wantHosts []string // hosts of the attempts, in order
+		wantErr   bool
+	}{
+		{
+			name:      "switches after threshold failures and stays",
+			fallbacks: []string{"https://aws.okx.com"},
+			wantHosts: []string{"www.okx.com", "www.okx.com", "aws.okx.com", "aws.okx.com"},
+		},
+		{
+			name: "no fallbacks keeps the primary",
+			// maxRetries 2 gives 3 attempts per request
+			wantHosts: []string{"www.okx.com", "www.okx.com", "www.okx.com", "www.okx.com", "www.okx.com", "www.okx.com"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hosts []string
+			transport := stubTransport(func(req *http.Request) (*http.Response, error) {
+				hosts = append(hosts, req.URL.Host)
+				if req.URL.Host == "www.okx.com" {
+					return nil, errors.New("connection refused")
+				}
+				return stubResponse(http.StatusOK, `{"code":"0","msg":"","data":[]}`), nil
+			})
+			client := New("https://www.okx.com", "key", "secret", "pass", 5, 2, false,
+				WithHTTPClient(&http.Client{Transport: transport}), WithClock(clock.NewFake(time.Now())),
+				WithFallbackURLs(tt.fallbacks, 2))
+
+			// The second request starts on the domain the first one ended on
+			for i := 0; i < 2; i++ {
+				if _, err := client.GetPositions(); (err != nil) != tt.wantErr {
+					t.Fatalf("request %d: error = %v, wantErr %v", i+1, err, tt.wantErr)
+				}
+			}
+			if strings.Join(hosts, ",") != strings.Join(tt.wantHosts, ",") {
+				t.Errorf("expected attempts on %v, got %v", tt.wantHosts, hosts)
+			}
+		})
+	}
+}
+
+func TestWithConnectionPool(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+	tests := []struct {
+		name               string
+		maxIdle, perHost   int
+		idleTimeout        time.Duration
+		wantIdle, wantHost int
+		wantTimeout        time.Duration
+	}{
+		{"custom settings", 20, 5, 2 * time.Minute, 20, 5, 2 * time.Minute},
+		{"zero keeps Go defaults", 0, 0, 0, defaults.MaxIdleConns, defaults.MaxIdleConnsPerHost, defaults.IdleConnTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New("https://www.okx.com", "key", "secret", "pass", 5, 0, false,
+				WithConnectionPool(tt.maxIdle, tt.perHost, tt.idleTimeout))
+
+			transport, ok := client.httpClient.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("expected an *http.Transport, got %T", client.httpClient.Transport)
+			}
+			if transport == defaults {
+				t.Fatal("the shared default transport must not be modified")
+			}
+			if transport.MaxIdleConns != tt.wantIdle || transport.MaxIdleConnsPerHost != tt.wantHost || transport.IdleConnTimeout != tt.wantTimeout {
+				t.Errorf("expected pool %d/%d/%v, got %d/%d/%v", tt.wantIdle, tt.wantHost, tt.wantTimeout,
+					transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package okx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// PositionFromOKX 将OKX持仓数据转换为持仓模型 / Convert OKX position data to position model
+// 解析持仓数值字段并规范化持仓方向和保证金模式，供监控服务和TPSL调度器共用
+// Parse numeric position fields and normalize position side and margin mode,
+// shared by the monitoring service and the TPSL scheduler
+//
+// 转换规则 / Conversion Rules:
+//   - 仓位为0时跳过 / Zero size is skipped
+//   - 空posSide视为net（单向持仓模式）/ Empty posSide is treated as net (one-way mode)
+//   - 空mgnMode视为cross / Empty mgnMode is treated as cross
+//   - net模式下负仓位表示空头，保留符号；long/short模式下仓位不能为负
+//     In net mode a negative size means short and the sign is kept; in long/short mode size cannot be negative
+//   - 可选字段（盈亏、保证金、杠杆、强平价、标记价、美元名义价值）解析失败时默认为0
+//     Optional fields (PnL, margin, leverage, liquidation and mark price, USD notional) default to 0 when they fail to parse
+//
+// 调用方负责设置Timestamp字段 / Caller is responsible for setting the Timestamp field
+//
+// Parameters:
+//   - raw: OKX API返回的持仓数据 / Position data returned by OKX API
+//
+// Returns:
+//   - *models.Position: 转换后的持仓模型 / Converted position model
+//   - bool: 是否跳过该持仓（零仓位）/ Whether the position should be skipped (zero size)
+//   - error: 必需字段无效时返回错误 / Error when a required field is invalid
+//     例如 / Examples: unparseable size or average price, unknown posSide or mgnMode
+func PositionFromOKX(raw PositionData) (*models.Position, bool, error) {
+	posSize, err := strconv.ParseFloat(raw.Pos, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse position size '%s' for %s: %w", raw.Pos, raw.InstId, err)
+	}
+	if posSize == 0 {
+		return nil, true, nil // Skip positions with zero size
+	}
+
+	// Normalize position side
+	posSide := models.PositionSide(raw.PosSide)
+	if posSide == "" {
+		posSide = models.PositionSideNet // Default for one-way mode
+	}
+	if !posSide.IsValid() {
+		return nil, false, fmt.Errorf("unknown position side '%s' for %s", raw.PosSide, raw.InstId)
+	}
+	if posSize < 0 && posSide != models.PositionSideNet {
+		return nil, false, fmt.Errorf("negative position size %s for %s position %s", raw.Pos, posSide, raw.InstId)
+	}
+
+	// Map margin mode (cross or isolated)
+	marginMode := models.MarginMode(raw.MgnMode)
+	if marginMode == "" {
+		marginMode = models.MarginModeCross // Default to cross if not specified
+	}
+	if !marginMode.IsValid() {
+		return nil, false, fmt.Errorf("unsupported margin mode '%s' for %s", raw.MgnMode, raw.InstId)
+	}
+
+	avgPrice, err := strconv.ParseFloat(raw.AvgPx, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse average price '%s' for %s: %w", raw.AvgPx, raw.InstId, err)
+	}
+
+	var attached []models.AttachedTPSL
+	for _, algo := range raw.CloseOrderAlgo {
+		attached = append(attached, models.AttachedTPSL{
+			AlgoId:        algo.AlgoId,
+			TpTriggerPx:   ParseOptionalFloat(algo.TpTriggerPx),
+			SlTriggerPx:   ParseOptionalFloat(algo.SlTriggerPx),
+			CloseFraction: ParseOptionalFloat(algo.CloseFraction),
+		})
+	}
+
+	return &models.Position{
+		Instrument:    raw.InstId,
+		PositionSide:  posSide,
+		PositionSize:  posSize,
+		AveragePrice:  avgPrice,
+		UnrealizedPnL: ParseOptionalFloat(raw.Upl),
+		Margin:        ParseOptionalFloat(raw.Margin),
+		Leverage:      ParseOptionalFloat(raw.Lever),
+		MarginMode:    marginMode,
+		LiqPx:         ParseOptionalFloat(raw.LiqPx),
+		MarkPx:        ParseOptionalFloat(raw.MarkPx),
+		NotionalUSD:   math.Abs(ParseOptionalFloat(raw.NotionalUsd)), // unsigned even for net-mode shorts
+		OpenedAt:      parseOptionalMillis(raw.CTime),
+		AttachedTPSL:  attached,
+	}, false, nil
+}
+
+// BalanceFromOKX 将OKX单币种余额转换为余额模型 / Convert an OKX currency balance to balance model
+// 字段选择 / Field choice:
+//   - Balance: 以该币种计价的数量。保证金模式账户使用eq（现金余额加未实现盈亏），
+//     简单交易模式账户没有未实现盈亏，使用cashBal；首选字段为空时使用另一个
+//     Amount in the currency itself. Margin accounts use eq (cash balance plus unrealized PnL);
+//     simple mode accounts have no unrealized PnL and use cashBal; the other field is used when
+//     the preferred one is empty
+//   - Equity: 权益的美元估值eqUsd，缺失时为0 / Equity valued in USD from eqUsd, 0 when missing
+//   - UnrealizedPnL: upl，单位为该币种，简单交易模式下为空即0 / upl in the currency itself, empty (0) in simple mode
+//
+// 调用方负责设置Timestamp字段 / Caller is responsible for setting the Timestamp field
+//
+// Parameters:
+//   - account: 余额所属的账户数据，用于判断账户模式 / Account data the detail belongs to, decides the account mode
+//   - detail: 单币种余额详情 / Per-currency balance detail
+//
+// Returns:
+//   - *models.AccountBalance: 转换后的余额 / Converted balance
+//   - error: 余额或可用余额无法解析时返回错误 / Error when the balance or available balance can't be parsed
+func BalanceFromOKX(account *AccountBalanceData, detail AccountBalanceDetail) (*models.AccountBalance, error) {
+	margin := account.IsMarginAccount()
+
+	preferred, fallback := detail.CashBal, detail.Eq
+	if margin {
+		preferred, fallback = detail.Eq, detail.CashBal
+	}
+	if preferred == "" {
+		preferred = fallback
+	}
+	balance, err := strconv.ParseFloat(preferred, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse balance '%s' for %s: %w", preferred, detail.Ccy, err)
+	}
+
+	available, err := strconv.ParseFloat(detail.AvailBal, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse available balance '%s' for %s: %w", detail.AvailBal, detail.Ccy, err)
+	}
+
+	return &models.AccountBalance{
+		Currency:      detail.Ccy,
+		Balance:       balance,
+		Available:     available,
+		Frozen:        ParseOptionalFloat(detail.FrozenBal),
+		Equity:        ParseOptionalFloat(detail.EqUsd),
+		UnrealizedPnL: ParseOptionalFloat(detail.Upl),
+	}, nil
+}
+
+// BillFromOKX 将OKX账单数据转换为账单模型 / Convert OKX bill data to bill model
+// 数值字段解析失败时默认为0 / Numeric fields default to 0 when they fail to parse
+//
+// Parameters:
+//   - raw: OKX API返回的账单数据 / Bill data returned by OKX API
+//
+// Returns:
+//   - *models.Bill: 转换后的账单 / Converted bill
+//   - error: 账单ID为空或时间戳无法解析时返回错误 / Error when the bill ID is empty or the timestamp can't be parsed
+func BillFromOKX(raw BillData) (*models.Bill, error) {
+	if raw.BillId == "" {
+		return nil, fmt.Errorf("bill has no billId")
+	}
+	ms, err := strconv.ParseInt(raw.Ts, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp '%s' for bill %s: %w", raw.Ts, raw.BillId, err)
+	}
+
+	return &models.Bill{
+		BillID:        raw.BillId,
+		Timestamp:     time.UnixMilli(ms).UTC(),
+		InstType:      raw.InstType,
+		Instrument:    raw.InstId,
+		Currency:      raw.Ccy,
+		Type:          raw.Type,
+		SubType:       raw.SubType,
+		BalanceChange: ParseOptionalFloat(raw.BalChg),
+		Balance:       ParseOptionalFloat(raw.Bal),
+		PnL:           ParseOptionalFloat(raw.Pnl),
+		Fee:           ParseOptionalFloat(raw.Fee),
+		OrderID:       raw.OrdId,
+	}, nil
+}
+
+// ParseOptionalFloat 解析可选数值字段 / Parse optional numeric field
+// OKX对未知值返回空字符串，解析失败时返回0。供直接读取原始响应字段的调用方使用
+// OKX returns an empty string for unknown values; returns 0 on parse failure. For callers
+// reading raw response fields directly
+func ParseOptionalFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// parseOptionalMillis 解析可选的毫秒时间戳 / Parse an optional millisecond timestamp
+// 为空或解析失败时返回零值时间 / Returns the zero time when empty or unparsable
+func parseOptionalMillis(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+// BestBidAsk 获取最优买卖价 / Get best bid and ask prices
+//
+// Returns:
+//   - float64: 最优买价 / Best bid price
+//   - float64: 最优卖价 / Best ask price
+//   - error: 深度为空或价格无法解析时返回错误 / Error when a side is empty or a price can't be parsed
+func (d *OrderBookData) BestBidAsk() (float64, float64, error) {
+	if len(d.Bids) == 0 || len(d.Bids[0]) == 0 || len(d.Asks) == 0 || len(d.Asks[0]) == 0 {
+		return 0, 0, fmt.Errorf("order book has no bids or asks")
+	}
+
+	bid, err := strconv.ParseFloat(d.Bids[0][0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse best bid '%s': %w", d.Bids[0][0], err)
+	}
+	ask, err := strconv.ParseFloat(d.Asks[0][0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse best ask '%s': %w", d.Asks[0][0], err)
+	}
+
+	return bid, ask, nil
+}
+
+// SpreadPct 计算买卖价差占中间价的比例 / Compute bid-ask spread as a fraction of the mid price
+//
+// Returns:
+//   - float64: 价差比例 / Spread fraction (e.g., 0.001 = 0.1%)
+//   - error: 无法获取最优买卖价时返回错误 / Error when best bid/ask are unavailable
+func (d *OrderBookData) SpreadPct() (float64, error) {
+	bid, ask, err := d.BestBidAsk()
+	if err != nil {
+		return 0, err
+	}
+	mid := (bid + ask) / 2
+	if mid <= 0 {
+		return 0, fmt.Errorf("invalid mid price: %.8f", mid)
+	}
+	return (ask - bid) / mid, nil
+}
+
+// InstTypeFromID 根据交易对ID推断产品类型 / Infer instrument type from instrument ID
+// 例如 / e.g., BTC-USDT-SWAP → SWAP, BTC-USD-250328 → FUTURES, BTC-USD-250328-100000-C → OPTION, BTC-USDT → SPOT
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID
+//
+// Returns:
+//   - string: 产品类型 / Instrument type
+func InstTypeFromID(instId string) string {
+	parts := strings.Split(instId, "-")
+	switch {
+	case len(parts) == 3 && parts[2] == "SWAP":
+		return "SWAP"
+	case len(parts) == 3:
+		return "FUTURES"
+	case len(parts) == 5:
+		return "OPTION"
+	default:
+		return "SPOT"
+	}
+}
+
+// ContractValue 合约面值乘以乘数 / Contract value times multiplier
+// 现货/杠杆无合约面值时返回1（数量即为币数）
+// Returns 1 for spot/margin instruments without a contract value (size is in base currency)
+//
+// Returns:
+//   - float64: 每张合约对应的面值 / Value represented by one contract
+//   - error: 面值无法解析时返回错误 / Error when the contract value can't be parsed
+func (d *InstrumentData) ContractValue() (float64, error) {
+	if d.CtVal == "" {
+		return 1, nil
+	}
+
+	ctVal, err := strconv.ParseFloat(d.CtVal, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ctVal '%s': %w", d.CtVal, err)
+	}
+	ctMult := 1.0
+	if d.CtMult != "" {
+		if ctMult, err = strconv.ParseFloat(d.CtMult, 64); err != nil {
+			return 0, fmt.Errorf("failed to parse ctMult '%s': %w", d.CtMult, err)
+		}
+	}
+	if ctVal <= 0 || ctMult <= 0 {
+		return 0, fmt.Errorf("invalid contract value: ctVal=%s, ctMult=%s", d.CtVal, d.CtMult)
+	}
+
+	return ctVal * ctMult, nil
+}
@@ -0,0 +1,281 @@
+package okx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+func TestPositionFromOKX(t *testing.T) {
+	raw := PositionData{
+		InstId:  "BTC-USDT-SWAP",
+		MgnMode: "isolated",
+		PosSide: "long",
+		Pos:     "2",
+		AvgPx:   "50000.5",
+		Upl:     "12.3",
+		Margin:  "1000",
+		Lever:   "10",
+		LiqPx:   "45500",
+		MarkPx:  "50100.25",
+		CTime:   "1704067200000",
+	}
+
+	position, skip, err := PositionFromOKX(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if skip {
+		t.Fatal("expected position not to be skipped")
+	}
+
+	expected := models.Position{
+		Instrument:    "BTC-USDT-SWAP",
+		PositionSide:  models.PositionSideLong,
+		PositionSize:  2,
+		AveragePrice:  50000.5,
+		UnrealizedPnL: 12.3,
+		Margin:        1000,
+		Leverage:      10,
+		MarginMode:    models.MarginModeIsolated,
+		LiqPx:         45500,
+		MarkPx:        50100.25,
+		OpenedAt:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(*position, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *position)
+	}
+}
+
+func TestPositionFromOKXCloseOrderAlgo(t *testing.T) {
+	raw := PositionData{
+		InstId:  "BTC-USDT-SWAP",
+		PosSide: "long",
+		Pos:     "2",
+		AvgPx:   "50000",
+		CloseOrderAlgo: []CloseOrderAlgoItem{
+			{AlgoId: "a1", TpTriggerPx: "55000", SlTriggerPx: "48000", CloseFraction: "1"},
+			{AlgoId: "a2", SlTriggerPx: "47000", CloseFraction: "0.5"},
+		},
+	}
+
+	position, _, err := PositionFromOKX(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []models.AttachedTPSL{
+		{AlgoId: "a1", TpTriggerPx: 55000, SlTriggerPx: 48000, CloseFraction: 1},
+		{AlgoId: "a2", SlTriggerPx: 47000, CloseFraction: 0.5},
+	}
+	if !reflect.DeepEqual(position.AttachedTPSL, expected) {
+		t.Errorf("expected attached TP/SL %+v, got %+v", expected, position.AttachedTPSL)
+	}
+}
+
+func TestPositionFromOKXZeroSize(t *testing.T) {
+	position, skip, err := PositionFromOKX(PositionData{InstId: "BTC-USDT-SWAP", Pos: "0", AvgPx: "50000"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !skip {
+		t.Error("expected zero-size position to be skipped")
+	}
+	if position != nil {
+		t.Errorf("expected nil position, got %+v", position)
+	}
+}
+
+func TestPositionFromOKXEdgeCases(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          PositionData
+		expectError  bool
+		expectSkip   bool
+		expectSide   models.PositionSide
+		expectSize   float64
+		expectMode   models.MarginMode
+		expectUpl    float64
+		expectMargin float64
+	}{
+		{
+			name:       "empty posSide defaults to net",
+			raw:        PositionData{InstId: "BTC-USDT-SWAP", Pos: "1", AvgPx: "50000"},
+			expectSide: models.PositionSideNet,
+			expectSize: 1,
+			expectMode: models.MarginModeCross,
+		},
+		{
+			name:       "negative size in net mode is short",
+			raw:        PositionData{InstId: "BTC-USDT-SWAP", PosSide: "net", MgnMode: "cross", Pos: "-3", AvgPx: "50000"},
+			expectSide: models.PositionSideNet,
+			expectSize: -3,
+			expectMode: models.MarginModeCross,
+		},
+		{
+			name:        "negative size in hedge mode",
+			raw:         PositionData{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "-3", AvgPx: "50000"},
+			expectError: true,
+		},
+		{
+			name:        "unparseable size",
+			raw:         PositionData{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "abc", AvgPx: "50000"},
+			expectError: true,
+		},
+		{
+			name:        "unparseable average price",
+			raw:         PositionData{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "1", AvgPx: ""},
+			expectError: true,
+		},
+		{
+			name:         "unparseable optional fields default to zero",
+			raw:          PositionData{InstId: "BTC-USDT-SWAP", PosSide: "short", MgnMode: "isolated", Pos: "1", AvgPx: "50000", Upl: "", Margin: "n/a", Lever: ""},
+			expectSide:   models.PositionSideShort,
+			expectSize:   1,
+			expectMode:   models.MarginModeIsolated,
+			expectUpl:    0,
+			expectMargin: 0,
+		},
+		{
+			name:        "unknown posSide",
+			raw:         PositionData{InstId: "BTC-USDT-SWAP", PosSide: "both", Pos: "1", AvgPx: "50000"},
+			expectError: true,
+		},
+		{
+			name:        "unsupported margin mode",
+			raw:         PositionData{InstId: "BTC-USDT", MgnMode: "cash", Pos: "1", AvgPx: "50000"},
+			expectError: true,
+		},
+		{
+			name:       "zero size is skipped",
+			raw:        PositionData{InstId: "BTC-USDT-SWAP", PosSide: "long", Pos: "0", AvgPx: ""},
+			expectSkip: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position, skip, err := PositionFromOKX(tt.raw)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if skip != tt.expectSkip {
+				t.Fatalf("expected skip=%v, got %v", tt.expectSkip, skip)
+			}
+			if skip {
+				return
+			}
+			if position.PositionSide != tt.expectSide {
+				t.Errorf("expected side %s, got %s", tt.expectSide, position.PositionSide)
+			}
+			if position.PositionSize != tt.expectSize {
+				t.Errorf("expected size %f, got %f", tt.expectSize, position.PositionSize)
+			}
+			if position.MarginMode != tt.expectMode {
+				t.Errorf("expected margin mode %s, got %s", tt.expectMode, position.MarginMode)
+			}
+			if position.UnrealizedPnL != tt.expectUpl {
+				t.Errorf("expected upl %f, got %f", tt.expectUpl, position.UnrealizedPnL)
+			}
+			if position.Margin != tt.expectMargin {
+				t.Errorf("expected margin %f, got %f", tt.expectMargin, position.Margin)
+			}
+			if err := position.Validate(); err != nil {
+				t.Errorf("converted position failed validation: %v", err)
+			}
+		})
+	}
+}
+
+func TestInstTypeFromID(t *testing.T) {
+	tests := []struct {
+		instId   string
+		expected string
+	}{
+		{"BTC-USDT-SWAP", "SWAP"},
+		{"BTC-USD-250328", "FUTURES"},
+		{"BTC-USD-250328-100000-C", "OPTION"},
+		{"BTC-USDT", "SPOT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.instId, func(t *testing.T) {
+			if got := InstTypeFromID(tt.instId); got != tt.expected {
+				t.Errorf("InstTypeFromID(%s) = %s, want %s", tt.instId, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBalanceFromOKX(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected models.AccountBalance
+	}{
+		{
+			// Margin mode: eq includes unrealized PnL and differs from cashBal
+			name: "unified margin account",
+			response: `{"code":"0","msg":"","data":[{"totalEq":"52000","adjEq":"51000","imr":"2000","mmr":"200","mgnRatio":"25.5",
+				"details":[{"ccy":"BTC","eq":"1.05","cashBal":"1","availBal":"0.9","frozenBal":"0.1","upl":"0.05","eqUsd":"52000"}]}]}`,
+			expected: models.AccountBalance{Currency: "BTC", Balance: 1.05, Available: 0.9, Frozen: 0.1, Equity: 52000, UnrealizedPnL: 0.05},
+		},
+		{
+			// Simple mode: no margin fields, cashBal is the balance and upl is empty
+			name: "simple spot account",
+			response: `{"code":"0","msg":"","data":[{"totalEq":"1000","adjEq":"","imr":"","mmr":"","mgnRatio":"",
+				"details":[{"ccy":"USDT","eq":"1000.2","cashBal":"1000","availBal":"990","frozenBal":"10","upl":"","eqUsd":"1000.1"}]}]}`,
+			expected: models.AccountBalance{Currency: "USDT", Balance: 1000, Available: 990, Frozen: 10, Equity: 1000.1},
+		},
+		{
+			name: "simple account without cashBal falls back to eq",
+			response: `{"code":"0","msg":"","data":[{"totalEq":"500","details":[
+				{"ccy":"ETH","eq":"0.2","availBal":"0.2","frozenBal":"0","eqUsd":"500"}]}]}`,
+			expected: models.AccountBalance{Currency: "ETH", Balance: 0.2, Available: 0.2, Equity: 500},
+		},
+		{
+			name: "margin account without eqUsd",
+			response: `{"code":"0","msg":"","data":[{"totalEq":"100","imr":"10","mmr":"1","details":[
+				{"ccy":"USDT","eq":"100","cashBal":"95","availBal":"80","frozenBal":"20","upl":"5"}]}]}`,
+			expected: models.AccountBalance{Currency: "USDT", Balance: 100, Available: 80, Frozen: 20, UnrealizedPnL: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp AccountBalanceResponse
+			if err := json.Unmarshal([]byte(tt.response), &resp); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+
+			account := resp.Data[0]
+			balance, err := BalanceFromOKX(&account, account.Details[0])
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*balance, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, *balance)
+			}
+		})
+	}
+}
+
+func TestBalanceFromOKXInvalid(t *testing.T) {
+	account := AccountBalanceData{}
+	if _, err := BalanceFromOKX(&account, AccountBalanceDetail{Ccy: "BTC", AvailBal: "1"}); err == nil {
+		t.Error("expected error without eq or cashBal")
+	}
+	if _, err := BalanceFromOKX(&account, AccountBalanceDetail{Ccy: "BTC", CashBal: "1", AvailBal: "x"}); err == nil {
+		t.Error("expected error for unparsable availBal")
+	}
+}
@@ -0,0 +1,106 @@
+package okx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// triggerPriceRejectCodes 触发价在最新价错误一侧时的拒单码 / sCodes for a trigger price on the wrong side of the last price
+var triggerPriceRejectCodes = map[string]bool{
+	"51277": true, // TP trigger price cannot be higher than the last price
+	"51278": true, // SL trigger price cannot be lower than the last price
+	"51279": true, // TP trigger price cannot be lower than the last price
+	"51280": true, // SL trigger price cannot be higher than the last price
+}
+
+// duplicateClientIdCodes 客户端订单ID重复的拒单码 / sCodes for a client order ID that already exists
+var duplicateClientIdCodes = map[string]bool{
+	"51016": true, // Duplicated clOrdId
+	"51065": true, // algoClOrdId already exists
+}
+
+// OrderError 订单级错误 / Order-level error reported in a response's sCode
+type OrderError struct {
+	SCode string
+	SMsg  string
+}
+
+// Error 实现error接口 / Implement the error interface
+func (e *OrderError) Error() string {
+	return fmt.Sprintf("order placement error: code=%s, msg=%s", e.SCode, e.SMsg)
+}
+
+// TriggerPriceRejected 判断是否因触发价已越过最新价被拒 / Check whether the trigger price was rejected against the last price
+// 通常是读取行情与下单之间价格变动造成的 / Usually caused by price moving between the ticker read and the order
+func (e *OrderError) TriggerPriceRejected() bool {
+	return triggerPriceRejectCodes[e.SCode]
+}
+
+// DuplicateClientOrderId 判断是否因客户端订单ID重复被拒 / Check whether the client order ID was rejected as a duplicate
+// 发送确定性ID时，这表示同一订单此前已下单成功 / With deterministic IDs this means the same order was already placed
+func (e *OrderError) DuplicateClientOrderId() bool {
+	return duplicateClientIdCodes[e.SCode]
+}
+
+// maintenanceCodes OKX维护或系统繁忙时的错误码 / Error codes returned during OKX maintenance or overload
+// 这些错误会在维护结束后自行恢复，GET请求重试时使用更长的退避；其中50004和51054表示请求超时、
+// 结果未知，因此POST请求不重试，以免重复下单
+// These clear by themselves once maintenance ends, so GET requests are retried with a longer
+// backoff; 50004 and 51054 mean the request timed out with an unknown outcome, so POST requests
+// are not retried to avoid placing an order twice
+var maintenanceCodes = map[string]bool{
+	"50001": true, // Service temporarily unavailable
+	"50004": true, // API endpoint request timeout
+	"50013": true, // Systems are busy, please try again later
+	"50026": true, // System error, please try again later
+	"51054": true, // Request timed out, please try again later
+}
+
+// MaintenanceError OKX维护错误 / OKX maintenance error
+// HTTP 503或响应码属于maintenanceCodes时返回
+// Returned on HTTP 503 or when the response code is one of maintenanceCodes
+type MaintenanceError struct {
+	Code string
+	Msg  string
+}
+
+// Error 实现error接口 / Implement the error interface
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("OKX in maintenance: code=%s, msg=%s", e.Code, e.Msg)
+}
+
+// IsMaintenance 判断错误是否由OKX维护引起 / Check whether an error is caused by OKX maintenance
+//
+// Parameters:
+//   - err: 客户端返回的错误 / Error returned by the client
+//
+// Returns:
+//   - bool: 是否为维护错误 / Whether the error is a maintenance error
+func IsMaintenance(err error) bool {
+	var maintenanceErr *MaintenanceError
+	return errors.As(err, &maintenanceErr)
+}
+
+// StatusError 非200的HTTP响应 / Non-200 HTTP response
+// Code和Msg取自响应体，响应体不是JSON时为空
+// Code and Msg come from the response body and are empty when it isn't JSON
+type StatusError struct {
+	StatusCode int
+	Code       string
+	Msg        string
+	Body       string
+}
+
+// Error 实现error接口 / Implement the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable 判断重试是否可能成功 / Check whether a retry can succeed
+// 5xx和408是临时故障；其余4xx（签名无效、请求格式错误、权限不足）重试只会得到相同结果
+// 5xx and 408 are transient; other 4xx responses (invalid signature, malformed request,
+// insufficient permission) fail identically on every retry
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusRequestTimeout
+}
@@ -0,0 +1,89 @@
+package okx
+
+import "sync"
+
+// defaultFailoverThreshold 默认切换域名前的连续失败次数 / Default consecutive failures before switching domain
+const defaultFailoverThreshold = 3
+
+// failover OKX域名故障切换状态 / OKX domain failover state
+// 当前域名连续失败达到阈值后轮换到下一个域名，任何响应都会清零失败计数
+// Moves on to the next domain once the active one fails threshold times in a row; any response
+// resets the count
+type failover struct {
+	mu        sync.Mutex
+	urls      []string // primary URL first, then the fallbacks in order
+	active    int      // index into urls of the domain requests go to
+	failures  int      // consecutive failed attempts on the active domain
+	threshold int
+}
+
+// WithFallbackURLs 设置备用OKX域名 / Set fallback OKX domains
+// 如https://aws.okx.com、https://app.okx.com。当前域名连续threshold次请求尝试因网络错误或5xx失败后，
+// 切换到下一个域名并记录日志，最后一个之后回到主域名；单次失败不会切换。
+// 未设置时只使用apiURL；threshold非正值使用默认值3
+// E.g. https://aws.okx.com, https://app.okx.com. Once threshold request attempts in a row fail on
+// the active domain with a network error or a 5xx, requests move to the next domain and the switch
+// is logged, wrapping back to the primary after the last one; a single failure never switches.
+// Without fallbacks only apiURL is used; a non-positive threshold uses the default of 3
+//
+// Parameters:
+//   - urls: 备用基础URL，按尝试顺序 / Fallback base URLs, in the order they are tried
+//   - threshold: 切换前的连续失败次数 / Consecutive failures before switching
+func WithFallbackURLs(urls []string, threshold int) Option {
+	return func(c *Client) {
+		if len(urls) == 0 {
+			return
+		}
+		if threshold <= 0 {
+			threshold = defaultFailoverThreshold
+		}
+		c.failover = &failover{
+			urls:      append([]string{c.apiURL}, urls...),
+			threshold: threshold,
+		}
+	}
+}
+
+// baseURL 返回当前使用的基础URL / Return the base URL requests currently go to
+func (c *Client) baseURL() string {
+	if c.failover == nil {
+		return c.apiURL
+	}
+	c.failover.mu.Lock()
+	defer c.failover.mu.Unlock()
+	return c.failover.urls[c.failover.active]
+}
+
+// recordDomainResult 记录一次请求尝试的结果 / Record the outcome of a request attempt
+// 失败只计入仍为当前域名的请求，避免并发请求重复切换
+// Failures only count while their domain is still active, so concurrent requests don't switch twice
+//
+// Parameters:
+//   - base: 本次尝试使用的基础URL / Base URL the attempt used
+//   - failed: 是否因网络错误或5xx失败 / Whether it failed with a network error or a 5xx
+func (c *Client) recordDomainResult(base string, failed bool) {
+	f := c.failover
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.urls[f.active] != base {
+		return
+	}
+	if !failed {
+		f.failures = 0
+		return
+	}
+	f.failures++
+	if f.failures < f.threshold {
+		return
+	}
+
+	f.active = (f.active + 1) % len(f.urls)
+	f.failures = 0
+	if c.logger != nil {
+		c.logger.Warn("OKX domain %s failed %d requests in a row, switching to %s", base, f.threshold, f.urls[f.active])
+	}
+}
@@ -0,0 +1,35 @@
+package okx
+
+import (
+	"net/http"
+	"time"
+)
+
+// WithConnectionPool 设置HTTP连接池 / Tune the HTTP connection pool
+// 以调整后的默认Transport替换默认客户端，使空闲连接在轮询间隔之间保持可用，
+// 避免每个周期重新建立TCP和TLS连接。非正值保持Go的默认值（共100、每主机2、90秒）。
+// 会替换WithHTTPClient设置的客户端，反之亦然，以最后一个选项为准
+// Replaces the default client with one on a tuned copy of the default transport, so idle
+// connections stay open across polling intervals instead of paying a new TCP and TLS handshake
+// every cycle. Non-positive values keep Go's defaults (100 total, 2 per host, 90s). Replaces a
+// client set by WithHTTPClient and vice versa, the last option wins
+//
+// Parameters:
+//   - maxIdleConns: 所有主机的最大空闲连接数 / Maximum idle connections across all hosts
+//   - maxIdleConnsPerHost: 每个主机的最大空闲连接数 / Maximum idle connections per host
+//   - idleConnTimeout: 空闲连接关闭前保持的时间 / How long an idle connection is kept before closing
+func WithConnectionPool(maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if maxIdleConns > 0 {
+			transport.MaxIdleConns = maxIdleConns
+		}
+		if maxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		}
+		if idleConnTimeout > 0 {
+			transport.IdleConnTimeout = idleConnTimeout
+		}
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
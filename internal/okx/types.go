@@ -2,100 +2,121 @@ package okx
 
 // AccountBalanceResponse OKX账户余额响应 / OKX account balance response
 type AccountBalanceResponse struct {
-	Code string `json:"code"`
-	Msg  string `json:"msg"`
-	Data []struct {
-		TotalEq     string `json:"totalEq"`
-		IsoEq       string `json:"isoEq"`
-		AdjEq       string `json:"adjEq"`
-		OrdFroz     string `json:"ordFroz"`
-		Imr         string `json:"imr"`
-		Mmr         string `json:"mmr"`
-		MgnRatio    string `json:"mgnRatio"`
-		NotionalUsd string `json:"notionalUsd"`
-		UTime       string `json:"uTime"`
-		Details     []struct {
-			Ccy           string `json:"ccy"`
-			Eq            string `json:"eq"`
-			CashBal       string `json:"cashBal"`
-			AvailBal      string `json:"availBal"`
-			FrozenBal     string `json:"frozenBal"`
-			OrdFrozen     string `json:"ordFrozen"`
-			Liab          string `json:"liab"`
-			Upl           string `json:"upl"`
-			UplLib        string `json:"uplLib"`
-			CrossLiab     string `json:"crossLiab"`
-			IsoLiab       string `json:"isoLiab"`
-			MgnRatio      string `json:"mgnRatio"`
-			Interest      string `json:"interest"`
-			Twap          string `json:"twap"`
-			MaxLoan       string `json:"maxLoan"`
-			EqUsd         string `json:"eqUsd"`
-			NotionalLever string `json:"notionalLever"`
-			StgyEq        string `json:"stgyEq"`
-			IsoUpl        string `json:"isoUpl"`
-			SpotInUseAmt  string `json:"spotInUseAmt"`
-		} `json:"details"`
-	} `json:"data"`
+	Code string               `json:"code"`
+	Msg  string               `json:"msg"`
+	Data []AccountBalanceData `json:"data"`
+}
+
+// AccountBalanceData OKX账户余额数据 / OKX account balance data
+type AccountBalanceData struct {
+	TotalEq     string                 `json:"totalEq"`
+	IsoEq       string                 `json:"isoEq"`
+	AdjEq       string                 `json:"adjEq"`
+	OrdFroz     string                 `json:"ordFroz"`
+	Imr         string                 `json:"imr"`
+	Mmr         string                 `json:"mmr"`
+	MgnRatio    string                 `json:"mgnRatio"`
+	NotionalUsd string                 `json:"notionalUsd"`
+	UTime       string                 `json:"uTime"`
+	Details     []AccountBalanceDetail `json:"details"`
+}
+
+// IsMarginAccount 是否为保证金模式账户 / Whether the account trades on margin
+// 简单交易模式（acctLv 1，仅现货）不返回保证金字段；单币种、跨币种和组合保证金模式会返回imr/mmr，
+// 跨币种和组合保证金模式还返回adjEq
+// Simple mode (acctLv 1, spot only) leaves the margin fields empty; single-currency,
+// multi-currency and portfolio margin modes report imr/mmr, the latter two also adjEq
+func (a *AccountBalanceData) IsMarginAccount() bool {
+	return a.Imr != "" || a.Mmr != "" || a.MgnRatio != "" || a.AdjEq != ""
+}
+
+// AccountBalanceDetail OKX单币种余额详情 / OKX per-currency balance detail
+// eq为该币种计价的权益（含未实现盈亏），cashBal为现金余额，eqUsd为权益的美元估值
+// eq is equity in the currency itself (including unrealized PnL), cashBal is the cash balance and
+// eqUsd is the equity valued in USD
+type AccountBalanceDetail struct {
+	Ccy           string `json:"ccy"`
+	Eq            string `json:"eq"`
+	CashBal       string `json:"cashBal"`
+	AvailBal      string `json:"availBal"`
+	FrozenBal     string `json:"frozenBal"`
+	OrdFrozen     string `json:"ordFrozen"`
+	Liab          string `json:"liab"`
+	Upl           string `json:"upl"`
+	UplLib        string `json:"uplLib"`
+	CrossLiab     string `json:"crossLiab"`
+	IsoLiab       string `json:"isoLiab"`
+	MgnRatio      string `json:"mgnRatio"`
+	Interest      string `json:"interest"`
+	Twap          string `json:"twap"`
+	MaxLoan       string `json:"maxLoan"`
+	EqUsd         string `json:"eqUsd"`
+	NotionalLever string `json:"notionalLever"`
+	StgyEq        string `json:"stgyEq"`
+	IsoUpl        string `json:"isoUpl"`
+	SpotInUseAmt  string `json:"spotInUseAmt"`
 }
 
 // PositionsResponse OKX持仓响应 / OKX positions response
 type PositionsResponse struct {
-	Code string `json:"code"`
-	Msg  string `json:"msg"`
-	Data []struct {
-		InstType      string `json:"instType"`
-		MgnMode       string `json:"mgnMode"`
-		PosId         string `json:"posId"`
-		PosSide       string `json:"posSide"`
-		Pos           string `json:"pos"`
-		BaseBal       string `json:"baseBal"`
-		QuoteBal      string `json:"quoteBal"`
-		PosCcy        string `json:"posCcy"`
-		AvailPos      string `json:"availPos"`
-		AvgPx         string `json:"avgPx"`
-		Upl           string `json:"upl"`
-		UplRatio      string `json:"uplRatio"`
-		UplLastPx     string `json:"uplLastPx"`
-		UplRatioLastPx string `json:"uplRatioLastPx"`
-		InstId        string `json:"instId"`
-		Lever         string `json:"lever"`
-		LiqPx         string `json:"liqPx"`
-		MarkPx        string `json:"markPx"`
-		Imr           string `json:"imr"`
-		Margin        string `json:"margin"`
-		MgnRatio      string `json:"mgnRatio"`
-		Mmr           string `json:"mmr"`
-		Liab          string `json:"liab"`
-		LiabCcy       string `json:"liabCcy"`
-		Interest      string `json:"interest"`
-		TradeId       string `json:"tradeId"`
-		OptVal        string `json:"optVal"`
-		NotionalUsd   string `json:"notionalUsd"`
-		Adl           string `json:"adl"`
-		Ccy           string `json:"ccy"`
-		Last          string `json:"last"`
-		UsdPx         string `json:"usdPx"`
-		DeltaBS       string `json:"deltaBS"`
-		DeltaPA       string `json:"deltaPA"`
-		GammaBS       string `json:"gammaBS"`
-		GammaPA       string `json:"gammaPA"`
-		ThetaBS       string `json:"thetaBS"`
-		ThetaPA       string `json:"thetaPA"`
-		VegaBS        string `json:"vegaBS"`
-		VegaPA        string `json:"vegaPA"`
-		SpotInUseAmt  string `json:"spotInUseAmt"`
-		ClSpotInUseAmt string `json:"clSpotInUseAmt"`
-		RealizedPnl   string `json:"realizedPnl"`
-		Pnl           string `json:"pnl"`
-		Fee           string `json:"fee"`
-		FundingFee    string `json:"fundingFee"`
-		LiqPenalty    string `json:"liqPenalty"`
-		CloseOrderAlgo []CloseOrderAlgoItem `json:"closeOrderAlgo"`
-		CTime         string `json:"cTime"`
-		UTime         string `json:"uTime"`
-		PTime         string `json:"pTime"`
-	} `json:"data"`
+	Code string         `json:"code"`
+	Msg  string         `json:"msg"`
+	Data []PositionData `json:"data"`
+}
+
+// PositionData OKX持仓数据 / OKX position data
+type PositionData struct {
+	InstType       string               `json:"instType"`
+	MgnMode        string               `json:"mgnMode"`
+	PosId          string               `json:"posId"`
+	PosSide        string               `json:"posSide"`
+	Pos            string               `json:"pos"`
+	BaseBal        string               `json:"baseBal"`
+	QuoteBal       string               `json:"quoteBal"`
+	PosCcy         string               `json:"posCcy"`
+	AvailPos       string               `json:"availPos"`
+	AvgPx          string               `json:"avgPx"`
+	Upl            string               `json:"upl"`
+	UplRatio       string               `json:"uplRatio"`
+	UplLastPx      string               `json:"uplLastPx"`
+	UplRatioLastPx string               `json:"uplRatioLastPx"`
+	InstId         string               `json:"instId"`
+	Lever          string               `json:"lever"`
+	LiqPx          string               `json:"liqPx"`
+	MarkPx         string               `json:"markPx"`
+	Imr            string               `json:"imr"`
+	Margin         string               `json:"margin"`
+	MgnRatio       string               `json:"mgnRatio"`
+	Mmr            string               `json:"mmr"`
+	Liab           string               `json:"liab"`
+	LiabCcy        string               `json:"liabCcy"`
+	Interest       string               `json:"interest"`
+	TradeId        string               `json:"tradeId"`
+	OptVal         string               `json:"optVal"`
+	NotionalUsd    string               `json:"notionalUsd"`
+	Adl            string               `json:"adl"`
+	Ccy            string               `json:"ccy"`
+	Last           string               `json:"last"`
+	UsdPx          string               `json:"usdPx"`
+	DeltaBS        string               `json:"deltaBS"`
+	DeltaPA        string               `json:"deltaPA"`
+	GammaBS        string               `json:"gammaBS"`
+	GammaPA        string               `json:"gammaPA"`
+	ThetaBS        string               `json:"thetaBS"`
+	ThetaPA        string               `json:"thetaPA"`
+	VegaBS         string               `json:"vegaBS"`
+	VegaPA         string               `json:"vegaPA"`
+	SpotInUseAmt   string               `json:"spotInUseAmt"`
+	ClSpotInUseAmt string               `json:"clSpotInUseAmt"`
+	RealizedPnl    string               `json:"realizedPnl"`
+	Pnl            string               `json:"pnl"`
+	Fee            string               `json:"fee"`
+	FundingFee     string               `json:"fundingFee"`
+	LiqPenalty     string               `json:"liqPenalty"`
+	CloseOrderAlgo []CloseOrderAlgoItem `json:"closeOrderAlgo"`
+	CTime          string               `json:"cTime"`
+	UTime          string               `json:"uTime"`
+	PTime          string               `json:"pTime"`
 }
 
 // CloseOrderAlgoItem 持仓关联的止盈止损订单 / Close order algo item attached to position
@@ -110,42 +131,118 @@ type CloseOrderAlgoItem struct {
 
 // AlgoOrderRequest OKX算法订单请求 / OKX algo order request
 type AlgoOrderRequest struct {
-	InstId        string `json:"instId"`
-	TdMode        string `json:"tdMode"`
-	Side          string `json:"side"`
-	PosSide       string `json:"posSide,omitempty"`
-	OrdType       string `json:"ordType"`
-	Sz            string `json:"sz"`
-	TpTriggerPx   string `json:"tpTriggerPx,omitempty"`
-	TpOrdPx       string `json:"tpOrdPx,omitempty"`
-	SlTriggerPx   string `json:"slTriggerPx,omitempty"`
-	SlOrdPx       string `json:"slOrdPx,omitempty"`
-	ReduceOnly    bool   `json:"reduceOnly,omitempty"`
+	InstId          string `json:"instId"`
+	TdMode          string `json:"tdMode"`
+	Side            string `json:"side"`
+	PosSide         string `json:"posSide,omitempty"`
+	OrdType         string `json:"ordType"`
+	Sz              string `json:"sz,omitempty"`            // Omitted when CloseFraction is set
+	CloseFraction   string `json:"closeFraction,omitempty"` // "1" closes the whole position, SWAP/FUTURES only
+	TpTriggerPx     string `json:"tpTriggerPx,omitempty"`
+	TpOrdPx         string `json:"tpOrdPx,omitempty"`
+	SlTriggerPx     string `json:"slTriggerPx,omitempty"`
+	SlOrdPx         string `json:"slOrdPx,omitempty"`
+	ReduceOnly      bool   `json:"reduceOnly,omitempty"`
 	TpTriggerPxType string `json:"tpTriggerPxType,omitempty"`
 	SlTriggerPxType string `json:"slTriggerPxType,omitempty"`
+	AlgoClOrdId     string `json:"algoClOrdId,omitempty"` // Client-supplied ID, OKX rejects duplicates
+	Tag             string `json:"tag,omitempty"`         // Broker tag for attribution
 }
 
 // AlgoOrderResponse OKX算法订单响应 / OKX algo order response
 type AlgoOrderResponse struct {
+	Code string            `json:"code"`
+	Msg  string            `json:"msg"`
+	Data []AlgoOrderResult `json:"data"`
+}
+
+// AlgoOrderResult 单个算法订单的下单结果 / Placement result of one algo order
+type AlgoOrderResult struct {
+	AlgoId      string `json:"algoId"`
+	AlgoClOrdId string `json:"algoClOrdId"`
+	SCode       string `json:"sCode"`
+	SMsg        string `json:"sMsg"`
+}
+
+// CancelAlgoOrderRequest OKX撤销算法订单请求 / OKX cancel algo order request
+type CancelAlgoOrderRequest struct {
+	AlgoId string `json:"algoId"`
+	InstId string `json:"instId"`
+}
+
+// OrderRequest OKX普通订单请求 / OKX order request
+type OrderRequest struct {
+	InstId     string `json:"instId"`
+	TdMode     string `json:"tdMode"`
+	Side       string `json:"side"`
+	PosSide    string `json:"posSide,omitempty"`
+	OrdType    string `json:"ordType"` // market, limit, ...
+	Sz         string `json:"sz"`
+	ReduceOnly bool   `json:"reduceOnly,omitempty"`
+	Tag        string `json:"tag,omitempty"` // Broker tag for attribution
+}
+
+// OrderResponse OKX普通订单响应 / OKX order response
+type OrderResponse struct {
+	Code string        `json:"code"`
+	Msg  string        `json:"msg"`
+	Data []OrderResult `json:"data"`
+}
+
+// OrderResult 单个订单的下单结果 / Placement result of one order
+type OrderResult struct {
+	OrdId   string `json:"ordId"`
+	ClOrdId string `json:"clOrdId"`
+	SCode   string `json:"sCode"`
+	SMsg    string `json:"sMsg"`
+}
+
+// ClosePositionRequest OKX市价平仓请求 / OKX close position request
+type ClosePositionRequest struct {
+	InstId  string `json:"instId"`
+	MgnMode string `json:"mgnMode"`
+	PosSide string `json:"posSide,omitempty"`
+	AutoCxl bool   `json:"autoCxl"`
+}
+
+// ClosePositionResponse OKX市价平仓响应 / OKX close position response
+type ClosePositionResponse struct {
 	Code string `json:"code"`
 	Msg  string `json:"msg"`
 	Data []struct {
-		AlgoId    string `json:"algoId"`
-		SCode     string `json:"sCode"`
-		SMsg      string `json:"sMsg"`
+		InstId  string `json:"instId"`
+		PosSide string `json:"posSide"`
 	} `json:"data"`
 }
 
+// AmendAlgoOrderRequest OKX修改算法订单请求 / OKX amend algo order request
+// 空字段不修改 / Empty fields are left unchanged
+type AmendAlgoOrderRequest struct {
+	InstId         string `json:"instId"`
+	AlgoId         string `json:"algoId"`
+	NewSz          string `json:"newSz,omitempty"`
+	NewTpTriggerPx string `json:"newTpTriggerPx,omitempty"`
+	NewSlTriggerPx string `json:"newSlTriggerPx,omitempty"`
+}
+
 // PendingAlgoOrdersResponse OKX待处理算法订单响应 / OKX pending algo orders response
 type PendingAlgoOrdersResponse struct {
-	Code string `json:"code"`
-	Msg  string `json:"msg"`
+	Code string      `json:"code"`
+	Msg  string      `json:"msg"`
+	Data []AlgoOrder `json:"data"`
+}
+
+// AlgoOrderDetailsResponse OKX算法订单详情响应 / OKX algo order details response
+type AlgoOrderDetailsResponse struct {
+	Code string      `json:"code"`
+	Msg  string      `json:"msg"`
 	Data []AlgoOrder `json:"data"`
 }
 
 // AlgoOrder OKX算法订单数据 / OKX algo order data
 type AlgoOrder struct {
 	AlgoId          string `json:"algoId"`
+	AlgoClOrdId     string `json:"algoClOrdId"`
 	InstId          string `json:"instId"`
 	PosSide         string `json:"posSide"`
 	Side            string `json:"side"`
@@ -164,6 +261,7 @@ type AlgoOrder struct {
 	CTime           string `json:"cTime"`
 	TriggerTime     string `json:"triggerTime"`
 	ReduceOnly      string `json:"reduceOnly"`
+	CloseFraction   string `json:"closeFraction"` // "1" when the order closes the whole position
 }
 
 // TickerResponse OKX行情响应 / OKX ticker response
@@ -191,3 +289,143 @@ type TickerData struct {
 	SodUtc0   string `json:"sodUtc0"`   // Open price at UTC 0
 	SodUtc8   string `json:"sodUtc8"`   // Open price at UTC 8
 }
+
+// FundingRateResponse OKX资金费率响应 / OKX funding rate response
+type FundingRateResponse struct {
+	Code string            `json:"code"`
+	Msg  string            `json:"msg"`
+	Data []FundingRateData `json:"data"`
+}
+
+// FundingRateData OKX资金费率数据 / OKX funding rate data
+type FundingRateData struct {
+	InstType        string `json:"instType"`
+	InstId          string `json:"instId"`
+	FundingRate     string `json:"fundingRate"`     // Current funding rate
+	NextFundingRate string `json:"nextFundingRate"` // Forecasted funding rate for the next period
+	FundingTime     string `json:"fundingTime"`     // Settlement time of the current funding rate (ms)
+	NextFundingTime string `json:"nextFundingTime"` // Settlement time of the next funding rate (ms)
+}
+
+// PositionTiersResponse OKX仓位档位响应 / OKX position tiers response
+type PositionTiersResponse struct {
+	Code string             `json:"code"`
+	Msg  string             `json:"msg"`
+	Data []PositionTierData `json:"data"`
+}
+
+// PositionTierData OKX仓位档位数据 / OKX position tier data
+// 持仓数量落在[MinSz, MaxSz]内时适用该档位的维持保证金率和最大杠杆
+// A position whose size falls within [MinSz, MaxSz] uses the tier's maintenance margin rate and max leverage
+type PositionTierData struct {
+	InstFamily string `json:"instFamily"`
+	InstId     string `json:"instId"`
+	Tier       string `json:"tier"`
+	MinSz      string `json:"minSz"`    // Lower bound of the tier, in contracts
+	MaxSz      string `json:"maxSz"`    // Upper bound of the tier, in contracts
+	Mmr        string `json:"mmr"`      // Maintenance margin rate
+	Imr        string `json:"imr"`      // Initial margin rate
+	MaxLever   string `json:"maxLever"` // Maximum leverage
+}
+
+// BillsResponse OKX账单流水响应 / OKX account bills response
+type BillsResponse struct {
+	Code string     `json:"code"`
+	Msg  string     `json:"msg"`
+	Data []BillData `json:"data"`
+}
+
+// BillData OKX账单流水数据 / OKX account bill data
+// 按时间倒序返回，最后一条的BillId用作下一页的after参数
+// Returned newest first; the last entry's BillId is the after cursor for the next page
+type BillData struct {
+	BillId   string `json:"billId"`
+	InstType string `json:"instType"`
+	InstId   string `json:"instId"`
+	Ccy      string `json:"ccy"`
+	Type     string `json:"type"`    // Bill type, e.g. "2" trade, "8" funding fee
+	SubType  string `json:"subType"` // Bill sub type
+	Bal      string `json:"bal"`     // Balance after the change
+	BalChg   string `json:"balChg"`  // Balance change
+	Pnl      string `json:"pnl"`     // Realized PnL
+	Fee      string `json:"fee"`     // Negative when charged, positive for rebates
+	OrdId    string `json:"ordId"`
+	Ts       string `json:"ts"` // Creation time (ms)
+}
+
+// Bill types carrying fees, funding and realized PnL
+const (
+	BillTypeTrade      = "2" // Fills, carry fee and realized PnL
+	BillTypeFundingFee = "8" // Perpetual swap funding payments
+)
+
+// AccountConfigResponse OKX账户配置响应 / OKX account configuration response
+type AccountConfigResponse struct {
+	Code string              `json:"code"`
+	Msg  string              `json:"msg"`
+	Data []AccountConfigData `json:"data"`
+}
+
+// AccountConfigData OKX账户配置数据 / OKX account configuration data
+type AccountConfigData struct {
+	Uid     string `json:"uid"`
+	AcctLv  string `json:"acctLv"`  // Account level: 1 simple, 2 single-currency margin, 3 multi-currency margin, 4 portfolio margin
+	PosMode string `json:"posMode"` // Position mode: long_short_mode (hedge) or net_mode (one-way)
+}
+
+// Position modes reported by the account configuration
+const (
+	PosModeLongShort = "long_short_mode" // Hedge mode, orders must carry posSide
+	PosModeNet       = "net_mode"        // One-way mode, orders must omit posSide
+)
+
+// MaxAvailSizeResponse OKX最大可用数量响应 / OKX maximum available size response
+type MaxAvailSizeResponse struct {
+	Code string             `json:"code"`
+	Msg  string             `json:"msg"`
+	Data []MaxAvailSizeData `json:"data"`
+}
+
+// MaxAvailSizeData OKX最大可用数量数据 / OKX maximum available size data
+type MaxAvailSizeData struct {
+	InstId    string `json:"instId"`
+	AvailBuy  string `json:"availBuy"`  // Maximum size for buy orders (closes shorts when reduce-only)
+	AvailSell string `json:"availSell"` // Maximum size for sell orders (closes longs when reduce-only)
+}
+
+// OrderBookResponse OKX深度响应 / OKX order book response
+type OrderBookResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data []OrderBookData `json:"data"`
+}
+
+// OrderBookData OKX深度数据 / OKX order book data
+// 每档为[价格, 数量, 已废弃字段, 订单数] / Each level is [price, size, deprecated, order count]
+type OrderBookData struct {
+	Asks [][]string `json:"asks"` // Ask levels, best (lowest) first
+	Bids [][]string `json:"bids"` // Bid levels, best (highest) first
+	Ts   string     `json:"ts"`   // Order book generation time (ms)
+}
+
+// InstrumentsResponse OKX交易产品信息响应 / OKX instruments response
+type InstrumentsResponse struct {
+	Code string           `json:"code"`
+	Msg  string           `json:"msg"`
+	Data []InstrumentData `json:"data"`
+}
+
+// InstrumentData OKX交易产品信息 / OKX instrument metadata
+type InstrumentData struct {
+	InstType  string `json:"instType"`
+	InstId    string `json:"instId"`
+	CtVal     string `json:"ctVal"`     // Contract value (derivatives only)
+	CtMult    string `json:"ctMult"`    // Contract multiplier (derivatives only)
+	CtValCcy  string `json:"ctValCcy"`  // Currency of the contract value
+	CtType    string `json:"ctType"`    // "linear" or "inverse" (derivatives only)
+	SettleCcy string `json:"settleCcy"` // Settlement currency
+	TickSz    string `json:"tickSz"`    // Price tick size
+	LotSz     string `json:"lotSz"`     // Order size increment
+	MinSz     string `json:"minSz"`     // Minimum order size
+	State     string `json:"state"`
+}
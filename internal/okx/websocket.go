@@ -0,0 +1,432 @@
+package okx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+)
+
+// wsConnection 自动重连的WebSocket连接 / Auto-reconnecting WebSocket connection
+// 公共和私有频道客户端共用的连接循环：拨号、心跳、读取消息、断线重连
+// Connection loop shared by public and private channel clients: dial, heartbeat, read, reconnect
+type wsConnection struct {
+	url            string
+	logger         *logger.Logger
+	pingInterval   time.Duration
+	pongTimeout    time.Duration // how long after a ping a pong may take before the connection counts as dead
+	reconnectDelay time.Duration
+
+	// onConnect 连接建立后调用（登录、重新订阅）/ Called after dial (login, resubscribe)
+	onConnect func() error
+	// onMessage 收到非心跳消息时调用 / Called for every non-heartbeat message
+	onMessage func(data []byte)
+
+	connMu sync.Mutex
+	conn   *websocket.Conn
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	started bool
+}
+
+// newWSConnection 创建WebSocket连接 / Create WebSocket connection
+func newWSConnection(url string, logger *logger.Logger) *wsConnection {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsConnection{
+		url:            url,
+		logger:         logger,
+		pingInterval:   20 * time.Second, // OKX closes idle connections after 30s
+		pongTimeout:    10 * time.Second,
+		reconnectDelay: 5 * time.Second,
+		ctx:            ctx,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+}
+
+// start 在后台启动连接循环 / Start connection loop in background
+func (c *wsConnection) start() {
+	c.started = true
+	go c.run()
+}
+
+// stop 停止连接循环并等待退出 / Stop connection loop and wait for exit
+func (c *wsConnection) stop() {
+	c.cancel()
+	if c.started {
+		<-c.done
+	}
+}
+
+// run 连接循环 / Connection loop
+func (c *wsConnection) run() {
+	defer close(c.done)
+
+	for {
+		err := c.connectAndServe()
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.logger.Warn("OKX WebSocket %s disconnected: %v, reconnecting in %v", c.url, err, c.reconnectDelay)
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.reconnectDelay):
+		}
+	}
+}
+
+// connectAndServe 建立连接并处理消息直到断开 / Connect and handle messages until disconnected
+// 每收到一条消息（包括"pong"）就延长读取期限；超过pingInterval+pongTimeout未收到任何消息，
+// 说明ping没有收到pong，视为断线并重连，避免半开连接上的行情悄悄停止更新
+// Every message, "pong" included, extends the read deadline; with nothing received for
+// pingInterval+pongTimeout a ping went unanswered, which counts as a disconnect and reconnects
+// instead of leaving prices silently frozen on a half-open connection
+func (c *wsConnection) connectAndServe() error {
+	conn, _, err := websocket.DefaultDialer.DialContext(c.ctx, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("dial failed: %w", err)
+	}
+
+	c.connMu.Lock()
+	c.conn = conn
+	c.connMu.Unlock()
+
+	defer func() {
+		c.connMu.Lock()
+		c.conn = nil
+		c.connMu.Unlock()
+		conn.Close()
+	}()
+
+	c.logger.Info("OKX WebSocket connected: %s", c.url)
+
+	// Only the read loop below reads, so it alone owns the read deadline
+	readTimeout := c.pingInterval + c.pongTimeout
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return fmt.Errorf("failed to set read deadline: %w", err)
+	}
+
+	if c.onConnect != nil {
+		if err := c.onConnect(); err != nil {
+			return err
+		}
+	}
+
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go c.keepAlive(conn, connDone)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("no pong or message within %v: %w", readTimeout, err)
+		}
+		if err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+			return fmt.Errorf("failed to set read deadline: %w", err)
+		}
+		if string(data) == "pong" {
+			continue
+		}
+		c.onMessage(data)
+	}
+}
+
+// keepAlive 发送ping并在停止时关闭连接 / Send pings and close connection on stop
+// OKX使用文本"ping"/"pong"作为心跳，未收到的pong由connectAndServe的读取期限发现
+// OKX uses text "ping"/"pong" as heartbeat; a missing pong is caught by the read deadline in connectAndServe
+func (c *wsConnection) keepAlive(conn *websocket.Conn, connDone chan struct{}) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			conn.Close() // Unblock ReadMessage
+			return
+		case <-connDone:
+			return
+		case <-ticker.C:
+			c.connMu.Lock()
+			err := conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+			c.connMu.Unlock()
+			if err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// writeJSON 发送JSON消息 / Send JSON message
+// 未连接时返回false，消息在下次连接时由onConnect重新发送
+// Returns false when not connected; onConnect resends state on the next connection
+func (c *wsConnection) writeJSON(v interface{}) (bool, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.conn == nil {
+		return false, nil
+	}
+	if err := c.conn.WriteJSON(v); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// WSClient OKX WebSocket公共频道客户端 / OKX WebSocket public channel client
+// 订阅tickers频道，维护线程安全的最新价格表，断线自动重连
+// Subscribes to the tickers channel, maintains a thread-safe latest-price map and reconnects automatically
+type WSClient struct {
+	*wsConnection
+	maxPriceAge time.Duration
+
+	mu          sync.RWMutex
+	prices      map[string]wsPrice
+	instruments map[string]bool
+}
+
+// wsPrice 最新价格及更新时间 / Latest price with update time
+type wsPrice struct {
+	price   float64
+	updated time.Time
+}
+
+// wsRequest WebSocket操作请求 / WebSocket operation request
+type wsRequest struct {
+	Op   string  `json:"op"`
+	Args []wsArg `json:"args"`
+}
+
+// wsArg WebSocket频道参数 / WebSocket channel argument
+type wsArg struct {
+	Channel     string `json:"channel"`
+	InstType    string `json:"instType,omitempty"`
+	InstId      string `json:"instId,omitempty"`
+	ExtraParams string `json:"extraParams,omitempty"`
+}
+
+// wsMessage WebSocket推送消息 / WebSocket push message
+type wsMessage struct {
+	Event string          `json:"event"`
+	Code  string          `json:"code"`
+	Msg   string          `json:"msg"`
+	Arg   wsArg           `json:"arg"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// NewWSClient 创建WebSocket公共频道客户端 / Create WebSocket public channel client
+// 初始化客户端，调用Start后开始连接
+// Initialize client; connection starts after Start is called
+//
+// Parameters:
+//   - url: WebSocket public endpoint (e.g., "wss://ws.okx.com:8443/ws/v5/public")
+//   - logger: Logger instance
+//
+// Returns:
+//   - *WSClient: WebSocket客户端实例 / WebSocket client instance
+func NewWSClient(url string, logger *logger.Logger) *WSClient {
+	w := &WSClient{
+		wsConnection: newWSConnection(url, logger),
+		maxPriceAge:  30 * time.Second,
+		prices:       make(map[string]wsPrice),
+		instruments:  make(map[string]bool),
+	}
+	// Resubscribe to all instruments after (re)connect
+	w.onConnect = func() error {
+		if err := w.send("subscribe", w.instrumentList()); err != nil {
+			return fmt.Errorf("resubscribe failed: %w", err)
+		}
+		return nil
+	}
+	w.onMessage = w.handleMessage
+	return w
+}
+
+// Start 启动WebSocket连接 / Start WebSocket connection
+// 在后台保持连接，断线后按reconnectDelay间隔重连并重新订阅
+// Keep the connection alive in background; on disconnect, reconnect after reconnectDelay and resubscribe
+func (w *WSClient) Start() {
+	w.logger.Info("Starting OKX WebSocket ticker stream: %s", w.url)
+	w.start()
+}
+
+// Stop 停止WebSocket连接 / Stop WebSocket connection
+func (w *WSClient) Stop() {
+	w.stop()
+	w.logger.Info("OKX WebSocket ticker stream stopped")
+}
+
+// LatestPrice 获取最新价格 / Get latest price
+// 返回推送的最新成交价；未订阅、尚未收到推送或价格过期时返回false
+// Return the latest pushed last price; false if not subscribed, not yet received, or stale
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//
+// Returns:
+//   - float64: 最新价格 / Latest price
+//   - bool: 价格是否可用 / Whether the price is available
+func (w *WSClient) LatestPrice(instId string) (float64, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	p, ok := w.prices[instId]
+	if !ok || time.Since(p.updated) > w.maxPriceAge {
+		return 0, false
+	}
+	return p.price, true
+}
+
+// SetInstruments 设置订阅的交易对集合 / Set subscribed instrument set
+// 与当前订阅对比，订阅新增的交易对并取消不再需要的交易对
+// Diff against current subscriptions, subscribe new instruments and unsubscribe ones no longer needed
+//
+// Parameters:
+//   - instIds: 需要行情的交易对列表 / Instruments that need prices
+//
+// Returns:
+//   - error: 发送订阅请求失败时返回错误 / Error when sending a (un)subscribe request fails
+func (w *WSClient) SetInstruments(instIds []string) error {
+	wanted := make(map[string]bool, len(instIds))
+	for _, instId := range instIds {
+		wanted[instId] = true
+	}
+
+	w.mu.RLock()
+	var toAdd, toRemove []string
+	for instId := range wanted {
+		if !w.instruments[instId] {
+			toAdd = append(toAdd, instId)
+		}
+	}
+	for instId := range w.instruments {
+		if !wanted[instId] {
+			toRemove = append(toRemove, instId)
+		}
+	}
+	w.mu.RUnlock()
+
+	if err := w.Subscribe(toAdd...); err != nil {
+		return err
+	}
+	return w.Unsubscribe(toRemove...)
+}
+
+// Subscribe 订阅交易对行情 / Subscribe to instrument tickers
+// 未连接时仅记录订阅，连接建立后自动发送
+// When not connected, subscriptions are recorded and sent once the connection is established
+func (w *WSClient) Subscribe(instIds ...string) error {
+	if len(instIds) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	for _, instId := range instIds {
+		w.instruments[instId] = true
+	}
+	w.mu.Unlock()
+
+	w.logger.Debug("Subscribing to tickers: %v", instIds)
+	return w.send("subscribe", instIds)
+}
+
+// Unsubscribe 取消订阅交易对行情 / Unsubscribe from instrument tickers
+func (w *WSClient) Unsubscribe(instIds ...string) error {
+	if len(instIds) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	for _, instId := range instIds {
+		delete(w.instruments, instId)
+		delete(w.prices, instId)
+	}
+	w.mu.Unlock()
+
+	w.logger.Debug("Unsubscribing from tickers: %v", instIds)
+	return w.send("unsubscribe", instIds)
+}
+
+// send 发送订阅操作 / Send subscription operation
+func (w *WSClient) send(op string, instIds []string) error {
+	if len(instIds) == 0 {
+		return nil
+	}
+
+	req := wsRequest{Op: op}
+	for _, instId := range instIds {
+		req.Args = append(req.Args, wsArg{Channel: "tickers", InstId: instId})
+	}
+
+	if _, err := w.writeJSON(req); err != nil {
+		return fmt.Errorf("failed to send %s: %w", op, err)
+	}
+	return nil
+}
+
+// handleMessage 处理推送消息 / Handle pushed message
+func (w *WSClient) handleMessage(data []byte) {
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		w.logger.Warn("Failed to parse WebSocket message: %v", err)
+		return
+	}
+
+	if msg.Event == "error" {
+		w.logger.Warn("OKX WebSocket error: code=%s, msg=%s", msg.Code, msg.Msg)
+		return
+	}
+	if msg.Event != "" {
+		w.logger.Debug("OKX WebSocket event: %s %s %s", msg.Event, msg.Arg.Channel, msg.Arg.InstId)
+		return
+	}
+	if msg.Arg.Channel != "tickers" || len(msg.Data) == 0 {
+		return
+	}
+
+	var tickers []TickerData
+	if err := json.Unmarshal(msg.Data, &tickers); err != nil {
+		w.logger.Warn("Failed to parse ticker push: %v", err)
+		return
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ticker := range tickers {
+		if !w.instruments[ticker.InstId] {
+			continue // Late push after unsubscribe
+		}
+		price, err := strconv.ParseFloat(ticker.Last, 64)
+		if err != nil {
+			continue
+		}
+		w.prices[ticker.InstId] = wsPrice{price: price, updated: now}
+	}
+}
+
+// instrumentList 当前订阅的交易对 / Currently subscribed instruments
+func (w *WSClient) instrumentList() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	list := make([]string, 0, len(w.instruments))
+	for instId := range w.instruments {
+		list = append(list, instId)
+	}
+	return list
+}
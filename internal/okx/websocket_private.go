@@ -0,0 +1,173 @@
+package okx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+)
+
+// WSPrivateClient OKX WebSocket私有频道客户端 / OKX WebSocket private channel client
+// 登录后订阅positions频道，持仓变化时回调处理函数；断线后自动重连并重新登录
+// Logs in and subscribes to the positions channel, invoking the handler on position changes;
+// reconnects and logs in again after a drop
+//
+// REST轮询仍作为兜底和对账路径 / REST polling remains the fallback and reconciliation path
+type WSPrivateClient struct {
+	*wsConnection
+	apiKey     string
+	apiSecret  string
+	passphrase string
+
+	mu       sync.RWMutex
+	handler  func([]PositionData)
+	loggedIn bool
+}
+
+// NewWSPrivateClient 创建WebSocket私有频道客户端 / Create WebSocket private channel client
+//
+// Parameters:
+//   - url: WebSocket private endpoint (e.g., "wss://ws.okx.com:8443/ws/v5/private")
+//   - apiKey: API key from OKX account settings
+//   - apiSecret: API secret corresponding to the API key
+//   - passphrase: API passphrase set during key creation
+//   - logger: Logger instance
+//
+// Returns:
+//   - *WSPrivateClient: WebSocket私有频道客户端实例 / WebSocket private channel client instance
+func NewWSPrivateClient(url, apiKey, apiSecret, passphrase string, logger *logger.Logger) *WSPrivateClient {
+	w := &WSPrivateClient{
+		wsConnection: newWSConnection(url, logger),
+		apiKey:       apiKey,
+		apiSecret:    apiSecret,
+		passphrase:   passphrase,
+	}
+	w.onConnect = w.login
+	w.onMessage = w.handleMessage
+	return w
+}
+
+// SetPositionsHandler 设置持仓更新处理函数 / Set position update handler
+// 处理函数在读取协程中调用，应尽快返回 / Handler runs on the read goroutine and should return quickly
+func (w *WSPrivateClient) SetPositionsHandler(handler func([]PositionData)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handler = handler
+}
+
+// Start 启动WebSocket私有连接 / Start WebSocket private connection
+func (w *WSPrivateClient) Start() {
+	w.logger.Info("Starting OKX WebSocket private stream: %s", w.url)
+	w.start()
+}
+
+// Stop 停止WebSocket私有连接 / Stop WebSocket private connection
+func (w *WSPrivateClient) Stop() {
+	w.stop()
+	w.logger.Info("OKX WebSocket private stream stopped")
+}
+
+// LoggedIn 是否已登录 / Whether the current connection is logged in
+func (w *WSPrivateClient) LoggedIn() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.loggedIn
+}
+
+// login 发送登录请求 / Send login request
+// 签名算法与REST相同，预哈希字符串为: timestamp + "GET" + "/users/self/verify"
+// 时间戳为Unix秒数（REST使用ISO8601）
+// Same signature scheme as REST with prehash: timestamp + "GET" + "/users/self/verify"
+// The timestamp is Unix seconds (REST uses ISO8601)
+func (w *WSPrivateClient) login() error {
+	w.mu.Lock()
+	w.loggedIn = false
+	w.mu.Unlock()
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := map[string]interface{}{
+		"op": "login",
+		"args": []map[string]string{{
+			"apiKey":     w.apiKey,
+			"passphrase": w.passphrase,
+			"timestamp":  timestamp,
+			"sign":       sign(w.apiSecret, timestamp, "GET", "/users/self/verify", ""),
+		}},
+	}
+
+	if _, err := w.writeJSON(req); err != nil {
+		return fmt.Errorf("failed to send login: %w", err)
+	}
+	return nil
+}
+
+// subscribe 登录成功后订阅持仓频道 / Subscribe to positions channel after login
+// updateInterval为"0"时仅在持仓变化时推送 / updateInterval "0" pushes only on position changes
+func (w *WSPrivateClient) subscribe() error {
+	req := wsRequest{
+		Op: "subscribe",
+		Args: []wsArg{{
+			Channel:     "positions",
+			InstType:    "ANY",
+			ExtraParams: `{"updateInterval":"0"}`,
+		}},
+	}
+	if _, err := w.writeJSON(req); err != nil {
+		return fmt.Errorf("failed to subscribe to positions: %w", err)
+	}
+	return nil
+}
+
+// handleMessage 处理推送消息 / Handle pushed message
+func (w *WSPrivateClient) handleMessage(data []byte) {
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		w.logger.Warn("Failed to parse WebSocket private message: %v", err)
+		return
+	}
+
+	switch msg.Event {
+	case "login":
+		if msg.Code != "0" {
+			w.logger.Error("OKX WebSocket login failed: code=%s, msg=%s", msg.Code, msg.Msg)
+			return
+		}
+		w.mu.Lock()
+		w.loggedIn = true
+		w.mu.Unlock()
+		w.logger.Info("OKX WebSocket private login successful")
+		if err := w.subscribe(); err != nil {
+			w.logger.Warn("%v", err)
+		}
+		return
+	case "error":
+		w.logger.Warn("OKX WebSocket private error: code=%s, msg=%s", msg.Code, msg.Msg)
+		return
+	case "":
+	default:
+		w.logger.Debug("OKX WebSocket private event: %s %s", msg.Event, msg.Arg.Channel)
+		return
+	}
+
+	if msg.Arg.Channel != "positions" || len(msg.Data) == 0 {
+		return
+	}
+
+	var positions []PositionData
+	if err := json.Unmarshal(msg.Data, &positions); err != nil {
+		w.logger.Warn("Failed to parse positions push: %v", err)
+		return
+	}
+
+	w.mu.RLock()
+	handler := w.handler
+	w.mu.RUnlock()
+
+	w.logger.Debug("Received %d position updates over WebSocket", len(positions))
+	if handler != nil {
+		handler(positions)
+	}
+}
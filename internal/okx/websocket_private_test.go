@@ -0,0 +1,93 @@
+package okx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSPrivateClientLoginAndReconnect(t *testing.T) {
+	var logins, connections int32
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := atomic.AddInt32(&connections, 1)
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req struct {
+				Op   string              `json:"op"`
+				Args []map[string]string `json:"args"`
+			}
+			if err := json.Unmarshal(data, &req); err != nil {
+				continue
+			}
+
+			switch req.Op {
+			case "login":
+				args := req.Args[0]
+				expected := sign("test-secret", args["timestamp"], "GET", "/users/self/verify", "")
+				if args["apiKey"] != "test-key" || args["passphrase"] != "test-pass" || args["sign"] != expected {
+					conn.WriteJSON(map[string]string{"event": "login", "code": "60009", "msg": "Login failed"})
+					continue
+				}
+				atomic.AddInt32(&logins, 1)
+				conn.WriteJSON(map[string]string{"event": "login", "code": "0", "msg": ""})
+			case "subscribe":
+				if req.Args[0]["channel"] != "positions" {
+					t.Errorf("unexpected channel: %s", req.Args[0]["channel"])
+				}
+				conn.WriteJSON(map[string]interface{}{
+					"arg":  map[string]string{"channel": "positions", "instType": "ANY"},
+					"data": []map[string]string{{"instId": "BTC-USDT-SWAP", "posSide": "long", "pos": "1", "avgPx": "50000"}},
+				})
+				if n == 1 {
+					return // Drop the first connection to force a reconnect
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	ws := NewWSPrivateClient("ws"+strings.TrimPrefix(server.URL, "http"), "test-key", "test-secret", "test-pass", newTestLogger(t))
+	ws.reconnectDelay = 10 * time.Millisecond
+
+	var updates int32
+	ws.SetPositionsHandler(func(positions []PositionData) {
+		if len(positions) != 1 || positions[0].InstId != "BTC-USDT-SWAP" {
+			t.Errorf("unexpected positions: %+v", positions)
+		}
+		atomic.AddInt32(&updates, 1)
+	})
+	ws.Start()
+	defer ws.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&updates) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := atomic.LoadInt32(&logins); got < 2 {
+		t.Errorf("expected login on each connection, got %d logins", got)
+	}
+	if got := atomic.LoadInt32(&updates); got < 2 {
+		t.Errorf("expected position updates from both connections, got %d", got)
+	}
+	if !ws.LoggedIn() {
+		t.Error("expected client to be logged in after reconnect")
+	}
+}
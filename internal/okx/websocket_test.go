@@ -0,0 +1,202 @@
+package okx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+)
+
+// newTestLogger creates a file-only logger in a temporary directory
+func newTestLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(filepath.Join(t.TempDir(), "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+// newMockWSServer starts a WebSocket server that answers every ticker subscription
+// with one push carrying the given last price. When dropFirst is set, the first
+// connection is closed right after the push to exercise reconnects.
+func newMockWSServer(t *testing.T, last string, dropFirst bool, connections *int32) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := atomic.AddInt32(connections, 1)
+
+		for {
+			var req wsRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if req.Op != "subscribe" {
+				continue
+			}
+			for _, arg := range req.Args {
+				conn.WriteJSON(map[string]interface{}{"event": "subscribe", "arg": arg})
+				conn.WriteJSON(map[string]interface{}{
+					"arg":  arg,
+					"data": []map[string]string{{"instId": arg.InstId, "last": last}},
+				})
+			}
+			if dropFirst && n == 1 {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// waitForPrice polls LatestPrice until it becomes available or the deadline passes
+func waitForPrice(ws *WSClient, instId string, timeout time.Duration) (float64, bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if price, ok := ws.LatestPrice(instId); ok {
+			return price, true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return 0, false
+}
+
+func TestWSClientLatestPrice(t *testing.T) {
+	var connections int32
+	server := newMockWSServer(t, "50123.5", false, &connections)
+
+	ws := NewWSClient("ws"+strings.TrimPrefix(server.URL, "http"), newTestLogger(t))
+	ws.Start()
+	defer ws.Stop()
+
+	if _, ok := ws.LatestPrice("BTC-USDT-SWAP"); ok {
+		t.Error("expected no price before subscribing")
+	}
+
+	if err := ws.SetInstruments([]string{"BTC-USDT-SWAP"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	price, ok := waitForPrice(ws, "BTC-USDT-SWAP", 2*time.Second)
+	if !ok {
+		t.Fatal("expected streamed price")
+	}
+	if price != 50123.5 {
+		t.Errorf("expected price 50123.5, got %f", price)
+	}
+
+	// Unsubscribing drops the cached price
+	if err := ws.SetInstruments(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ws.LatestPrice("BTC-USDT-SWAP"); ok {
+		t.Error("expected no price after unsubscribing")
+	}
+}
+
+func TestWSClientReconnectResubscribes(t *testing.T) {
+	var connections int32
+	server := newMockWSServer(t, "3000", true, &connections)
+
+	ws := NewWSClient("ws"+strings.TrimPrefix(server.URL, "http"), newTestLogger(t))
+	ws.reconnectDelay = 10 * time.Millisecond
+	if err := ws.Subscribe("ETH-USDT-SWAP"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ws.Start()
+	defer ws.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&connections) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&connections); got < 2 {
+		t.Fatalf("expected client to reconnect, got %d connections", got)
+	}
+
+	if _, ok := waitForPrice(ws, "ETH-USDT-SWAP", 2*time.Second); !ok {
+		t.Error("expected price after reconnect")
+	}
+}
+
+func TestWSClientStalePrice(t *testing.T) {
+	ws := NewWSClient("ws://127.0.0.1:0", newTestLogger(t))
+	ws.instruments["BTC-USDT-SWAP"] = true
+	ws.prices["BTC-USDT-SWAP"] = wsPrice{price: 50000, updated: time.Now().Add(-time.Minute)}
+
+	if _, ok := ws.LatestPrice("BTC-USDT-SWAP"); ok {
+		t.Error("expected stale price to be unavailable")
+	}
+}
+
+func TestWSClientPongTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		answerPings     bool
+		expectReconnect bool
+	}{
+		{"pongs keep the connection", true, false},
+		{"missed pong reconnects", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var connections int32
+			upgrader := websocket.Upgrader{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				atomic.AddInt32(&connections, 1)
+
+				for {
+					_, data, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					if string(data) == "ping" && tt.answerPings {
+						conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+					}
+				}
+			}))
+			defer server.Close()
+
+			ws := NewWSClient("ws"+strings.TrimPrefix(server.URL, "http"), newTestLogger(t))
+			ws.pingInterval = 20 * time.Millisecond
+			ws.pongTimeout = 50 * time.Millisecond
+			ws.reconnectDelay = 10 * time.Millisecond
+			ws.Start()
+			defer ws.Stop()
+
+			// Several pong timeouts pass within the wait
+			deadline := time.Now().Add(500 * time.Millisecond)
+			for time.Now().Before(deadline) && (!tt.expectReconnect || atomic.LoadInt32(&connections) < 2) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			got := atomic.LoadInt32(&connections)
+			if tt.expectReconnect && got < 2 {
+				t.Errorf("expected a reconnect after the missed pong, got %d connections", got)
+			}
+			if !tt.expectReconnect && got != 1 {
+				t.Errorf("expected the connection to stay up, got %d connections", got)
+			}
+		})
+	}
+}
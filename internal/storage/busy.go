@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// busyRetries 数据库繁忙时写入的最大重试次数 / Maximum retries of a write while the database is busy
+const busyRetries = 3
+
+// busyRetryBackoff 首次重试前的等待时间，之后每次翻倍 / Wait before the first retry, doubled on each further retry
+const busyRetryBackoff = 50 * time.Millisecond
+
+// Option 存储层可选配置 / Optional storage configuration
+type Option func(*Storage)
+
+// WithBusyTimeout 设置SQLite繁忙等待时间 / Set the SQLite busy timeout
+// 每个连接都设置PRAGMA busy_timeout，写锁被其他连接持有时最多等待该时长后才返回繁忙错误；
+// 非正值保持驱动默认的5秒
+// Sets PRAGMA busy_timeout on every connection, so a write waits up to this long for a lock held
+// by another connection before failing as busy; non-positive values keep the driver's 5s default
+//
+// Parameters:
+//   - ms: 繁忙等待时间（毫秒）/ Busy timeout in milliseconds
+func WithBusyTimeout(ms int) Option {
+	return func(s *Storage) {
+		if ms > 0 {
+			s.busyTimeoutMs = ms
+		}
+	}
+}
+
+// retryBusy 数据库繁忙时重试写入 / Retry a write while the database is busy
+// busy_timeout之外的兜底：等待超时或死锁检测仍会返回SQLITE_BUSY/SQLITE_LOCKED，
+// 此时按指数退避重试，其他错误立即返回
+// A fallback beyond busy_timeout: a wait that times out or is cut short by deadlock detection
+// still fails with SQLITE_BUSY/SQLITE_LOCKED, which is retried with exponential backoff; other
+// errors are returned at once
+//
+// Parameters:
+//   - write: 写入操作，可能执行多次 / The write, possibly run more than once
+//
+// Returns:
+//   - error: 写入的最后一次错误 / The write's last error
+func (s *Storage) retryBusy(write func() error) error {
+	backoff := busyRetryBackoff
+	err := write()
+	for attempt := 0; attempt < busyRetries && isBusy(err); attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = write()
+	}
+	return err
+}
+
+// isBusy 判断错误是否为数据库繁忙或被锁 / Whether an error means the database is busy or locked
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
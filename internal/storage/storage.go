@@ -5,15 +5,26 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
 )
 
+// execer 可执行SQL语句的连接或事务 / Connection or transaction that can execute statements
+// 由*sql.DB和*sql.Tx实现，使插入逻辑可在事务内外共用
+// Implemented by *sql.DB and *sql.Tx so the insert logic is shared inside and outside transactions
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 // Storage 数据库存储层 / Database storage layer
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	path string // database file path, used to measure file sizes during maintenance
+
+	busyTimeoutMs int // PRAGMA busy_timeout of every connection, 0 for the driver default
 }
 
 // New 创建新的存储实例 / Create new storage instance
@@ -25,21 +36,31 @@ type Storage struct {
 //   - walMode: Whether to enable WAL (Write-Ahead Logging) mode for better concurrency performance
 //   - maxOpenConns: Maximum number of open connections
 //   - maxIdleConns: Maximum number of idle connections
+//   - opts: 可选配置，如WithBusyTimeout / Optional configuration such as WithBusyTimeout
 //
 // Returns:
 //   - *Storage: 已初始化的存储实例，包含数据库连接和表结构
 //     Initialized storage instance with database connection and table schema
 //   - error: 数据库创建失败或表结构初始化失败时返回错误
 //     Error on database creation failure or schema initialization failure
-func New(dbPath string, walMode bool, maxOpenConns, maxIdleConns int) (*Storage, error) {
+func New(dbPath string, walMode bool, maxOpenConns, maxIdleConns int, opts ...Option) (*Storage, error) {
 	// Ensure database directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0750); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	// Open database connection
-	db, err := sql.Open("sqlite3", dbPath)
+	storage := &Storage{path: dbPath}
+	for _, opt := range opts {
+		opt(storage)
+	}
+
+	// Open database connection; the driver applies _busy_timeout to each new connection
+	dsn := dbPath
+	if storage.busyTimeoutMs > 0 {
+		dsn += "?_busy_timeout=" + strconv.Itoa(storage.busyTimeoutMs)
+	}
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -56,7 +77,7 @@ func New(dbPath string, walMode bool, maxOpenConns, maxIdleConns int) (*Storage,
 		}
 	}
 
-	storage := &Storage{db: db}
+	storage.db = db
 
 	// Initialize database schema
 	if err := storage.initSchema(); err != nil {
@@ -78,7 +99,8 @@ func (s *Storage) initSchema() error {
 		balance REAL NOT NULL,
 		available REAL NOT NULL,
 		frozen REAL NOT NULL,
-		equity REAL
+		equity REAL,
+		deleted_at DATETIME
 	);
 	CREATE INDEX IF NOT EXISTS idx_account_balances_timestamp ON account_balances(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_account_balances_currency ON account_balances(currency);
@@ -87,6 +109,14 @@ func (s *Storage) initSchema() error {
 	if _, err := s.db.Exec(accountBalancesSchema); err != nil {
 		return fmt.Errorf("failed to create account_balances table: %w", err)
 	}
+	// Databases created before unrealized PnL was tracked per currency lack the column
+	if err := s.ensureColumn("account_balances", "unrealized_pnl", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// Soft-deleted rows keep their data with deleted_at set and are left out of every read
+	if err := s.ensureColumn("account_balances", "deleted_at", "DATETIME"); err != nil {
+		return err
+	}
 
 	// Create positions table
 	positionsSchema := `
@@ -100,16 +130,179 @@ func (s *Storage) initSchema() error {
 		unrealized_pnl REAL NOT NULL,
 		margin REAL NOT NULL,
 		leverage REAL,
-		margin_mode VARCHAR(10) DEFAULT 'cross'
+		margin_mode VARCHAR(10) DEFAULT 'cross',
+		liquidation_price REAL NOT NULL DEFAULT 0,
+		mark_price REAL NOT NULL DEFAULT 0,
+		notional_usd REAL NOT NULL DEFAULT 0,
+		opened_at DATETIME,
+		deleted_at DATETIME
 	);
 	CREATE INDEX IF NOT EXISTS idx_positions_timestamp ON positions(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_positions_timestamp_instrument ON positions(timestamp, instrument);
+	CREATE INDEX IF NOT EXISTS idx_positions_instrument_timestamp ON positions(instrument, timestamp);
 	`
 
 	if _, err := s.db.Exec(positionsSchema); err != nil {
 		return fmt.Errorf("failed to create positions table: %w", err)
 	}
+	// Databases created before liquidation and mark prices and notional were tracked lack the columns
+	for _, column := range []string{"liquidation_price", "mark_price", "notional_usd"} {
+		if err := s.ensureColumn("positions", column, "REAL NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	if err := s.ensureColumn("positions", "opened_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("positions", "deleted_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Create account_margin table
+	accountMarginSchema := `
+	CREATE TABLE IF NOT EXISTS account_margin (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		total_equity REAL NOT NULL,
+		margin_ratio REAL NOT NULL,
+		initial_margin REAL NOT NULL,
+		maintenance_margin REAL NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_account_margin_timestamp ON account_margin(timestamp);
+	`
+
+	if _, err := s.db.Exec(accountMarginSchema); err != nil {
+		return fmt.Errorf("failed to create account_margin table: %w", err)
+	}
+
+	// Create tpsl_orders table
+	tpslOrdersSchema := `
+	CREATE TABLE IF NOT EXISTS tpsl_orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		algo_id TEXT NOT NULL UNIQUE,
+		instrument TEXT NOT NULL,
+		position_side TEXT NOT NULL,
+		leg TEXT NOT NULL,
+		size REAL NOT NULL,
+		trigger_price REAL NOT NULL,
+		placed_at DATETIME NOT NULL,
+		status TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_tpsl_orders_status ON tpsl_orders(status);
+	`
+
+	if _, err := s.db.Exec(tpslOrdersSchema); err != nil {
+		return fmt.Errorf("failed to create tpsl_orders table: %w", err)
+	}
+	// Databases created before client order IDs were sent lack the column
+	if err := s.ensureColumn("tpsl_orders", "client_order_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_tpsl_orders_client_order_id ON tpsl_orders(client_order_id)"); err != nil {
+		return fmt.Errorf("failed to create tpsl_orders client_order_id index: %w", err)
+	}
+
+	// Create bills table
+	billsSchema := `
+	CREATE TABLE IF NOT EXISTS bills (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bill_id TEXT NOT NULL UNIQUE,
+		timestamp DATETIME NOT NULL,
+		inst_type TEXT NOT NULL,
+		instrument TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		type TEXT NOT NULL,
+		sub_type TEXT NOT NULL,
+		balance_change REAL NOT NULL,
+		balance REAL NOT NULL,
+		pnl REAL NOT NULL,
+		fee REAL NOT NULL,
+		order_id TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_bills_timestamp ON bills(timestamp);
+	`
+
+	if _, err := s.db.Exec(billsSchema); err != nil {
+		return fmt.Errorf("failed to create bills table: %w", err)
+	}
+
+	// Create position events table
+	positionEventsSchema := `
+	CREATE TABLE IF NOT EXISTS position_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		instrument TEXT NOT NULL,
+		position_side TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		previous_size REAL NOT NULL,
+		size REAL NOT NULL,
+		average_price REAL NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_position_events_timestamp ON position_events(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_position_events_instrument_side ON position_events(instrument, position_side);
+	`
+
+	if _, err := s.db.Exec(positionEventsSchema); err != nil {
+		return fmt.Errorf("failed to create position_events table: %w", err)
+	}
+
+	// Create run sessions table
+	runSessionsSchema := `
+	CREATE TABLE IF NOT EXISTS run_sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at DATETIME NOT NULL,
+		stopped_at DATETIME NOT NULL,
+		cycles INTEGER NOT NULL,
+		success_count INTEGER NOT NULL,
+		error_count INTEGER NOT NULL,
+		orders_placed INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_run_sessions_started_at ON run_sessions(started_at);
+	`
+
+	if _, err := s.db.Exec(runSessionsSchema); err != nil {
+		return fmt.Errorf("failed to create run_sessions table: %w", err)
+	}
+
+	return nil
+}
+
+// ensureColumn 确保表中存在指定列 / Ensure a table has the given column
+// 用于为旧版本创建的数据库补充新增的列
+// Used to add columns introduced after a database was created
+//
+// Parameters:
+//   - table: 表名 / Table name
+//   - column: 列名 / Column name
+//   - definition: 列类型及约束 / Column type and constraints
+//
+// Returns:
+//   - error: 查询表结构或添加列失败时返回错误 / Error reading table info or adding the column
+func (s *Storage) ensureColumn(table, column, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read %s table info: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan %s table info: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating %s table info: %w", table, err)
+	}
 
+	if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
+	}
 	return nil
 }
 
@@ -125,22 +318,28 @@ func (s *Storage) initSchema() error {
 //   - error: 数据验证失败或数据库写入失败时返回错误 / Error on validation failure or database write failure
 //     成功时会将生成的ID回写到balance.ID字段 / On success, generated ID is written back to balance.ID
 func (s *Storage) InsertAccountBalance(balance *models.AccountBalance) error {
+	return s.retryBusy(func() error { return insertAccountBalance(s.db, balance) })
+}
+
+// insertAccountBalance 在给定连接或事务上插入账户余额记录 / Insert a account balance record on the given connection or transaction
+func insertAccountBalance(db execer, balance *models.AccountBalance) error {
 	if err := balance.Validate(); err != nil {
 		return fmt.Errorf("invalid account balance: %w", err)
 	}
 
 	query := `
-		INSERT INTO account_balances (timestamp, currency, balance, available, frozen, equity)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO account_balances (timestamp, currency, balance, available, frozen, equity, unrealized_pnl)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := s.db.Exec(query,
+	result, err := db.Exec(query,
 		balance.Timestamp.UTC(),
 		balance.Currency,
 		balance.Balance,
 		balance.Available,
 		balance.Frozen,
 		balance.Equity,
+		balance.UnrealizedPnL,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert account balance: %w", err)
@@ -167,16 +366,21 @@ func (s *Storage) InsertAccountBalance(balance *models.AccountBalance) error {
 //   - error: 数据验证失败或数据库写入失败时返回错误 / Error on validation failure or database write failure
 //     成功时会将生成的ID回写到position.ID字段 / On success, generated ID is written back to position.ID
 func (s *Storage) InsertPosition(position *models.Position) error {
+	return s.retryBusy(func() error { return insertPosition(s.db, position) })
+}
+
+// insertPosition 在给定连接或事务上插入持仓记录 / Insert a position record on the given connection or transaction
+func insertPosition(db execer, position *models.Position) error {
 	if err := position.Validate(); err != nil {
 		return fmt.Errorf("invalid position: %w", err)
 	}
 
 	query := `
-		INSERT INTO positions (timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage, margin_mode)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO positions (timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage, margin_mode, liquidation_price, mark_price, notional_usd, opened_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := s.db.Exec(query,
+	result, err := db.Exec(query,
 		position.Timestamp.UTC(),
 		position.Instrument,
 		position.PositionSide,
@@ -186,6 +390,10 @@ func (s *Storage) InsertPosition(position *models.Position) error {
 		position.Margin,
 		position.Leverage,
 		position.MarginMode,
+		position.LiqPx,
+		position.MarkPx,
+		position.NotionalUSD,
+		nullableTime(position.OpenedAt),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert position: %w", err)
@@ -200,6 +408,217 @@ func (s *Storage) InsertPosition(position *models.Position) error {
 	return nil
 }
 
+// InsertAccountMargin 插入账户保证金记录 / Insert account margin record
+// 将账户级保证金率和保证金占用写入account_margin表
+// Write account-level margin ratio and margin requirements to account_margin table
+//
+// Parameters:
+//   - margin: Account margin data model, Timestamp will be converted to UTC for storage
+//
+// Returns:
+//   - error: 数据验证失败或数据库写入失败时返回错误 / Error on validation failure or database write failure
+//     成功时会将生成的ID回写到margin.ID字段 / On success, generated ID is written back to margin.ID
+func (s *Storage) InsertAccountMargin(margin *models.AccountMargin) error {
+	return s.retryBusy(func() error { return insertAccountMargin(s.db, margin) })
+}
+
+// insertAccountMargin 在给定连接或事务上插入账户保证金记录 / Insert a account margin record on the given connection or transaction
+func insertAccountMargin(db execer, margin *models.AccountMargin) error {
+	if err := margin.Validate(); err != nil {
+		return fmt.Errorf("invalid account margin: %w", err)
+	}
+
+	query := `
+		INSERT INTO account_margin (timestamp, total_equity, margin_ratio, initial_margin, maintenance_margin)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err := db.Exec(query,
+		margin.Timestamp.UTC(),
+		margin.TotalEquity,
+		margin.MarginRatio,
+		margin.InitialMargin,
+		margin.MaintenanceMargin,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert account margin: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	margin.ID = id
+	return nil
+}
+
+// InsertTPSLOrder 插入止盈止损订单记录 / Insert TPSL order record
+// 记录本系统下单的止盈止损订单及其下单时间
+// Record a TPSL order placed by this system together with its placement time
+//
+// Parameters:
+//   - order: TPSL order record, PlacedAt will be converted to UTC for storage
+//
+// Returns:
+//   - error: 数据验证失败或数据库写入失败时返回错误 / Error on validation failure or database write failure
+//     成功时会将生成的ID回写到order.ID字段 / On success, generated ID is written back to order.ID
+func (s *Storage) InsertTPSLOrder(order *models.TPSLOrder) error {
+	return s.retryBusy(func() error { return insertTPSLOrder(s.db, order) })
+}
+
+// insertTPSLOrder 在给定连接或事务上插入止盈止损订单记录 / Insert a TPSL order record on the given connection or transaction
+func insertTPSLOrder(db execer, order *models.TPSLOrder) error {
+	if err := order.Validate(); err != nil {
+		return fmt.Errorf("invalid tpsl order: %w", err)
+	}
+
+	query := `
+		INSERT INTO tpsl_orders (algo_id, client_order_id, instrument, position_side, leg, size, trigger_price, placed_at, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := db.Exec(query,
+		order.AlgoID,
+		order.ClientOrderID,
+		order.Instrument,
+		order.PositionSide,
+		order.Leg,
+		order.Size,
+		order.TriggerPrice,
+		order.PlacedAt.UTC(),
+		order.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert tpsl order: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	order.ID = id
+	return nil
+}
+
+// GetLiveTPSLOrders 获取未触发的止盈止损订单记录 / Get live TPSL order records
+// 按algoId索引返回状态为live的订单记录
+// Return records with status live, keyed by algoId
+//
+// Returns:
+//   - map[string]models.TPSLOrder: algoId到订单记录的映射 / Map from algoId to order record
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetLiveTPSLOrders() (map[string]models.TPSLOrder, error) {
+	query := `
+		SELECT id, algo_id, client_order_id, instrument, position_side, leg, size, trigger_price, placed_at, status
+		FROM tpsl_orders
+		WHERE status = ?
+	`
+
+	rows, err := s.db.Query(query, models.TPSLOrderStatusLive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query live tpsl orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := make(map[string]models.TPSLOrder)
+	for rows.Next() {
+		o, err := scanTPSLOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders[o.AlgoID] = o
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return orders, nil
+}
+
+// GetTPSLOrderByClientOrderID 按客户端订单ID获取止盈止损订单记录 / Get a TPSL order record by client order ID
+//
+// Parameters:
+//   - clientOrderID: 客户端算法订单ID（algoClOrdId）/ Client algo order ID (algoClOrdId)
+//
+// Returns:
+//   - *models.TPSLOrder: 订单记录，不存在时为nil / Order record, nil when there is none
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetTPSLOrderByClientOrderID(clientOrderID string) (*models.TPSLOrder, error) {
+	query := `
+		SELECT id, algo_id, client_order_id, instrument, position_side, leg, size, trigger_price, placed_at, status
+		FROM tpsl_orders
+		WHERE client_order_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	rows, err := s.db.Query(query, clientOrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tpsl order by client order id: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating rows: %w", err)
+		}
+		return nil, nil
+	}
+	o, err := scanTPSLOrder(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// scanTPSLOrder 扫描一行止盈止损订单记录 / Scan one TPSL order record row
+func scanTPSLOrder(rows *sql.Rows) (models.TPSLOrder, error) {
+	var o models.TPSLOrder
+	var placedAt string
+	if err := rows.Scan(&o.ID, &o.AlgoID, &o.ClientOrderID, &o.Instrument, &o.PositionSide, &o.Leg, &o.Size, &o.TriggerPrice, &placedAt, &o.Status); err != nil {
+		return o, fmt.Errorf("failed to scan tpsl order: %w", err)
+	}
+
+	var err error
+	o.PlacedAt, err = parseTimestamp(placedAt)
+	if err != nil {
+		return o, fmt.Errorf("failed to parse placed_at: %w", err)
+	}
+	return o, nil
+}
+
+// UpdateTPSLOrderStatus 更新止盈止损订单记录状态 / Update TPSL order record status
+//
+// Parameters:
+//   - algoID: 算法订单ID / Algo order ID
+//   - status: 新状态 / New status
+//
+// Returns:
+//   - error: 数据库写入失败或记录不存在时返回错误 / Error on database write failure or missing record
+func (s *Storage) UpdateTPSLOrderStatus(algoID string, status models.TPSLOrderStatus) error {
+	var result sql.Result
+	err := s.retryBusy(func() (err error) {
+		result, err = s.db.Exec("UPDATE tpsl_orders SET status = ? WHERE algo_id = ?", status, algoID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update tpsl order %s: %w", algoID, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("tpsl order %s not found", algoID)
+	}
+
+	return nil
+}
+
 // GetLatestAccountBalances 获取最新的账户余额 / Get latest account balances
 // 查询最新时间戳的所有币种账户余额记录
 // Query all currency account balance records with the latest timestamp
@@ -211,9 +630,9 @@ func (s *Storage) InsertPosition(position *models.Position) error {
 //   - error: 数据库查询失败时返回错误 / Error on database query failure
 func (s *Storage) GetLatestAccountBalances() ([]models.AccountBalance, error) {
 	query := `
-		SELECT id, timestamp, currency, balance, available, frozen, equity
+		SELECT id, timestamp, currency, balance, available, frozen, equity, unrealized_pnl
 		FROM account_balances
-		WHERE timestamp = (SELECT MAX(timestamp) FROM account_balances)
+		WHERE deleted_at IS NULL AND timestamp = (SELECT MAX(timestamp) FROM account_balances WHERE deleted_at IS NULL)
 		ORDER BY currency
 	`
 
@@ -227,7 +646,7 @@ func (s *Storage) GetLatestAccountBalances() ([]models.AccountBalance, error) {
 	for rows.Next() {
 		var b models.AccountBalance
 		var timestamp string
-		if err := rows.Scan(&b.ID, &timestamp, &b.Currency, &b.Balance, &b.Available, &b.Frozen, &b.Equity); err != nil {
+		if err := rows.Scan(&b.ID, &timestamp, &b.Currency, &b.Balance, &b.Available, &b.Frozen, &b.Equity, &b.UnrealizedPnL); err != nil {
 			return nil, fmt.Errorf("failed to scan balance: %w", err)
 		}
 
@@ -247,14 +666,151 @@ func (s *Storage) GetLatestAccountBalances() ([]models.AccountBalance, error) {
 	return balances, nil
 }
 
+// GetTotalEquity 获取最新快照的总权益 / Get total equity of the latest snapshot
+// 在SQL中汇总最新账户余额快照各币种的美元权益
+// Sums the USD equity of every currency in the latest account balance snapshot in SQL
+//
+// Returns:
+//   - float64: 总美元权益，没有记录时为0 / Total USD equity, 0 if no records
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetTotalEquity() (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(equity), 0)
+		FROM account_balances
+		WHERE deleted_at IS NULL AND timestamp = (SELECT MAX(timestamp) FROM account_balances WHERE deleted_at IS NULL)
+	`
+
+	var total float64
+	if err := s.db.QueryRow(query).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to query total equity: %w", err)
+	}
+
+	return total, nil
+}
+
+// GetCurrencyBreakdown 获取最新快照按币种的权益 / Get equity by currency of the latest snapshot
+// 在SQL中按币种汇总最新账户余额快照的美元权益
+// Groups the USD equity of the latest account balance snapshot by currency in SQL
+//
+// Returns:
+//   - map[string]float64: 币种到美元权益的映射，没有记录时为空映射
+//     Currency to USD equity, empty map if no records
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetCurrencyBreakdown() (map[string]float64, error) {
+	query := `
+		SELECT currency, SUM(equity)
+		FROM account_balances
+		WHERE deleted_at IS NULL AND timestamp = (SELECT MAX(timestamp) FROM account_balances WHERE deleted_at IS NULL)
+		GROUP BY currency
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query currency breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	breakdown := make(map[string]float64)
+	for rows.Next() {
+		var currency string
+		var equity float64
+		if err := rows.Scan(&currency, &equity); err != nil {
+			return nil, fmt.Errorf("failed to scan currency equity: %w", err)
+		}
+		breakdown[currency] = equity
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return breakdown, nil
+}
+
+// QueryOptions 持仓查询选项 / Position query options
+type QueryOptions struct {
+	OrderBy    string // "instrument" (default), "notional" or "pnl"
+	Descending bool   // sort descending instead of ascending
+	Limit      int    // maximum rows to return, 0 means no limit
+
+	// IncludeStale 返回最新快照而不论其时间 / Return the latest snapshot however old it is
+	// 默认情况下超过10分钟的快照视为已平仓并返回空切片；需要自行判断快照是否过期的调用方设置此项
+	// By default a snapshot older than 10 minutes counts as closed and an empty slice is returned;
+	// callers that judge staleness themselves set this
+	IncludeStale bool
+}
+
+// positionOrderColumns 允许排序的字段 / Whitelisted sort fields mapped to SQL expressions
+// 排序字段只能来自此映射，不直接拼接用户输入 / Sort fields only come from this map, never from raw input
+// notional按notional_usd排序，此前存储的行回退为数量 × 入场价
+// notional sorts by notional_usd, rows stored before it was tracked fall back to size × entry price
+var positionOrderColumns = map[string]string{
+	"instrument": "instrument",
+	"notional":   "CASE WHEN notional_usd > 0 THEN notional_usd ELSE ABS(position_size * average_price) END",
+	"pnl":        "unrealized_pnl",
+}
+
+// orderClause 生成排序和限制子句 / Build the ORDER BY and LIMIT clause
+//
+// Parameters:
+//   - opts: 查询选项 / Query options
+//
+// Returns:
+//   - string: SQL子句 / SQL clause
+//   - error: 排序字段不在白名单或限制为负数时返回错误 / Error on a non-whitelisted field or negative limit
+func (opts QueryOptions) orderClause() (string, error) {
+	orderBy := opts.OrderBy
+	if orderBy == "" {
+		orderBy = "instrument"
+	}
+	column, ok := positionOrderColumns[orderBy]
+	if !ok {
+		return "", fmt.Errorf("invalid order by field: %q (must be instrument, notional or pnl)", opts.OrderBy)
+	}
+	if opts.Limit < 0 {
+		return "", fmt.Errorf("limit must be non-negative, got %d", opts.Limit)
+	}
+
+	direction := "ASC"
+	if opts.Descending {
+		direction = "DESC"
+	}
+
+	// Instrument breaks ties so results are deterministic
+	clause := fmt.Sprintf("ORDER BY %s %s, instrument ASC", column, direction)
+	if opts.Limit > 0 {
+		clause += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+	return clause, nil
+}
+
 // GetLatestPositions 获取最新的持仓 / Get latest positions
-// Returns only positions from the most recent snapshot.
+// Returns only positions from the most recent snapshot, ordered by instrument.
 // If the latest snapshot is older than 10 minutes, returns empty slice
 // (assumes positions have been closed since last monitoring cycle)
 func (s *Storage) GetLatestPositions() ([]models.Position, error) {
+	return s.GetLatestPositionsWithOptions(QueryOptions{})
+}
+
+// GetLatestPositionsWithOptions 按选项获取最新的持仓 / Get latest positions with ordering and limit
+// 与GetLatestPositions相同，但可按名义价值、未实现盈亏或交易对排序并限制数量
+// Same as GetLatestPositions, but ordered by notional, unrealized PnL or instrument and optionally limited
+//
+// Parameters:
+//   - opts: 排序字段、方向和数量限制 / Order-by field, direction and limit
+//
+// Returns:
+//   - []models.Position: 最新快照中的持仓 / Positions from the latest snapshot
+//   - error: 选项无效或数据库查询失败时返回错误 / Error on invalid options or database query failure
+func (s *Storage) GetLatestPositionsWithOptions(opts QueryOptions) ([]models.Position, error) {
+	orderClause, err := opts.orderClause()
+	if err != nil {
+		return nil, err
+	}
+
 	// First, get the latest timestamp
 	var latestTimestamp string
-	err := s.db.QueryRow("SELECT MAX(timestamp) FROM positions").Scan(&latestTimestamp)
+	err = s.db.QueryRow("SELECT MAX(timestamp) FROM positions WHERE deleted_at IS NULL").Scan(&latestTimestamp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latest timestamp: %w", err)
 	}
@@ -264,24 +820,23 @@ func (s *Storage) GetLatestPositions() ([]models.Position, error) {
 		return []models.Position{}, nil
 	}
 
-	// Parse the latest timestamp
-	latestTime, err := time.Parse(time.RFC3339, latestTimestamp)
+	// Parse the latest timestamp (MAX() returns the raw stored text, not RFC3339)
+	latestTime, err := parseTimestamp(latestTimestamp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse latest timestamp: %w", err)
 	}
 
 	// If latest snapshot is older than 10 minutes, consider all positions closed
 	// This handles the case where monitoring detected no positions and didn't insert records
-	if time.Since(latestTime) > 10*time.Minute {
+	if !opts.IncludeStale && time.Since(latestTime) > 10*time.Minute {
 		return []models.Position{}, nil
 	}
 
 	query := `
-		SELECT id, timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage, margin_mode
+		SELECT id, timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage, margin_mode, liquidation_price, mark_price, notional_usd, opened_at
 		FROM positions
-		WHERE timestamp = ?
-		ORDER BY instrument
-	`
+		WHERE timestamp = ? AND deleted_at IS NULL
+	` + orderClause
 
 	rows, err := s.db.Query(query, latestTimestamp)
 	if err != nil {
@@ -293,7 +848,8 @@ func (s *Storage) GetLatestPositions() ([]models.Position, error) {
 	for rows.Next() {
 		var p models.Position
 		var timestamp string
-		if err := rows.Scan(&p.ID, &timestamp, &p.Instrument, &p.PositionSide, &p.PositionSize, &p.AveragePrice, &p.UnrealizedPnL, &p.Margin, &p.Leverage, &p.MarginMode); err != nil {
+		var openedAt sql.NullString
+		if err := rows.Scan(&p.ID, &timestamp, &p.Instrument, &p.PositionSide, &p.PositionSize, &p.AveragePrice, &p.UnrealizedPnL, &p.Margin, &p.Leverage, &p.MarginMode, &p.LiqPx, &p.MarkPx, &p.NotionalUSD, &openedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan position: %w", err)
 		}
 
@@ -302,6 +858,9 @@ func (s *Storage) GetLatestPositions() ([]models.Position, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
 		}
+		if p.OpenedAt, err = parseOptionalTimestamp(openedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse opened_at: %w", err)
+		}
 
 		positions = append(positions, p)
 	}
@@ -313,16 +872,158 @@ func (s *Storage) GetLatestPositions() ([]models.Position, error) {
 	return positions, nil
 }
 
-// GetAccountBalancesByTimeRange 按时间范围查询账户余额 / Query account balances by time range
-func (s *Storage) GetAccountBalancesByTimeRange(currency string, startTime, endTime time.Time) ([]models.AccountBalance, error) {
+// GetPositionsAsOf 获取指定时间点的持仓快照 / Get the position snapshot as of a point in time
+// 返回时间戳不晚于t的最近一次快照中的全部持仓
+// Returns all rows of the most recent snapshot taken at or before t
+//
+// Parameters:
+//   - t: Point in time to look up, converted to UTC for comparison
+//
+// Returns:
+//   - []models.Position: 该快照的持仓切片，按交易对排序
+//     Positions of that snapshot, sorted by instrument
+//     如果t之前没有快照，返回空切片 / Returns empty slice if no snapshot exists at or before t
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetPositionsAsOf(t time.Time) ([]models.Position, error) {
 	query := `
-		SELECT id, timestamp, currency, balance, available, frozen, equity
-		FROM account_balances
-		WHERE currency = ? AND timestamp BETWEEN ? AND ?
-		ORDER BY timestamp ASC
+		SELECT id, timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage, margin_mode, liquidation_price, mark_price, notional_usd, opened_at
+		FROM positions
+		WHERE deleted_at IS NULL AND timestamp = (SELECT MAX(timestamp) FROM positions WHERE timestamp <= ? AND deleted_at IS NULL)
+		ORDER BY instrument
 	`
 
-	rows, err := s.db.Query(query, currency, startTime.UTC(), endTime.UTC())
+	rows, err := s.db.Query(query, t.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query positions as of %s: %w", t.UTC().Format(time.RFC3339), err)
+	}
+	defer rows.Close()
+
+	positions := []models.Position{}
+	for rows.Next() {
+		var p models.Position
+		var timestamp string
+		var openedAt sql.NullString
+		if err := rows.Scan(&p.ID, &timestamp, &p.Instrument, &p.PositionSide, &p.PositionSize, &p.AveragePrice, &p.UnrealizedPnL, &p.Margin, &p.Leverage, &p.MarginMode, &p.LiqPx, &p.MarkPx, &p.NotionalUSD, &openedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan position: %w", err)
+		}
+
+		p.Timestamp, err = parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+		if p.OpenedAt, err = parseOptionalTimestamp(openedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse opened_at: %w", err)
+		}
+
+		positions = append(positions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return positions, nil
+}
+
+// GetPositionHistory 按时间范围查询单个交易对的持仓历史 / Query one instrument's position history by time range
+// 用于分析持仓数量和盈亏随时间的变化。交易对未持仓期间的快照不包含该交易对的记录，
+// 因此这些时段在结果中表现为时间戳的空缺，而不是零仓位记录
+// Used to analyze how a position's size and PnL evolved. Snapshots taken while the instrument
+// was not held contain no row for it, so such periods appear as gaps between timestamps
+// rather than as zero-size rows
+//
+// Parameters:
+//   - instrument: Instrument ID (e.g., "BTC-USDT-SWAP")
+//   - startTime: Start of the range (inclusive)
+//   - endTime: End of the range (inclusive), a range ending before startTime yields no rows
+//
+// Returns:
+//   - []models.Position: 持仓记录，按时间戳再按持仓方向排序
+//     Position rows ordered by timestamp, then position side
+//     范围内没有记录时返回空切片 / Returns empty slice if the range has no records
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetPositionHistory(instrument string, startTime, endTime time.Time) ([]models.Position, error) {
+	query := `
+		SELECT id, timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage, margin_mode, liquidation_price, mark_price, notional_usd, opened_at
+		FROM positions
+		WHERE instrument = ? AND timestamp BETWEEN ? AND ? AND deleted_at IS NULL
+		ORDER BY timestamp ASC, position_side ASC
+	`
+
+	rows, err := s.db.Query(query, instrument, startTime.UTC(), endTime.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position history for %s: %w", instrument, err)
+	}
+	defer rows.Close()
+
+	positions := []models.Position{}
+	for rows.Next() {
+		var p models.Position
+		var timestamp string
+		var openedAt sql.NullString
+		if err := rows.Scan(&p.ID, &timestamp, &p.Instrument, &p.PositionSide, &p.PositionSize, &p.AveragePrice, &p.UnrealizedPnL, &p.Margin, &p.Leverage, &p.MarginMode, &p.LiqPx, &p.MarkPx, &p.NotionalUSD, &openedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan position: %w", err)
+		}
+
+		p.Timestamp, err = parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+		if p.OpenedAt, err = parseOptionalTimestamp(openedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse opened_at: %w", err)
+		}
+
+		positions = append(positions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return positions, nil
+}
+
+// GetDistinctInstruments 查询曾经持有过的所有交易对 / Query every instrument ever held
+// 用于下拉列表和按交易对的报表，已软删除的快照不计入
+// Used for dropdowns and per-instrument reports; soft-deleted snapshots are not counted
+//
+// Returns:
+//   - []string: 按字母排序的交易对ID / Instrument IDs in alphabetical order
+//     没有持仓记录时返回空切片 / Returns empty slice if no position is stored
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetDistinctInstruments() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT instrument FROM positions WHERE deleted_at IS NULL ORDER BY instrument`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query instruments: %w", err)
+	}
+	defer rows.Close()
+
+	instruments := []string{}
+	for rows.Next() {
+		var instrument string
+		if err := rows.Scan(&instrument); err != nil {
+			return nil, fmt.Errorf("failed to scan instrument: %w", err)
+		}
+		instruments = append(instruments, instrument)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return instruments, nil
+}
+
+// GetAccountBalancesByTimeRange 按时间范围查询账户余额 / Query account balances by time range
+func (s *Storage) GetAccountBalancesByTimeRange(currency string, startTime, endTime time.Time) ([]models.AccountBalance, error) {
+	query := `
+		SELECT id, timestamp, currency, balance, available, frozen, equity, unrealized_pnl
+		FROM account_balances
+		WHERE currency = ? AND timestamp BETWEEN ? AND ? AND deleted_at IS NULL
+		ORDER BY timestamp ASC
+	`
+
+	rows, err := s.db.Query(query, currency, startTime.UTC(), endTime.UTC())
 	if err != nil {
 		return nil, fmt.Errorf("failed to query balances by time range: %w", err)
 	}
@@ -332,7 +1033,7 @@ func (s *Storage) GetAccountBalancesByTimeRange(currency string, startTime, endT
 	for rows.Next() {
 		var b models.AccountBalance
 		var timestamp string
-		if err := rows.Scan(&b.ID, &timestamp, &b.Currency, &b.Balance, &b.Available, &b.Frozen, &b.Equity); err != nil {
+		if err := rows.Scan(&b.ID, &timestamp, &b.Currency, &b.Balance, &b.Available, &b.Frozen, &b.Equity, &b.UnrealizedPnL); err != nil {
 			return nil, fmt.Errorf("failed to scan balance: %w", err)
 		}
 
@@ -352,6 +1053,587 @@ func (s *Storage) GetAccountBalancesByTimeRange(currency string, startTime, endT
 	return balances, nil
 }
 
+// GetAllBalancesByTimeRange 按时间范围查询所有币种的账户余额 / Query account balances of all currencies by time range
+// 一次查询返回所有币种的记录，避免按币种逐个查询
+// Returns every currency's rows in a single query instead of one query per currency
+//
+// Parameters:
+//   - startTime: Start of the range (inclusive)
+//   - endTime: End of the range (inclusive), a range ending before startTime yields no rows
+//
+// Returns:
+//   - []models.AccountBalance: 余额记录，按时间戳再按币种排序
+//     Balance rows ordered by timestamp, then currency
+//     范围内没有记录时返回空切片 / Returns empty slice if the range has no records
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetAllBalancesByTimeRange(startTime, endTime time.Time) ([]models.AccountBalance, error) {
+	query := `
+		SELECT id, timestamp, currency, balance, available, frozen, equity, unrealized_pnl
+		FROM account_balances
+		WHERE timestamp BETWEEN ? AND ? AND deleted_at IS NULL
+		ORDER BY timestamp ASC, currency ASC
+	`
+
+	rows, err := s.db.Query(query, startTime.UTC(), endTime.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query all balances by time range: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []models.AccountBalance{}
+	for rows.Next() {
+		var b models.AccountBalance
+		var timestamp string
+		if err := rows.Scan(&b.ID, &timestamp, &b.Currency, &b.Balance, &b.Available, &b.Frozen, &b.Equity, &b.UnrealizedPnL); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+
+		b.Timestamp, err = parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+
+		balances = append(balances, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return balances, nil
+}
+
+// DeleteMode 删除方式 / How rows are deleted
+type DeleteMode int
+
+const (
+	// HardDelete 永久删除行，用于数据保留清理 / Remove rows for good, for retention cleanup
+	HardDelete DeleteMode = iota
+	// SoftDelete 标记deleted_at并从读取中隐藏，可通过RestoreDeleted恢复，用于人工更正
+	// Set deleted_at and hide rows from reads, recoverable with RestoreDeleted, for manual corrections
+	SoftDelete
+)
+
+// DeletePositionsBefore 删除早于指定时间的持仓快照 / Delete position snapshots taken before a time
+//
+// Parameters:
+//   - before: 删除时间戳早于此时间的行（不含）/ Rows with a timestamp before this time (exclusive) are deleted
+//   - mode: HardDelete or SoftDelete
+//
+// Returns:
+//   - int64: 删除的行数，已软删除的行不重复计数 / Rows deleted, rows already soft-deleted are not counted again
+//   - error: 数据库写入失败时返回错误 / Error on database write failure
+func (s *Storage) DeletePositionsBefore(before time.Time, mode DeleteMode) (int64, error) {
+	return s.deleteBefore("positions", before, mode)
+}
+
+// DeleteBalancesBefore 删除早于指定时间的账户余额快照 / Delete account balance snapshots taken before a time
+//
+// Parameters:
+//   - before: 删除时间戳早于此时间的行（不含）/ Rows with a timestamp before this time (exclusive) are deleted
+//   - mode: HardDelete or SoftDelete
+//
+// Returns:
+//   - int64: 删除的行数，已软删除的行不重复计数 / Rows deleted, rows already soft-deleted are not counted again
+//   - error: 数据库写入失败时返回错误 / Error on database write failure
+func (s *Storage) DeleteBalancesBefore(before time.Time, mode DeleteMode) (int64, error) {
+	return s.deleteBefore("account_balances", before, mode)
+}
+
+// deleteBefore 删除表中早于指定时间的行 / Delete a table's rows taken before a time
+// 硬删除同时移除已软删除的行 / A hard delete also removes rows that were soft-deleted
+func (s *Storage) deleteBefore(table string, before time.Time, mode DeleteMode) (int64, error) {
+	var query string
+	var args []any
+	switch mode {
+	case HardDelete:
+		query = fmt.Sprintf("DELETE FROM %s WHERE timestamp < ?", table)
+		args = []any{before.UTC()}
+	case SoftDelete:
+		query = fmt.Sprintf("UPDATE %s SET deleted_at = ? WHERE timestamp < ? AND deleted_at IS NULL", table)
+		args = []any{time.Now().UTC(), before.UTC()}
+	default:
+		return 0, fmt.Errorf("invalid delete mode: %d", mode)
+	}
+
+	var result sql.Result
+	err := s.retryBusy(func() (err error) {
+		result, err = s.db.Exec(query, args...)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete %s before %s: %w", table, before.UTC().Format(time.RFC3339), err)
+	}
+
+	return result.RowsAffected()
+}
+
+// RestoreDeleted 恢复所有软删除的持仓和余额 / Restore every soft-deleted position and balance
+//
+// Returns:
+//   - int64: 恢复的行数 / Rows restored
+//   - error: 数据库写入失败时返回错误 / Error on database write failure
+func (s *Storage) RestoreDeleted() (int64, error) {
+	var restored int64
+	for _, table := range []string{"positions", "account_balances"} {
+		query := fmt.Sprintf("UPDATE %s SET deleted_at = NULL WHERE deleted_at IS NOT NULL", table)
+		var result sql.Result
+		err := s.retryBusy(func() (err error) {
+			result, err = s.db.Exec(query)
+			return err
+		})
+		if err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return restored, fmt.Errorf("failed to count restored %s: %w", table, err)
+		}
+		restored += n
+	}
+
+	return restored, nil
+}
+
+// InsertBills 插入账单记录 / Insert bill records
+// 在单个事务中写入，已存在的账单ID被忽略，因此重复拉取同一页是安全的
+// Written in a single transaction; bill IDs already stored are ignored, so fetching the
+// same page twice is safe
+//
+// Parameters:
+//   - bills: 待写入的账单 / Bills to write
+//
+// Returns:
+//   - int: 新写入的条数 / Number of bills newly written
+//   - error: 校验或数据库写入失败时返回错误，此时不写入任何记录
+//     Error on validation or database write failure, in which case nothing is written
+func (s *Storage) InsertBills(bills []models.Bill) (int, error) {
+	inserted := 0
+	err := s.WithTx(func(tx *Tx) error {
+		inserted = 0 // Counted afresh if a busy database retries the transaction
+		for i := range bills {
+			n, err := insertBill(tx.tx, &bills[i])
+			if err != nil {
+				return err
+			}
+			inserted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+func insertBill(db execer, bill *models.Bill) (int, error) {
+	if err := bill.Validate(); err != nil {
+		return 0, fmt.Errorf("invalid bill: %w", err)
+	}
+
+	query := `
+		INSERT OR IGNORE INTO bills (bill_id, timestamp, inst_type, instrument, currency, type, sub_type,
+			balance_change, balance, pnl, fee, order_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := db.Exec(query,
+		bill.BillID,
+		bill.Timestamp.UTC(),
+		bill.InstType,
+		bill.Instrument,
+		bill.Currency,
+		bill.Type,
+		bill.SubType,
+		bill.BalanceChange,
+		bill.Balance,
+		bill.PnL,
+		bill.Fee,
+		bill.OrderID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert bill %s: %w", bill.BillID, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return 0, nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	bill.ID = id
+	return 1, nil
+}
+
+// HasBill 检查账单是否已存储 / Check whether a bill is already stored
+func (s *Storage) HasBill(billID string) (bool, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM bills WHERE bill_id = ?", billID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to query bill %s: %w", billID, err)
+	}
+	return count > 0, nil
+}
+
+// GetBillsByTimeRange 按时间范围查询账单 / Query bills by time range
+//
+// Parameters:
+//   - startTime: Start of the range (inclusive)
+//   - endTime: End of the range (inclusive)
+//
+// Returns:
+//   - []models.Bill: 账单记录，按时间戳排序 / Bills ordered by timestamp
+//     范围内没有记录时返回空切片 / Returns empty slice if the range has no records
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetBillsByTimeRange(startTime, endTime time.Time) ([]models.Bill, error) {
+	query := `
+		SELECT id, bill_id, timestamp, inst_type, instrument, currency, type, sub_type,
+			balance_change, balance, pnl, fee, order_id
+		FROM bills
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC, bill_id ASC
+	`
+
+	rows, err := s.db.Query(query, startTime.UTC(), endTime.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bills by time range: %w", err)
+	}
+	defer rows.Close()
+
+	bills := []models.Bill{}
+	for rows.Next() {
+		var b models.Bill
+		var timestamp string
+		if err := rows.Scan(&b.ID, &b.BillID, &timestamp, &b.InstType, &b.Instrument, &b.Currency, &b.Type, &b.SubType,
+			&b.BalanceChange, &b.Balance, &b.PnL, &b.Fee, &b.OrderID); err != nil {
+			return nil, fmt.Errorf("failed to scan bill: %w", err)
+		}
+
+		b.Timestamp, err = parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+
+		bills = append(bills, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return bills, nil
+}
+
+// positionEventColumns 持仓变化事件的查询列 / Columns selected for position events
+const positionEventColumns = "id, timestamp, instrument, position_side, event_type, previous_size, size, average_price"
+
+// InsertPositionEvents 插入持仓变化事件 / Insert position events
+// 在单个事务中写入，失败时不写入任何事件
+// Written in a single transaction, nothing is written on failure
+//
+// Parameters:
+//   - events: 待写入的事件 / Events to write
+//
+// Returns:
+//   - error: 校验或数据库写入失败时返回错误 / Error on validation or database write failure
+//     成功时会将生成的ID回写到各事件的ID字段 / On success, generated IDs are written back to each event's ID
+func (s *Storage) InsertPositionEvents(events []models.PositionEvent) error {
+	return s.WithTx(func(tx *Tx) error {
+		for i := range events {
+			if err := insertPositionEvent(tx.tx, &events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertPositionEvent(db execer, event *models.PositionEvent) error {
+	if err := event.Validate(); err != nil {
+		return fmt.Errorf("invalid position event: %w", err)
+	}
+
+	query := `
+		INSERT INTO position_events (timestamp, instrument, position_side, event_type, previous_size, size, average_price)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := db.Exec(query,
+		event.Timestamp.UTC(),
+		event.Instrument,
+		event.PositionSide,
+		event.EventType,
+		event.PreviousSize,
+		event.Size,
+		event.AveragePrice,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert position event: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	event.ID = id
+	return nil
+}
+
+// GetPositionEventsByTimeRange 按时间范围查询持仓变化事件 / Query position events by time range
+//
+// Parameters:
+//   - startTime: Start of the range (inclusive)
+//   - endTime: End of the range (inclusive)
+//
+// Returns:
+//   - []models.PositionEvent: 事件记录，按时间戳排序 / Events ordered by timestamp
+//     范围内没有记录时返回空切片 / Returns empty slice if the range has no records
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetPositionEventsByTimeRange(startTime, endTime time.Time) ([]models.PositionEvent, error) {
+	query := `SELECT ` + positionEventColumns + `
+		FROM position_events
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC, id ASC
+	`
+	return s.queryPositionEvents(query, startTime.UTC(), endTime.UTC())
+}
+
+// GetLastPositionEvents 查询每个持仓的最新事件 / Query the latest event of each position
+// 每个交易对和方向返回一条；最新事件不是closed的持仓即为事件日志中仍持有的持仓
+// One per instrument and side; a position whose latest event is not closed is still held as
+// far as the event log knows
+//
+// Returns:
+//   - []models.PositionEvent: 最新事件，按交易对排序 / Latest events, sorted by instrument
+//     没有事件时返回空切片 / Returns empty slice if no event is stored
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetLastPositionEvents() ([]models.PositionEvent, error) {
+	query := `SELECT ` + positionEventColumns + `
+		FROM position_events
+		WHERE id IN (SELECT MAX(id) FROM position_events GROUP BY instrument, position_side)
+		ORDER BY instrument, position_side
+	`
+	return s.queryPositionEvents(query)
+}
+
+// queryPositionEvents 执行查询并扫描持仓变化事件 / Run a query and scan position events
+func (s *Storage) queryPositionEvents(query string, args ...any) ([]models.PositionEvent, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.PositionEvent{}
+	for rows.Next() {
+		var e models.PositionEvent
+		var timestamp string
+		if err := rows.Scan(&e.ID, &timestamp, &e.Instrument, &e.PositionSide, &e.EventType,
+			&e.PreviousSize, &e.Size, &e.AveragePrice); err != nil {
+			return nil, fmt.Errorf("failed to scan position event: %w", err)
+		}
+
+		e.Timestamp, err = parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// InsertRunSession 插入运行会话记录 / Insert a run session record
+//
+// Parameters:
+//   - session: 运行会话数据 / Run session data
+//
+// Returns:
+//   - error: 校验或数据库写入失败时返回错误 / Error on validation or database write failure
+func (s *Storage) InsertRunSession(session *models.RunSession) error {
+	if err := session.Validate(); err != nil {
+		return fmt.Errorf("invalid run session: %w", err)
+	}
+
+	query := `
+		INSERT INTO run_sessions (started_at, stopped_at, cycles, success_count, error_count, orders_placed)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	var result sql.Result
+	err := s.retryBusy(func() (err error) {
+		result, err = s.db.Exec(query,
+			session.StartedAt.UTC(),
+			session.StoppedAt.UTC(),
+			session.Cycles,
+			session.SuccessCount,
+			session.ErrorCount,
+			session.OrdersPlaced,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert run session: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	session.ID = id
+	return nil
+}
+
+// GetRunSessions 查询最近的运行会话 / Query the most recent run sessions
+//
+// Parameters:
+//   - limit: 最多返回的条数，0表示不限制 / Maximum sessions to return, 0 for no limit
+//
+// Returns:
+//   - []models.RunSession: 运行会话，最新的在前 / Run sessions, newest first
+//     没有记录时返回空切片 / Returns empty slice if no session is stored
+//   - error: 数据库查询失败时返回错误 / Error on database query failure
+func (s *Storage) GetRunSessions(limit int) ([]models.RunSession, error) {
+	query := `
+		SELECT id, started_at, stopped_at, cycles, success_count, error_count, orders_placed
+		FROM run_sessions
+		ORDER BY started_at DESC, id DESC
+	`
+	args := []interface{}{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query run sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.RunSession{}
+	for rows.Next() {
+		var r models.RunSession
+		var startedAt, stoppedAt string
+		if err := rows.Scan(&r.ID, &startedAt, &stoppedAt, &r.Cycles, &r.SuccessCount, &r.ErrorCount, &r.OrdersPlaced); err != nil {
+			return nil, fmt.Errorf("failed to scan run session: %w", err)
+		}
+
+		if r.StartedAt, err = parseTimestamp(startedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse started_at: %w", err)
+		}
+		if r.StoppedAt, err = parseTimestamp(stoppedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse stopped_at: %w", err)
+		}
+
+		sessions = append(sessions, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// nullableTime 零值时间存为NULL / Store the zero time as NULL
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// parseOptionalTimestamp 解析可为NULL的时间戳 / Parse a nullable timestamp
+// NULL返回零值时间 / NULL yields the zero time
+func parseOptionalTimestamp(s sql.NullString) (time.Time, error) {
+	if !s.Valid || s.String == "" {
+		return time.Time{}, nil
+	}
+	return parseTimestamp(s.String)
+}
+
+// timestampLayouts SQLite时间戳格式 / Timestamp layouts that may be returned by SQLite
+// go-sqlite3 writes time.Time as "2006-01-02 15:04:05.999999999-07:00", but converts
+// typed DATETIME columns to RFC3339 on scan. Aggregates like MAX() return the raw text.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+// parseTimestamp 解析SQLite时间戳 / Parse timestamp returned by SQLite
+// 依次尝试已知的时间格式 / Try each known layout in turn
+//
+// Parameters:
+//   - s: Timestamp string read from database
+//
+// Returns:
+//   - time.Time: 解析后的时间 / Parsed time
+//   - error: 格式无法识别时返回错误 / Error if no layout matches
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp format: %s", s)
+}
+
+// Maintenance 执行数据库维护 / Run database maintenance
+// 执行VACUUM整理碎片，然后以TRUNCATE模式检查点WAL文件
+// VACUUM rebuilds the database to remove fragmentation, then the WAL is checkpointed in
+// TRUNCATE mode. VACUUM writes through the WAL, so the checkpoint must come after it.
+//
+// 维护期间数据库被锁定，应在监控周期之外调用
+// The database is locked while this runs, so call it outside of fetch cycles
+//
+// Returns:
+//   - int64: 回收的字节数（数据库和WAL文件大小之差）
+//     Bytes reclaimed (difference in database plus WAL file size)
+//   - error: VACUUM或检查点失败时返回错误 / Error if VACUUM or the checkpoint fails
+func (s *Storage) Maintenance() (int64, error) {
+	before := s.fileSize()
+
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return 0, fmt.Errorf("failed to vacuum database: %w", err)
+	}
+
+	// Result columns: busy flag, WAL frames, checkpointed frames
+	var busy, logFrames, checkpointed int
+	if err := s.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return 0, fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+	if busy != 0 {
+		return 0, fmt.Errorf("WAL checkpoint blocked by concurrent readers or writers")
+	}
+
+	return before - s.fileSize(), nil
+}
+
+// fileSize 返回数据库和WAL文件的总大小 / Return combined size of the database and WAL files
+// 无法读取的文件按0计算 / Files that cannot be stat'ed count as 0
+func (s *Storage) fileSize() int64 {
+	var total int64
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
 // Close 关闭数据库连接 / Close database connection
 func (s *Storage) Close() error {
 	if s.db != nil {
@@ -0,0 +1,993 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// newTestStorage creates a storage backed by a temporary database
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestGetPositionsAsOf(t *testing.T) {
+	s := newTestStorage(t)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	snapshots := []struct {
+		at          time.Time
+		instruments []string
+	}{
+		{base, []string{"BTC-USDT-SWAP"}},
+		{base.Add(5 * time.Minute), []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP"}},
+		{base.Add(10 * time.Minute), []string{"ETH-USDT-SWAP"}},
+	}
+	for _, snap := range snapshots {
+		for _, inst := range snap.instruments {
+			p := &models.Position{
+				Timestamp:    snap.at,
+				Instrument:   inst,
+				PositionSide: models.PositionSideLong,
+				PositionSize: 1,
+				AveragePrice: 100,
+				MarginMode:   models.MarginModeCross,
+			}
+			if err := s.InsertPosition(p); err != nil {
+				t.Fatalf("failed to insert position: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		asOf        time.Time
+		expectInsts []string
+		expectTime  time.Time
+	}{
+		{"before first snapshot", base.Add(-time.Second), nil, time.Time{}},
+		{"exactly at first snapshot", base, []string{"BTC-USDT-SWAP"}, base},
+		{"between first and second", base.Add(3 * time.Minute), []string{"BTC-USDT-SWAP"}, base},
+		{"between second and third", base.Add(7*time.Minute + 500*time.Millisecond), []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP"}, base.Add(5 * time.Minute)},
+		{"after last snapshot", base.Add(time.Hour), []string{"ETH-USDT-SWAP"}, base.Add(10 * time.Minute)},
+		{"non-UTC location", base.Add(3 * time.Minute).In(time.FixedZone("UTC+8", 8*3600)), []string{"BTC-USDT-SWAP"}, base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, err := s.GetPositionsAsOf(tt.asOf)
+			if err != nil {
+				t.Fatalf("GetPositionsAsOf() error = %v", err)
+			}
+			if positions == nil {
+				t.Fatal("expected empty slice, got nil")
+			}
+			if len(positions) != len(tt.expectInsts) {
+				t.Fatalf("expected %d positions, got %d", len(tt.expectInsts), len(positions))
+			}
+			for i, p := range positions {
+				if p.Instrument != tt.expectInsts[i] {
+					t.Errorf("position %d: expected %s, got %s", i, tt.expectInsts[i], p.Instrument)
+				}
+				if !p.Timestamp.Equal(tt.expectTime) {
+					t.Errorf("position %d: expected timestamp %v, got %v", i, tt.expectTime, p.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDistinctInstruments(t *testing.T) {
+	s := newTestStorage(t)
+
+	instruments, err := s.GetDistinctInstruments()
+	if err != nil {
+		t.Fatalf("GetDistinctInstruments() error = %v", err)
+	}
+	if instruments == nil || len(instruments) != 0 {
+		t.Errorf("expected an empty slice without positions, got %v", instruments)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := []struct {
+		at   time.Time
+		inst string
+		side models.PositionSide
+	}{
+		{base, "ETH-USDT-SWAP", models.PositionSideLong},
+		{base, "BTC-USDT-SWAP", models.PositionSideLong},
+		{base, "BTC-USDT-SWAP", models.PositionSideShort},
+		{base.Add(5 * time.Minute), "BTC-USDT-SWAP", models.PositionSideLong},
+		{base.Add(10 * time.Minute), "SOL-USDT-SWAP", models.PositionSideNet},
+	}
+	for _, row := range rows {
+		p := &models.Position{
+			Timestamp:    row.at,
+			Instrument:   row.inst,
+			PositionSide: row.side,
+			PositionSize: 1,
+			AveragePrice: 100,
+			MarginMode:   models.MarginModeCross,
+		}
+		if err := s.InsertPosition(p); err != nil {
+			t.Fatalf("failed to insert position: %v", err)
+		}
+	}
+
+	instruments, err = s.GetDistinctInstruments()
+	if err != nil {
+		t.Fatalf("GetDistinctInstruments() error = %v", err)
+	}
+	expected := []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP", "SOL-USDT-SWAP"}
+	if !reflect.DeepEqual(instruments, expected) {
+		t.Errorf("expected %v, got %v", expected, instruments)
+	}
+}
+
+func TestGetPositionHistory(t *testing.T) {
+	s := newTestStorage(t)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := []struct {
+		at   time.Time
+		inst string
+		size float64
+		pnl  float64
+	}{
+		// Inserted out of order; BTC is not held in the snapshot at +5m
+		{base.Add(15 * time.Minute), "BTC-USDT-SWAP", 3, 20},
+		{base, "BTC-USDT-SWAP", 1, 10},
+		{base.Add(5 * time.Minute), "ETH-USDT-SWAP", 4, 1},
+		{base.Add(10 * time.Minute), "BTC-USDT-SWAP", 2, -5},
+	}
+	for _, row := range rows {
+		p := &models.Position{
+			Timestamp:     row.at,
+			Instrument:    row.inst,
+			PositionSide:  models.PositionSideLong,
+			PositionSize:  row.size,
+			AveragePrice:  100,
+			UnrealizedPnL: row.pnl,
+			MarginMode:    models.MarginModeCross,
+		}
+		if err := s.InsertPosition(p); err != nil {
+			t.Fatalf("failed to insert position: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		instrument  string
+		start, end  time.Time
+		expectSizes []float64
+	}{
+		{"whole history in order", "BTC-USDT-SWAP", base, base.Add(time.Hour), []float64{1, 2, 3}},
+		{"inclusive bounds", "BTC-USDT-SWAP", base.Add(10 * time.Minute), base.Add(15 * time.Minute), []float64{2, 3}},
+		{"range inside a gap", "BTC-USDT-SWAP", base.Add(time.Minute), base.Add(9 * time.Minute), nil},
+		{"other instrument", "ETH-USDT-SWAP", base, base.Add(time.Hour), []float64{4}},
+		{"end before start", "BTC-USDT-SWAP", base.Add(time.Hour), base, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, err := s.GetPositionHistory(tt.instrument, tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("GetPositionHistory() error = %v", err)
+			}
+			if positions == nil {
+				t.Fatal("expected empty slice, got nil")
+			}
+			if len(positions) != len(tt.expectSizes) {
+				t.Fatalf("expected %d positions, got %d", len(tt.expectSizes), len(positions))
+			}
+			for i, p := range positions {
+				if p.Instrument != tt.instrument || p.PositionSize != tt.expectSizes[i] {
+					t.Errorf("position %d: expected %s size %v, got %s size %v", i, tt.instrument, tt.expectSizes[i], p.Instrument, p.PositionSize)
+				}
+				if i > 0 && !p.Timestamp.After(positions[i-1].Timestamp) {
+					t.Errorf("position %d: timestamp %v not after %v", i, p.Timestamp, positions[i-1].Timestamp)
+				}
+			}
+		})
+	}
+
+	// PnL is returned alongside size so its evolution can be analyzed
+	positions, err := s.GetPositionHistory("BTC-USDT-SWAP", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetPositionHistory() error = %v", err)
+	}
+	if positions[1].UnrealizedPnL != -5 || !positions[1].Timestamp.Equal(base.Add(10*time.Minute)) {
+		t.Errorf("expected PnL -5 at +10m, got %v at %v", positions[1].UnrealizedPnL, positions[1].Timestamp)
+	}
+}
+
+func TestEquityAggregation(t *testing.T) {
+	s := newTestStorage(t)
+
+	// No data yet
+	total, err := s.GetTotalEquity()
+	if err != nil {
+		t.Fatalf("GetTotalEquity() error = %v", err)
+	}
+	if total != 0 {
+		t.Errorf("expected 0 total equity without data, got %f", total)
+	}
+	breakdown, err := s.GetCurrencyBreakdown()
+	if err != nil {
+		t.Fatalf("GetCurrencyBreakdown() error = %v", err)
+	}
+	if len(breakdown) != 0 {
+		t.Errorf("expected empty breakdown without data, got %v", breakdown)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	balances := []struct {
+		at       time.Time
+		currency string
+		equity   float64
+	}{
+		// Older snapshot must be ignored
+		{base, "USDT", 9999},
+		{base, "BTC", 9999},
+		{base.Add(time.Minute), "USDT", 1000.5},
+		{base.Add(time.Minute), "BTC", 42000},
+		{base.Add(time.Minute), "ETH", 2500.25},
+	}
+	for _, b := range balances {
+		balance := &models.AccountBalance{Timestamp: b.at, Currency: b.currency, Equity: b.equity}
+		if err := s.InsertAccountBalance(balance); err != nil {
+			t.Fatalf("failed to insert balance: %v", err)
+		}
+	}
+
+	total, err = s.GetTotalEquity()
+	if err != nil {
+		t.Fatalf("GetTotalEquity() error = %v", err)
+	}
+	if total != 45500.75 {
+		t.Errorf("expected total equity 45500.75, got %f", total)
+	}
+
+	breakdown, err = s.GetCurrencyBreakdown()
+	if err != nil {
+		t.Fatalf("GetCurrencyBreakdown() error = %v", err)
+	}
+	expected := map[string]float64{"USDT": 1000.5, "BTC": 42000, "ETH": 2500.25}
+	if len(breakdown) != len(expected) {
+		t.Fatalf("expected %d currencies, got %v", len(expected), breakdown)
+	}
+	for currency, equity := range expected {
+		if breakdown[currency] != equity {
+			t.Errorf("%s: expected equity %f, got %f", currency, equity, breakdown[currency])
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	s := newTestStorage(t)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 500; i++ {
+		balance := &models.AccountBalance{Timestamp: base.Add(time.Duration(i) * time.Minute), Currency: "USDT", Balance: float64(i)}
+		if err := s.InsertAccountBalance(balance); err != nil {
+			t.Fatalf("failed to insert balance: %v", err)
+		}
+	}
+	if _, err := s.db.Exec("DELETE FROM account_balances WHERE id % 2 = 0"); err != nil {
+		t.Fatalf("failed to delete balances: %v", err)
+	}
+
+	reclaimed, err := s.Maintenance()
+	if err != nil {
+		t.Fatalf("Maintenance() error = %v", err)
+	}
+	if reclaimed <= 0 {
+		t.Errorf("expected space to be reclaimed, got %d bytes", reclaimed)
+	}
+
+	// The database remains usable after maintenance
+	balances, err := s.GetAccountBalancesByTimeRange("USDT", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetAccountBalancesByTimeRange() error = %v", err)
+	}
+	// Minutes 0..60 inclusive, every other row kept
+	if len(balances) != 31 {
+		t.Errorf("expected 31 remaining balances in the first hour, got %d", len(balances))
+	}
+}
+
+func TestGetAllBalancesByTimeRange(t *testing.T) {
+	s := newTestStorage(t)
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		// Insert USDT before BTC to check ordering by currency within a timestamp
+		for _, currency := range []string{"USDT", "BTC"} {
+			balance := &models.AccountBalance{Timestamp: base.Add(time.Duration(i) * time.Minute), Currency: currency, Balance: float64(i)}
+			if err := s.InsertAccountBalance(balance); err != nil {
+				t.Fatalf("failed to insert balance: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		start, end  time.Time
+		expectCount int
+	}{
+		{"whole history", base, base.Add(3 * time.Minute), 8},
+		{"middle snapshots", base.Add(30 * time.Second), base.Add(2 * time.Minute), 4},
+		{"range before data", base.Add(-time.Hour), base.Add(-time.Minute), 0},
+		{"inverted range", base.Add(3 * time.Minute), base, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances, err := s.GetAllBalancesByTimeRange(tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("GetAllBalancesByTimeRange() error = %v", err)
+			}
+			if balances == nil {
+				t.Fatal("expected empty slice, got nil")
+			}
+			if len(balances) != tt.expectCount {
+				t.Fatalf("expected %d balances, got %d", tt.expectCount, len(balances))
+			}
+			for i := 0; i+1 < len(balances); i += 2 {
+				a, b := balances[i], balances[i+1]
+				if !a.Timestamp.Equal(b.Timestamp) || a.Currency != "BTC" || b.Currency != "USDT" {
+					t.Errorf("rows %d-%d not ordered by timestamp then currency: %s@%v, %s@%v",
+						i, i+1, a.Currency, a.Timestamp, b.Currency, b.Timestamp)
+				}
+				if i > 0 && !balances[i-1].Timestamp.Before(a.Timestamp) {
+					t.Errorf("row %d not after row %d", i, i-1)
+				}
+			}
+		})
+	}
+}
+
+func TestGetLatestPositionsWithOptions(t *testing.T) {
+	s := newTestStorage(t)
+
+	// Snapshot must be recent, older snapshots are treated as closed positions
+	now := time.Now().UTC()
+	seed := []struct {
+		instrument string
+		side       models.PositionSide
+		size       float64
+		price      float64
+		pnl        float64
+	}{
+		{"BTC-USDT-SWAP", models.PositionSideLong, 2, 50000, 150},
+		{"ETH-USDT-SWAP", models.PositionSideShort, 10, 3000, -40},
+		{"SOL-USDT-SWAP", models.PositionSideLong, 100, 100, 320},
+		{"DOGE-USDT-SWAP", models.PositionSideNet, -50000, 0.1, 5},
+	}
+	for _, p := range seed {
+		position := &models.Position{
+			Timestamp:     now,
+			Instrument:    p.instrument,
+			PositionSide:  p.side,
+			PositionSize:  p.size,
+			AveragePrice:  p.price,
+			UnrealizedPnL: p.pnl,
+		}
+		if err := s.InsertPosition(position); err != nil {
+			t.Fatalf("failed to insert position: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		opts        QueryOptions
+		expected    []string
+		expectError bool
+	}{
+		{"default orders by instrument", QueryOptions{}, []string{"BTC-USDT-SWAP", "DOGE-USDT-SWAP", "ETH-USDT-SWAP", "SOL-USDT-SWAP"}, false},
+		{"top 2 by pnl descending", QueryOptions{OrderBy: "pnl", Descending: true, Limit: 2}, []string{"SOL-USDT-SWAP", "BTC-USDT-SWAP"}, false},
+		{"pnl ascending", QueryOptions{OrderBy: "pnl"}, []string{"ETH-USDT-SWAP", "DOGE-USDT-SWAP", "BTC-USDT-SWAP", "SOL-USDT-SWAP"}, false},
+		{"top 3 by absolute notional", QueryOptions{OrderBy: "notional", Descending: true, Limit: 3}, []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP", "SOL-USDT-SWAP"}, false},
+		{"field outside whitelist", QueryOptions{OrderBy: "instrument; DROP TABLE positions"}, nil, true},
+		{"negative limit", QueryOptions{Limit: -1}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions, err := s.GetLatestPositionsWithOptions(tt.opts)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetLatestPositionsWithOptions() error = %v", err)
+			}
+			if len(positions) != len(tt.expected) {
+				t.Fatalf("expected %d positions, got %d", len(tt.expected), len(positions))
+			}
+			for i, p := range positions {
+				if p.Instrument != tt.expected[i] {
+					t.Errorf("position %d: expected %s, got %s", i, tt.expected[i], p.Instrument)
+				}
+			}
+		})
+	}
+}
+
+func TestPositionLiquidationPriceMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+
+	// Database created before the liquidation_price column existed
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE positions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp DATETIME NOT NULL,
+			instrument VARCHAR(50) NOT NULL,
+			position_side VARCHAR(10) NOT NULL,
+			position_size REAL NOT NULL,
+			average_price REAL NOT NULL,
+			unrealized_pnl REAL NOT NULL,
+			margin REAL NOT NULL,
+			leverage REAL,
+			margin_mode VARCHAR(10) DEFAULT 'cross'
+		);
+		INSERT INTO positions (timestamp, instrument, position_side, position_size, average_price, unrealized_pnl, margin, leverage)
+		VALUES ('2024-01-01 12:00:00+00:00', 'BTC-USDT-SWAP', 'long', 1, 50000, 0, 0, 10);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+
+	s, err := New(path, true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to open old database: %v", err)
+	}
+	defer s.Close()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	positions, err := s.GetPositionsAsOf(base)
+	if err != nil {
+		t.Fatalf("GetPositionsAsOf() error = %v", err)
+	}
+	if len(positions) != 1 || positions[0].LiqPx != 0 || positions[0].MarkPx != 0 {
+		t.Fatalf("expected old row with zero liquidation and mark price, got %+v", positions)
+	}
+
+	position := &models.Position{
+		Timestamp:    base.Add(time.Minute),
+		Instrument:   "BTC-USDT-SWAP",
+		PositionSide: models.PositionSideLong,
+		PositionSize: 1,
+		AveragePrice: 50000,
+		MarginMode:   models.MarginModeCross,
+		LiqPx:        45500.5,
+	}
+	if err := s.InsertPosition(position); err != nil {
+		t.Fatalf("failed to insert position: %v", err)
+	}
+	positions, err = s.GetPositionsAsOf(base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetPositionsAsOf() error = %v", err)
+	}
+	if len(positions) != 1 || positions[0].LiqPx != 45500.5 {
+		t.Errorf("expected liquidation price 45500.5, got %+v", positions)
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	s := newTestStorage(t)
+
+	// Snapshot must be recent to be returned as the latest positions
+	position := &models.Position{
+		Timestamp:     time.Now().UTC().Truncate(time.Second),
+		Instrument:    "ETH-USDT-SWAP",
+		PositionSide:  models.PositionSideShort,
+		PositionSize:  4,
+		AveragePrice:  3000.5,
+		UnrealizedPnL: -12.25,
+		Margin:        600,
+		Leverage:      20,
+		MarginMode:    models.MarginModeIsolated,
+		LiqPx:         3140.75,
+		MarkPx:        3003.1,
+		NotionalUSD:   12012.4,
+		OpenedAt:      time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC),
+	}
+	if err := s.InsertPosition(position); err != nil {
+		t.Fatalf("failed to insert position: %v", err)
+	}
+
+	positions, err := s.GetLatestPositions()
+	if err != nil {
+		t.Fatalf("GetLatestPositions() error = %v", err)
+	}
+	if len(positions) != 1 {
+		t.Fatalf("expected 1 position, got %d", len(positions))
+	}
+	got := positions[0]
+	if !got.Timestamp.Equal(position.Timestamp) {
+		t.Errorf("expected timestamp %v, got %v", position.Timestamp, got.Timestamp)
+	}
+	if !got.OpenedAt.Equal(position.OpenedAt) {
+		t.Errorf("expected opened_at %v, got %v", position.OpenedAt, got.OpenedAt)
+	}
+	got.Timestamp = position.Timestamp
+	got.OpenedAt = position.OpenedAt
+	if !reflect.DeepEqual(got, *position) {
+		t.Errorf("expected %+v, got %+v", *position, got)
+	}
+
+	// Negative prices are rejected before reaching the database
+	position.MarkPx = -1
+	if err := s.InsertPosition(position); err == nil {
+		t.Error("expected error inserting negative mark price")
+	}
+	position.MarkPx = 3003.1
+	position.NotionalUSD = -1
+	if err := s.InsertPosition(position); err == nil {
+		t.Error("expected error inserting negative notional")
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	balance := func() *models.AccountBalance {
+		return &models.AccountBalance{Timestamp: now, Currency: "USDT", Balance: 1000, Available: 900, Equity: 1000}
+	}
+	position := func() *models.Position {
+		return &models.Position{Timestamp: now, Instrument: "BTC-USDT-SWAP", PositionSide: models.PositionSideLong,
+			PositionSize: 3, AveragePrice: 50000, MarginMode: models.MarginModeCross}
+	}
+
+	// A failure in the middle of the transaction rolls back the earlier writes
+	err := s.WithTx(func(tx *Tx) error {
+		if err := tx.InsertAccountBalance(balance()); err != nil {
+			return err
+		}
+		invalid := position()
+		invalid.Instrument = ""
+		return tx.InsertPosition(invalid)
+	})
+	if err == nil {
+		t.Fatal("expected error from invalid position")
+	}
+
+	balances, err := s.GetLatestAccountBalances()
+	if err != nil {
+		t.Fatalf("GetLatestAccountBalances() error = %v", err)
+	}
+	if len(balances) != 0 {
+		t.Errorf("expected no balances after rollback, got %d", len(balances))
+	}
+
+	// A successful transaction commits every write
+	err = s.WithTx(func(tx *Tx) error {
+		if err := tx.InsertAccountBalance(balance()); err != nil {
+			return err
+		}
+		return tx.InsertPosition(position())
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+
+	balances, err = s.GetLatestAccountBalances()
+	if err != nil {
+		t.Fatalf("GetLatestAccountBalances() error = %v", err)
+	}
+	positions, err := s.GetLatestPositions()
+	if err != nil {
+		t.Fatalf("GetLatestPositions() error = %v", err)
+	}
+	if len(balances) != 1 || len(positions) != 1 {
+		t.Errorf("expected 1 balance and 1 position after commit, got %d and %d", len(balances), len(positions))
+	}
+}
+
+func TestInsertBills(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	bills := []models.Bill{
+		{BillID: "1", Timestamp: base, Currency: "USDT", Type: "2", PnL: 10, Fee: -0.5},
+		{BillID: "2", Timestamp: base.Add(time.Hour), Currency: "USDT", Type: "8", BalanceChange: -0.2},
+	}
+	inserted, err := s.InsertBills(bills)
+	if err != nil {
+		t.Fatalf("failed to insert bills: %v", err)
+	}
+	if inserted != 2 {
+		t.Errorf("expected 2 bills inserted, got %d", inserted)
+	}
+
+	// Bills already stored are ignored
+	inserted, err = s.InsertBills([]models.Bill{
+		{BillID: "2", Timestamp: base.Add(time.Hour), Currency: "USDT", Type: "8", BalanceChange: -0.2},
+		{BillID: "3", Timestamp: base.Add(2 * time.Hour), Currency: "USDT", Type: "2", Fee: -0.1},
+	})
+	if err != nil {
+		t.Fatalf("failed to insert bills: %v", err)
+	}
+	if inserted != 1 {
+		t.Errorf("expected 1 new bill inserted, got %d", inserted)
+	}
+
+	if ok, err := s.HasBill("3"); err != nil || !ok {
+		t.Errorf("expected bill 3 to be stored, got %v, %v", ok, err)
+	}
+	if ok, err := s.HasBill("4"); err != nil || ok {
+		t.Errorf("expected bill 4 to be missing, got %v, %v", ok, err)
+	}
+
+	got, err := s.GetBillsByTimeRange(base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to query bills: %v", err)
+	}
+	if len(got) != 2 || got[0].BillID != "1" || got[0].PnL != 10 || got[0].Fee != -0.5 || got[1].BillID != "2" {
+		t.Errorf("unexpected bills: %+v", got)
+	}
+
+	// An invalid bill rolls back the whole batch
+	if _, err := s.InsertBills([]models.Bill{
+		{BillID: "5", Timestamp: base, Currency: "USDT"},
+		{BillID: "", Timestamp: base, Currency: "USDT"},
+	}); err == nil {
+		t.Error("expected error for bill without ID")
+	}
+	if ok, _ := s.HasBill("5"); ok {
+		t.Error("expected batch with an invalid bill to be rolled back")
+	}
+}
+
+func TestDeleteBefore(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newer := base.Add(time.Hour)
+
+	// seed stores a position and a balance snapshot at base and at newer
+	seed := func(t *testing.T) *Storage {
+		s := newTestStorage(t)
+		for i, at := range []time.Time{base, newer} {
+			position := &models.Position{
+				Timestamp:    at,
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: models.PositionSideLong,
+				PositionSize: float64(i + 1),
+				AveragePrice: 50000,
+				MarginMode:   models.MarginModeCross,
+			}
+			if err := s.InsertPosition(position); err != nil {
+				t.Fatalf("failed to insert position: %v", err)
+			}
+			balance := &models.AccountBalance{Timestamp: at, Currency: "USDT", Equity: float64(1000 * (i + 1))}
+			if err := s.InsertAccountBalance(balance); err != nil {
+				t.Fatalf("failed to insert balance: %v", err)
+			}
+		}
+		return s
+	}
+
+	// visible reports the position and balance rows reads still return
+	visible := func(t *testing.T, s *Storage) (int, int) {
+		positions, err := s.GetPositionHistory("BTC-USDT-SWAP", base, newer)
+		if err != nil {
+			t.Fatalf("GetPositionHistory() error = %v", err)
+		}
+		balances, err := s.GetAllBalancesByTimeRange(base, newer)
+		if err != nil {
+			t.Fatalf("GetAllBalancesByTimeRange() error = %v", err)
+		}
+		return len(positions), len(balances)
+	}
+
+	for _, mode := range []DeleteMode{HardDelete, SoftDelete} {
+		s := seed(t)
+
+		deleted, err := s.DeletePositionsBefore(newer, mode)
+		if err != nil || deleted != 1 {
+			t.Fatalf("mode %d: DeletePositionsBefore() = %d, %v, want 1 row", mode, deleted, err)
+		}
+		deleted, err = s.DeleteBalancesBefore(newer, mode)
+		if err != nil || deleted != 1 {
+			t.Fatalf("mode %d: DeleteBalancesBefore() = %d, %v, want 1 row", mode, deleted, err)
+		}
+		if positions, balances := visible(t, s); positions != 1 || balances != 1 {
+			t.Errorf("mode %d: expected only the newer rows visible, got %d positions %d balances", mode, positions, balances)
+		}
+
+		// Deleting the same range again finds nothing left
+		if deleted, err := s.DeletePositionsBefore(newer, mode); err != nil || deleted != 0 {
+			t.Errorf("mode %d: expected nothing left to delete, got %d, %v", mode, deleted, err)
+		}
+
+		var stored int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM positions").Scan(&stored); err != nil {
+			t.Fatalf("failed to count positions: %v", err)
+		}
+		if want := map[DeleteMode]int{HardDelete: 1, SoftDelete: 2}[mode]; stored != want {
+			t.Errorf("mode %d: expected %d stored position rows, got %d", mode, want, stored)
+		}
+	}
+
+	if _, err := newTestStorage(t).DeletePositionsBefore(newer, DeleteMode(9)); err == nil {
+		t.Error("expected error for an invalid delete mode")
+	}
+}
+
+func TestSoftDeleteHidesLatest(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, at := range []time.Time{base, base.Add(time.Minute)} {
+		position := &models.Position{
+			Timestamp:    at,
+			Instrument:   "BTC-USDT-SWAP",
+			PositionSide: models.PositionSideLong,
+			PositionSize: float64(i + 1),
+			AveragePrice: 50000,
+			MarginMode:   models.MarginModeCross,
+		}
+		if err := s.InsertPosition(position); err != nil {
+			t.Fatalf("failed to insert position: %v", err)
+		}
+		balance := &models.AccountBalance{Timestamp: at, Currency: "USDT", Equity: float64(1000 * (i + 1))}
+		if err := s.InsertAccountBalance(balance); err != nil {
+			t.Fatalf("failed to insert balance: %v", err)
+		}
+	}
+
+	// Soft-deleting everything leaves the latest queries empty instead of falling back
+	if _, err := s.DeletePositionsBefore(base.Add(time.Hour), SoftDelete); err != nil {
+		t.Fatalf("DeletePositionsBefore() error = %v", err)
+	}
+	if _, err := s.DeleteBalancesBefore(base.Add(time.Hour), SoftDelete); err != nil {
+		t.Fatalf("DeleteBalancesBefore() error = %v", err)
+	}
+	positions, err := s.GetPositionsAsOf(base.Add(time.Hour))
+	if err != nil || len(positions) != 0 {
+		t.Errorf("expected no positions after soft delete, got %v, %v", positions, err)
+	}
+	balances, err := s.GetLatestAccountBalances()
+	if err != nil || len(balances) != 0 {
+		t.Errorf("expected no balances after soft delete, got %v, %v", balances, err)
+	}
+	if total, err := s.GetTotalEquity(); err != nil || total != 0 {
+		t.Errorf("expected 0 total equity after soft delete, got %f, %v", total, err)
+	}
+
+	// Restoring brings the latest snapshot back
+	restored, err := s.RestoreDeleted()
+	if err != nil || restored != 4 {
+		t.Fatalf("RestoreDeleted() = %d, %v, want 4 rows", restored, err)
+	}
+	positions, err = s.GetPositionsAsOf(base.Add(time.Hour))
+	if err != nil || len(positions) != 1 || positions[0].PositionSize != 2 {
+		t.Errorf("expected the restored latest position, got %v, %v", positions, err)
+	}
+	if total, err := s.GetTotalEquity(); err != nil || total != 2000 {
+		t.Errorf("expected restored total equity 2000, got %f, %v", total, err)
+	}
+}
+
+func TestPositionEvents(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	events := []models.PositionEvent{
+		{Timestamp: base, Instrument: "BTC-USDT-SWAP", PositionSide: models.PositionSideLong, EventType: models.PositionEventOpened, Size: 1, AveragePrice: 50000},
+		{Timestamp: base, Instrument: "ETH-USDT-SWAP", PositionSide: models.PositionSideShort, EventType: models.PositionEventOpened, Size: 2, AveragePrice: 3000},
+		{Timestamp: base.Add(time.Hour), Instrument: "BTC-USDT-SWAP", PositionSide: models.PositionSideLong, EventType: models.PositionEventIncreased, PreviousSize: 1, Size: 2, AveragePrice: 50500},
+		{Timestamp: base.Add(2 * time.Hour), Instrument: "ETH-USDT-SWAP", PositionSide: models.PositionSideShort, EventType: models.PositionEventClosed, PreviousSize: 2, AveragePrice: 3000},
+	}
+	if err := s.InsertPositionEvents(events); err != nil {
+		t.Fatalf("failed to insert position events: %v", err)
+	}
+
+	// An invalid event rolls back the whole batch
+	err := s.InsertPositionEvents([]models.PositionEvent{
+		{Timestamp: base.Add(3 * time.Hour), Instrument: "BTC-USDT-SWAP", PositionSide: models.PositionSideLong, EventType: models.PositionEventClosed, PreviousSize: 2},
+		{Timestamp: base.Add(3 * time.Hour), Instrument: "SOL-USDT-SWAP", PositionSide: models.PositionSideLong, EventType: "flipped"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid event type")
+	}
+
+	got, err := s.GetPositionEventsByTimeRange(base.Add(30*time.Minute), base.Add(5*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to query position events: %v", err)
+	}
+	if len(got) != 2 || got[0].EventType != models.PositionEventIncreased || got[1].EventType != models.PositionEventClosed {
+		t.Errorf("expected increased then closed, got %+v", got)
+	}
+	if !got[0].Timestamp.Equal(base.Add(time.Hour)) || got[0].PreviousSize != 1 || got[0].Size != 2 {
+		t.Errorf("unexpected round trip: %+v", got[0])
+	}
+
+	last, err := s.GetLastPositionEvents()
+	if err != nil {
+		t.Fatalf("failed to query last position events: %v", err)
+	}
+	if len(last) != 2 {
+		t.Fatalf("expected one event per position, got %+v", last)
+	}
+	if last[0].Instrument != "BTC-USDT-SWAP" || last[0].EventType != models.PositionEventIncreased {
+		t.Errorf("expected BTC increased as its latest event, got %+v", last[0])
+	}
+	if last[1].Instrument != "ETH-USDT-SWAP" || last[1].EventType != models.PositionEventClosed {
+		t.Errorf("expected ETH closed as its latest event, got %+v", last[1])
+	}
+}
+
+func TestInsertRetriesWhileLocked(t *testing.T) {
+	tests := []struct {
+		name        string
+		holdFor     time.Duration // how long the other connection keeps the write lock
+		expectError bool
+	}{
+		{"lock released during the retries", 80 * time.Millisecond, false},
+		{"lock held past the retries", 600 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			s, err := New(path, true, 1, 1, WithBusyTimeout(1))
+			if err != nil {
+				t.Fatalf("failed to create storage: %v", err)
+			}
+			defer s.Close()
+
+			// A second connection holds the write lock, as a concurrent writer would
+			other, err := sql.Open("sqlite3", path)
+			if err != nil {
+				t.Fatalf("failed to open second connection: %v", err)
+			}
+			defer other.Close()
+			lock, err := other.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin: %v", err)
+			}
+			if _, err := lock.Exec("DELETE FROM positions"); err != nil {
+				t.Fatalf("failed to take the write lock: %v", err)
+			}
+			released := make(chan struct{})
+			go func() {
+				defer close(released)
+				time.Sleep(tt.holdFor)
+				lock.Rollback()
+			}()
+
+			err = s.InsertPosition(&models.Position{
+				Timestamp:    time.Now(),
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: models.PositionSideLong,
+				PositionSize: 1,
+				AveragePrice: 100,
+				MarginMode:   models.MarginModeCross,
+			})
+			<-released
+			if tt.expectError {
+				if !isBusy(err) {
+					t.Errorf("expected a busy error once retries run out, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the retry to succeed, got %v", err)
+			}
+			positions, err := s.GetLatestPositions()
+			if err != nil {
+				t.Fatalf("GetLatestPositions() error = %v", err)
+			}
+			if len(positions) != 1 {
+				t.Errorf("expected the position to be stored, got %d rows", len(positions))
+			}
+		})
+	}
+}
+
+func TestDeleteRetriesWhileLocked(t *testing.T) {
+	tests := []struct {
+		name string
+		mode DeleteMode
+	}{
+		{"hard delete", HardDelete},
+		{"soft delete", SoftDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			s, err := New(path, true, 1, 1, WithBusyTimeout(1))
+			if err != nil {
+				t.Fatalf("failed to create storage: %v", err)
+			}
+			defer s.Close()
+
+			err = s.InsertPosition(&models.Position{
+				Timestamp:    time.Now().Add(-time.Hour),
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: models.PositionSideLong,
+				PositionSize: 1,
+				AveragePrice: 100,
+				MarginMode:   models.MarginModeCross,
+			})
+			if err != nil {
+				t.Fatalf("failed to insert position: %v", err)
+			}
+
+			// A second connection holds the write lock briefly, as a concurrent writer would
+			other, err := sql.Open("sqlite3", path)
+			if err != nil {
+				t.Fatalf("failed to open second connection: %v", err)
+			}
+			defer other.Close()
+			lock, err := other.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin: %v", err)
+			}
+			if _, err := lock.Exec("UPDATE account_balances SET deleted_at = NULL WHERE 0"); err != nil {
+				t.Fatalf("failed to take the write lock: %v", err)
+			}
+			released := make(chan struct{})
+			go func() {
+				defer close(released)
+				time.Sleep(80 * time.Millisecond)
+				lock.Rollback()
+			}()
+
+			deleted, err := s.DeletePositionsBefore(time.Now(), tt.mode)
+			<-released
+			if err != nil {
+				t.Fatalf("expected the retry to succeed, got %v", err)
+			}
+			if deleted != 1 {
+				t.Errorf("expected 1 row deleted, got %d", deleted)
+			}
+
+			if tt.mode != SoftDelete {
+				return
+			}
+			lock, err = other.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin: %v", err)
+			}
+			if _, err := lock.Exec("UPDATE account_balances SET deleted_at = NULL WHERE 0"); err != nil {
+				t.Fatalf("failed to take the write lock: %v", err)
+			}
+			released = make(chan struct{})
+			go func() {
+				defer close(released)
+				time.Sleep(80 * time.Millisecond)
+				lock.Rollback()
+			}()
+
+			restored, err := s.RestoreDeleted()
+			<-released
+			if err != nil {
+				t.Fatalf("expected the restore retry to succeed, got %v", err)
+			}
+			if restored != 1 {
+				t.Errorf("expected 1 row restored, got %d", restored)
+			}
+		})
+	}
+}
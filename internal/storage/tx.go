@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// Tx 数据库事务 / Database transaction
+// 提供插入方法的事务版本，仅在WithTx回调内有效
+// Exposes transactional variants of the insert methods, valid only inside a WithTx callback
+type Tx struct {
+	tx execer
+}
+
+// WithTx 在单个事务中执行写入 / Run writes in a single transaction
+// 回调返回nil时提交；返回错误或发生panic时回滚，不会写入任何数据。
+// 用于需要跨表保持一致的写入，例如同一时间戳下的余额和持仓。
+// 数据库繁忙时整个事务回滚后重试，因此回调可能执行多次
+// Commits when the callback returns nil; rolls back on an error or panic so nothing is written.
+// Used for writes that must stay consistent across tables, such as balances and positions
+// recorded under the same timestamp. While the database is busy the whole transaction is rolled
+// back and retried, so the callback may run more than once
+//
+// Parameters:
+//   - fn: 在事务内执行的回调 / Callback run inside the transaction
+//
+// Returns:
+//   - error: 开始事务、回调或提交失败时返回错误 / Error on begin, callback or commit failure
+func (s *Storage) WithTx(fn func(tx *Tx) error) error {
+	return s.retryBusy(func() error { return s.withTx(fn) })
+}
+
+// withTx 执行一次事务 / Run the transaction once
+func (s *Storage) withTx(fn func(tx *Tx) error) (err error) {
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			if rbErr := sqlTx.Rollback(); rbErr != nil && err != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+			}
+		}
+	}()
+
+	if err := fn(&Tx{tx: sqlTx}); err != nil {
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// InsertAccountBalance 在事务内插入账户余额记录 / Insert account balance record in the transaction
+// 语义同Storage.InsertAccountBalance / Same semantics as Storage.InsertAccountBalance
+func (t *Tx) InsertAccountBalance(balance *models.AccountBalance) error {
+	return insertAccountBalance(t.tx, balance)
+}
+
+// InsertPosition 在事务内插入持仓记录 / Insert position record in the transaction
+// 语义同Storage.InsertPosition / Same semantics as Storage.InsertPosition
+func (t *Tx) InsertPosition(position *models.Position) error {
+	return insertPosition(t.tx, position)
+}
+
+// InsertAccountMargin 在事务内插入账户保证金记录 / Insert account margin record in the transaction
+// 语义同Storage.InsertAccountMargin / Same semantics as Storage.InsertAccountMargin
+func (t *Tx) InsertAccountMargin(margin *models.AccountMargin) error {
+	return insertAccountMargin(t.tx, margin)
+}
+
+// InsertTPSLOrder 在事务内插入止盈止损订单记录 / Insert TPSL order record in the transaction
+// 语义同Storage.InsertTPSLOrder / Same semantics as Storage.InsertTPSLOrder
+func (t *Tx) InsertTPSLOrder(order *models.TPSLOrder) error {
+	return insertTPSLOrder(t.tx, order)
+}
@@ -0,0 +1,126 @@
+package tpsl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// positionAged 持仓是否已超过止损收紧时长 / Whether a position has been open long enough to tighten its stop
+// 未启用SLTightenAfterHours或开仓时间未知时返回false
+// False when SLTightenAfterHours is disabled or the opening time is unknown
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - bool: 是否应收紧止损 / Whether the stop should be tightened
+func (m *Manager) positionAged(position *models.Position) bool {
+	hours := m.cfg().SLTightenAfterHours
+	if hours <= 0 || position.OpenedAt.IsZero() {
+		return false
+	}
+	return m.clock.Now().Sub(position.OpenedAt) >= time.Duration(hours)*time.Hour
+}
+
+// withinGracePeriod 持仓是否仍在开仓宽限期内 / Whether a position is still within the new-position grace period
+// 开仓不足NewPositionGraceSeconds的持仓暂不放置订单，等待分批成交的开仓均价稳定。
+// 未启用或开仓时间未知时返回false
+// Positions opened less than NewPositionGraceSeconds ago are deferred so the average price of an
+// entry filled in parts settles first. False when disabled or the opening time is unknown
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - string: 推迟原因 / Reason for the deferral
+//   - bool: 是否推迟 / Whether to defer
+func (m *Manager) withinGracePeriod(position *models.Position) (string, bool) {
+	grace := time.Duration(m.cfg().NewPositionGraceSeconds) * time.Second
+	if grace <= 0 || position.OpenedAt.IsZero() {
+		return "", false
+	}
+	age := m.clock.Now().Sub(position.OpenedAt)
+	if age >= grace {
+		return "", false
+	}
+	return fmt.Sprintf("opened %s ago, deferring placement until the %s new_position_grace_seconds elapse",
+		age.Truncate(time.Second), grace), true
+}
+
+// tightenStopDistance 收紧老持仓的止损距离 / Tighten the stop distance of an old position
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - slDistance: 计算得到的止损距离 / Calculated stop distance
+//
+// Returns:
+//   - decimal.Decimal: 超过时长时乘以SLTightenFactor，否则不变 / Multiplied by SLTightenFactor past the age, unchanged otherwise
+func (m *Manager) tightenStopDistance(position *models.Position, slDistance decimal.Decimal) decimal.Decimal {
+	if !m.positionAged(position) {
+		return slDistance
+	}
+	tightened := slDistance.Mul(toDecimal(m.cfg().SLTightenFactor))
+	m.logger.Debug("Position %s (%s) open since %s, tightening stop distance from %s to %s",
+		position.Instrument, position.PositionSide, position.OpenedAt.Format(time.RFC3339), slDistance, tightened)
+	return tightened
+}
+
+// tightenStopLoss 将老持仓的已有止损移近 / Move the existing stop of an old position closer
+// 对已完整覆盖且止盈止损各有一个可修改订单的持仓，开仓超过SLTightenAfterHours后
+// 将止损修改为收紧后的止损价；只向有利方向移动，从不放宽止损，止盈不变
+// For a fully covered position with one amendable order per leg that has been open longer than
+// SLTightenAfterHours, the stop is amended to the tightened stop price; it only moves in the
+// favourable direction, never loosening the stop, and the take-profit is left alone
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - algoOrders: 待处理的算法订单 / Pending algo orders
+//
+// Returns:
+//   - bool: 是否修改了止损 / Whether the stop was amended
+//   - error: 计算价格、获取价格或修改订单失败时返回错误 / Error calculating or fetching prices, or amending the order
+func (m *Manager) tightenStopLoss(position *models.Position, algoOrders []okx.AlgoOrder) (bool, error) {
+	if !m.positionAged(position) {
+		return false, nil
+	}
+
+	_, sl, ok := m.chooseAmendTargets(position, algoOrders)
+	if !ok || sl == nil {
+		return false, nil
+	}
+
+	prices, err := m.calculateTPSLPrices(position)
+	if err != nil {
+		return false, fmt.Errorf("failed to calculate tightened stop: %w", err)
+	}
+
+	isLong := m.isLongPosition(position)
+	newSL := ratchetTrigger(sl.SlTriggerPx, toDecimal(prices.SlPrice), isLong, m.orderFormatFor(position.Instrument))
+	if newSL == "" {
+		return false, nil // Already at or inside the tightened stop
+	}
+
+	price := position.MarkPx
+	if price <= 0 {
+		if price, err = m.getCurrentMarketPrice(position.Instrument); err != nil {
+			return false, fmt.Errorf("failed to get price for stop tightening: %w", err)
+		}
+	}
+	if crossesPrice(newSL, price, isLong) {
+		// Price already trades beyond the tightened stop, which OKX would reject
+		m.logger.Warn("Tightened Stop-Loss %s for %s (%s) is through the current price %s, keeping %s",
+			newSL, position.Instrument, position.PositionSide, formatFloat(price), sl.SlTriggerPx)
+		return false, nil
+	}
+
+	if _, err := m.okxClient.AmendAlgoOrder(sl.InstId, sl.AlgoId, "", "", newSL); err != nil {
+		return false, fmt.Errorf("tightening Stop-Loss amend of %s failed: %w", sl.AlgoId, err)
+	}
+	m.logger.Info("Tightened Stop-Loss %s for %s (%s) open since %s: %s -> %s",
+		sl.AlgoId, position.Instrument, position.PositionSide, position.OpenedAt.Format(time.RFC3339), sl.SlTriggerPx, newSL)
+	return true, nil
+}
@@ -0,0 +1,24 @@
+package tpsl
+
+import "github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+
+// OKXAPI TPSL管理使用的OKX接口 / OKX API used by TPSL management
+// 由*okx.Client实现；测试中可替换为模拟实现，无需真实HTTP请求
+// Implemented by *okx.Client; tests substitute a mock so no real HTTP is needed
+type OKXAPI interface {
+	GetPositions() (*okx.PositionsResponse, error)
+	GetAccountConfig() (*okx.AccountConfigResponse, error)
+	GetPendingAlgoOrders(ordType string) (*okx.PendingAlgoOrdersResponse, error)
+	GetAlgoOrder(algoId string) (*okx.AlgoOrderDetailsResponse, error)
+	PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error)
+	AmendAlgoOrder(instId, algoId, newSz, newTpTrigger, newSlTrigger string) (*okx.AlgoOrderResponse, error)
+	CancelAlgoOrders(orders []okx.CancelAlgoOrderRequest) (*okx.AlgoOrderResponse, error)
+	PlaceOrder(req okx.OrderRequest) (*okx.OrderResponse, error)
+	GetMaxAvailSize(instId, tdMode string) (*okx.MaxAvailSizeResponse, error)
+	GetTicker(instId string) (*okx.TickerResponse, error)
+	GetTickers(instType string) (*okx.TickerResponse, error)
+	GetOrderBook(instId string, depth int) (*okx.OrderBookResponse, error)
+	GetInstruments(instType, instId string) (*okx.InstrumentsResponse, error)
+}
+
+var _ OKXAPI = (*okx.Client)(nil)
@@ -0,0 +1,94 @@
+package tpsl
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+)
+
+// clientOrderIdPrefix 客户端订单ID前缀 / Client order ID prefix
+const clientOrderIdPrefix = "tj"
+
+// clientOrderIdAttempts 同一订单最多尝试的客户端订单ID数量 / Most client order IDs tried for one order
+const clientOrderIdAttempts = 3
+
+// errDuplicateNotPending 客户端订单ID已存在但订单不在待处理列表中 / The client order ID exists but its order is not pending
+var errDuplicateNotPending = errors.New("client order ID already used by an order that is no longer pending")
+
+// clientOrderId 生成确定性的客户端算法订单ID / Build a deterministic client algo order ID
+// 由交易品种、方向、订单类型（tp、sl或同时包含两者的ts）、数量、触发价、序号和UTC日期决定，
+// 因此同一天内重试同一请求得到相同的ID，OKX会拒绝重复的ID；数量或触发价不同的订单得到不同的ID。
+// 同一请求的订单已触发或撤销后，以下一个序号重新下单。
+// 格式为 "tj" + yyyymmdd + 类型 + 16位十六进制哈希，共28个字母数字字符（OKX上限32）
+// Determined by instrument, side, kind (tp, sl, or ts for an order carrying both), size, trigger
+// prices, sequence number and UTC day, so retrying a request the same day reuses its ID, which
+// OKX rejects as a duplicate, while orders of another size or trigger get different IDs. Once the
+// order of an identical request has triggered or been cancelled, it is placed again under the
+// next sequence number. Format is "tj" + yyyymmdd + kind + 16 hex digits of hash, 28
+// alphanumeric characters (OKX allows 32)
+//
+// Parameters:
+//   - req: 算法订单请求 / Algo order request
+//   - now: 当前时间 / Current time
+//   - seq: 序号，首次下单为0 / Sequence number, 0 for the first placement
+//
+// Returns:
+//   - string: 客户端算法订单ID / Client algo order ID
+func clientOrderId(req okx.AlgoOrderRequest, now time.Time, seq int) string {
+	kind := "ts"
+	switch {
+	case req.SlTriggerPx == "":
+		kind = "tp"
+	case req.TpTriggerPx == "":
+		kind = "sl"
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s|%s|%s|%d", req.InstId, req.Side, req.PosSide,
+		req.Sz, req.CloseFraction, req.TpTriggerPx, req.SlTriggerPx, seq)
+	return fmt.Sprintf("%s%s%s%016x", clientOrderIdPrefix, now.UTC().Format("20060102"), kind, h.Sum64())
+}
+
+// stampOrder 为订单请求设置标签和客户端订单ID / Set the broker tag and client order ID on a request
+func (m *Manager) stampOrder(req *okx.AlgoOrderRequest, seq int) {
+	req.Tag = m.cfg().OrderTag
+	if m.cfg().ClientOrderIds {
+		req.AlgoClOrdId = clientOrderId(*req, m.clock.Now(), seq)
+	}
+}
+
+// resolveDuplicate 将客户端订单ID重复的拒单解析为已有订单 / Resolve a duplicate client order ID rejection to the existing order
+// 只认可OKX上仍待处理的订单；订单已触发或撤销时返回errDuplicateNotPending，
+// 以免持仓在没有保护的情况下被计为已下单
+// Only an order still pending on OKX counts; when it has triggered or been cancelled
+// errDuplicateNotPending is returned, so the position isn't counted as protected without an order
+//
+// Parameters:
+//   - req: 被拒的算法订单请求 / Rejected algo order request
+//   - rejection: 重复ID的拒单错误 / The duplicate ID rejection
+//
+// Returns:
+//   - *okx.AlgoOrderResponse: 已有订单的下单结果 / Placement result of the existing order
+//   - error: 订单不在待处理列表中或查询失败时返回错误 / Error when the order is not pending or the lookup fails
+func (m *Manager) resolveDuplicate(req okx.AlgoOrderRequest, rejection error) (*okx.AlgoOrderResponse, error) {
+	pending, err := m.okxClient.GetPendingAlgoOrders("conditional")
+	if err != nil {
+		return nil, fmt.Errorf("%w (looking up the existing order failed: %v)", rejection, err)
+	}
+
+	for _, order := range pending.Data {
+		if order.AlgoClOrdId != req.AlgoClOrdId {
+			continue
+		}
+		m.logger.Info("Order for %s (%s) with client order ID %s already exists as algoId %s, treating it as placed",
+			req.InstId, req.PosSide, req.AlgoClOrdId, order.AlgoId)
+		return &okx.AlgoOrderResponse{
+			Code: "0",
+			Data: []okx.AlgoOrderResult{{AlgoId: order.AlgoId, AlgoClOrdId: req.AlgoClOrdId, SCode: "0"}},
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errDuplicateNotPending, req.AlgoClOrdId)
+}
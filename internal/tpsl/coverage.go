@@ -0,0 +1,71 @@
+package tpsl
+
+import (
+	"math"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// AccountCoverageRatio 计算整个账户被TPSL保护的名义价值比例 / Share of the account's notional protected by TPSL
+// 基于与AnalyzeCoverage相同的只读覆盖分析，不下单
+// Based on the same read-only coverage analysis as AnalyzeCoverage, never placing orders
+//
+// Parameters:
+//   - positions: 持仓列表 / List of positions
+//
+// Returns:
+//   - float64: 已覆盖名义价值 / 总名义价值，见CoverageRatio / Covered notional / total notional, see CoverageRatio
+//   - error: 查询待处理订单失败时返回错误 / Error when pending algo orders cannot be queried
+func (m *Manager) AccountCoverageRatio(positions []*models.Position) (float64, error) {
+	coverage, err := m.AnalyzeCoverage(positions)
+	if err != nil {
+		return 0, err
+	}
+	return CoverageRatio(positions, coverage), nil
+}
+
+// CoverageRatio 根据覆盖明细计算已覆盖名义价值比例 / Covered share of notional from coverage details
+// 每个持仓按已覆盖数量占持仓数量的比例计入其美元名义价值；跳过的持仓计为未保护。
+// 名义价值未知（0）的持仓不计入，没有可计入的名义价值时返回1（没有未保护的敞口）
+// Each position contributes its USD notional in proportion to its covered size; skipped positions
+// count as unprotected. Positions with an unknown (0) notional are left out, and with no notional
+// left 1 is returned (nothing is exposed)
+//
+// Parameters:
+//   - positions: 持仓列表 / List of positions
+//   - coverage: 每个持仓的覆盖明细，顺序与positions一致 / Coverage detail of each position, in the same order
+//
+// Returns:
+//   - float64: [0, 1]内的覆盖比例 / Coverage ratio in [0, 1]
+func CoverageRatio(positions []*models.Position, coverage []PositionCoverage) float64 {
+	var total, covered float64
+	for i, position := range positions {
+		notional := math.Abs(position.NotionalUSD)
+		if notional == 0 || i >= len(coverage) {
+			continue
+		}
+		total += notional
+		if c := coverage[i]; c.Size > 0 {
+			covered += notional * math.Min(c.CoveredSize/c.Size, 1)
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return covered / total
+}
+
+// coveredBy 记录新下单覆盖的数量 / Account for size newly covered by placed orders
+// 已覆盖数量不超过持仓数量 / The covered size never exceeds the position size
+//
+// Parameters:
+//   - coverage: 下单前的覆盖明细 / Coverage detail before the placement
+//   - size: 新覆盖的数量 / Size newly covered
+//
+// Returns:
+//   - PositionCoverage: 下单后的覆盖明细 / Coverage detail after the placement
+func coveredBy(coverage PositionCoverage, size float64) PositionCoverage {
+	coverage.CoveredSize = math.Min(coverage.CoveredSize+size, coverage.Size)
+	coverage.UncoveredSize = coverage.Size - coverage.CoveredSize
+	return coverage
+}
@@ -0,0 +1,55 @@
+package tpsl
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// apiPrecision 发送给API的最大小数位数 / Maximum decimal places sent to the API
+const apiPrecision = 8
+
+// toDecimal 将float64转换为十进制数 / Convert float64 to decimal
+// 使用能往返还原该float64的最短十进制表示，因此由"0.1"解析得到的值精确转换为0.1
+// Uses the shortest decimal that round-trips the float64, so a value parsed from "0.1" becomes exactly 0.1
+func toDecimal(f float64) decimal.Decimal {
+	return decimal.NewFromFloat(f)
+}
+
+// parseDecimal 解析API返回的数值字符串 / Parse a numeric string returned by the API
+func parseDecimal(s string) (decimal.Decimal, error) {
+	return decimal.NewFromString(s)
+}
+
+// formatDecimal 格式化为API使用的字符串 / Format a decimal for the API
+// 保留最多8位小数，去除末尾的零 / Rounded to at most 8 decimal places without trailing zeros
+func formatDecimal(d decimal.Decimal) string {
+	return d.Round(apiPrecision).String()
+}
+
+// stepPrecision 根据步长计算小数位数 / Decimal places implied by a step size
+// 例如tickSz "0.1"为1位，"0.00000001"为8位，"1"为0位
+// For example tickSz "0.1" gives 1, "0.00000001" gives 8 and "1" gives 0
+//
+// Parameters:
+//   - step: 步长字符串（tickSz或lotSz）/ Step size string (tickSz or lotSz)
+//
+// Returns:
+//   - int32: 小数位数 / Decimal places
+//   - bool: 步长是否有效 / Whether the step size is valid
+func stepPrecision(step string) (int32, bool) {
+	d, err := parseDecimal(step)
+	if err != nil || !d.IsPositive() {
+		return 0, false
+	}
+	s := d.String() // Trailing zeros are dropped, so "0.10" counts as 1 place
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return int32(len(s) - i - 1), true
+	}
+	return 0, true
+}
+
+// formatDecimalPlaces 按固定小数位数格式化 / Format a decimal to a fixed number of places
+func formatDecimalPlaces(d decimal.Decimal, places int32) string {
+	return d.StringFixed(places)
+}
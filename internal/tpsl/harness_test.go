@@ -0,0 +1,249 @@
+package tpsl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+)
+
+// simInstrument is the instrument traded in the simulated account
+const simInstrument = "BTC-USDT-SWAP"
+
+// simExchange is a scripted OKX account holding one long position in simInstrument. Conditional
+// orders whose trigger the price crosses are filled against the position, reduce-only, and every
+// order action taken by the manager or the exchange is recorded in actions.
+type simExchange struct {
+	OKXAPI
+
+	mu      sync.Mutex
+	price   float64
+	size    float64 // 0 when flat
+	entry   float64
+	pending []okx.AlgoOrder
+	nextId  int
+	actions []string // order actions since the last takeActions call
+}
+
+// setPrice moves the price and fills the orders it triggers
+func (e *simExchange) setPrice(price float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.price = price
+
+	live := e.pending[:0]
+	for _, order := range e.pending {
+		tp, _ := strconv.ParseFloat(order.TpTriggerPx, 64)
+		sl, _ := strconv.ParseFloat(order.SlTriggerPx, 64)
+		if (tp > 0 && price >= tp) || (sl > 0 && price <= sl) {
+			sz, _ := strconv.ParseFloat(order.Sz, 64)
+			e.size -= min(sz, e.size)
+			e.actions = append(e.actions, "fill "+order.AlgoId)
+			continue
+		}
+		live = append(live, order)
+	}
+	e.pending = live
+}
+
+// setSize changes the position as a manual trade would, 0 closes it
+func (e *simExchange) setSize(size float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.size == 0 {
+		e.entry = e.price
+	}
+	e.size = size
+}
+
+// takeActions returns the recorded actions and starts a new record
+func (e *simExchange) takeActions() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	actions := e.actions
+	e.actions = nil
+	return actions
+}
+
+func (e *simExchange) GetPositions() (*okx.PositionsResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := &okx.PositionsResponse{Code: "0"}
+	if e.size > 0 {
+		resp.Data = []okx.PositionData{{
+			InstId:  simInstrument,
+			PosSide: "long",
+			Pos:     formatFloat(e.size),
+			AvgPx:   formatFloat(e.entry),
+			MgnMode: "cross",
+		}}
+	}
+	return resp, nil
+}
+
+func (e *simExchange) GetPendingAlgoOrders(ordType string) (*okx.PendingAlgoOrdersResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &okx.PendingAlgoOrdersResponse{Code: "0", Data: append([]okx.AlgoOrder(nil), e.pending...)}, nil
+}
+
+func (e *simExchange) PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextId++
+	algoId := "algo-" + strconv.Itoa(e.nextId)
+	e.pending = append(e.pending, okx.AlgoOrder{
+		AlgoId:      algoId,
+		InstId:      req.InstId,
+		PosSide:     req.PosSide,
+		Sz:          req.Sz,
+		OrdType:     req.OrdType,
+		State:       "live",
+		TpTriggerPx: req.TpTriggerPx,
+		SlTriggerPx: req.SlTriggerPx,
+	})
+	if req.TpTriggerPx != "" {
+		e.actions = append(e.actions, fmt.Sprintf("place %s tp %s@%s", algoId, req.Sz, req.TpTriggerPx))
+	} else {
+		e.actions = append(e.actions, fmt.Sprintf("place %s sl %s@%s", algoId, req.Sz, req.SlTriggerPx))
+	}
+	return &okx.AlgoOrderResponse{Code: "0", Data: []okx.AlgoOrderResult{{AlgoId: algoId, SCode: "0"}}}, nil
+}
+
+func (e *simExchange) AmendAlgoOrder(instId, algoId, newSz, newTpTrigger, newSlTrigger string) (*okx.AlgoOrderResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.pending {
+		if e.pending[i].AlgoId != algoId {
+			continue
+		}
+		if newSz != "" {
+			e.pending[i].Sz = newSz
+		}
+		if newTpTrigger != "" {
+			e.pending[i].TpTriggerPx = newTpTrigger
+		}
+		if newSlTrigger != "" {
+			e.pending[i].SlTriggerPx = newSlTrigger
+		}
+	}
+	e.actions = append(e.actions, fmt.Sprintf("amend %s sz=%s tp=%s sl=%s", algoId, newSz, newTpTrigger, newSlTrigger))
+	return &okx.AlgoOrderResponse{Code: "0"}, nil
+}
+
+func (e *simExchange) CancelAlgoOrders(orders []okx.CancelAlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, cancel := range orders {
+		for i := range e.pending {
+			if e.pending[i].AlgoId == cancel.AlgoId {
+				e.pending = append(e.pending[:i], e.pending[i+1:]...)
+				break
+			}
+		}
+		e.actions = append(e.actions, "cancel "+cancel.AlgoId)
+	}
+	return &okx.AlgoOrderResponse{Code: "0"}, nil
+}
+
+func (e *simExchange) GetTicker(instId string) (*okx.TickerResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &okx.TickerResponse{Code: "0", Data: []okx.TickerData{{InstId: instId, Last: formatFloat(e.price)}}}, nil
+}
+
+func (e *simExchange) GetMaxAvailSize(instId, tdMode string) (*okx.MaxAvailSizeResponse, error) {
+	return &okx.MaxAvailSizeResponse{Code: "0", Data: []okx.MaxAvailSizeData{{InstId: instId, AvailBuy: "100", AvailSell: "100"}}}, nil
+}
+
+func (e *simExchange) GetInstruments(instType, instId string) (*okx.InstrumentsResponse, error) {
+	return &okx.InstrumentsResponse{Code: "0"}, nil // No metadata, generic precision
+}
+
+// simStep is one scheduler cycle: the price moves (filling triggered orders), the position is
+// traded manually, then the scheduler runs a check
+type simStep struct {
+	name    string
+	price   float64  // price before the check, 0 keeps the previous price
+	size    float64  // position size after manual trades, keepSize leaves it to fills
+	actions []string // order actions expected from fills and the check, in order
+	pending int      // live algo orders expected after the check
+}
+
+// keepSize leaves the position size of a step to fills
+const keepSize = -1
+
+func TestSchedulerSimulatedFills(t *testing.T) {
+	// With volatility 1% and a 5:1 ratio, entry 50000 gives SL 49500 and TP 52500
+	tests := []struct {
+		name  string
+		steps []simStep
+	}{
+		{
+			name: "open, partial close, full close",
+			steps: []simStep{
+				{"open", 50000, 3, []string{"place algo-1 tp 3@52500", "place algo-2 sl 3@49500"}, 2},
+				{"price drifts", 50800, keepSize, nil, 2},
+				// Reduce-only orders larger than the position are left alone, OKX caps them at the position
+				{"partial close", 0, 1, nil, 2},
+				// Nothing cleans up the orders of a closed position yet
+				{"full close", 0, 0, nil, 2},
+			},
+		},
+		{
+			name: "stop-loss fill closes the position",
+			steps: []simStep{
+				{"open", 50000, 3, []string{"place algo-1 tp 3@52500", "place algo-2 sl 3@49500"}, 2},
+				{"price falls through the stop", 49400, keepSize, []string{"fill algo-2"}, 1},
+				{"flat afterwards", 49000, keepSize, nil, 1},
+			},
+		},
+		{
+			name: "scale in resizes, take-profit fill closes",
+			steps: []simStep{
+				{"open", 50000, 3, []string{"place algo-1 tp 3@52500", "place algo-2 sl 3@49500"}, 2},
+				{"scale in", 0, 5, []string{"amend algo-2 sz=5 tp= sl=", "amend algo-1 sz=5 tp= sl="}, 2},
+				{"price rallies through the target", 52600, keepSize, []string{"fill algo-1"}, 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := logger.New(filepath.Join(t.TempDir(), "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			t.Cleanup(func() { log.Close() })
+
+			cfg := &config.TPSLConfig{VolatilityPct: 0.01, ProfitLossRatio: 5.0, PriceBufferPct: 0.001, PositionSource: "live"}
+			exchange := &simExchange{}
+			scheduler := NewScheduler(cfg, nil, exchange, log)
+
+			for _, step := range tt.steps {
+				if step.price > 0 {
+					exchange.setPrice(step.price)
+				}
+				if step.size != keepSize {
+					exchange.setSize(step.size)
+				}
+				if _, err := scheduler.RunCheck(); err != nil {
+					t.Fatalf("%s: RunCheck() error = %v", step.name, err)
+				}
+
+				actions := exchange.takeActions()
+				if fmt.Sprint(actions) != fmt.Sprint(step.actions) {
+					t.Errorf("%s: expected actions %q, got %q", step.name, step.actions, actions)
+				}
+				if pending := len(exchange.pending); pending != step.pending {
+					t.Errorf("%s: expected %d pending orders, got %d", step.name, step.pending, pending)
+				}
+			}
+		})
+	}
+}
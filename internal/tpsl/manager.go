@@ -1,12 +1,22 @@
 package tpsl
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
-
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
 	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
 )
 
@@ -14,9 +24,45 @@ import (
 // 负责分析持仓TPSL覆盖情况并下单TPSL订单
 // Responsible for analyzing position TPSL coverage and placing TPSL orders
 type Manager struct {
+	configMu  sync.RWMutex // guards config, runConfig and runs
 	config    *config.TPSLConfig
-	okxClient *okx.Client
+	okxClient OKXAPI
+	wsClient  *okx.WSClient
+	storage   *storage.Storage
 	logger    *logger.Logger
+	alerter   *alert.Alerter
+	clock     clock.Clock // order age and price cache expiry, replaceable in tests
+	posMode   string      // account position mode, empty until detected
+
+	instMu      sync.Mutex
+	instruments map[string]*okx.InstrumentData // instrument metadata cache by instId
+
+	priceMu sync.Mutex
+	prices  map[string]cachedPrice // last ticker price by instId, reused within PriceCacheTTL
+
+	trailMu   sync.Mutex
+	highWater map[string]highWaterMark // favourable price per position once TP trailing activated
+
+	latency latencyTracker // PlaceAlgoOrder wall-clock durations
+
+	ordersPlaced atomic.Int64 // algo orders OKX accepted since start, across all runs and entry points
+
+	// Share of the account's notional covered after the latest coverage analysis or TPSL check, nil until one ran
+	coverageRatio atomic.Pointer[float64]
+
+	// Config snapshot of the checks in flight, taken when the first starts; SetConfig applies from the next
+	runConfig *config.TPSLConfig
+	runs      int
+
+	// Orders placed in the current check, awaiting verification when VerifyPlacement is enabled
+	placedMu sync.Mutex
+	placed   []placedOrder
+}
+
+// cachedPrice 缓存的最新价格 / Cached last price
+type cachedPrice struct {
+	price     float64
+	fetchedAt time.Time
 }
 
 // TPSLPrices TPSL价格 / TPSL prices
@@ -25,16 +71,61 @@ type TPSLPrices struct {
 	SlPrice float64
 }
 
+// price 返回指定一侧的价格 / Return the price of the given leg
+func (p *TPSLPrices) price(leg models.TPSLLeg) float64 {
+	if leg == models.TPSLLegStopLoss {
+		return p.SlPrice
+	}
+	return p.TpPrice
+}
+
 // CoverageSummary 覆盖情况汇总 / Coverage summary
 type CoverageSummary struct {
-	TotalChecked      int
-	FullyCovered      int
-	PartiallyCovered  int
-	NotCovered        int
-	OrdersPlaced      int
-	PlacementFailures int
+	TotalChecked      int `json:"total_checked"`
+	FullyCovered      int `json:"fully_covered"`
+	PartiallyCovered  int `json:"partially_covered"`
+	NotCovered        int `json:"not_covered"`
+	OrdersPlaced      int `json:"orders_placed"`
+	OrdersAmended     int `json:"orders_amended"`
+	OrdersReplaced    int `json:"orders_replaced"`
+	PlacementFailures int `json:"placement_failures"`
+	Skipped           int `json:"skipped"`
+	ResidualsIgnored  int `json:"residuals_ignored"`
+	ResidualsClosed   int `json:"residuals_closed"`    // residuals closed at market by residual_action close
+	UnpairedCoverage  int `json:"unpaired_coverage"`   // positions with only a TP or only an SL
+	OrderLimitRefused int `json:"order_limit_refused"` // placements refused by MaxOrdersPerInstrument
+	OrdersTrailed     int `json:"orders_trailed"`      // covered positions whose triggers were trailed
+	OverNotionalCap   int `json:"over_notional_cap"`   // positions whose USD notional exceeds the configured cap
+	StopsTightened    int `json:"stops_tightened"`     // covered positions whose stop was tightened for age
+	OverMarginRisk    int `json:"over_margin_risk"`    // positions whose stop loses more margin than MaxMarginRisk
+
+	// Positions whose placed orders were not live or covered less than placed, with VerifyPlacement
+	UnverifiedPlacements int `json:"unverified_placements"`
+}
+
+// PositionCoverage 单个持仓的覆盖状态 / Coverage status of a single position
+type PositionCoverage struct {
+	Instrument    string  `json:"instrument"`
+	PositionSide  string  `json:"position_side"`
+	Size          float64 `json:"size"`
+	CoveredSize   float64 `json:"covered_size"` // size covered by both a TP and an SL
+	UncoveredSize float64 `json:"uncovered_size"`
+	TPCount       int     `json:"tp_count"`
+	SLCount       int     `json:"sl_count"`
+	Status        string  `json:"status"` // covered, residual, partial, uncovered or skipped
+	SkipReason    string  `json:"skip_reason,omitempty"`
+	MarginRisk    float64 `json:"margin_risk,omitempty"` // margin fraction lost if the widest existing stop fills
 }
 
+// 覆盖状态 / Coverage statuses
+const (
+	CoverageCovered   = "covered"   // fully covered by TP and SL
+	CoverageResidual  = "residual"  // uncovered part is below MinUncoveredFraction and ignored
+	CoveragePartial   = "partial"   // partly covered
+	CoverageUncovered = "uncovered" // no TP+SL coverage at all
+	CoverageSkipped   = "skipped"   // excluded by the instrument filter
+)
+
 // New 创建TPSL管理器 / Create TPSL manager
 // 初始化TPSL管理器实例
 // Initialize TPSL manager instance
@@ -46,11 +137,138 @@ type CoverageSummary struct {
 //
 // Returns:
 //   - *Manager: TPSL管理器实例 / TPSL manager instance
-func New(config *config.TPSLConfig, okxClient *okx.Client, logger *logger.Logger) *Manager {
+func New(config *config.TPSLConfig, okxClient OKXAPI, logger *logger.Logger) *Manager {
 	return &Manager{
-		config:    config,
-		okxClient: okxClient,
-		logger:    logger,
+		config:      config,
+		okxClient:   okxClient,
+		logger:      logger,
+		clock:       clock.Real{},
+		instruments: make(map[string]*okx.InstrumentData),
+		prices:      make(map[string]cachedPrice),
+		highWater:   make(map[string]highWaterMark),
+	}
+}
+
+// SetConfig 更新TPSL配置 / Update TPSL configuration
+// 用于配置热加载：立即替换配置而不等待进行中的检查，进行中的检查继续使用开始时的快照，
+// 新配置在没有检查进行时生效，因此同一次检查内的所有计算使用同一份配置。传入的配置替换后不应再被修改
+// For config hot-reload: swaps the config without waiting for a check in flight, which keeps
+// the snapshot it started with; the new config applies once no check is in flight, so every
+// calculation within one check sees the same config. The passed config must not be modified
+// after the swap
+//
+// Parameters:
+//   - cfg: 新的TPSL配置，nil时忽略 / New TPSL configuration, nil is ignored
+func (m *Manager) SetConfig(cfg *config.TPSLConfig) {
+	if cfg == nil {
+		return
+	}
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.config = cfg
+}
+
+// cfg 返回当前TPSL配置 / Return the current TPSL configuration
+// 有检查进行时返回其开始时的快照，否则返回最新配置
+// Returns the snapshot of the checks in flight while one runs, the latest config otherwise
+func (m *Manager) cfg() *config.TPSLConfig {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	if m.runConfig != nil {
+		return m.runConfig
+	}
+	return m.config
+}
+
+// beginRun 开始一次检查并固定配置快照 / Start a check and pin the config snapshot
+// 重叠的检查（如看板的覆盖分析与定时检查）共享第一个检查的快照，必须以endRun结束
+// Overlapping checks (e.g., a dashboard coverage analysis during a scheduled check) share the
+// snapshot taken by the first, each must be ended with endRun
+func (m *Manager) beginRun() {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	if m.runs == 0 {
+		m.runConfig = m.config
+	}
+	m.runs++
+}
+
+// endRun 结束一次检查，最后一个检查结束时释放快照 / End a check, the last one releases the snapshot
+func (m *Manager) endRun() {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.runs--
+	if m.runs == 0 {
+		m.runConfig = nil
+	}
+}
+
+// SetWSClient 设置WebSocket行情客户端 / Set WebSocket ticker client
+// 设置后优先使用推送的最新价格，并随持仓变化更新订阅
+// When set, streamed prices are preferred and subscriptions follow the position set
+//
+// Parameters:
+//   - wsClient: WebSocket ticker client, nil to use REST ticker only
+func (m *Manager) SetWSClient(wsClient *okx.WSClient) {
+	m.wsClient = wsClient
+}
+
+// DetectPositionMode 检测账户持仓模式 / Detect account position mode
+// 查询账户配置并缓存持仓模式，决定下单时是否发送posSide；
+// 检测失败时继续根据持仓方向推断
+// Query the account configuration and cache the position mode that decides whether orders
+// carry posSide; on failure posSide keeps being inferred from each position's side
+//
+// Returns:
+//   - error: 查询失败或返回未知模式时返回错误 / Error on query failure or unknown mode
+func (m *Manager) DetectPositionMode() error {
+	resp, err := m.okxClient.GetAccountConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get account config: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("empty account config response")
+	}
+
+	posMode := resp.Data[0].PosMode
+	if posMode != okx.PosModeLongShort && posMode != okx.PosModeNet {
+		return fmt.Errorf("unknown position mode: %q", posMode)
+	}
+
+	m.posMode = posMode
+	m.logger.Info("Detected account position mode: %s", posMode)
+	return nil
+}
+
+// SetStorage 设置订单记录存储 / Set order record storage
+// 设置后记录每个下单的止盈止损订单，用于订单过期重下
+// When set, every placed TPSL order is recorded so expired orders can be replaced
+//
+// Parameters:
+//   - storage: Storage instance, nil to disable order recording
+func (m *Manager) SetStorage(storage *storage.Storage) {
+	m.storage = storage
+}
+
+// SetAlerter 设置告警器 / Set alerter
+// 设置后，只有止盈或只有止损的持仓会触发告警
+// When set, positions protected by only a TP or only an SL raise an alert
+//
+// Parameters:
+//   - alerter: Alerter instance, nil to only log unpaired coverage
+func (m *Manager) SetAlerter(alerter *alert.Alerter) {
+	m.alerter = alerter
+}
+
+// SetClock 设置时钟 / Set clock
+// 用于订单过期和价格缓存判断，测试中可替换为可控时钟
+// Used for order age and price cache expiry; tests replace it with a controllable clock
+//
+// Parameters:
+//   - clk: Clock instance, nil keeps the current clock
+func (m *Manager) SetClock(clk clock.Clock) {
+	if clk != nil {
+		m.clock = clk
 	}
 }
 
@@ -65,16 +283,36 @@ func New(config *config.TPSLConfig, okxClient *okx.Client, logger *logger.Logger
 //   - *CoverageSummary: 覆盖情况汇总 / Coverage summary
 //   - error: 处理失败时返回错误 / Error on processing failure
 func (m *Manager) AnalyzeAndPlaceTPSL(positions []*models.Position) (*CoverageSummary, error) {
+	m.beginRun()
+	defer m.endRun()
+
 	summary := &CoverageSummary{}
+	m.pruneHighWater(positions)
 
 	// Handle empty positions list
 	if len(positions) == 0 {
 		m.logger.Info("No open positions, skipping TPSL check")
+		ratio := CoverageRatio(positions, nil)
+		m.coverageRatio.Store(&ratio)
 		return summary, nil
 	}
 
 	m.logger.Info("Starting TPSL analysis for %d positions", len(positions))
 
+	// Keep streamed tickers in sync with held instruments
+	if m.wsClient != nil {
+		instruments := make([]string, 0, len(positions))
+		for _, position := range positions {
+			instruments = append(instruments, position.Instrument)
+		}
+		if err := m.wsClient.SetInstruments(instruments); err != nil {
+			m.logger.Warn("Failed to update WebSocket ticker subscriptions: %v", err)
+		}
+	}
+
+	// One bulk ticker call per instrument type instead of one per position
+	m.primePriceCache(positions)
+
 	// Query pending algo orders
 	algoOrders, err := m.okxClient.GetPendingAlgoOrders("conditional")
 	if err != nil {
@@ -83,30 +321,175 @@ func (m *Manager) AnalyzeAndPlaceTPSL(positions []*models.Position) (*CoverageSu
 
 	m.logger.Debug("Retrieved %d pending conditional algo orders", len(algoOrders.Data))
 
+	// Leave expired orders out so they are re-placed below with fresh prices, they are cancelled
+	// once the position is protected without them
+	pendingOrders, expired := m.expiredOrders(positions, algoOrders.Data)
+	protected := make(map[*models.Position]bool) // positions covered without their expired orders
+
+	// Track pending orders per instrument so placements stay within MaxOrdersPerInstrument
+	orderCounts := countOrdersByInstrument(pendingOrders)
+
+	// Coverage of each position as left by this check, for the account coverage ratio
+	analyzed := make([]PositionCoverage, len(positions))
+
 	// Analyze each position
-	for _, position := range positions {
+	for i, position := range positions {
+		coverage := m.positionCoverage(position, pendingOrders)
+		analyzed[i] = coverage
+		if coverage.Status == CoverageSkipped {
+			m.logger.Info("Skipping TPSL for %s (%s): %s", position.Instrument, position.PositionSide, coverage.SkipReason)
+			summary.Skipped++
+			continue
+		}
+
 		summary.TotalChecked++
+		overCap := m.exceedsNotionalCap(position)
+		if overCap {
+			summary.OverNotionalCap++
+		}
 
-		// Analyze coverage
-		uncoveredSize := m.analyzeCoverage(position, algoOrders.Data)
+		// A lone TP or SL looks protected but isn't, so surface it beyond the coverage log
+		var replaceLone *okx.AlgoOrder // cancelled once the fresh pair below is placed
+		if lone, missing, ok := m.unpairedOrder(position, pendingOrders); ok {
+			summary.UnpairedCoverage++
+			m.alertUnpaired(position, lone, missing)
+
+			switch m.cfg().UnpairedAction {
+			case "add_missing":
+				// Pair the lone order as-is; any remaining uncovered size is handled next run
+				if overCap && m.cfg().NotionalCapAction == "refuse" {
+					m.logger.Warn("Refusing to add missing %s for %s (%s): notional exceeds tpsl max notional cap",
+						missing, position.Instrument, position.PositionSide)
+					continue
+				}
+				if !m.allowPlacement(position, orderCounts, 1) {
+					summary.OrderLimitRefused++
+					continue
+				}
+				prices, err := m.calculateTPSLPrices(position)
+				if err != nil {
+					m.logger.Error("Failed to calculate TPSL prices for %s: %v", position.Instrument, err)
+					summary.PlacementFailures++
+					continue
+				}
+				if missing == models.TPSLLegStopLoss && m.exceedsMarginRisk(position, marginRisk(position, prices.SlPrice)) {
+					summary.OverMarginRisk++
+					if m.cfg().MarginRiskAction == "refuse" {
+						m.logger.Warn("Refusing to add missing %s for %s (%s): stop-loss exceeds tpsl max margin risk",
+							missing, position.Instrument, position.PositionSide)
+						continue
+					}
+				}
+				if err := m.placeMissingLeg(position, lone, missing, prices); err != nil {
+					m.logger.Error("Failed to add missing %s for %s (%s): %v", missing, position.Instrument, position.PositionSide, err)
+					summary.PlacementFailures++
+				} else {
+					orderCounts[position.Instrument]++
+					summary.OrdersPlaced++
+					protected[position] = true
+					if size, err := orderSize(lone, position); err == nil {
+						analyzed[i] = coveredBy(analyzed[i], size.InexactFloat64())
+					}
+				}
+				continue
+			case "replace_both":
+				// Fall through to place a fresh pair for the whole position; the lone order stays
+				// until it is placed, so a refused or failed placement never leaves the position bare
+				replaceLone = lone
+			}
+		} else {
+			m.resolveUnpaired(position)
+		}
 
-		if uncoveredSize <= 0.000001 { // Effectively zero (account for float precision)
+		uncoveredSize := coverage.UncoveredSize
+		switch coverage.Status {
+		case CoverageCovered:
 			m.logger.Debug("Position %s (%s) fully covered by TPSL", position.Instrument, position.PositionSide)
 			summary.FullyCovered++
+			protected[position] = true
+			if m.exceedsMarginRisk(position, coverage.MarginRisk) {
+				summary.OverMarginRisk++
+			}
+			if trailed, err := m.trailTakeProfit(position, pendingOrders); err != nil {
+				m.logger.Warn("Failed to trail TPSL for %s (%s): %v", position.Instrument, position.PositionSide, err)
+			} else if trailed {
+				summary.OrdersTrailed++
+				continue
+			}
+			// The pending orders are stale once trailing amended them, so tightening waits a run
+			if tightened, err := m.tightenStopLoss(position, pendingOrders); err != nil {
+				m.logger.Warn("Failed to tighten Stop-Loss for %s (%s): %v", position.Instrument, position.PositionSide, err)
+			} else if tightened {
+				summary.StopsTightened++
+			}
 			continue
-		}
-
-		// Check if partial coverage
-		if uncoveredSize < position.PositionSize {
+		case CoverageResidual:
+			if m.cfg().ResidualAction == "close" {
+				// Flatten the dust rather than protecting it, the covered portion is left as is
+				if err := m.closeResidual(position, uncoveredSize); err != nil {
+					m.logger.Error("Failed to close uncovered residual of %s (%s): %v", position.Instrument, position.PositionSide, err)
+					summary.PlacementFailures++
+				} else {
+					summary.ResidualsClosed++
+				}
+				continue
+			}
+			// Leave small residuals (e.g., after a partial close) alone instead of churning tiny orders
+			m.logger.Info("Position %s (%s) uncovered residual %.8f is below %.2f%% of size %.8f, ignoring",
+				position.Instrument, position.PositionSide, uncoveredSize, m.cfg().MinUncoveredFraction*100, coverage.Size)
+			summary.ResidualsIgnored++
+			continue
+		case CoveragePartial:
+			summary.PartiallyCovered++
+			if m.cfg().AllowPartialCoverage {
+				// Partial coverage is intentional (e.g., manual scale-out orders), don't fight it
+				m.logger.Info("Position %s (%s) partially covered, uncovered size %.8f accepted by allow_partial_coverage",
+					position.Instrument, position.PositionSide, uncoveredSize)
+				continue
+			}
 			m.logger.Info("Position %s (%s) partially covered, uncovered size: %.8f",
 				position.Instrument, position.PositionSide, uncoveredSize)
-			summary.PartiallyCovered++
-		} else {
+		default:
 			m.logger.Info("Position %s (%s) has no TPSL coverage, size: %.8f",
-				position.Instrument, position.PositionSide, position.PositionSize)
+				position.Instrument, position.PositionSide, coverage.Size)
 			summary.NotCovered++
 		}
 
+		if overCap && m.cfg().NotionalCapAction == "refuse" {
+			m.logger.Warn("Refusing to place TPSL for %s (%s): notional exceeds tpsl max notional cap",
+				position.Instrument, position.PositionSide)
+			continue
+		}
+
+		// Prefer resizing the existing TP/SL over stacking a second pair of orders
+		if tp, sl, ok := m.chooseAmendTargets(position, pendingOrders); ok {
+			err := m.amendTPSLOrders(position, tp, sl)
+			if err == nil {
+				summary.OrdersAmended++
+				protected[position] = true
+				analyzed[i] = coveredBy(analyzed[i], analyzed[i].Size)
+				continue
+			}
+			if errors.Is(err, errPartialAmend) {
+				// A new pair would stack on the resized SL; the next run amends the TP again
+				m.logger.Error("Failed to amend TPSL for %s (%s): %v", position.Instrument, position.PositionSide, err)
+				summary.PlacementFailures++
+				continue
+			}
+			m.logger.Warn("Failed to amend TPSL for %s (%s), placing new orders instead: %v",
+				position.Instrument, position.PositionSide, err)
+		}
+
+		// A TP+SL pair is two orders unless both legs go into one closeFraction order or the mode places one leg
+		needed := 2
+		if m.useCloseFraction(position) || !m.placesLeg(models.TPSLLegTakeProfit) || !m.placesLeg(models.TPSLLegStopLoss) {
+			needed = 1
+		}
+		if !m.allowPlacement(position, orderCounts, needed) {
+			summary.OrderLimitRefused++
+			continue
+		}
+
 		// Calculate TPSL prices
 		prices, err := m.calculateTPSLPrices(position)
 		if err != nil {
@@ -115,6 +498,16 @@ func (m *Manager) AnalyzeAndPlaceTPSL(positions []*models.Position) (*CoverageSu
 			continue
 		}
 
+		// A tight stop can still lose most of the margin at high leverage
+		if m.placesLeg(models.TPSLLegStopLoss) && m.exceedsMarginRisk(position, marginRisk(position, prices.SlPrice)) {
+			summary.OverMarginRisk++
+			if m.cfg().MarginRiskAction == "refuse" {
+				m.logger.Warn("Refusing to place TPSL for %s (%s): stop-loss exceeds tpsl max margin risk",
+					position.Instrument, position.PositionSide)
+				continue
+			}
+		}
+
 		// Place TPSL order with current price validation
 		err = m.placeTPSLOrderWithValidation(position, uncoveredSize, prices)
 		if err != nil {
@@ -123,44 +516,353 @@ func (m *Manager) AnalyzeAndPlaceTPSL(positions []*models.Position) (*CoverageSu
 			continue
 		}
 
+		orderCounts[position.Instrument] += needed
 		summary.OrdersPlaced++
+		protected[position] = true
+		analyzed[i] = coveredBy(analyzed[i], uncoveredSize)
+
+		if replaceLone != nil {
+			if err := m.cancelLoneOrder(replaceLone); err != nil {
+				// The position is protected by the new pair, the extra order only over-covers it
+				m.logger.Warn("Failed to cancel lone order %s for %s (%s) after placing a fresh pair, keeping it: %v",
+					replaceLone.AlgoId, position.Instrument, position.PositionSide, err)
+			} else {
+				orderCounts[position.Instrument]--
+				summary.OrdersReplaced++
+			}
+		}
+	}
+
+	summary.OrdersReplaced += m.cancelExpiredOrders(expired, positions, protected)
+
+	// Expired orders of unprotected positions were kept, so they still count as coverage
+	for i, position := range positions {
+		if len(expired) > 0 && !protected[position] {
+			analyzed[i] = m.positionCoverage(position, algoOrders.Data)
+		}
+	}
+	ratio := CoverageRatio(positions, analyzed)
+	m.coverageRatio.Store(&ratio)
+
+	// Placement responses are trusted otherwise, confirm the orders actually exist
+	if m.cfg().VerifyPlacement {
+		unverified, err := m.verifyPlacements()
+		if err != nil {
+			m.logger.Warn("Failed to verify placed TPSL orders: %v", err)
+		}
+		summary.UnverifiedPlacements = unverified
 	}
 
-	m.logger.Info("TPSL check complete: checked=%d, fully_covered=%d, partially_covered=%d, not_covered=%d, orders_placed=%d, failures=%d",
+	m.logger.Info("TPSL check complete: checked=%d, fully_covered=%d, partially_covered=%d, not_covered=%d, orders_placed=%d, orders_amended=%d, orders_replaced=%d, failures=%d, skipped=%d, residuals_ignored=%d, residuals_closed=%d, unpaired=%d, order_limit_refused=%d, trailed=%d, over_notional_cap=%d, stops_tightened=%d, over_margin_risk=%d, unverified=%d",
 		summary.TotalChecked, summary.FullyCovered, summary.PartiallyCovered,
-		summary.NotCovered, summary.OrdersPlaced, summary.PlacementFailures)
+		summary.NotCovered, summary.OrdersPlaced, summary.OrdersAmended, summary.OrdersReplaced,
+		summary.PlacementFailures, summary.Skipped, summary.ResidualsIgnored, summary.ResidualsClosed, summary.UnpairedCoverage,
+		summary.OrderLimitRefused, summary.OrdersTrailed, summary.OverNotionalCap, summary.StopsTightened, summary.OverMarginRisk, summary.UnverifiedPlacements)
 
 	return summary, nil
 }
 
+// expiredOrders 找出过期的止盈止损订单 / Find expired TPSL orders
+// 找出由本系统下单且超过OrderMaxAgeHours的订单，并从待处理列表中移除，
+// 使后续覆盖分析将持仓视为未覆盖并以最新价格重新下单；过期订单在新订单下单后由cancelExpiredOrders撤销。
+// 未记录的订单（手动下单等）不会被替换。
+// Find orders placed by this system that are older than OrderMaxAgeHours and drop them from the
+// pending list, so coverage analysis treats the position as uncovered and orders are re-placed at
+// freshly calculated prices; cancelExpiredOrders cancels them once the new ones are placed.
+// Unrecorded (e.g., manual) orders are never touched.
+//
+// Parameters:
+//   - positions: 持仓列表 / List of positions, only orders of managed positions are replaced
+//   - algoOrders: 待处理的算法订单列表 / Pending algo orders
+//
+// Returns:
+//   - []okx.AlgoOrder: 不含过期订单的待处理订单 / Pending orders without the expired ones
+//   - []okx.AlgoOrder: 过期订单 / Expired orders
+func (m *Manager) expiredOrders(positions []*models.Position, algoOrders []okx.AlgoOrder) ([]okx.AlgoOrder, []okx.AlgoOrder) {
+	if m.cfg().OrderMaxAgeHours <= 0 || m.storage == nil {
+		return algoOrders, nil
+	}
+
+	records, err := m.storage.GetLiveTPSLOrders()
+	if err != nil {
+		m.logger.Warn("Failed to load TPSL order records, skipping expiry check: %v", err)
+		return algoOrders, nil
+	}
+
+	maxAge := time.Duration(m.cfg().OrderMaxAgeHours) * time.Hour
+	now := m.clock.Now()
+
+	var remaining, expired []okx.AlgoOrder
+	for i := range algoOrders {
+		order := &algoOrders[i]
+		record, ok := records[order.AlgoId]
+		if !ok || now.Sub(record.PlacedAt) < maxAge || !m.isManagedOrder(order, positions) {
+			remaining = append(remaining, *order)
+			continue
+		}
+
+		m.logger.Info("Replacing expired TPSL order %s for %s (%s leg), placed %s ago",
+			order.AlgoId, order.InstId, record.Leg, now.Sub(record.PlacedAt).Round(time.Minute))
+		expired = append(expired, *order)
+	}
+	return remaining, expired
+}
+
+// cancelExpiredOrders 撤销已被替换的过期订单 / Cancel expired orders that have been replaced
+// 只撤销在不计过期订单时已受保护（已覆盖、已补单或已修改）的持仓的订单；替换下单失败或被拒绝时
+// 保留过期订单，使持仓不会失去保护，下次检查再重试
+// Only cancels the orders of positions protected without them (covered, placed or amended this
+// run); when the replacement failed or was refused the expired order is kept so the position is
+// never left without protection, and the next check tries again
+//
+// Parameters:
+//   - expired: 过期订单 / Expired orders
+//   - positions: 持仓列表 / List of positions
+//   - protected: 不计过期订单时已受保护的持仓 / Positions protected without their expired orders
+//
+// Returns:
+//   - int: 撤销的订单数量 / Number of cancelled orders
+func (m *Manager) cancelExpiredOrders(expired []okx.AlgoOrder, positions []*models.Position, protected map[*models.Position]bool) int {
+	var cancels []okx.CancelAlgoOrderRequest
+	for i := range expired {
+		order := &expired[i]
+		replaced := false
+		for _, position := range positions {
+			if protected[position] && m.matchesPosition(order, position) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			m.logger.Warn("Keeping expired TPSL order %s for %s, no replacement was placed", order.AlgoId, order.InstId)
+			continue
+		}
+		cancels = append(cancels, okx.CancelAlgoOrderRequest{AlgoId: order.AlgoId, InstId: order.InstId})
+	}
+	if len(cancels) == 0 {
+		return 0
+	}
+
+	if _, err := m.okxClient.CancelAlgoOrders(cancels); err != nil {
+		m.logger.Warn("Failed to cancel %d replaced expired TPSL orders, retrying next check: %v", len(cancels), err)
+		return 0
+	}
+	for _, cancel := range cancels {
+		if err := m.storage.UpdateTPSLOrderStatus(cancel.AlgoId, models.TPSLOrderStatusReplaced); err != nil {
+			m.logger.Warn("Failed to mark TPSL order %s as replaced: %v", cancel.AlgoId, err)
+		}
+	}
+	return len(cancels)
+}
+
+// isManagedOrder 判断订单是否属于受管理的持仓 / Check whether an order belongs to a managed position
+func (m *Manager) isManagedOrder(order *okx.AlgoOrder, positions []*models.Position) bool {
+	for _, position := range positions {
+		if _, skip := m.skipReason(position); skip {
+			continue
+		}
+		if m.matchesPosition(order, position) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOrder 记录已下单的止盈止损订单 / Record a placed TPSL order
+// 仅在设置了存储时记录，记录失败只告警不影响下单结果；启用VerifyPlacement时同时记下以便下单后验证
+// Only recorded when storage is set; a failed write is logged and does not fail the placement.
+// With VerifyPlacement the order is also noted for post-placement verification
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - leg: 订单类型 / Order leg (tp or sl)
+//   - algoId: 算法订单ID / Algo order ID
+//   - size: 订单大小 / Order size
+//   - triggerPrice: 触发价格 / Trigger price
+func (m *Manager) recordOrder(position *models.Position, leg models.TPSLLeg, algoId, clientOrderId string, size, triggerPrice float64) {
+	m.notePlaced(position, leg, algoId, size)
+	if m.storage == nil || algoId == "" {
+		return
+	}
+	if clientOrderId != "" {
+		// An order resolved from a duplicate client order ID may already be recorded
+		existing, err := m.storage.GetTPSLOrderByClientOrderID(clientOrderId)
+		if err != nil {
+			m.logger.Warn("Failed to look up TPSL order record for client order ID %s: %v", clientOrderId, err)
+		} else if existing != nil && existing.AlgoID == algoId {
+			return
+		}
+	}
+
+	order := &models.TPSLOrder{
+		AlgoID:        algoId,
+		ClientOrderID: clientOrderId,
+		Instrument:    position.Instrument,
+		PositionSide:  position.PositionSide,
+		Leg:           leg,
+		Size:          size,
+		TriggerPrice:  triggerPrice,
+		PlacedAt:      m.clock.Now(),
+		Status:        models.TPSLOrderStatusLive,
+	}
+	if err := m.storage.InsertTPSLOrder(order); err != nil {
+		m.logger.Warn("Failed to record TPSL order %s for %s: %v", algoId, position.Instrument, err)
+	}
+}
+
+// AnalyzeCoverage 分析持仓的TPSL覆盖状态（只读）/ Analyze TPSL coverage of positions (read-only)
+// 与AnalyzeAndPlaceTPSL使用相同的覆盖分析，但不下单、不修改或撤销订单，
+// 供管理接口和看板展示覆盖情况
+// Uses the same coverage analysis as AnalyzeAndPlaceTPSL without placing, amending or
+// cancelling orders, for the admin API and dashboards
+//
+// Parameters:
+//   - positions: 持仓列表 / List of positions
+//
+// Returns:
+//   - []PositionCoverage: 每个持仓的覆盖明细，顺序与positions一致 / Coverage detail of each position, in input order
+//   - error: 查询待处理订单失败时返回错误 / Error when pending algo orders cannot be queried
+func (m *Manager) AnalyzeCoverage(positions []*models.Position) ([]PositionCoverage, error) {
+	m.beginRun()
+	defer m.endRun()
+
+	coverage := make([]PositionCoverage, 0, len(positions))
+	if len(positions) == 0 {
+		ratio := CoverageRatio(positions, coverage)
+		m.coverageRatio.Store(&ratio)
+		return coverage, nil
+	}
+
+	algoOrders, err := m.okxClient.GetPendingAlgoOrders("conditional")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending algo orders: %w", err)
+	}
+
+	for _, position := range positions {
+		coverage = append(coverage, m.positionCoverage(position, algoOrders.Data))
+	}
+
+	ratio := CoverageRatio(positions, coverage)
+	m.coverageRatio.Store(&ratio)
+	return coverage, nil
+}
+
+// positionCoverage 计算单个持仓的覆盖明细 / Compute coverage detail of a single position
+// 先应用交易对过滤和开仓宽限期，再分析覆盖并确定状态
+// Applies the instrument filter and the new-position grace period, then analyzes coverage and
+// determines the status
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - algoOrders: 算法订单列表 / List of algo orders
+//
+// Returns:
+//   - PositionCoverage: 覆盖明细 / Coverage detail
+func (m *Manager) positionCoverage(position *models.Position, algoOrders []okx.AlgoOrder) PositionCoverage {
+	reason, skip := m.skipReason(position)
+	if !skip {
+		reason, skip = m.withinGracePeriod(position)
+	}
+	if skip {
+		return PositionCoverage{
+			Instrument:   position.Instrument,
+			PositionSide: position.PositionSide.String(),
+			Size:         absSize(position),
+			Status:       CoverageSkipped,
+			SkipReason:   reason,
+		}
+	}
+
+	coverage := m.analyzeCoverage(position, algoOrders)
+	coverage.MarginRisk = m.stopRisk(position, algoOrders)
+	switch {
+	case coverage.UncoveredSize <= 0: // Computed in decimal, so full coverage is exactly zero
+		coverage.Status = CoverageCovered
+	case m.isIgnorableResidual(position, coverage.UncoveredSize):
+		coverage.Status = CoverageResidual
+	case coverage.UncoveredSize < coverage.Size:
+		coverage.Status = CoveragePartial
+	default:
+		coverage.Status = CoverageUncovered
+	}
+	return coverage
+}
+
+// skipReason 判断持仓是否应跳过 / Check whether a position should be skipped
+// 排除列表中的交易对总是跳过；包含列表非空时，不在其中的交易对也跳过
+// Instruments in the exclude list are always skipped; when the include list is non-empty,
+// instruments not in it are skipped too
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - string: 跳过原因 / Reason for skipping
+//   - bool: 是否跳过 / Whether to skip
+func (m *Manager) skipReason(position *models.Position) (string, bool) {
+	for _, instId := range m.cfg().ExcludeInstruments {
+		if instId == position.Instrument {
+			return "instrument is in exclude_instruments", true
+		}
+	}
+
+	if len(m.cfg().IncludeInstruments) == 0 {
+		return "", false
+	}
+	for _, instId := range m.cfg().IncludeInstruments {
+		if instId == position.Instrument {
+			return "", false
+		}
+	}
+	return "instrument is not in include_instruments", true
+}
+
+// placesLeg 当前模式是否管理止盈或止损 / Whether the configured mode manages a leg
+// mode为sl_only时只管理止损，为tp_only时只管理止盈；未配置时视为tp_sl
+// Mode sl_only manages only the stop-loss and tp_only only the take-profit; an unset mode counts as tp_sl
+func (m *Manager) placesLeg(leg models.TPSLLeg) bool {
+	switch m.cfg().Mode {
+	case "sl_only":
+		return leg == models.TPSLLegStopLoss
+	case "tp_only":
+		return leg == models.TPSLLegTakeProfit
+	default:
+		return true
+	}
+}
+
 // analyzeCoverage 分析持仓TPSL覆盖情况 / Analyze position TPSL coverage
 // 计算持仓的未覆盖大小
 // Calculate uncovered size of position
 //
 // 修改说明 / Modification Note:
 // 由于TP和SL现在是两个独立的订单，我们需要检查是否同时存在TP和SL订单。
-// 只有同时有TP和SL的部分才算完全覆盖。
+// 只有同时有TP和SL的部分才算完全覆盖；mode为sl_only或tp_only时只计算该一侧。
 // Since TP and SL are now two separate orders, we need to check if both TP and SL exist.
-// Only the portion covered by BOTH TP and SL orders is considered fully covered.
+// Only the portion covered by BOTH TP and SL orders is considered fully covered; with mode
+// sl_only or tp_only only that leg counts.
 //
 // Parameters:
 //   - position: 持仓信息 / Position information
 //   - algoOrders: 算法订单列表 / List of algo orders
 //
 // Returns:
-//   - float64: 未覆盖的持仓大小 / Uncovered position size
-func (m *Manager) analyzeCoverage(position *models.Position, algoOrders []okx.AlgoOrder) float64 {
-	maxTpSize := 0.0
-	maxSlSize := 0.0
+//   - PositionCoverage: 覆盖数量与订单数，Status由调用方确定 / Covered sizes and order counts, Status is left to the caller
+func (m *Manager) analyzeCoverage(position *models.Position, algoOrders []okx.AlgoOrder) PositionCoverage {
+	maxTpSize := decimal.Zero
+	maxSlSize := decimal.Zero
 	tpCount := 0
 	slCount := 0
 
 	// Filter matching algo orders and track TP and SL separately
 	// We need BOTH TP and SL to consider a position covered
+	counted := make(map[string]bool)
 	for _, order := range algoOrders {
 		if m.matchesPosition(&order, position) {
+			counted[order.AlgoId] = true
+
 			// Parse order size
-			size, err := strconv.ParseFloat(order.Sz, 64)
+			size, err := orderSize(&order, position)
 			if err != nil {
 				m.logger.Warn("Failed to parse algo order size '%s' for order %s: %v", order.Sz, order.AlgoId, err)
 				continue
@@ -172,68 +874,389 @@ func (m *Manager) analyzeCoverage(position *models.Position, algoOrders []okx.Al
 
 			if hasTp {
 				tpCount++
-				if size > maxTpSize {
-					maxTpSize = size
-				}
-				m.logger.Debug("Found Take-Profit order %s with size %.8f for position %s",
+				maxTpSize = decimal.Max(maxTpSize, size)
+				m.logger.Debug("Found Take-Profit order %s with size %s for position %s",
 					order.AlgoId, size, position.Instrument)
 			}
 			if hasSl {
 				slCount++
-				if size > maxSlSize {
-					maxSlSize = size
-				}
-				m.logger.Debug("Found Stop-Loss order %s with size %.8f for position %s",
+				maxSlSize = decimal.Max(maxSlSize, size)
+				m.logger.Debug("Found Stop-Loss order %s with size %s for position %s",
 					order.AlgoId, size, position.Instrument)
 			}
 		}
 	}
 
+	// TP/SL attached to the position covers its closeFraction; skip ones already counted above
+	for _, attached := range position.AttachedTPSL {
+		if counted[attached.AlgoId] {
+			continue
+		}
+		if attached.CloseFraction <= 0 {
+			m.logger.Debug("Ignoring attached TP/SL %s for %s without closeFraction", attached.AlgoId, position.Instrument)
+			continue
+		}
+		size := toDecimal(absSize(position)).Mul(toDecimal(math.Min(attached.CloseFraction, 1)))
+		if attached.TpTriggerPx > 0 {
+			tpCount++
+			maxTpSize = decimal.Max(maxTpSize, size)
+			m.logger.Debug("Found attached Take-Profit %s with size %s for position %s", attached.AlgoId, size, position.Instrument)
+		}
+		if attached.SlTriggerPx > 0 {
+			slCount++
+			maxSlSize = decimal.Max(maxSlSize, size)
+			m.logger.Debug("Found attached Stop-Loss %s with size %s for position %s", attached.AlgoId, size, position.Instrument)
+		}
+	}
+
 	// Only the portion covered by BOTH TP and SL is considered covered
 	// If either TP or SL is missing, the position is not properly covered
-	coveredSize := 0.0
-	if tpCount > 0 && slCount > 0 {
+	coveredSize := decimal.Zero
+	switch {
+	case !m.placesLeg(models.TPSLLegTakeProfit):
+		// sl_only: a TP, if any, is managed by hand and doesn't matter
+		coveredSize = maxSlSize
+		if slCount == 0 && tpCount > 0 {
+			m.logger.Warn("Position %s has TP orders but NO SL orders - not considered covered!", position.Instrument)
+		}
+	case !m.placesLeg(models.TPSLLegStopLoss):
+		// tp_only: a SL, if any, is managed by hand and doesn't matter
+		coveredSize = maxTpSize
+		if tpCount == 0 && slCount > 0 {
+			m.logger.Warn("Position %s has SL orders but NO TP orders - not considered covered in tp_only mode!", position.Instrument)
+		}
+	case tpCount > 0 && slCount > 0:
 		// Use the minimum of TP and SL sizes (conservative approach)
 		// because only the portion covered by BOTH is truly protected
-		if maxTpSize < maxSlSize {
-			coveredSize = maxTpSize
-		} else {
-			coveredSize = maxSlSize
-		}
-	} else if tpCount > 0 {
+		coveredSize = decimal.Min(maxTpSize, maxSlSize)
+	case tpCount > 0:
 		m.logger.Warn("Position %s has TP orders but NO SL orders - not considered covered!", position.Instrument)
-	} else if slCount > 0 {
+	case slCount > 0:
 		m.logger.Warn("Position %s has SL orders but NO TP orders - not considered covered!", position.Instrument)
 	}
 
-	uncoveredSize := position.PositionSize - coveredSize
-	if uncoveredSize < 0 {
-		uncoveredSize = 0 // Shouldn't happen, but handle gracefully
+	// Subtract in decimal so e.g. 1.1 - 1.0 is exactly 0.1 and full coverage is exactly zero
+	uncoveredSize := toDecimal(absSize(position)).Sub(coveredSize)
+	if uncoveredSize.IsNegative() {
+		uncoveredSize = decimal.Zero // Shouldn't happen, but handle gracefully
 	}
 
-	m.logger.Info("Position %s coverage: total=%.8f, TP_covered=%.8f (count:%d), SL_covered=%.8f (count:%d), final_covered=%.8f, uncovered=%.8f",
-		position.Instrument, position.PositionSize, maxTpSize, tpCount, maxSlSize, slCount, coveredSize, uncoveredSize)
-
-	return uncoveredSize
+	m.logger.Info("Position %s coverage: total=%.8f, TP_covered=%s (count:%d), SL_covered=%s (count:%d), final_covered=%s, uncovered=%s",
+		position.Instrument, absSize(position), maxTpSize, tpCount, maxSlSize, slCount, coveredSize, uncoveredSize)
+
+	return PositionCoverage{
+		Instrument:    position.Instrument,
+		PositionSide:  position.PositionSide.String(),
+		Size:          absSize(position),
+		CoveredSize:   coveredSize.InexactFloat64(),
+		UncoveredSize: uncoveredSize.InexactFloat64(),
+		TPCount:       tpCount,
+		SLCount:       slCount,
+	}
 }
 
-// matchesPosition 判断算法订单是否匹配持仓 / Check if algo order matches position
-// 检查算法订单的交易对和持仓方向是否与持仓匹配
-// Check if algo order's instrument and position side match the position
+// unpairedOrder 查找单边保护的订单 / Find the lone leg of one-sided protection
+// 持仓只有止盈或只有止损时，返回现有一侧中数量最大的订单和缺失的一侧；sl_only或tp_only模式下不报告
+// When a position has only TP orders or only SL orders, return the largest order of the
+// existing leg and the leg that is missing. Never reported in sl_only or tp_only mode
 //
 // Parameters:
-//   - order: 算法订单 / Algo order
 //   - position: 持仓信息 / Position information
+//   - algoOrders: 算法订单列表 / List of algo orders
 //
 // Returns:
-//   - bool: 是否匹配 / Whether it matches
-func (m *Manager) matchesPosition(order *okx.AlgoOrder, position *models.Position) bool {
-	// Check instrument
-	if order.InstId != position.Instrument {
-		return false
+//   - *okx.AlgoOrder: 现有一侧的订单 / Order of the existing leg
+//   - models.TPSLLeg: 缺失的一侧 / Missing leg
+//   - bool: 是否为单边保护 / Whether the position is protected on one side only
+func (m *Manager) unpairedOrder(position *models.Position, algoOrders []okx.AlgoOrder) (*okx.AlgoOrder, models.TPSLLeg, bool) {
+	if !m.placesLeg(models.TPSLLegTakeProfit) || !m.placesLeg(models.TPSLLegStopLoss) {
+		return nil, "", false // A single-leg mode leaves the other leg out on purpose
 	}
 
-	// Check position side
+	var tp, sl *okx.AlgoOrder
+	tpSize, slSize := decimal.Zero, decimal.Zero
+
+	for i := range algoOrders {
+		order := &algoOrders[i]
+		if !m.matchesPosition(order, position) {
+			continue
+		}
+		size, err := orderSize(order, position)
+		if err != nil {
+			continue // Already logged by analyzeCoverage
+		}
+		if order.TpTriggerPx != "" && order.TpTriggerPx != "0" && (tp == nil || size.GreaterThan(tpSize)) {
+			tp, tpSize = order, size
+		}
+		if order.SlTriggerPx != "" && order.SlTriggerPx != "0" && (sl == nil || size.GreaterThan(slSize)) {
+			sl, slSize = order, size
+		}
+	}
+
+	// A leg provided by TP/SL attached to the position pairs the lone order
+	attachedTP, attachedSL := attachedLegs(position)
+	switch {
+	case tp != nil && sl == nil && !attachedSL:
+		return tp, models.TPSLLegStopLoss, true
+	case sl != nil && tp == nil && !attachedTP:
+		return sl, models.TPSLLegTakeProfit, true
+	default:
+		return nil, "", false
+	}
+}
+
+// attachedLegs 持仓关联的止盈止损提供的一侧 / Legs provided by TP/SL attached to a position
+func attachedLegs(position *models.Position) (hasTP, hasSL bool) {
+	for _, attached := range position.AttachedTPSL {
+		if attached.CloseFraction <= 0 {
+			continue
+		}
+		hasTP = hasTP || attached.TpTriggerPx > 0
+		hasSL = hasSL || attached.SlTriggerPx > 0
+	}
+	return hasTP, hasSL
+}
+
+// placeMissingLeg 为单边保护的持仓补下缺失的一侧 / Place the missing leg of one-sided protection
+// 补下的订单数量与现有订单相同（不超过实际可平仓数量），触发价根据当前价格调整
+// The added order uses the same size as the existing order, clamped to the live closable size;
+// its trigger is adjusted to the current price
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - lone: 现有一侧的订单 / Order of the existing leg
+//   - missing: 缺失的一侧 / Missing leg
+//   - prices: 按持仓计算的TPSL价格 / TPSL prices calculated for the position
+//
+// Returns:
+//   - error: 下单失败时返回错误 / Error on placement failure
+func (m *Manager) placeMissingLeg(position *models.Position, lone *okx.AlgoOrder, missing models.TPSLLeg, prices *TPSLPrices) error {
+	loneSize, err := orderSize(lone, position)
+	if err != nil {
+		return fmt.Errorf("failed to parse size '%s' of order %s: %w", lone.Sz, lone.AlgoId, err)
+	}
+
+	// Never ask for more than the live closable size
+	size := m.clampToAvailableSize(position, loneSize.InexactFloat64())
+
+	adjusted := &TPSLPrices{TpPrice: prices.TpPrice, SlPrice: prices.SlPrice}
+	if currentPrice, err := m.getCurrentMarketPrice(position.Instrument); err != nil {
+		m.logger.Warn("Failed to get current market price for %s: %v, proceeding with calculated prices", position.Instrument, err)
+	} else {
+		var skipTP, skipSL bool
+		adjusted, skipTP, skipSL = m.adjustTPSLPricesWithCurrentPrice(position, prices, currentPrice)
+		if (missing == models.TPSLLegTakeProfit && skipTP) || (missing == models.TPSLLegStopLoss && skipSL) {
+			return fmt.Errorf("missing %s skipped due to price condition - manual intervention required", missing)
+		}
+	}
+
+	req := m.legRequest(position, missing, size, adjusted.price(missing))
+	if req.CloseFraction != "" && lone.CloseFraction != "" {
+		// OKX allows one full-close order per position and the lone order already is one
+		req.CloseFraction = ""
+		req.Sz = m.orderFormatFor(position.Instrument).size(size)
+	}
+	resp, err := m.placeWithReprice(position, req, prices, adjusted)
+	if err != nil {
+		return err
+	}
+
+	// A repriced retry updates adjusted, so read the trigger back after placing
+	trigger := adjusted.price(missing)
+	if len(resp.Data) > 0 {
+		m.logger.Info("Added missing %s order for %s (%s), algoId: %s, size: %s, trigger: %.8f, paired with %s",
+			missing, position.Instrument, position.PositionSide, resp.Data[0].AlgoId, formatFloat(size), trigger, lone.AlgoId)
+		m.recordOrder(position, missing, resp.Data[0].AlgoId, resp.Data[0].AlgoClOrdId, size, trigger)
+	}
+	return nil
+}
+
+// cancelLoneOrder 撤销单边保护的订单 / Cancel the lone order of one-sided protection
+// 撤销成功后，若该订单由本系统记录，则标记为已替换
+// After cancelling, the order record is marked replaced if this system recorded it
+//
+// Parameters:
+//   - lone: 现有一侧的订单 / Order of the existing leg
+//
+// Returns:
+//   - error: 撤销失败时返回错误 / Error on cancel failure
+func (m *Manager) cancelLoneOrder(lone *okx.AlgoOrder) error {
+	if _, err := m.okxClient.CancelAlgoOrders([]okx.CancelAlgoOrderRequest{{AlgoId: lone.AlgoId, InstId: lone.InstId}}); err != nil {
+		return err
+	}
+	m.logger.Info("Cancelled lone order %s for %s, replaced by a fresh TP+SL pair", lone.AlgoId, lone.InstId)
+
+	if m.storage != nil {
+		if err := m.storage.UpdateTPSLOrderStatus(lone.AlgoId, models.TPSLOrderStatusReplaced); err != nil {
+			m.logger.Debug("Lone order %s not marked replaced (likely placed manually): %v", lone.AlgoId, err)
+		}
+	}
+	return nil
+}
+
+// unpairedAlertKey 单边保护告警键 / Alert key for one-sided protection of a position
+func unpairedAlertKey(position *models.Position) string {
+	return fmt.Sprintf("tpsl_unpaired:%s:%s", position.Instrument, position.PositionSide)
+}
+
+// alertUnpaired 告警单边保护的持仓 / Alert on a position protected on one side only
+// 告警按持仓去重，持续存在的状况不会每次检查都重复告警
+// Alerts are deduplicated per position, so a persistent condition doesn't repeat every run
+func (m *Manager) alertUnpaired(position *models.Position, lone *okx.AlgoOrder, missing models.TPSLLeg) {
+	if m.alerter == nil {
+		return
+	}
+
+	existing := models.TPSLLegTakeProfit
+	if missing == models.TPSLLegTakeProfit {
+		existing = models.TPSLLegStopLoss
+	}
+	m.alerter.Alert(unpairedAlertKey(position), "%s (%s) has %s order %s (size %s) but no %s order, position is not fully protected",
+		position.Instrument, position.PositionSide, strings.ToUpper(existing.String()), lone.AlgoId, lone.Sz,
+		strings.ToUpper(missing.String()))
+}
+
+// orderLimitAlertKey 订单数量限制告警键 / Alert key for the per-instrument order limit of a position
+func orderLimitAlertKey(position *models.Position) string {
+	return fmt.Sprintf("tpsl_order_limit:%s:%s", position.Instrument, position.PositionSide)
+}
+
+// countOrdersByInstrument 按品种统计待处理订单数量 / Count pending orders per instrument
+func countOrdersByInstrument(orders []okx.AlgoOrder) map[string]int {
+	counts := make(map[string]int)
+	for _, order := range orders {
+		counts[order.InstId]++
+	}
+	return counts
+}
+
+// allowPlacement 检查下单是否超过每个品种的订单数量限制 / Check a placement against the per-instrument order limit
+// 超过MaxOrdersPerInstrument时拒绝下单并告警，防止失控的重复下单
+// Refuses and alerts when the placement would exceed MaxOrdersPerInstrument, guarding against
+// runaway order placement
+//
+// Parameters:
+//   - position: 待保护的持仓 / Position to protect
+//   - counts: 各品种当前待处理订单数量 / Current pending orders per instrument
+//   - needed: 本次将下单的订单数量 / Number of orders the placement adds
+//
+// Returns:
+//   - bool: 是否允许下单 / Whether the placement is allowed
+func (m *Manager) allowPlacement(position *models.Position, counts map[string]int, needed int) bool {
+	limit := m.cfg().MaxOrdersPerInstrument
+	if limit <= 0 {
+		return true
+	}
+
+	existing := counts[position.Instrument]
+	if existing+needed <= limit {
+		if m.alerter != nil {
+			m.alerter.Resolve(orderLimitAlertKey(position))
+		}
+		return true
+	}
+
+	m.logger.Warn("Refusing to place %d TPSL orders for %s (%s): %d pending orders already, limit %d",
+		needed, position.Instrument, position.PositionSide, existing, limit)
+	if m.alerter != nil {
+		m.alerter.Alert(orderLimitAlertKey(position), "%s (%s) is not protected: %d pending algo orders on the instrument, placing %d more would exceed tpsl.max_orders_per_instrument %d",
+			position.Instrument, position.PositionSide, existing, needed, limit)
+	}
+	return false
+}
+
+// notionalCapAlertKey 名义价值上限告警键 / Alert key for the notional cap of a position
+func notionalCapAlertKey(position *models.Position) string {
+	return fmt.Sprintf("tpsl_notional_cap:%s:%s", position.Instrument, position.PositionSide)
+}
+
+// notionalCap 获取交易对的名义价值上限 / Get the notional cap of an instrument
+// 按交易对配置的上限优先于全局上限，0表示不限制
+// A per-instrument cap takes precedence over the global one, 0 means no cap
+func (m *Manager) notionalCap(instId string) float64 {
+	if limit, ok := m.cfg().MaxNotionalUSDByInstrument[instId]; ok {
+		return limit
+	}
+	return m.cfg().MaxNotionalUSD
+}
+
+// exceedsNotionalCap 检查持仓名义价值是否超过上限 / Check a position's notional against its cap
+// 超过上限说明持仓本身过大（例如策略失控加仓），发出告警；回到上限以内时解除告警。
+// 名义价值未知（0）时不检查。这是风控护栏，不做交易决策
+// Exceeding the cap means the position itself is too large (e.g., a runaway strategy kept
+// adding), so an alert is raised and resolved once back under the cap. Positions with an
+// unknown (0) notional are not checked. This is a risk guardrail, not a trading decision
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - bool: 是否超过上限 / Whether the cap is exceeded
+func (m *Manager) exceedsNotionalCap(position *models.Position) bool {
+	limit := m.notionalCap(position.Instrument)
+	if limit <= 0 || position.NotionalUSD <= 0 {
+		return false
+	}
+
+	if position.NotionalUSD <= limit {
+		if m.alerter != nil {
+			m.alerter.Resolve(notionalCapAlertKey(position))
+		}
+		return false
+	}
+
+	m.logger.Warn("Position %s (%s) notional $%.2f exceeds cap $%.2f",
+		position.Instrument, position.PositionSide, position.NotionalUSD, limit)
+	if m.alerter != nil {
+		m.alerter.Alert(notionalCapAlertKey(position), "%s (%s) notional $%.2f exceeds the $%.2f cap, the position is larger than allowed",
+			position.Instrument, position.PositionSide, position.NotionalUSD, limit)
+	}
+	return true
+}
+
+// resolveUnpaired 解除单边保护告警 / Resolve the one-sided protection alert of a position
+func (m *Manager) resolveUnpaired(position *models.Position) {
+	if m.alerter != nil {
+		m.alerter.Resolve(unpairedAlertKey(position))
+	}
+}
+
+// isIgnorableResidual 判断未覆盖部分是否可忽略 / Check whether an uncovered residual can be ignored
+// 未覆盖部分小于持仓数量的MinUncoveredFraction时忽略；完全未覆盖的持仓永远不会被忽略
+// A residual below MinUncoveredFraction of the position size is ignored; a fully uncovered
+// position is never ignored
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - uncoveredSize: 未覆盖数量 / Uncovered size
+//
+// Returns:
+//   - bool: 是否忽略 / Whether to ignore the residual
+func (m *Manager) isIgnorableResidual(position *models.Position, uncoveredSize float64) bool {
+	if m.cfg().MinUncoveredFraction <= 0 {
+		return false
+	}
+	threshold := toDecimal(absSize(position)).Mul(toDecimal(m.cfg().MinUncoveredFraction))
+	return toDecimal(uncoveredSize).LessThan(threshold)
+}
+
+// matchesPosition 判断算法订单是否匹配持仓 / Check if algo order matches position
+// 检查算法订单的交易对和持仓方向是否与持仓匹配
+// Check if algo order's instrument and position side match the position
+//
+// Parameters:
+//   - order: 算法订单 / Algo order
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - bool: 是否匹配 / Whether it matches
+func (m *Manager) matchesPosition(order *okx.AlgoOrder, position *models.Position) bool {
+	// Check instrument
+	if order.InstId != position.Instrument {
+		return false
+	}
+
+	// Check position side
 	if order.PosSide != position.PositionSide.String() {
 		return false
 	}
@@ -251,13 +1274,130 @@ func (m *Manager) matchesPosition(order *okx.AlgoOrder, position *models.Positio
 	return true
 }
 
+// chooseAmendTargets 选择可修改的TPSL订单 / Choose TPSL orders to amend
+// 当持仓加仓后，若止盈和止损各只有一个可修改的订单，则修改其数量覆盖全部持仓，
+// 而不是再叠加一组新订单，避免覆盖碎片化
+// When a position has grown and each of TP and SL has exactly one amendable order, resize those
+// to the full position instead of stacking another pair, avoiding fragmented coverage
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - algoOrders: 算法订单列表 / List of algo orders
+//
+// Returns:
+//   - *okx.AlgoOrder: 止盈订单，tp_sl以外的模式不管理时为nil / Take-profit order, nil when the mode leaves it out
+//   - *okx.AlgoOrder: 止损订单（TP和SL在同一订单时与止盈订单相同），模式不管理时为nil
+//     Stop-loss order (same as TP when combined), nil when the mode leaves it out
+//   - bool: 是否应修改而非新下单 / Whether to amend instead of placing new orders
+func (m *Manager) chooseAmendTargets(position *models.Position, algoOrders []okx.AlgoOrder) (*okx.AlgoOrder, *okx.AlgoOrder, bool) {
+	var tp, sl *okx.AlgoOrder
+	tpCount, slCount := 0, 0
+
+	for i := range algoOrders {
+		order := &algoOrders[i]
+		if !m.matchesPosition(order, position) {
+			continue
+		}
+		if order.TpTriggerPx != "" && order.TpTriggerPx != "0" {
+			tpCount++
+			tp = order
+		}
+		if order.SlTriggerPx != "" && order.SlTriggerPx != "0" {
+			slCount++
+			sl = order
+		}
+	}
+
+	// Legs the mode leaves out are neither counted nor resized
+	if !m.placesLeg(models.TPSLLegTakeProfit) {
+		tp, tpCount = nil, 1
+	}
+	if !m.placesLeg(models.TPSLLegStopLoss) {
+		sl, slCount = nil, 1
+	}
+
+	// Amend only when there is exactly one order per leg to resize
+	if tpCount != 1 || slCount != 1 {
+		return nil, nil, false
+	}
+
+	if (tp != nil && !isAmendable(tp)) || (sl != nil && !isAmendable(sl)) {
+		m.logger.Debug("TPSL orders for %s (%s) do not support amend, placing new orders",
+			position.Instrument, position.PositionSide)
+		return nil, nil, false
+	}
+
+	return tp, sl, true
+}
+
+// isAmendable 判断订单类型是否支持修改 / Check if order type supports amend
+// OKX amend-algos仅支持止盈止损单（conditional、oco）
+// OKX amend-algos only supports TPSL orders (conditional, oco)
+func isAmendable(order *okx.AlgoOrder) bool {
+	return order.OrdType == "conditional" || order.OrdType == "oco"
+}
+
+// errPartialAmend 止损已修改而止盈未修改 / The SL was resized but the TP was not
+var errPartialAmend = errors.New("TPSL amend partly applied")
+
+// amendTPSLOrders 修改TPSL订单数量 / Amend TPSL order size
+// 将止盈和止损订单数量修改为当前持仓大小，触发价保持不变。
+// 先修改止损，确保部分失败时不会留下数量不足的止盈单作为唯一变更；止盈修改失败时将止损改回原数量，
+// 使调用方可以改为下新订单而不会重复覆盖。改回也失败时返回errPartialAmend，此时不应再下新订单
+// Resize TP and SL orders to the current position size, keeping trigger prices.
+// SL is amended first so a partial failure never leaves only the TP resized. When the TP amend
+// fails the SL is resized back, so the caller can place new orders instead without covering the
+// position twice; if that fails too the error wraps errPartialAmend and no new orders may be placed
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - tp: 止盈订单，nil表示不修改 / Take-profit order, nil to leave out
+//   - sl: 止损订单，nil表示不修改 / Stop-loss order, nil to leave out
+//
+// Returns:
+//   - error: 修改失败时返回错误 / Error on amend failure
+func (m *Manager) amendTPSLOrders(position *models.Position, tp, sl *okx.AlgoOrder) error {
+	newSz := m.orderFormatFor(position.Instrument).size(absSize(position))
+
+	if sl != nil {
+		if _, err := m.okxClient.AmendAlgoOrder(sl.InstId, sl.AlgoId, newSz, "", ""); err != nil {
+			return fmt.Errorf("Stop-Loss amend failed: %w", err)
+		}
+		m.logger.Info("Stop-Loss order %s for %s (%s) resized %s → %s",
+			sl.AlgoId, position.Instrument, position.PositionSide, sl.Sz, newSz)
+	}
+
+	if tp == nil || (sl != nil && tp.AlgoId == sl.AlgoId) {
+		return nil // No TP managed, or a combined TP/SL order already amended
+	}
+
+	if _, err := m.okxClient.AmendAlgoOrder(tp.InstId, tp.AlgoId, newSz, "", ""); err != nil {
+		if sl == nil {
+			return fmt.Errorf("Take-Profit amend failed: %w", err)
+		}
+		if _, revertErr := m.okxClient.AmendAlgoOrder(sl.InstId, sl.AlgoId, sl.Sz, "", ""); revertErr != nil {
+			return fmt.Errorf("%w: Take-Profit amend failed (%v) and Stop-Loss %s stays resized (revert failed: %v)",
+				errPartialAmend, err, sl.AlgoId, revertErr)
+		}
+		m.logger.Info("Stop-Loss order %s for %s (%s) resized back to %s",
+			sl.AlgoId, position.Instrument, position.PositionSide, sl.Sz)
+		return fmt.Errorf("Take-Profit amend failed: %w", err)
+	}
+	m.logger.Info("Take-Profit order %s for %s (%s) resized %s → %s",
+		tp.AlgoId, position.Instrument, position.PositionSide, tp.Sz, newSz)
+
+	return nil
+}
+
 // calculateTPSLPrices 计算TPSL价格 / Calculate TPSL prices
 // 根据持仓入场价、波动率百分比和盈亏比计算止盈止损价格
 // Calculate stop-loss and take-profit prices based on entry price, volatility percentage, and profit-loss ratio
 //
 // 计算逻辑 / Calculation Logic:
-// - 止损距离 = 入场价 × 波动率百分比 (不考虑杠杆)
-// - 止盈距离 = 入场价 × 波动率百分比 × 盈亏比
+// - 止损距离 = 入场价 × 波动率百分比 (不考虑杠杆)；sl_mode为risk时见stopDistance
+// - 止盈距离 = 止损距离 × 盈亏比
+// - 开仓超过sl_tighten_after_hours时止损距离再乘以sl_tighten_factor，见tightenStopDistance
+// - 已知强平价时止损不会超出强平价，见clampStopToLiquidation
 // 例如: 入场价$100, 波动率1%, 盈亏比5:1
 //   多头: SL=$99 (-1%), TP=$105 (+5%)
 //   空头: SL=$101 (+1%), TP=$95 (-5%)
@@ -270,176 +1410,646 @@ func (m *Manager) matchesPosition(order *okx.AlgoOrder, position *models.Positio
 //   - error: 计算失败时返回错误 / Error on calculation failure
 func (m *Manager) calculateTPSLPrices(position *models.Position) (*TPSLPrices, error) {
 	entryPrice := position.AveragePrice
-	volatilityPct := m.config.VolatilityPct
-	plRatio := m.config.ProfitLossRatio
+	plRatio := m.cfg().ProfitLossRatio
 
 	if entryPrice <= 0 {
 		return nil, fmt.Errorf("invalid entry price: %.8f", entryPrice)
 	}
 
-	// Calculate SL distance (percentage of entry price, NOT considering leverage)
-	slDistance := entryPrice * volatilityPct
+	// Calculate SL distance (percentage of entry price or target dollar risk, NOT considering leverage)
+	slDistance, err := m.stopDistance(position)
+	if err != nil {
+		return nil, err
+	}
 
 	// Calculate TP distance (SL distance multiplied by profit-loss ratio)
-	tpDistance := entryPrice * volatilityPct * plRatio
+	tpDistance := slDistance.Mul(toDecimal(plRatio))
 
-	var tpPrice, slPrice float64
+	// Old positions get a tighter stop; the TP keeps the untightened distance
+	slDistance = m.tightenStopDistance(position, slDistance)
+
+	// Prices are computed in decimal so e.g. 0.1 + 0.005 is exactly 0.105
+	entry := toDecimal(entryPrice)
+	var tpPrice, slPrice decimal.Decimal
 
 	// Determine if position is long or short
 	isLong := m.isLongPosition(position)
 
 	if isLong {
 		// Long position: SL below entry, TP above entry
-		slPrice = entryPrice - slDistance
-		tpPrice = entryPrice + tpDistance
+		slPrice = entry.Sub(slDistance)
+		tpPrice = entry.Add(tpDistance)
 	} else {
 		// Short position: SL above entry, TP below entry
-		slPrice = entryPrice + slDistance
-		tpPrice = entryPrice - tpDistance
+		slPrice = entry.Add(slDistance)
+		tpPrice = entry.Sub(tpDistance)
 	}
 
+	slPrice = m.clampStopToLiquidation(position, isLong, slPrice)
+
 	// Validate prices
-	if slPrice <= 0 || tpPrice <= 0 {
-		return nil, fmt.Errorf("invalid calculated prices: SL=%.8f, TP=%.8f", slPrice, tpPrice)
+	if !slPrice.IsPositive() || !tpPrice.IsPositive() {
+		return nil, fmt.Errorf("invalid calculated prices: SL=%s, TP=%s", slPrice, tpPrice)
+	}
+
+	prices := &TPSLPrices{
+		TpPrice: tpPrice.InexactFloat64(),
+		SlPrice: slPrice.InexactFloat64(),
+	}
+	if err := validateTPSLDirection(isLong, entryPrice, prices); err != nil {
+		return nil, fmt.Errorf("invalid TPSL for %s (%s): %w", position.Instrument, position.PositionSide, err)
+	}
+
+	m.logger.Debug("Calculated TPSL for %s (%s): entry=%.8f, sl_mode=%s, SL_distance=%s, SL=%s, TP=%s",
+		position.Instrument, position.PositionSide, entryPrice, m.cfg().SLMode, slDistance, slPrice, tpPrice)
+
+	return prices, nil
+}
+
+// clampStopToLiquidation 将止损价限制在强平价以内 / Keep the stop-loss inside the liquidation price
+// 止损价位于强平价之外时持仓会先被强平，止损永远不会触发。
+// 此时将止损移至强平价内LiqBufferPct处并告警；强平价未知时不做调整
+// A stop beyond the liquidation price never fires because the position is liquidated first.
+// Such a stop is moved LiqBufferPct inside the liquidation price and alerted; nothing is
+// adjusted when the liquidation price is unknown
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - isLong: 是否为多头 / Whether the position is long
+//   - slPrice: 计算得到的止损价 / Calculated stop-loss price
+//
+// Returns:
+//   - decimal.Decimal: 调整后的止损价 / Adjusted stop-loss price
+func (m *Manager) clampStopToLiquidation(position *models.Position, isLong bool, slPrice decimal.Decimal) decimal.Decimal {
+	if position.LiqPx <= 0 {
+		return slPrice
+	}
+
+	liq := toDecimal(position.LiqPx)
+	buffer := toDecimal(m.cfg().LiqBufferPct)
+	var limit decimal.Decimal
+	var beyond bool
+	if isLong {
+		// Long liquidates below entry, the stop must stay above the liquidation price
+		limit = liq.Mul(decimal.NewFromInt(1).Add(buffer))
+		beyond = slPrice.LessThan(limit)
+	} else {
+		// Short liquidates above entry, the stop must stay below the liquidation price
+		limit = liq.Mul(decimal.NewFromInt(1).Sub(buffer))
+		beyond = slPrice.GreaterThan(limit)
+	}
+
+	key := liquidationAlertKey(position)
+	if !beyond {
+		if m.alerter != nil {
+			m.alerter.Resolve(key)
+		}
+		return slPrice
+	}
+
+	m.logger.Warn("SL %s for %s (%s) is beyond liquidation price %s, moving it to %s",
+		slPrice, position.Instrument, position.PositionSide, liq, limit)
+	if m.alerter != nil {
+		m.alerter.Alert(key, "%s (%s) stop-loss %s would trigger after liquidation at %s, moved to %s",
+			position.Instrument, position.PositionSide, slPrice, liq, limit)
+	}
+	return limit
+}
+
+// liquidationAlertKey 止损超出强平价告警键 / Alert key for a stop-loss beyond the liquidation price
+func liquidationAlertKey(position *models.Position) string {
+	return fmt.Sprintf("tpsl_sl_beyond_liq:%s:%s", position.Instrument, position.PositionSide)
+}
+
+// validateTPSLDirection 验证止盈止损方向 / Validate TP/SL direction
+// 多头必须满足 SL < 入场价 < TP，空头必须满足 TP < 入场价 < SL，
+// 在发送OKX会拒绝的订单之前发现配置错误
+// Longs must satisfy SL < entry < TP and shorts TP < entry < SL, catching misconfiguration
+// before sending orders OKX would reject
+//
+// Parameters:
+//   - isLong: 是否为多头 / Whether the position is long
+//   - entryPrice: 入场价 / Entry price
+//   - prices: TPSL价格 / TPSL prices
+//
+// Returns:
+//   - error: 方向错误时返回描述性错误 / Descriptive error on inverted prices
+func validateTPSLDirection(isLong bool, entryPrice float64, prices *TPSLPrices) error {
+	if isLong {
+		if prices.SlPrice >= entryPrice {
+			return fmt.Errorf("long stop-loss %.8f must be below entry %.8f", prices.SlPrice, entryPrice)
+		}
+		if prices.TpPrice <= entryPrice {
+			return fmt.Errorf("long take-profit %.8f must be above entry %.8f", prices.TpPrice, entryPrice)
+		}
+		return nil
+	}
+
+	if prices.SlPrice <= entryPrice {
+		return fmt.Errorf("short stop-loss %.8f must be above entry %.8f", prices.SlPrice, entryPrice)
+	}
+	if prices.TpPrice >= entryPrice {
+		return fmt.Errorf("short take-profit %.8f must be below entry %.8f", prices.TpPrice, entryPrice)
+	}
+	return nil
+}
+
+// stopDistance 计算止损距离 / Calculate stop-loss distance
+// percent模式: 入场价 × 波动率百分比
+// risk模式: 使止损触发时亏损约等于RiskPerTradeUSD
+//   正向合约/现货: 距离 = 风险金额 / (数量 × 合约面值)
+//   反向合约（面值以美元计）: 距离 = 风险金额 × 入场价 / (数量 × 合约面值)
+// percent mode: entry price × volatility percentage
+// risk mode: the distance at which hitting the SL loses about RiskPerTradeUSD
+//   linear/spot: distance = risk / (size × contract value)
+//   inverse (USD contract value): distance = risk × entry / (size × contract value)
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - float64: 止损距离（价格单位）/ Stop-loss distance in price units
+//   - error: 获取合约信息失败或持仓数量为0时返回错误 / Error on instrument lookup failure or zero size
+func (m *Manager) stopDistance(position *models.Position) (decimal.Decimal, error) {
+	if m.cfg().SLMode != "risk" {
+		return toDecimal(position.AveragePrice).Mul(toDecimal(m.cfg().VolatilityPct)), nil
+	}
+
+	size := absSize(position)
+	if size <= 0 {
+		return decimal.Zero, fmt.Errorf("cannot size risk-based stop for zero position")
+	}
+
+	inst, err := m.getInstrument(position.Instrument)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	contractValue, err := inst.ContractValue()
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid contract value for %s: %w", position.Instrument, err)
 	}
 
-	m.logger.Debug("Calculated TPSL for %s (%s): entry=%.8f, volatility=%.2f%%, SL=%.8f, TP=%.8f",
-		position.Instrument, position.PositionSide, entryPrice, volatilityPct*100, slPrice, tpPrice)
+	distance := toDecimal(m.cfg().RiskPerTradeUSD).Div(toDecimal(size).Mul(toDecimal(contractValue)))
+	if inst.CtType == "inverse" {
+		distance = distance.Mul(toDecimal(position.AveragePrice))
+	}
+
+	m.logger.Debug("Risk-based SL distance for %s: risk=$%.2f, size=%.8f, contract_value=%.8f (%s), distance=%s",
+		position.Instrument, m.cfg().RiskPerTradeUSD, size, contractValue, inst.CtType, distance)
+
+	return distance, nil
+}
+
+// getInstrument 获取交易产品信息 / Get instrument metadata
+// 首次查询后缓存，合约面值等信息不会频繁变化
+// Cached after the first lookup since contract metadata rarely changes
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID
+//
+// Returns:
+//   - *okx.InstrumentData: 交易产品信息 / Instrument metadata
+//   - error: 查询失败时返回错误 / Error on lookup failure
+func (m *Manager) getInstrument(instId string) (*okx.InstrumentData, error) {
+	m.instMu.Lock()
+	defer m.instMu.Unlock()
+
+	if inst, ok := m.instruments[instId]; ok {
+		return inst, nil
+	}
+
+	resp, err := m.okxClient.GetInstruments(okx.InstTypeFromID(instId), instId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instrument %s: %w", instId, err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no instrument data returned for %s", instId)
+	}
+
+	inst := resp.Data[0]
+	m.instruments[instId] = &inst
+	return &inst, nil
+}
+
+// isLongPosition 判断是否为多头持仓 / Check if position is long
+// 根据持仓方向判断是否为多头
+// Determine if position is long based on position side
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - bool: 是否为多头 / Whether it's a long position
+func (m *Manager) isLongPosition(position *models.Position) bool {
+	// In hedge mode, position side is explicitly "long" or "short"
+	if position.PositionSide == models.PositionSideLong {
+		return true
+	}
+	if position.PositionSide == models.PositionSideShort {
+		return false
+	}
+
+	// In one-way (net) mode, determine from position size
+	// Positive size = long, negative size = short
+	return position.PositionSize > 0
+}
+
+// orderPosSide 获取下单使用的持仓方向 / Get position side to send with orders
+// 单向持仓（net）模式下不传posSide，由side和reduceOnly决定平仓方向。
+// 已检测到账户持仓模式时以账户模式为准，否则根据持仓方向推断
+// In one-way (net) mode posSide is omitted and side plus reduceOnly determine the close direction.
+// The detected account position mode takes precedence; otherwise it is inferred from the position side
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - string: 持仓方向，net模式返回空字符串 / Position side, empty in net mode
+func (m *Manager) orderPosSide(position *models.Position) string {
+	if m.posMode == okx.PosModeNet || position.PositionSide == models.PositionSideNet {
+		return ""
+	}
+	return position.PositionSide.String()
+}
+
+// absSize 获取持仓数量绝对值 / Get absolute position size
+// net模式下空头持仓数量为负数 / Short positions have negative size in net mode
+func absSize(position *models.Position) float64 {
+	return math.Abs(position.PositionSize)
+}
+
+// placeTPSLOrder 下单TPSL订单 / Place TPSL order
+// 为持仓下单止盈止损订单（分成两个独立订单）
+// Place take-profit and stop-loss orders for position (as two separate orders)
+//
+// 修改说明 / Modification Note:
+// 1. 由于OKX API在某些情况下同时发送TP和SL时可能只执行SL，
+//    因此将止盈和止损分成两个独立的订单分别下单。
+// 2. 检查当前价格是否已超过预期止盈位置，如果已超过则跳过止盈订单设置。
+// 1. Due to OKX API limitation where only SL is executed when both TP and SL are sent together,
+//    we now place take-profit and stop-loss as two separate orders.
+// 2. Check if current price has already passed the expected TP price, skip TP order if so.
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - size: 订单大小 / Order size
+//   - prices: TPSL价格 / TPSL prices
+//
+// Returns:
+//   - error: 下单失败时返回错误 / Error on placement failure
+//
+// NOTE: This function signature is kept for backward compatibility.
+// The actual implementation now includes current price validation.
+// See placeTPSLOrderWithValidation() for the full implementation.
+
+// formatFloat 格式化浮点数为字符串 / Format float to string
+// 将浮点数格式化为字符串，保留足够精度
+// Format float to string with sufficient precision
+//
+// Parameters:
+//   - f: 浮点数 / Float number
+//
+// Returns:
+//   - string: 格式化后的字符串 / Formatted string
+func formatFloat(f float64) string {
+	return formatDecimal(toDecimal(f))
+}
+
+// orderFormat 交易产品的价格与数量精度 / Price and size precision of an instrument
+// 精度未知时（值为-1）回退到formatFloat
+// Falls back to formatFloat when a precision is unknown (-1)
+type orderFormat struct {
+	pricePlaces int32 // Decimal places of tickSz
+	sizePlaces  int32 // Decimal places of lotSz
+}
+
+// genericOrderFormat 无交易产品信息时使用的格式 / Format used when instrument metadata is unavailable
+var genericOrderFormat = orderFormat{pricePlaces: -1, sizePlaces: -1}
+
+// price 格式化价格 / Format a price
+func (f orderFormat) price(v float64) string {
+	if f.pricePlaces < 0 {
+		return formatFloat(v)
+	}
+	return formatDecimalPlaces(toDecimal(v), f.pricePlaces)
+}
+
+// size 格式化数量 / Format a size
+func (f orderFormat) size(v float64) string {
+	if f.sizePlaces < 0 {
+		return formatFloat(v)
+	}
+	return formatDecimalPlaces(toDecimal(v), f.sizePlaces)
+}
+
+// orderFormatFor 获取交易产品的下单精度 / Get the order precision of an instrument
+// 由tickSz和lotSz推导；无法获取交易产品信息时使用通用格式（最多8位小数）
+// Derived from tickSz and lotSz; the generic format (at most 8 decimals) is used when
+// instrument metadata is unavailable
+//
+// Parameters:
+//   - instId: 产品ID / Instrument ID
+//
+// Returns:
+//   - orderFormat: 下单精度 / Order precision
+func (m *Manager) orderFormatFor(instId string) orderFormat {
+	inst, err := m.getInstrument(instId)
+	if err != nil {
+		m.logger.Debug("Instrument metadata unavailable for %s, using generic precision: %v", instId, err)
+		return genericOrderFormat
+	}
+
+	format := genericOrderFormat
+	if places, ok := stepPrecision(inst.TickSz); ok {
+		format.pricePlaces = places
+	}
+	if places, ok := stepPrecision(inst.LotSz); ok {
+		format.sizePlaces = places
+	}
+	return format
+}
+
+// getCurrentMarketPrice 获取当前市场价格 / Get current market price from OKX ticker API
+// 优先使用WebSocket推送的最新价格，否则从OKX ticker API获取指定交易对的当前价格
+// Prefer the WebSocket streamed price, otherwise fetch current price from OKX ticker API
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
+//
+// Returns:
+//   - float64: 当前市场价格 / Current market price
+//   - error: 获取失败时返回错误 / Error on failure
+func (m *Manager) getCurrentMarketPrice(instId string) (float64, error) {
+	// Prefer streamed price when available
+	if m.wsClient != nil {
+		if price, ok := m.wsClient.LatestPrice(instId); ok {
+			m.logger.Debug("Using streamed price for %s: %.8f", instId, price)
+			return price, nil
+		}
+		m.logger.Debug("No fresh streamed price for %s, falling back to ticker API", instId)
+	}
+
+	ttl := m.priceCacheTTL()
+	if ttl > 0 {
+		m.priceMu.Lock()
+		cached, ok := m.prices[instId]
+		m.priceMu.Unlock()
+		if ok && m.clock.Now().Sub(cached.fetchedAt) < ttl {
+			m.logger.Debug("Using cached price for %s: %.8f", instId, cached.price)
+			return cached.price, nil
+		}
+	}
+
+	// Query OKX ticker API
+	resp, err := m.okxClient.GetTicker(instId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ticker for %s: %w", instId, err)
+	}
+
+	// Parse last price
+	if len(resp.Data) == 0 {
+		return 0, fmt.Errorf("no ticker data returned for %s", instId)
+	}
+
+	lastPrice, err := strconv.ParseFloat(resp.Data[0].Last, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse last price '%s': %w", resp.Data[0].Last, err)
+	}
+
+	if ttl > 0 {
+		m.cachePrice(instId, lastPrice)
+	}
+
+	return lastPrice, nil
+}
+
+// cachePrice 缓存最新价格 / Cache a last price
+func (m *Manager) cachePrice(instId string, price float64) {
+	m.priceMu.Lock()
+	m.prices[instId] = cachedPrice{price: price, fetchedAt: m.clock.Now()}
+	m.priceMu.Unlock()
+}
+
+// primePriceCache 批量预取持仓交易对的价格 / Prefetch prices of held instruments in bulk
+// 按产品类型调用一次GetTickers，仅缓存持有的交易对；价格缓存未启用时不预取。
+// 失败仅记录警告，之后按交易对单独获取价格
+// Calls GetTickers once per instrument type and caches only the held instruments; nothing is
+// prefetched when the price cache is disabled. Failures are only logged, prices are then fetched
+// per instrument
+//
+// Parameters:
+//   - positions: 持仓列表 / Position list
+func (m *Manager) primePriceCache(positions []*models.Position) {
+	if m.priceCacheTTL() <= 0 {
+		return
+	}
+
+	held := make(map[string]bool, len(positions))
+	var instTypes []string
+	seenTypes := make(map[string]bool)
+	for _, position := range positions {
+		held[position.Instrument] = true
+		if instType := okx.InstTypeFromID(position.Instrument); !seenTypes[instType] {
+			seenTypes[instType] = true
+			instTypes = append(instTypes, instType)
+		}
+	}
+
+	for _, instType := range instTypes {
+		resp, err := m.okxClient.GetTickers(instType)
+		if err != nil {
+			m.logger.Warn("Failed to get %s tickers, fetching prices per instrument: %v", instType, err)
+			continue
+		}
+
+		cached := 0
+		for _, ticker := range resp.Data {
+			if !held[ticker.InstId] {
+				continue
+			}
+			price, err := strconv.ParseFloat(ticker.Last, 64)
+			if err != nil {
+				m.logger.Debug("Skipping unparsable last price '%s' for %s: %v", ticker.Last, ticker.InstId, err)
+				continue
+			}
+			m.cachePrice(ticker.InstId, price)
+			cached++
+		}
+		m.logger.Debug("Cached %d %s prices from bulk tickers", cached, instType)
+	}
+}
+
+// priceCacheTTL 返回价格缓存有效期 / Return the price cache TTL
+// 未配置或为0时不缓存 / No caching when unset or 0
+func (m *Manager) priceCacheTTL() time.Duration {
+	if m.cfg().PriceCacheTTL == nil {
+		return 0
+	}
+	return time.Duration(*m.cfg().PriceCacheTTL * float64(time.Second))
+}
 
-	return &TPSLPrices{
-		TpPrice: tpPrice,
-		SlPrice: slPrice,
-	}, nil
+// invalidatePrice 丢弃缓存的价格 / Drop the cached price
+// 用于必须读取最新价格的场景，例如触发价被拒后重新定价
+// Used where the latest price is required, such as repricing after a trigger rejection
+//
+// Parameters:
+//   - instId: 交易对ID / Instrument ID
+func (m *Manager) invalidatePrice(instId string) {
+	m.priceMu.Lock()
+	delete(m.prices, instId)
+	m.priceMu.Unlock()
 }
 
-// isLongPosition 判断是否为多头持仓 / Check if position is long
-// 根据持仓方向判断是否为多头
-// Determine if position is long based on position side
+// clampToAvailableSize 将订单数量限制在实际可平仓数量内 / Clamp order size to live closable size
+// 只减仓订单的数量不能超过当前持仓；若数据库持仓已过期（如手动部分平仓后），
+// 按实际可平仓数量缩减订单，避免"超过持仓"被拒。可平仓数量未知、为0或查询失败时保持原数量，
+// 不因此阻止下单，超出的部分由OKX拒单
+// Reduce-only orders cannot exceed the live position; when the stored position is stale
+// (e.g., after a manual partial close), shrink the order to the live closable size to avoid
+// rejections. When that size is unknown, zero or cannot be queried the requested size is kept,
+// never blocking protection; OKX rejects what is really too large
 //
 // Parameters:
 //   - position: 持仓信息 / Position information
+//   - size: 期望的订单数量 / Desired order size
 //
 // Returns:
-//   - bool: 是否为多头 / Whether it's a long position
-func (m *Manager) isLongPosition(position *models.Position) bool {
-	// In hedge mode, position side is explicitly "long" or "short"
-	if position.PositionSide == models.PositionSideLong {
-		return true
+//   - float64: 调整后的订单数量 / Clamped order size
+func (m *Manager) clampToAvailableSize(position *models.Position, size float64) float64 {
+	avail, ok := m.liveClosableSize(position)
+	if !ok {
+		return size
 	}
-	if position.PositionSide == models.PositionSideShort {
-		return false
+	if !avail.IsPositive() {
+		m.logger.Warn("Live closable size for %s (%s) is %s, keeping TPSL size %.8f",
+			position.Instrument, position.PositionSide, avail, size)
+		return size
+	}
+	if toDecimal(size).GreaterThan(avail) {
+		m.logger.Warn("Clamping TPSL size for %s (%s) from %.8f to live available %s",
+			position.Instrument, position.PositionSide, size, avail)
+		return avail.InexactFloat64()
 	}
 
-	// In one-way (net) mode, determine from position size
-	// Positive size = long, negative size = short
-	return position.PositionSize > 0
+	return size
 }
 
-// placeTPSLOrder 下单TPSL订单 / Place TPSL order
-// 为持仓下单止盈止损订单（分成两个独立订单）
-// Place take-profit and stop-loss orders for position (as two separate orders)
-//
-// 修改说明 / Modification Note:
-// 1. 由于OKX API在某些情况下同时发送TP和SL时可能只执行SL，
-//    因此将止盈和止损分成两个独立的订单分别下单。
-// 2. 检查当前价格是否已超过预期止盈位置，如果已超过则跳过止盈订单设置。
-// 1. Due to OKX API limitation where only SL is executed when both TP and SL are sent together,
-//    we now place take-profit and stop-loss as two separate orders.
-// 2. Check if current price has already passed the expected TP price, skip TP order if so.
+// liveClosableSize 查询持仓实际可平仓数量 / Query the live closable size of a position
+// 衍生品按OKX实时持仓数量；max-avail-size的reduceOnly仅适用于杠杆（MARGIN），对衍生品返回的是
+// 随保证金变化的可开仓数量，因此只用于杠杆持仓
+// Derivatives use the live position size from OKX; reduceOnly on max-avail-size applies to
+// MARGIN only and for derivatives it reports a margin-dependent openable size, so it is only
+// used for margin positions
 //
 // Parameters:
 //   - position: 持仓信息 / Position information
-//   - size: 订单大小 / Order size
-//   - prices: TPSL价格 / TPSL prices
 //
 // Returns:
-//   - error: 下单失败时返回错误 / Error on placement failure
-//
-// NOTE: This function signature is kept for backward compatibility.
-// The actual implementation now includes current price validation.
-// See placeTPSLOrderWithValidation() for the full implementation.
+//   - decimal.Decimal: 可平仓数量 / Closable size
+//   - bool: 是否读取到数量 / Whether a size was read
+func (m *Manager) liveClosableSize(position *models.Position) (decimal.Decimal, bool) {
+	if okx.InstTypeFromID(position.Instrument) == "SPOT" {
+		return m.marginClosableSize(position)
+	}
 
-// formatFloat 格式化浮点数为字符串 / Format float to string
-// 将浮点数格式化为字符串，保留足够精度
-// Format float to string with sufficient precision
+	resp, err := m.okxClient.GetPositions()
+	if err != nil {
+		m.logger.Warn("Failed to get live positions for %s: %v, keeping TPSL size", position.Instrument, err)
+		return decimal.Zero, false
+	}
+	for _, live := range resp.Data {
+		if live.InstId != position.Instrument || live.PosSide != position.PositionSide.String() {
+			continue
+		}
+		if position.MarginMode != "" && live.MgnMode != "" && live.MgnMode != position.MarginMode.String() {
+			continue
+		}
+		size, err := parseDecimal(live.Pos)
+		if err != nil {
+			m.logger.Warn("Failed to parse live position size '%s' for %s: %v, keeping TPSL size", live.Pos, position.Instrument, err)
+			return decimal.Zero, false
+		}
+		return size.Abs(), true
+	}
+
+	m.logger.Warn("No live position found for %s (%s), keeping TPSL size", position.Instrument, position.PositionSide)
+	return decimal.Zero, false
+}
+
+// marginClosableSize 查询杠杆持仓的最大可平仓数量 / Query the maximum closable size of a margin position
 //
 // Parameters:
-//   - f: 浮点数 / Float number
+//   - position: 持仓信息 / Position information
 //
 // Returns:
-//   - string: 格式化后的字符串 / Formatted string
-func formatFloat(f float64) string {
-	// Remove trailing zeros
-	s := strconv.FormatFloat(f, 'f', 8, 64)
-	// Trim trailing zeros after decimal point
-	if len(s) > 0 && (s[len(s)-1] == '0' || s[len(s)-1] == '.') {
-		s = trimTrailingZeros(s)
+//   - decimal.Decimal: 可平仓数量 / Closable size
+//   - bool: 是否读取到数量 / Whether a size was read
+func (m *Manager) marginClosableSize(position *models.Position) (decimal.Decimal, bool) {
+	tdMode := position.MarginMode.String()
+	if tdMode == "" {
+		tdMode = models.MarginModeCross.String()
 	}
-	return s
-}
 
-// trimTrailingZeros 去除尾随零 / Trim trailing zeros
-func trimTrailingZeros(s string) string {
-	// Find decimal point
-	dotIndex := -1
-	for i, ch := range s {
-		if ch == '.' {
-			dotIndex = i
-			break
-		}
+	resp, err := m.okxClient.GetMaxAvailSize(position.Instrument, tdMode)
+	if err != nil {
+		m.logger.Warn("Failed to get max available size for %s: %v, keeping TPSL size", position.Instrument, err)
+		return decimal.Zero, false
 	}
-
-	if dotIndex == -1 {
-		return s // No decimal point
+	if len(resp.Data) == 0 {
+		return decimal.Zero, false
 	}
 
-	// Trim zeros from the end
-	end := len(s) - 1
-	for end > dotIndex && s[end] == '0' {
-		end--
+	// Closing a long sells, closing a short buys
+	availStr := resp.Data[0].AvailBuy
+	if m.isLongPosition(position) {
+		availStr = resp.Data[0].AvailSell
 	}
-
-	// If only decimal point left, remove it too
-	if end == dotIndex {
-		return s[:dotIndex]
+	avail, err := parseDecimal(availStr)
+	if err != nil {
+		m.logger.Warn("Failed to parse max available size '%s' for %s: %v", availStr, position.Instrument, err)
+		return decimal.Zero, false
 	}
-
-	return s[:end+1]
+	return avail, true
 }
 
-// getCurrentMarketPrice 获取当前市场价格 / Get current market price from OKX ticker API
-// 从OKX ticker API获取指定交易对的当前价格
-// Fetch current price for the specified instrument from OKX ticker API
+// checkSpread 检查买卖价差 / Check bid-ask spread
+// 止盈止损以市价成交，价差过大时滑点可能远超预期，超过MaxSpreadPct时记录警告。
+// MaxSpreadPct为0时不检查；查询失败不影响下单
+// TPSL orders fill at market, so a wide spread can slip far beyond the trigger; warn when it exceeds
+// MaxSpreadPct. Disabled when MaxSpreadPct is 0; query failures never block placement
 //
 // Parameters:
-//   - instId: 交易对ID / Instrument ID (e.g., "BTC-USDT-SWAP")
-//
-// Returns:
-//   - float64: 当前市场价格 / Current market price
-//   - error: 获取失败时返回错误 / Error on failure
-func (m *Manager) getCurrentMarketPrice(instId string) (float64, error) {
-	// Query OKX ticker API
-	resp, err := m.okxClient.GetTicker(instId)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get ticker for %s: %w", instId, err)
+//   - position: 持仓信息 / Position information
+func (m *Manager) checkSpread(position *models.Position) {
+	if m.cfg().MaxSpreadPct <= 0 {
+		return
 	}
 
-	// Parse last price
+	resp, err := m.okxClient.GetOrderBook(position.Instrument, 1)
+	if err != nil {
+		m.logger.Warn("Failed to get order book for %s: %v, skipping spread check", position.Instrument, err)
+		return
+	}
 	if len(resp.Data) == 0 {
-		return 0, fmt.Errorf("no ticker data returned for %s", instId)
+		return
 	}
 
-	lastPrice, err := strconv.ParseFloat(resp.Data[0].Last, 64)
+	spread, err := resp.Data[0].SpreadPct()
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse last price '%s': %w", resp.Data[0].Last, err)
+		m.logger.Warn("Failed to compute spread for %s: %v", position.Instrument, err)
+		return
 	}
 
-	return lastPrice, nil
+	if spread > m.cfg().MaxSpreadPct {
+		m.logger.Warn("ALERT: Spread for %s is %.4f%% (threshold %.4f%%), TPSL market fills may slip",
+			position.Instrument, spread*100, m.cfg().MaxSpreadPct*100)
+	}
 }
 
 // adjustTPSLPricesWithCurrentPrice 根据当前价格调整止盈止损价格 / Adjust TP/SL prices based on current market price
 // 检查当前价格是否已经超过预期的止盈/止损位置，如果是则使用当前价格
 // Check if current price has exceeded expected TP/SL levels, use current price if so
+// 调整后的价格距当前价格PriceBufferPct / Adjusted prices are PriceBufferPct beyond current price
 //
 // Parameters:
 //   - position: 持仓信息 / Position information
@@ -452,6 +2062,10 @@ func (m *Manager) getCurrentMarketPrice(instId string) (float64, error) {
 //   - bool: 是否跳过止损订单 / Whether to skip SL order (if price moved too far)
 func (m *Manager) adjustTPSLPricesWithCurrentPrice(position *models.Position, prices *TPSLPrices, currentPrice float64) (*TPSLPrices, bool, bool) {
 	isLong := m.isLongPosition(position)
+	buffer := toDecimal(m.cfg().PriceBufferPct)
+	current := toDecimal(currentPrice)
+	tp := toDecimal(prices.TpPrice)
+	sl := toDecimal(prices.SlPrice)
 	adjustedPrices := &TPSLPrices{
 		TpPrice: prices.TpPrice,
 		SlPrice: prices.SlPrice,
@@ -466,25 +2080,25 @@ func (m *Manager) adjustTPSLPricesWithCurrentPrice(position *models.Position, pr
 		// Long position: TP above entry, SL below entry
 
 		// Check TP: if current price >= expected TP price
-		if currentPrice >= prices.TpPrice {
+		if current.GreaterThanOrEqual(tp) {
 			m.logger.Warn("Position %s (long): Current price %.8f has reached or exceeded expected TP %.8f",
 				position.Instrument, currentPrice, prices.TpPrice)
 			// For long position: TP must be ABOVE current price
-			// Set TP slightly above current price (0.1% higher to ensure it's above)
-			adjustedPrice := currentPrice * 1.001
+			// Set TP slightly above current price (by the configured buffer to ensure it's above)
+			adjustedPrice := current.Mul(decimal.NewFromInt(1).Add(buffer)).InexactFloat64()
 			m.logger.Info("Adjusting TP price to slightly above current price: %.8f → %.8f (current: %.8f)",
 				prices.TpPrice, adjustedPrice, currentPrice)
 			adjustedPrices.TpPrice = adjustedPrice
 		}
 
 		// Check SL: if current price <= expected SL price
-		if currentPrice <= prices.SlPrice {
+		if current.LessThanOrEqual(sl) {
 			m.logger.Warn("Position %s (long): Current price %.8f has hit or passed expected SL %.8f!",
 				position.Instrument, currentPrice, prices.SlPrice)
 			// For long position: SL must be BELOW current price
-			// Set SL slightly below current price (0.1% lower) to ensure it triggers
+			// Set SL slightly below current price (by the configured buffer) to ensure it triggers
 			// User accepts slightly more loss to ensure SL is set
-			adjustedPrice := currentPrice * 0.999
+			adjustedPrice := current.Mul(decimal.NewFromInt(1).Sub(buffer)).InexactFloat64()
 			m.logger.Info("Adjusting SL price to slightly below current price: %.8f → %.8f (current: %.8f)",
 				prices.SlPrice, adjustedPrice, currentPrice)
 			m.logger.Warn("ALERT: Setting emergency SL at current price - position already in loss beyond expected SL")
@@ -495,25 +2109,25 @@ func (m *Manager) adjustTPSLPricesWithCurrentPrice(position *models.Position, pr
 		// Short position: TP below entry, SL above entry
 
 		// Check TP: if current price <= expected TP price
-		if currentPrice <= prices.TpPrice {
+		if current.LessThanOrEqual(tp) {
 			m.logger.Warn("Position %s (short): Current price %.8f has reached or exceeded expected TP %.8f",
 				position.Instrument, currentPrice, prices.TpPrice)
 			// For short position: TP must be BELOW current price
-			// Set TP slightly below current price (0.1% lower to ensure it's below)
-			adjustedPrice := currentPrice * 0.999
+			// Set TP slightly below current price (by the configured buffer to ensure it's below)
+			adjustedPrice := current.Mul(decimal.NewFromInt(1).Sub(buffer)).InexactFloat64()
 			m.logger.Info("Adjusting TP price to slightly below current price: %.8f → %.8f (current: %.8f)",
 				prices.TpPrice, adjustedPrice, currentPrice)
 			adjustedPrices.TpPrice = adjustedPrice
 		}
 
 		// Check SL: if current price >= expected SL price
-		if currentPrice >= prices.SlPrice {
+		if current.GreaterThanOrEqual(sl) {
 			m.logger.Warn("Position %s (short): Current price %.8f has hit or passed expected SL %.8f!",
 				position.Instrument, currentPrice, prices.SlPrice)
 			// For short position: SL must be ABOVE current price
-			// Set SL slightly above current price (0.1% higher) to ensure it triggers
+			// Set SL slightly above current price (by the configured buffer) to ensure it triggers
 			// User accepts slightly more loss to ensure SL is set
-			adjustedPrice := currentPrice * 1.001
+			adjustedPrice := current.Mul(decimal.NewFromInt(1).Add(buffer)).InexactFloat64()
 			m.logger.Info("Adjusting SL price to slightly above current price: %.8f → %.8f (current: %.8f)",
 				prices.SlPrice, adjustedPrice, currentPrice)
 			m.logger.Warn("ALERT: Setting emergency SL at current price - position already in loss beyond expected SL")
@@ -547,6 +2161,9 @@ func (m *Manager) adjustTPSLPricesWithCurrentPrice(position *models.Position, pr
 // Returns:
 //   - error: 下单失败时返回错误 / Error on placement failure
 func (m *Manager) placeTPSLOrderWithValidation(position *models.Position, size float64, prices *TPSLPrices) error {
+	// Never ask for more than the live closable size
+	size = m.clampToAvailableSize(position, size)
+
 	// Get current market price
 	currentPrice, err := m.getCurrentMarketPrice(position.Instrument)
 	if err != nil {
@@ -555,48 +2172,34 @@ func (m *Manager) placeTPSLOrderWithValidation(position *models.Position, size f
 		return m.placeTPSLOrderOriginal(position, size, prices)
 	}
 
+	// Warn if market-triggered orders would fill into a wide spread
+	m.checkSpread(position)
+
 	// Adjust TP/SL prices based on current price
 	adjustedPrices, skipTP, skipSL := m.adjustTPSLPricesWithCurrentPrice(position, prices, currentPrice)
 
-	// Determine order side (opposite of position)
-	isLong := m.isLongPosition(position)
-	var orderSide string
-	if isLong {
-		orderSide = "sell" // Close long position
-	} else {
-		orderSide = "buy" // Close short position
-	}
-
 	m.logger.Info("Placing TPSL orders for %s (%s): TP=%.8f (adjusted: %v), SL=%.8f, current=%.8f",
 		position.Instrument, position.PositionSide, adjustedPrices.TpPrice,
 		adjustedPrices.TpPrice != prices.TpPrice, adjustedPrices.SlPrice, currentPrice)
 
-	var tpAlgoId string
+	// Legs the mode leaves out are never placed
+	placeTP, placeSL := m.placesLeg(models.TPSLLegTakeProfit), m.placesLeg(models.TPSLLegStopLoss)
 
-	// Determine trade mode from position
-	tdMode := position.MarginMode.String()
-	if tdMode == "" {
-		tdMode = models.MarginModeCross.String() // Default to cross if not specified
+	if m.useCloseFraction(position) {
+		return m.placeCloseFractionOrder(position, size, prices, adjustedPrices, skipTP || !placeTP, skipSL || !placeSL)
 	}
 
+	var tpAlgoId string
+
 	// Place Take-Profit order (if not skipped)
-	if !skipTP {
-		tpReq := okx.AlgoOrderRequest{
-			InstId:          position.Instrument,
-			TdMode:          tdMode,
-			Side:            orderSide,
-			PosSide:         position.PositionSide.String(),
-			OrdType:         "conditional",
-			Sz:              formatFloat(size),
-			TpTriggerPx:     formatFloat(adjustedPrices.TpPrice),
-			TpOrdPx:         "-1", // Market order
-			TpTriggerPxType: "last",
-			ReduceOnly:      true,
-		}
+	if !placeTP {
+		m.logger.Debug("Not placing Take-Profit for %s (%s) in %s mode", position.Instrument, position.PositionSide, m.cfg().Mode)
+	} else if !skipTP {
+		tpReq := m.legRequest(position, models.TPSLLegTakeProfit, size, adjustedPrices.TpPrice)
 
 		m.logger.Debug("Placing Take-Profit order for %s (%s): TP=%.8f", position.Instrument, position.PositionSide, adjustedPrices.TpPrice)
 
-		tpResp, err := m.okxClient.PlaceAlgoOrder(tpReq)
+		tpResp, err := m.placeWithReprice(position, tpReq, prices, adjustedPrices)
 		if err != nil {
 			return fmt.Errorf("Take-Profit order failed: %w", err)
 		}
@@ -605,29 +2208,21 @@ func (m *Manager) placeTPSLOrderWithValidation(position *models.Position, size f
 			tpAlgoId = tpResp.Data[0].AlgoId
 			m.logger.Info("Take-Profit order placed successfully for %s (%s), algoId: %s, trigger: %.8f",
 				position.Instrument, position.PositionSide, tpAlgoId, adjustedPrices.TpPrice)
+			m.recordOrder(position, models.TPSLLegTakeProfit, tpAlgoId, tpResp.Data[0].AlgoClOrdId, size, adjustedPrices.TpPrice)
 		}
 	} else {
 		m.logger.Warn("Skipping Take-Profit order for %s (%s) due to price condition", position.Instrument, position.PositionSide)
 	}
 
 	// Place Stop-Loss order (if not skipped)
-	if !skipSL {
-		slReq := okx.AlgoOrderRequest{
-			InstId:          position.Instrument,
-			TdMode:          tdMode,
-			Side:            orderSide,
-			PosSide:         position.PositionSide.String(),
-			OrdType:         "conditional",
-			Sz:              formatFloat(size),
-			SlTriggerPx:     formatFloat(adjustedPrices.SlPrice),
-			SlOrdPx:         "-1", // Market order
-			SlTriggerPxType: "last",
-			ReduceOnly:      true,
-		}
+	if !placeSL {
+		m.logger.Debug("Not placing Stop-Loss for %s (%s) in %s mode", position.Instrument, position.PositionSide, m.cfg().Mode)
+	} else if !skipSL {
+		slReq := m.legRequest(position, models.TPSLLegStopLoss, size, adjustedPrices.SlPrice)
 
 		m.logger.Debug("Placing Stop-Loss order for %s (%s): SL=%.8f", position.Instrument, position.PositionSide, adjustedPrices.SlPrice)
 
-		slResp, err := m.okxClient.PlaceAlgoOrder(slReq)
+		slResp, err := m.placeWithReprice(position, slReq, prices, adjustedPrices)
 		if err != nil {
 			if tpAlgoId != "" {
 				m.logger.Error("Stop-Loss order failed (TP order %s was placed): %v", tpAlgoId, err)
@@ -639,12 +2234,13 @@ func (m *Manager) placeTPSLOrderWithValidation(position *models.Position, size f
 			slAlgoId := slResp.Data[0].AlgoId
 			m.logger.Info("Stop-Loss order placed successfully for %s (%s), algoId: %s, trigger: %.8f",
 				position.Instrument, position.PositionSide, slAlgoId, adjustedPrices.SlPrice)
+			m.recordOrder(position, models.TPSLLegStopLoss, slAlgoId, slResp.Data[0].AlgoClOrdId, size, adjustedPrices.SlPrice)
 		}
 	} else {
 		m.logger.Error("Skipping Stop-Loss order for %s (%s) - CRITICAL: Manual intervention required!", position.Instrument, position.PositionSide)
 	}
 
-	if skipTP && skipSL {
+	if (skipTP || !placeTP) && (skipSL || !placeSL) {
 		return fmt.Errorf("both TP and SL orders were skipped due to price conditions - manual intervention required")
 	}
 
@@ -652,6 +2248,313 @@ func (m *Manager) placeTPSLOrderWithValidation(position *models.Position, size f
 	return nil
 }
 
+// closeFractionFull 全部平仓的closeFraction值 / closeFraction value that closes the whole position
+const closeFractionFull = "1"
+
+// useCloseFraction 是否以closeFraction下单 / Whether orders use closeFraction
+// OKX仅支持交割和永续合约的closeFraction / OKX supports closeFraction on FUTURES and SWAP only
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//
+// Returns:
+//   - bool: 是否以全部平仓方式下单 / Whether to place full-close orders
+func (m *Manager) useCloseFraction(position *models.Position) bool {
+	if !m.cfg().UseCloseFraction {
+		return false
+	}
+	instType := okx.InstTypeFromID(position.Instrument)
+	return instType == "SWAP" || instType == "FUTURES"
+}
+
+// orderSize 订单覆盖的持仓数量 / Position size covered by an order
+// closeFraction为1的订单覆盖整个持仓，与sz无关
+// An order with closeFraction 1 covers the whole position regardless of sz
+//
+// Parameters:
+//   - order: 算法订单 / Algo order
+//   - position: 订单对应的持仓 / Position the order belongs to
+//
+// Returns:
+//   - decimal.Decimal: 覆盖数量 / Covered size
+//   - error: sz无法解析时返回错误 / Error when sz can't be parsed
+func orderSize(order *okx.AlgoOrder, position *models.Position) (decimal.Decimal, error) {
+	if order.CloseFraction == closeFractionFull {
+		return toDecimal(absSize(position)), nil
+	}
+	return parseDecimal(order.Sz)
+}
+
+// placeCloseFractionOrder 下单全部平仓的止盈止损订单 / Place a full-close TP/SL order
+// OKX每个持仓只允许一个closeFraction订单，因此止盈和止损合并为一个订单；
+// 被跳过的一侧不包含在订单中
+// OKX allows one closeFraction order per position, so TP and SL are combined into one order;
+// a skipped leg is left out of it
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - size: 记录的订单数量 / Order size to record
+//   - prices: 计算得到的TPSL价格 / Calculated TPSL prices
+//   - adjusted: 实际使用的TPSL价格 / TPSL prices in use
+//   - skipTP: 是否跳过止盈 / Whether to skip the TP
+//   - skipSL: 是否跳过止损 / Whether to skip the SL
+//
+// Returns:
+//   - error: 两侧都被跳过或下单失败时返回错误 / Error when both legs are skipped or placement fails
+func (m *Manager) placeCloseFractionOrder(position *models.Position, size float64, prices, adjusted *TPSLPrices, skipTP, skipSL bool) error {
+	if skipTP && skipSL {
+		return fmt.Errorf("both TP and SL orders were skipped due to price conditions - manual intervention required")
+	}
+
+	var req okx.AlgoOrderRequest
+	switch {
+	case skipTP:
+		if m.placesLeg(models.TPSLLegTakeProfit) {
+			m.logger.Warn("Skipping Take-Profit for %s (%s) due to price condition", position.Instrument, position.PositionSide)
+		}
+		req = m.legRequest(position, models.TPSLLegStopLoss, size, adjusted.SlPrice)
+	case skipSL:
+		if m.placesLeg(models.TPSLLegStopLoss) {
+			m.logger.Error("Skipping Stop-Loss for %s (%s) - CRITICAL: Manual intervention required!", position.Instrument, position.PositionSide)
+		}
+		req = m.legRequest(position, models.TPSLLegTakeProfit, size, adjusted.TpPrice)
+	default:
+		req = m.legRequest(position, models.TPSLLegTakeProfit, size, adjusted.TpPrice)
+		sl := m.legRequest(position, models.TPSLLegStopLoss, size, adjusted.SlPrice)
+		req.SlTriggerPx, req.SlOrdPx, req.SlTriggerPxType = sl.SlTriggerPx, sl.SlOrdPx, sl.SlTriggerPxType
+	}
+
+	resp, err := m.placeWithReprice(position, req, prices, adjusted)
+	if err != nil {
+		return fmt.Errorf("close-fraction TP/SL order failed: %w", err)
+	}
+
+	if len(resp.Data) > 0 {
+		algoId := resp.Data[0].AlgoId
+		m.logger.Info("Close-fraction TP/SL order placed for %s (%s), algoId: %s, TP=%s, SL=%s",
+			position.Instrument, position.PositionSide, algoId, req.TpTriggerPx, req.SlTriggerPx)
+		// One order carries both legs; record it once, under the SL when it has one
+		if skipSL {
+			m.recordOrder(position, models.TPSLLegTakeProfit, algoId, resp.Data[0].AlgoClOrdId, size, adjusted.TpPrice)
+		} else {
+			m.recordOrder(position, models.TPSLLegStopLoss, algoId, resp.Data[0].AlgoClOrdId, size, adjusted.SlPrice)
+		}
+	}
+	return nil
+}
+
+// legRequest 构建单侧止盈或止损订单请求 / Build a take-profit or stop-loss order request
+// 订单方向与持仓相反，仅减仓，触发后以市价（或启用UseLimitOrders时以限价）成交；
+// 启用closeFraction时不指定数量，平掉整个持仓
+// The order closes the position (opposite side, reduce-only) at market, or at a limit with
+// UseLimitOrders, once triggered; with closeFraction enabled it carries no size and closes
+// the whole position
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - leg: 止盈或止损 / Take-profit or stop-loss
+//   - size: 订单大小 / Order size
+//   - triggerPrice: 触发价 / Trigger price
+//
+// Returns:
+//   - okx.AlgoOrderRequest: 算法订单请求 / Algo order request
+func (m *Manager) legRequest(position *models.Position, leg models.TPSLLeg, size, triggerPrice float64) okx.AlgoOrderRequest {
+	// Determine order side (opposite of position)
+	orderSide := "buy" // Close short position
+	if m.isLongPosition(position) {
+		orderSide = "sell" // Close long position
+	}
+
+	// Determine trade mode from position
+	tdMode := position.MarginMode.String()
+	if tdMode == "" {
+		tdMode = models.MarginModeCross.String() // Default to cross if not specified
+	}
+
+	format := m.orderFormatFor(position.Instrument)
+	req := okx.AlgoOrderRequest{
+		InstId:     position.Instrument,
+		TdMode:     tdMode,
+		Side:       orderSide,
+		PosSide:    m.orderPosSide(position),
+		OrdType:    "conditional",
+		ReduceOnly: m.reduceOnly(),
+	}
+	if m.useCloseFraction(position) {
+		req.CloseFraction = closeFractionFull
+	} else {
+		req.Sz = format.size(size)
+	}
+	if leg == models.TPSLLegTakeProfit {
+		req.TpTriggerPx = format.price(triggerPrice)
+		req.TpOrdPx = m.orderPrice(position, triggerPrice, format)
+		req.TpTriggerPxType = m.triggerPxType(leg)
+	} else {
+		req.SlTriggerPx = format.price(triggerPrice)
+		req.SlOrdPx = m.orderPrice(position, triggerPrice, format)
+		req.SlTriggerPxType = m.triggerPxType(leg)
+	}
+	return req
+}
+
+// triggerPxType 获取止盈或止损的触发价格类型 / Get the trigger price type of a take-profit or stop-loss
+// 未配置时使用最新成交价（last）/ Uses the last traded price when not configured
+func (m *Manager) triggerPxType(leg models.TPSLLeg) string {
+	pxType := m.cfg().SLTriggerPxType
+	if leg == models.TPSLLegTakeProfit {
+		pxType = m.cfg().TPTriggerPxType
+	}
+	if pxType == "" {
+		return "last"
+	}
+	return pxType
+}
+
+// marketOrderPrice 触发后以市价成交的委托价 / Order price that executes at market once triggered
+const marketOrderPrice = "-1"
+
+// orderPrice 获取止盈或止损触发后的委托价 / Get the order price of a triggered take-profit or stop-loss
+// 未启用UseLimitOrders时以市价成交；启用时为触发价向平仓方向偏移LimitOrderOffsetPct
+// （平多时低于触发价，平空时高于触发价），价格跳空越过限价时订单可能无法成交
+// Executes at market unless UseLimitOrders is set; otherwise the trigger price moved
+// LimitOrderOffsetPct in the closing direction (below the trigger when closing a long, above
+// it when closing a short). The limit order may not fill if price gaps through it
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - triggerPrice: 触发价 / Trigger price
+//   - format: 下单精度 / Order precision
+//
+// Returns:
+//   - string: 委托价，市价时为"-1" / Order price, "-1" for market
+func (m *Manager) orderPrice(position *models.Position, triggerPrice float64, format orderFormat) string {
+	if !m.cfg().UseLimitOrders {
+		return marketOrderPrice
+	}
+	offset := toDecimal(m.cfg().LimitOrderOffsetPct)
+	factor := decimal.NewFromInt(1).Add(offset) // Closing a short buys, accept paying a little more
+	if m.isLongPosition(position) {
+		factor = decimal.NewFromInt(1).Sub(offset) // Closing a long sells, accept a little less
+	}
+	return format.price(toDecimal(triggerPrice).Mul(factor).InexactFloat64())
+}
+
+// reduceOnly 是否以只减仓方式下单 / Whether orders are placed reduce-only
+// 未配置时默认为true；为false时请求中省略reduceOnly字段
+// Defaults to true when unset; when false the reduceOnly field is omitted from requests
+func (m *Manager) reduceOnly() bool {
+	return m.cfg().ReduceOnly == nil || *m.cfg().ReduceOnly
+}
+
+// placeAlgoOrder 下单并记录耗时 / Place an algo order and record its duration
+// 下单前附加配置的标签和客户端订单ID。耗时无论成功与否都记录，以便区分"下单失败"和"下单缓慢"。
+// 客户端订单ID重复且该订单仍在OKX待处理时视为成功：同一订单此前已下单（例如请求在服务端成功但响应丢失后重试）；
+// 订单已不在待处理列表中（已触发或已撤销）时换用新的序号重新下单
+// The configured tag and client order ID are attached first. The duration is recorded whether or
+// not the call succeeds, to tell slow placements apart from failing ones. A rejection for a
+// duplicate client order ID counts as success while that order is still pending on OKX: the same
+// order was placed before, e.g. a request that succeeded server-side was retried after its
+// response was lost. When the order is no longer pending (triggered or cancelled) it is placed
+// again under the next sequence number
+func (m *Manager) placeAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	m.stampOrder(&req, 0)
+	for seq := 1; ; seq++ {
+		start := m.clock.Now()
+		resp, err := m.okxClient.PlaceAlgoOrder(req)
+		m.latency.record(req.InstId, m.clock.Now().Sub(start))
+
+		var orderErr *okx.OrderError
+		if err == nil || req.AlgoClOrdId == "" || !errors.As(err, &orderErr) || !orderErr.DuplicateClientOrderId() {
+			if err == nil {
+				m.ordersPlaced.Add(1)
+			}
+			if err == nil && len(resp.Data) > 0 && resp.Data[0].AlgoClOrdId == "" {
+				resp.Data[0].AlgoClOrdId = req.AlgoClOrdId
+			}
+			return resp, err
+		}
+
+		resp, err = m.resolveDuplicate(req, err)
+		if !errors.Is(err, errDuplicateNotPending) || seq >= clientOrderIdAttempts {
+			return resp, err
+		}
+		m.logger.Warn("Order for %s (%s) with client order ID %s already exists but is not pending, placing it again under a new ID",
+			req.InstId, req.PosSide, req.AlgoClOrdId)
+		m.stampOrder(&req, seq)
+	}
+}
+
+// GetMetrics 获取TPSL指标 / Get TPSL metrics
+// 包含下单延迟（总体及按交易品种）、启动以来OKX接受的算法订单数（按重复客户端订单ID找回的订单不重复计数），
+// 以及最近一次覆盖分析或TPSL检查（含本次下单）后的账户覆盖率
+// Includes placement latency, overall and per instrument, the algo orders OKX accepted since start
+// (an order resolved from a duplicate client order ID is not counted again), and the account
+// coverage ratio after the latest coverage analysis or TPSL check, counting the orders it placed,
+// once one has run
+func (m *Manager) GetMetrics() map[string]interface{} {
+	overall, byInstrument := m.latency.snapshot()
+	metrics := map[string]interface{}{
+		"placement_latency":               overall,
+		"placement_latency_by_instrument": byInstrument,
+		"orders_placed":                   m.ordersPlaced.Load(),
+	}
+	if ratio := m.coverageRatio.Load(); ratio != nil {
+		metrics["account_coverage_ratio"] = *ratio
+	}
+	return metrics
+}
+
+// placeWithReprice 下单，触发价被拒时重新定价并重试一次 / Place an order, repricing and retrying once on a trigger rejection
+// 读取行情与下单之间价格可能已越过触发价，OKX会以特定sCode拒单；
+// 此时重新获取当前价格、重新调整TP/SL价格并重试一次
+// Price may cross the trigger between the ticker read and the order, which OKX rejects with a
+// specific sCode; the current price is then re-fetched, TP/SL re-adjusted and the order retried once
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - req: 止盈或止损订单请求 / Take-profit or stop-loss order request
+//   - prices: 计算得到的TPSL价格 / Calculated TPSL prices
+//   - adjusted: 实际使用的TPSL价格，重试时更新对应的价格 / TPSL prices in use, the retried leg's price is updated
+//
+// Returns:
+//   - *okx.AlgoOrderResponse: 算法订单响应对象 / Algo order response object
+//   - error: 下单失败时返回错误 / Error on placement failure
+func (m *Manager) placeWithReprice(position *models.Position, req okx.AlgoOrderRequest, prices, adjusted *TPSLPrices) (*okx.AlgoOrderResponse, error) {
+	resp, err := m.placeAlgoOrder(req)
+
+	var orderErr *okx.OrderError
+	if err == nil || !errors.As(err, &orderErr) || !orderErr.TriggerPriceRejected() {
+		return resp, err
+	}
+
+	m.logger.Warn("Order for %s (%s) rejected because price moved past the trigger (sCode %s: %s), repricing and retrying once",
+		position.Instrument, position.PositionSide, orderErr.SCode, orderErr.SMsg)
+
+	m.invalidatePrice(position.Instrument) // The cached price is what the rejected trigger was based on
+	currentPrice, priceErr := m.getCurrentMarketPrice(position.Instrument)
+	if priceErr != nil {
+		return nil, fmt.Errorf("%w (reprice failed: %v)", err, priceErr)
+	}
+
+	repriced, _, _ := m.adjustTPSLPricesWithCurrentPrice(position, prices, currentPrice)
+	format := m.orderFormatFor(position.Instrument)
+	if req.TpTriggerPx != "" {
+		req.TpTriggerPx = format.price(repriced.TpPrice)
+		req.TpOrdPx = m.orderPrice(position, repriced.TpPrice, format)
+		adjusted.TpPrice = repriced.TpPrice
+	}
+	if req.SlTriggerPx != "" {
+		req.SlTriggerPx = format.price(repriced.SlPrice)
+		req.SlOrdPx = m.orderPrice(position, repriced.SlPrice, format)
+		adjusted.SlPrice = repriced.SlPrice
+	}
+
+	m.logger.Info("Retrying order for %s (%s) at current price %.8f: TP=%s, SL=%s",
+		position.Instrument, position.PositionSide, currentPrice, req.TpTriggerPx, req.SlTriggerPx)
+
+	return m.placeAlgoOrder(req)
+}
+
 // placeTPSLOrderOriginal 原始的下单逻辑（不验证当前价格）/ Original order placement logic without price validation
 func (m *Manager) placeTPSLOrderOriginal(position *models.Position, size float64, prices *TPSLPrices) error {
 	// This is the fallback method when we can't get current market price
@@ -667,58 +2570,72 @@ func (m *Manager) placeTPSLOrderOriginal(position *models.Position, size float64
 
 	m.logger.Debug("Placing TPSL orders without price validation for %s (%s)", position.Instrument, position.PositionSide)
 
+	if m.useCloseFraction(position) {
+		adjusted := &TPSLPrices{TpPrice: prices.TpPrice, SlPrice: prices.SlPrice}
+		return m.placeCloseFractionOrder(position, size, prices, adjusted,
+			!m.placesLeg(models.TPSLLegTakeProfit), !m.placesLeg(models.TPSLLegStopLoss))
+	}
+
 	// Determine trade mode from position
 	tdMode := position.MarginMode.String()
 	if tdMode == "" {
 		tdMode = models.MarginModeCross.String() // Default to cross if not specified
 	}
 
+	format := m.orderFormatFor(position.Instrument)
+
 	// Place TP
-	tpReq := okx.AlgoOrderRequest{
-		InstId:          position.Instrument,
-		TdMode:          tdMode,
-		Side:            orderSide,
-		PosSide:         position.PositionSide.String(),
-		OrdType:         "conditional",
-		Sz:              formatFloat(size),
-		TpTriggerPx:     formatFloat(prices.TpPrice),
-		TpOrdPx:         "-1",
-		TpTriggerPxType: "last",
-		ReduceOnly:      true,
-	}
-
-	tpResp, err := m.okxClient.PlaceAlgoOrder(tpReq)
-	if err != nil {
-		return fmt.Errorf("Take-Profit order failed: %w", err)
-	}
+	if m.placesLeg(models.TPSLLegTakeProfit) {
+		tpReq := okx.AlgoOrderRequest{
+			InstId:          position.Instrument,
+			TdMode:          tdMode,
+			Side:            orderSide,
+			PosSide:         m.orderPosSide(position),
+			OrdType:         "conditional",
+			Sz:              format.size(size),
+			TpTriggerPx:     format.price(prices.TpPrice),
+			TpOrdPx:         m.orderPrice(position, prices.TpPrice, format),
+			TpTriggerPxType: m.triggerPxType(models.TPSLLegTakeProfit),
+			ReduceOnly:      m.reduceOnly(),
+		}
 
-	var tpAlgoId string
-	if len(tpResp.Data) > 0 {
-		tpAlgoId = tpResp.Data[0].AlgoId
-		m.logger.Info("Take-Profit order placed for %s, algoId: %s", position.Instrument, tpAlgoId)
+		tpResp, err := m.placeAlgoOrder(tpReq)
+		if err != nil {
+			return fmt.Errorf("Take-Profit order failed: %w", err)
+		}
+
+		var tpAlgoId string
+		if len(tpResp.Data) > 0 {
+			tpAlgoId = tpResp.Data[0].AlgoId
+			m.logger.Info("Take-Profit order placed for %s, algoId: %s", position.Instrument, tpAlgoId)
+			m.recordOrder(position, models.TPSLLegTakeProfit, tpAlgoId, tpResp.Data[0].AlgoClOrdId, size, prices.TpPrice)
+		}
 	}
 
 	// Place SL
-	slReq := okx.AlgoOrderRequest{
-		InstId:          position.Instrument,
-		TdMode:          tdMode,
-		Side:            orderSide,
-		PosSide:         position.PositionSide.String(),
-		OrdType:         "conditional",
-		Sz:              formatFloat(size),
-		SlTriggerPx:     formatFloat(prices.SlPrice),
-		SlOrdPx:         "-1",
-		SlTriggerPxType: "last",
-		ReduceOnly:      true,
-	}
-
-	slResp, err := m.okxClient.PlaceAlgoOrder(slReq)
-	if err != nil {
-		return fmt.Errorf("Stop-Loss order failed: %w", err)
-	}
+	if m.placesLeg(models.TPSLLegStopLoss) {
+		slReq := okx.AlgoOrderRequest{
+			InstId:          position.Instrument,
+			TdMode:          tdMode,
+			Side:            orderSide,
+			PosSide:         m.orderPosSide(position),
+			OrdType:         "conditional",
+			Sz:              format.size(size),
+			SlTriggerPx:     format.price(prices.SlPrice),
+			SlOrdPx:         m.orderPrice(position, prices.SlPrice, format),
+			SlTriggerPxType: m.triggerPxType(models.TPSLLegStopLoss),
+			ReduceOnly:      m.reduceOnly(),
+		}
+
+		slResp, err := m.placeAlgoOrder(slReq)
+		if err != nil {
+			return fmt.Errorf("Stop-Loss order failed: %w", err)
+		}
 
-	if len(slResp.Data) > 0 {
-		m.logger.Info("Stop-Loss order placed for %s, algoId: %s", position.Instrument, slResp.Data[0].AlgoId)
+		if len(slResp.Data) > 0 {
+			m.logger.Info("Stop-Loss order placed for %s, algoId: %s", position.Instrument, slResp.Data[0].AlgoId)
+			m.recordOrder(position, models.TPSLLegStopLoss, slResp.Data[0].AlgoId, slResp.Data[0].AlgoClOrdId, size, prices.SlPrice)
+		}
 	}
 
 	return nil
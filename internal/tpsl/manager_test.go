@@ -0,0 +1,3121 @@
+package tpsl
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/alert"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// newTestManager creates a manager whose OKX client talks to a test server using the given handler
+func newTestManager(t *testing.T, handler http.HandlerFunc) *Manager {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return newManagerWithClient(t, okx.New(server.URL, "key", "secret", "pass", 5, 0, false))
+}
+
+// newManagerWithClient creates a manager using the given OKX API implementation
+func newManagerWithClient(t *testing.T, client OKXAPI) *Manager {
+	t.Helper()
+	log, err := logger.New(filepath.Join(t.TempDir(), "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	cfg := &config.TPSLConfig{VolatilityPct: 0.01, ProfitLossRatio: 5.0, PriceBufferPct: 0.001}
+	return New(cfg, client, log)
+}
+
+// mockOKX is an in-memory OKXAPI: placed orders become pending, prices come from last
+// Methods a test does not need fall through to the nil embedded interface and panic
+type mockOKX struct {
+	OKXAPI
+
+	mu      sync.Mutex
+	last    map[string]string // last price by instId
+	pending []okx.AlgoOrder
+	placed  []okx.AlgoOrderRequest
+	amended []string // algoIds of amended orders
+	orders  []okx.OrderRequest
+
+	positions []okx.PositionData // live positions, empty keeps every TPSL size
+}
+
+func (c *mockOKX) GetPendingAlgoOrders(ordType string) (*okx.PendingAlgoOrdersResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &okx.PendingAlgoOrdersResponse{Code: "0", Data: append([]okx.AlgoOrder(nil), c.pending...)}, nil
+}
+
+func (c *mockOKX) PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.placed = append(c.placed, req)
+	algoId := "mock-" + strconv.Itoa(len(c.placed))
+	c.pending = append(c.pending, okx.AlgoOrder{
+		AlgoId:      algoId,
+		InstId:      req.InstId,
+		PosSide:     req.PosSide,
+		Sz:          req.Sz,
+		OrdType:     req.OrdType,
+		State:       "live",
+		TpTriggerPx: req.TpTriggerPx,
+		SlTriggerPx: req.SlTriggerPx,
+	})
+
+	resp := &okx.AlgoOrderResponse{}
+	err := json.Unmarshal([]byte(`{"code":"0","msg":"","data":[{"algoId":"`+algoId+`","sCode":"0"}]}`), resp)
+	return resp, err
+}
+
+func (c *mockOKX) PlaceOrder(req okx.OrderRequest) (*okx.OrderResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.orders = append(c.orders, req)
+	return &okx.OrderResponse{Code: "0", Data: []okx.OrderResult{{OrdId: "ord-" + strconv.Itoa(len(c.orders)), SCode: "0"}}}, nil
+}
+
+func (c *mockOKX) AmendAlgoOrder(instId, algoId, newSz, newTpTrigger, newSlTrigger string) (*okx.AlgoOrderResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.amended = append(c.amended, algoId)
+	for i := range c.pending {
+		if c.pending[i].AlgoId != algoId {
+			continue
+		}
+		if newSz != "" {
+			c.pending[i].Sz = newSz
+		}
+		if newTpTrigger != "" {
+			c.pending[i].TpTriggerPx = newTpTrigger
+		}
+		if newSlTrigger != "" {
+			c.pending[i].SlTriggerPx = newSlTrigger
+		}
+	}
+	return &okx.AlgoOrderResponse{Code: "0"}, nil
+}
+
+func (c *mockOKX) GetPositions() (*okx.PositionsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &okx.PositionsResponse{Code: "0", Data: append([]okx.PositionData(nil), c.positions...)}, nil
+}
+
+func (c *mockOKX) GetTicker(instId string) (*okx.TickerResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &okx.TickerResponse{Code: "0", Data: []okx.TickerData{{InstId: instId, Last: c.last[instId]}}}, nil
+}
+
+func (c *mockOKX) GetMaxAvailSize(instId, tdMode string) (*okx.MaxAvailSizeResponse, error) {
+	return &okx.MaxAvailSizeResponse{Code: "0", Data: []okx.MaxAvailSizeData{{InstId: instId, AvailBuy: "100", AvailSell: "100"}}}, nil
+}
+
+func (c *mockOKX) GetInstruments(instType, instId string) (*okx.InstrumentsResponse, error) {
+	return &okx.InstrumentsResponse{Code: "0"}, nil // No metadata, generic precision
+}
+
+// testPosition returns a 3-contract long BTC swap position
+func testPosition() *models.Position {
+	return &models.Position{
+		Instrument:   "BTC-USDT-SWAP",
+		PositionSide: models.PositionSideLong,
+		PositionSize: 3,
+		AveragePrice: 50000,
+		MarginMode:   models.MarginModeCross,
+	}
+}
+
+// tpslOrder builds a live algo order for the test position
+func tpslOrder(algoId, ordType, sz, tpTrigger, slTrigger string) okx.AlgoOrder {
+	return okx.AlgoOrder{
+		AlgoId:      algoId,
+		InstId:      "BTC-USDT-SWAP",
+		PosSide:     "long",
+		Sz:          sz,
+		OrdType:     ordType,
+		State:       "live",
+		TpTriggerPx: tpTrigger,
+		SlTriggerPx: slTrigger,
+	}
+}
+
+func TestChooseAmendTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		orders      []okx.AlgoOrder
+		expectAmend bool
+	}{
+		{
+			name: "single TP and SL",
+			orders: []okx.AlgoOrder{
+				tpslOrder("tp1", "conditional", "1", "52500", ""),
+				tpslOrder("sl1", "conditional", "1", "", "49500"),
+			},
+			expectAmend: true,
+		},
+		{
+			name: "combined TP/SL order",
+			orders: []okx.AlgoOrder{
+				tpslOrder("both", "conditional", "1", "52500", "49500"),
+			},
+			expectAmend: true,
+		},
+		{
+			name: "stacked SL orders",
+			orders: []okx.AlgoOrder{
+				tpslOrder("tp1", "conditional", "1", "52500", ""),
+				tpslOrder("sl1", "conditional", "1", "", "49500"),
+				tpslOrder("sl2", "conditional", "1", "", "49500"),
+			},
+			expectAmend: false,
+		},
+		{
+			name: "missing TP",
+			orders: []okx.AlgoOrder{
+				tpslOrder("sl1", "conditional", "1", "", "49500"),
+			},
+			expectAmend: false,
+		},
+		{
+			name:        "no orders",
+			orders:      nil,
+			expectAmend: false,
+		},
+	}
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, ok := manager.chooseAmendTargets(testPosition(), tt.orders)
+			if ok != tt.expectAmend {
+				t.Errorf("expected amend=%v, got %v", tt.expectAmend, ok)
+			}
+		})
+	}
+}
+
+func TestIsAmendable(t *testing.T) {
+	tests := []struct {
+		ordType  string
+		expected bool
+	}{
+		{"conditional", true},
+		{"oco", true},
+		{"move_order_stop", false},
+		{"trigger", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ordType, func(t *testing.T) {
+			order := tpslOrder("1", tt.ordType, "1", "52500", "")
+			if got := isAmendable(&order); got != tt.expected {
+				t.Errorf("isAmendable(%s) = %v, want %v", tt.ordType, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLAmendsGrownPosition(t *testing.T) {
+	tests := []struct {
+		name          string
+		amendResponse string
+		expectAmended int
+		expectPlaced  int
+		expectPlaces  int
+	}{
+		{
+			name:          "amend succeeds",
+			amendResponse: `{"code":"0","msg":"","data":[{"algoId":"x","sCode":"0"}]}`,
+			expectAmended: 1,
+			expectPlaced:  0,
+			expectPlaces:  0,
+		},
+		{
+			name:          "amend rejected falls back to placing new",
+			amendResponse: `{"code":"1","msg":"","data":[{"algoId":"x","sCode":"51000","sMsg":"not supported"}]}`,
+			expectAmended: 0,
+			expectPlaced:  1,
+			expectPlaces:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			places := 0
+
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/trade/orders-algo-pending":
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"algoId":"tp1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"1","ordType":"conditional","state":"live","tpTriggerPx":"52500"},
+						{"algoId":"sl1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"1","ordType":"conditional","state":"live","slTriggerPx":"49500"}]}`))
+				case "/api/v5/trade/amend-algos":
+					w.Write([]byte(tt.amendResponse))
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+				case "/api/v5/trade/order-algo":
+					mu.Lock()
+					places++
+					mu.Unlock()
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.OrdersAmended != tt.expectAmended {
+				t.Errorf("expected %d amended, got %d", tt.expectAmended, summary.OrdersAmended)
+			}
+			if summary.OrdersPlaced != tt.expectPlaced {
+				t.Errorf("expected %d placed, got %d", tt.expectPlaced, summary.OrdersPlaced)
+			}
+			if places != tt.expectPlaces {
+				t.Errorf("expected %d order-algo requests, got %d", tt.expectPlaces, places)
+			}
+		})
+	}
+}
+
+func TestDetectPositionModeDecidesPosSide(t *testing.T) {
+	tests := []struct {
+		name          string
+		posMode       string
+		positionSide  models.PositionSide
+		expectPosSide string
+	}{
+		{"hedge mode long", "long_short_mode", models.PositionSideLong, "long"},
+		{"hedge mode short", "long_short_mode", models.PositionSideShort, "short"},
+		{"net mode overrides position side", "net_mode", models.PositionSideLong, ""},
+		{"net mode net position", "net_mode", models.PositionSideNet, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/account/config" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				w.Write([]byte(`{"code":"0","msg":"","data":[{"uid":"1","posMode":"` + tt.posMode + `"}]}`))
+			})
+
+			if err := manager.DetectPositionMode(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if manager.posMode != tt.posMode {
+				t.Errorf("expected cached mode %s, got %s", tt.posMode, manager.posMode)
+			}
+
+			position := testPosition()
+			position.PositionSide = tt.positionSide
+			if got := manager.orderPosSide(position); got != tt.expectPosSide {
+				t.Errorf("expected posSide %q, got %q", tt.expectPosSide, got)
+			}
+		})
+	}
+}
+
+func TestDetectPositionModeUnknown(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"uid":"1","posMode":"something_else"}]}`))
+	})
+
+	if err := manager.DetectPositionMode(); err == nil {
+		t.Error("expected error for unknown position mode")
+	}
+	if manager.posMode != "" {
+		t.Errorf("unknown mode must not be cached, got %s", manager.posMode)
+	}
+
+	// Without a detected mode posSide is inferred from the position
+	if got := manager.orderPosSide(testPosition()); got != "long" {
+		t.Errorf("expected inferred posSide long, got %q", got)
+	}
+}
+
+func TestPlaceTPSLNetModeOmitsPosSide(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       float64
+		expectSide string
+	}{
+		{"net long", 2, "sell"},
+		{"net short", -2, "buy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []map[string]interface{}
+
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+				case "/api/v5/trade/order-algo":
+					var req map[string]interface{}
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Errorf("failed to decode request: %v", err)
+					}
+					mu.Lock()
+					requests = append(requests, req)
+					mu.Unlock()
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+
+			position := testPosition()
+			position.PositionSide = models.PositionSideNet
+			position.PositionSize = tt.size
+
+			prices, err := manager.calculateTPSLPrices(position)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := manager.placeTPSLOrderWithValidation(position, absSize(position), prices); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(requests) != 2 {
+				t.Fatalf("expected 2 order requests, got %d", len(requests))
+			}
+			for _, req := range requests {
+				if _, ok := req["posSide"]; ok {
+					t.Errorf("net mode request should omit posSide: %v", req)
+				}
+				if req["side"] != tt.expectSide {
+					t.Errorf("expected side %s, got %v", tt.expectSide, req["side"])
+				}
+				if req["sz"] != "2" {
+					t.Errorf("expected sz 2, got %v", req["sz"])
+				}
+				if req["reduceOnly"] != true {
+					t.Errorf("expected reduceOnly, got %v", req["reduceOnly"])
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeCoverageNetShort(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	position := testPosition()
+	position.PositionSide = models.PositionSideNet
+	position.PositionSize = -3
+
+	if got := manager.analyzeCoverage(position, nil).UncoveredSize; got != 3 {
+		t.Errorf("expected uncovered size 3 for uncovered net short, got %f", got)
+	}
+}
+
+func TestAnalyzeCoverageMatchesPlacement(t *testing.T) {
+	lastPrices := map[string]string{"BTC-USDT-SWAP": "50000", "ETH-USDT-SWAP": "3000", "SOL-USDT-SWAP": "100"}
+
+	var mu sync.Mutex
+	placed := map[string][]string{} // instrument -> sizes of placed orders
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v5/trade/orders-algo-pending":
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"algoId":"tp1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","tpTriggerPx":"52500"},
+				{"algoId":"sl1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","slTriggerPx":"49500"},
+				{"algoId":"tp2","instId":"ETH-USDT-SWAP","posSide":"long","sz":"1","ordType":"conditional","state":"live","tpTriggerPx":"3150"},
+				{"algoId":"tp3","instId":"ETH-USDT-SWAP","posSide":"long","sz":"1","ordType":"conditional","state":"live","tpTriggerPx":"3200"},
+				{"algoId":"sl2","instId":"ETH-USDT-SWAP","posSide":"long","sz":"1","ordType":"conditional","state":"live","slTriggerPx":"2970"}]}`))
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			instId := r.URL.Query().Get("instId")
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"` + instId + `","last":"` + lastPrices[instId] + `"}]}`))
+		case "/api/v5/trade/order-algo":
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode order request: %v", err)
+			}
+			placed[req.InstId] = append(placed[req.InstId], req.Sz)
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	manager.config.ExcludeInstruments = []string{"DOGE-USDT-SWAP"}
+
+	var positions []*models.Position
+	for _, p := range []struct {
+		instId string
+		entry  float64
+	}{
+		{"BTC-USDT-SWAP", 50000},
+		{"ETH-USDT-SWAP", 3000},
+		{"SOL-USDT-SWAP", 100},
+		{"DOGE-USDT-SWAP", 0.1},
+	} {
+		position := testPosition()
+		position.Instrument = p.instId
+		position.AveragePrice = p.entry
+		positions = append(positions, position)
+	}
+
+	coverage, err := manager.AnalyzeCoverage(positions)
+	if err != nil {
+		t.Fatalf("AnalyzeCoverage() error = %v", err)
+	}
+	if len(placed) != 0 {
+		t.Fatalf("AnalyzeCoverage must not place orders, placed %v", placed)
+	}
+
+	expected := []PositionCoverage{
+		{Instrument: "BTC-USDT-SWAP", PositionSide: "long", Size: 3, CoveredSize: 3, UncoveredSize: 0, TPCount: 1, SLCount: 1, Status: CoverageCovered},
+		{Instrument: "ETH-USDT-SWAP", PositionSide: "long", Size: 3, CoveredSize: 1, UncoveredSize: 2, TPCount: 2, SLCount: 1, Status: CoveragePartial},
+		{Instrument: "SOL-USDT-SWAP", PositionSide: "long", Size: 3, CoveredSize: 0, UncoveredSize: 3, TPCount: 0, SLCount: 0, Status: CoverageUncovered},
+		{Instrument: "DOGE-USDT-SWAP", PositionSide: "long", Size: 3, Status: CoverageSkipped, SkipReason: "instrument is in exclude_instruments"},
+	}
+	if len(coverage) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(coverage))
+	}
+	for i := range expected {
+		if coverage[i] != expected[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, expected[i], coverage[i])
+		}
+	}
+
+	summary, err := manager.AnalyzeAndPlaceTPSL(positions)
+	if err != nil {
+		t.Fatalf("AnalyzeAndPlaceTPSL() error = %v", err)
+	}
+	if summary.FullyCovered != 1 || summary.PartiallyCovered != 1 || summary.NotCovered != 1 || summary.Skipped != 1 {
+		t.Errorf("summary does not match coverage breakdown: %+v", summary)
+	}
+
+	// Each uncovered position gets a TP and an SL sized to its uncovered size, nothing else is touched
+	for _, entry := range coverage {
+		var want []string
+		if entry.UncoveredSize > 0 && entry.Status != CoverageSkipped {
+			size := formatFloat(entry.UncoveredSize)
+			want = []string{size, size}
+		}
+		if strings.Join(placed[entry.Instrument], ",") != strings.Join(want, ",") {
+			t.Errorf("%s (%s): expected placed sizes %v, got %v", entry.Instrument, entry.Status, want, placed[entry.Instrument])
+		}
+	}
+}
+
+func TestAdjustTPSLPricesWithCurrentPriceBuffer(t *testing.T) {
+	tests := []struct {
+		name         string
+		side         models.PositionSide
+		currentPrice float64
+		expected     TPSLPrices
+	}{
+		{
+			name:         "long past TP",
+			side:         models.PositionSideLong,
+			currentPrice: 53000,
+			expected:     TPSLPrices{TpPrice: 53000 * 1.02, SlPrice: 49500},
+		},
+		{
+			name:         "long past SL",
+			side:         models.PositionSideLong,
+			currentPrice: 49000,
+			expected:     TPSLPrices{TpPrice: 52500, SlPrice: 49000 * 0.98},
+		},
+		{
+			name:         "short past TP",
+			side:         models.PositionSideShort,
+			currentPrice: 47000,
+			expected:     TPSLPrices{TpPrice: 47000 * 0.98, SlPrice: 50500},
+		},
+		{
+			name:         "short past SL",
+			side:         models.PositionSideShort,
+			currentPrice: 51000,
+			expected:     TPSLPrices{TpPrice: 47500, SlPrice: 51000 * 1.02},
+		},
+	}
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+	manager.config.PriceBufferPct = 0.02
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := testPosition()
+			position.PositionSide = tt.side
+
+			prices, err := manager.calculateTPSLPrices(position)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			adjusted, _, _ := manager.adjustTPSLPricesWithCurrentPrice(position, prices, tt.currentPrice)
+			if math.Abs(adjusted.TpPrice-tt.expected.TpPrice) > 1e-6 {
+				t.Errorf("expected TP %.8f, got %.8f", tt.expected.TpPrice, adjusted.TpPrice)
+			}
+			if math.Abs(adjusted.SlPrice-tt.expected.SlPrice) > 1e-6 {
+				t.Errorf("expected SL %.8f, got %.8f", tt.expected.SlPrice, adjusted.SlPrice)
+			}
+		})
+	}
+}
+
+func TestClampToAvailableSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		instId   string
+		side     models.PositionSide
+		size     float64
+		expected float64
+	}{
+		{"long within live position", "BTC-USDT-SWAP", models.PositionSideLong, 1, 1},
+		{"long clamped to live position despite availSell 0", "BTC-USDT-SWAP", models.PositionSideLong, 3, 2},
+		{"short clamped to live position", "BTC-USDT-SWAP", models.PositionSideShort, 3, 0.5},
+		{"net short clamped to the absolute position", "ETH-USDT-SWAP", models.PositionSideNet, 3, 0.5},
+		{"no live position keeps the size", "SOL-USDT-SWAP", models.PositionSideLong, 3, 3},
+		{"margin with nothing available keeps the size", "BTC-USDT", models.PositionSideLong, 3, 3},
+		{"margin clamped to availBuy", "BTC-USDT", models.PositionSideShort, 3, 1},
+	}
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"2","mgnMode":"cross"},
+				{"instId":"BTC-USDT-SWAP","posSide":"short","pos":"0.5","mgnMode":"cross"},
+				{"instId":"ETH-USDT-SWAP","posSide":"net","pos":"-0.5","mgnMode":"cross"}]}`))
+		case "/api/v5/account/max-avail-size":
+			// Margin-dependent for derivatives, so only margin positions may read it
+			if r.URL.Query().Get("instId") != "BTC-USDT" {
+				t.Errorf("unexpected max-avail-size query for %s", r.URL.Query().Get("instId"))
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT","availBuy":"1","availSell":"0"}]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := testPosition()
+			position.Instrument = tt.instId
+			position.PositionSide = tt.side
+
+			if size := manager.clampToAvailableSize(position, tt.size); size != tt.expected {
+				t.Errorf("expected size %.8f, got %.8f", tt.expected, size)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLInstrumentFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		include       []string
+		exclude       []string
+		expectChecked int
+		expectSkipped int
+	}{
+		{
+			name:          "include only",
+			include:       []string{"BTC-USDT-SWAP"},
+			expectChecked: 1,
+			expectSkipped: 2,
+		},
+		{
+			name:          "exclude only",
+			exclude:       []string{"ETH-USDT-SWAP"},
+			expectChecked: 2,
+			expectSkipped: 1,
+		},
+		{
+			name:          "both set, exclude wins",
+			include:       []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP"},
+			exclude:       []string{"ETH-USDT-SWAP"},
+			expectChecked: 1,
+			expectSkipped: 2,
+		},
+		{
+			name:          "neither set",
+			expectChecked: 3,
+			expectSkipped: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every position is fully covered by a combined TP/SL order so no placement happens
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/trade/orders-algo-pending" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				w.Write([]byte(`{"code":"0","msg":"","data":[
+					{"algoId":"1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","tpTriggerPx":"1","slTriggerPx":"1"},
+					{"algoId":"2","instId":"ETH-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","tpTriggerPx":"1","slTriggerPx":"1"},
+					{"algoId":"3","instId":"SOL-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","tpTriggerPx":"1","slTriggerPx":"1"}]}`))
+			})
+			manager.config.IncludeInstruments = tt.include
+			manager.config.ExcludeInstruments = tt.exclude
+
+			var positions []*models.Position
+			for _, instId := range []string{"BTC-USDT-SWAP", "ETH-USDT-SWAP", "SOL-USDT-SWAP"} {
+				position := testPosition()
+				position.Instrument = instId
+				positions = append(positions, position)
+			}
+
+			summary, err := manager.AnalyzeAndPlaceTPSL(positions)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.TotalChecked != tt.expectChecked {
+				t.Errorf("expected %d checked, got %d", tt.expectChecked, summary.TotalChecked)
+			}
+			if summary.Skipped != tt.expectSkipped {
+				t.Errorf("expected %d skipped, got %d", tt.expectSkipped, summary.Skipped)
+			}
+		})
+	}
+}
+
+func TestCalculateTPSLPricesRiskMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		instId     string
+		instrument string
+		size       float64
+		entry      float64
+		// dollarRisk computes the USD loss of a move of distance from entry for this instrument
+		dollarRisk func(size, distance, entry float64) float64
+	}{
+		{
+			name:       "linear BTC swap",
+			instId:     "BTC-USDT-SWAP",
+			instrument: `{"instType":"SWAP","instId":"BTC-USDT-SWAP","ctVal":"0.01","ctMult":"1","ctValCcy":"BTC","ctType":"linear"}`,
+			size:       5,
+			entry:      50000,
+			dollarRisk: func(size, distance, entry float64) float64 { return size * 0.01 * distance },
+		},
+		{
+			name:       "inverse BTC swap",
+			instId:     "BTC-USD-SWAP",
+			instrument: `{"instType":"SWAP","instId":"BTC-USD-SWAP","ctVal":"100","ctMult":"1","ctValCcy":"USD","ctType":"inverse"}`,
+			size:       20,
+			entry:      50000,
+			dollarRisk: func(size, distance, entry float64) float64 { return size * 100 * distance / entry },
+		},
+		{
+			name:       "linear ETH swap in net short",
+			instId:     "ETH-USDT-SWAP",
+			instrument: `{"instType":"SWAP","instId":"ETH-USDT-SWAP","ctVal":"0.1","ctMult":"1","ctValCcy":"ETH","ctType":"linear"}`,
+			size:       -3,
+			entry:      3000,
+			dollarRisk: func(size, distance, entry float64) float64 { return math.Abs(size) * 0.1 * distance },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lookups int32
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/public/instruments" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				if r.URL.Query().Get("instType") != "SWAP" || r.URL.Query().Get("instId") != tt.instId {
+					t.Errorf("unexpected query: %s", r.URL.RawQuery)
+				}
+				atomic.AddInt32(&lookups, 1)
+				w.Write([]byte(`{"code":"0","msg":"","data":[` + tt.instrument + `]}`))
+			})
+			manager.config.SLMode = "risk"
+			manager.config.RiskPerTradeUSD = 50
+
+			position := testPosition()
+			position.Instrument = tt.instId
+			position.PositionSize = tt.size
+			position.AveragePrice = tt.entry
+			if tt.size < 0 {
+				position.PositionSide = models.PositionSideNet
+			}
+
+			prices, err := manager.calculateTPSLPrices(position)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			slDistance := math.Abs(prices.SlPrice - tt.entry)
+			if risk := tt.dollarRisk(tt.size, slDistance, tt.entry); math.Abs(risk-50) > 1e-6 {
+				t.Errorf("expected stop to risk $50, got $%.6f (SL distance %.8f)", risk, slDistance)
+			}
+			if tpDistance := math.Abs(prices.TpPrice - tt.entry); math.Abs(tpDistance-slDistance*5) > 1e-6 {
+				t.Errorf("expected TP distance %.8f, got %.8f", slDistance*5, tpDistance)
+			}
+
+			// Instrument metadata is cached after the first lookup
+			if _, err := manager.calculateTPSLPrices(position); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := atomic.LoadInt32(&lookups); got != 1 {
+				t.Errorf("expected 1 instrument lookup, got %d", got)
+			}
+		})
+	}
+}
+
+func TestCalculateTPSLPricesLiquidationClamp(t *testing.T) {
+	tests := []struct {
+		name        string
+		side        models.PositionSide
+		liqPx       float64
+		expectSL    float64
+		expectAlert bool
+		expectError bool
+	}{
+		{"long naive SL below liquidation", models.PositionSideLong, 48000, 48240, true, false},
+		{"long SL inside liquidation", models.PositionSideLong, 45000, 47500, false, false},
+		{"long liquidation unknown", models.PositionSideLong, 0, 47500, false, false},
+		{"short naive SL above liquidation", models.PositionSideShort, 52000, 51740, true, false},
+		{"long liquidation too close to entry", models.PositionSideLong, 49900, 0, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request: %s", r.URL.Path)
+			})
+			manager.config.VolatilityPct = 0.05
+			manager.config.LiqBufferPct = 0.005
+			alerter := alert.New(manager.logger, time.Minute)
+			manager.SetAlerter(alerter)
+
+			position := testPosition()
+			position.PositionSide = tt.side
+			position.LiqPx = tt.liqPx
+
+			prices, err := manager.calculateTPSLPrices(position)
+			if alerter.IsActive(liquidationAlertKey(position)) != tt.expectAlert {
+				t.Errorf("expected liquidation alert active=%v", tt.expectAlert)
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got SL=%.8f", prices.SlPrice)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if prices.SlPrice != tt.expectSL {
+				t.Errorf("expected SL %.8f, got %.8f", tt.expectSL, prices.SlPrice)
+			}
+
+			// TP keeps its distance from entry
+			if tpDistance := math.Abs(prices.TpPrice - 50000); tpDistance != 12500 {
+				t.Errorf("expected TP distance 12500, got %.8f", tpDistance)
+			}
+		})
+	}
+}
+
+func TestValidateTPSLDirection(t *testing.T) {
+	tests := []struct {
+		name     string
+		isLong   bool
+		prices   TPSLPrices
+		errorMsg string
+	}{
+		{"valid long", true, TPSLPrices{TpPrice: 105, SlPrice: 99}, ""},
+		{"valid short", false, TPSLPrices{TpPrice: 95, SlPrice: 101}, ""},
+		{"long SL above entry", true, TPSLPrices{TpPrice: 105, SlPrice: 101}, "long stop-loss 101.00000000 must be below entry"},
+		{"long SL at entry", true, TPSLPrices{TpPrice: 105, SlPrice: 100}, "long stop-loss 100.00000000 must be below entry"},
+		{"long TP below entry", true, TPSLPrices{TpPrice: 95, SlPrice: 99}, "long take-profit 95.00000000 must be above entry"},
+		{"short SL below entry", false, TPSLPrices{TpPrice: 95, SlPrice: 99}, "short stop-loss 99.00000000 must be above entry"},
+		{"short TP above entry", false, TPSLPrices{TpPrice: 105, SlPrice: 101}, "short take-profit 105.00000000 must be below entry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTPSLDirection(tt.isLong, 100, &tt.prices)
+			if tt.errorMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error containing '%s', got: %v", tt.errorMsg, err)
+			}
+		})
+	}
+}
+
+func TestCalculateTPSLPricesRejectsInvertedConfig(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+	manager.config.ProfitLossRatio = -5.0
+
+	_, err := manager.calculateTPSLPrices(testPosition())
+	if err == nil {
+		t.Fatal("expected error for negative profit-loss ratio")
+	}
+	if !strings.Contains(err.Error(), "take-profit") {
+		t.Errorf("expected take-profit direction error, got: %v", err)
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLReplacesExpiredOrders(t *testing.T) {
+	var mu sync.Mutex
+	var pending []string // pending order JSON returned by the server
+	var cancelled []string
+	placed := 0
+	rejectPlacements := false
+	var events []string // "place" and "cancel" in the order they reached the exchange
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v5/trade/orders-algo-pending":
+			w.Write([]byte(`{"code":"0","msg":"","data":[` + strings.Join(pending, ",") + `]}`))
+		case "/api/v5/trade/cancel-algos":
+			var req []map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode cancel request: %v", err)
+			}
+			for _, o := range req {
+				cancelled = append(cancelled, o["algoId"])
+				for i, order := range pending {
+					if strings.Contains(order, `"algoId":"`+o["algoId"]+`"`) {
+						pending = append(pending[:i], pending[i+1:]...)
+						break
+					}
+				}
+			}
+			events = append(events, "cancel")
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+		case "/api/v5/trade/order-algo":
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode order request: %v", err)
+			}
+			if rejectPlacements {
+				w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"","sCode":"51008","sMsg":"Insufficient margin"}]}`))
+				return
+			}
+			placed++
+			events = append(events, "place")
+			algoId := "algo-" + strconv.Itoa(placed)
+			pending = append(pending, `{"algoId":"`+algoId+`","instId":"BTC-USDT-SWAP","posSide":"long","sz":"`+req.Sz+
+				`","ordType":"conditional","state":"live","tpTriggerPx":"`+req.TpTriggerPx+`","slTriggerPx":"`+req.SlTriggerPx+`"}`)
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"` + algoId + `","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	manager.SetStorage(db)
+	manager.config.OrderMaxAgeHours = 24
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	manager.SetClock(fake)
+
+	run := func() *CoverageSummary {
+		t.Helper()
+		summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return summary
+	}
+
+	// First cycle places and records a TP and an SL
+	if summary := run(); summary.OrdersPlaced != 1 || placed != 2 {
+		t.Fatalf("expected initial placement of 2 orders, got placed=%d requests=%d", summary.OrdersPlaced, placed)
+	}
+
+	// Before the TTL the orders are left alone
+	fake.Advance(23 * time.Hour)
+	if summary := run(); summary.OrdersReplaced != 0 || summary.FullyCovered != 1 {
+		t.Errorf("expected no replacement before TTL, got %+v", summary)
+	}
+
+	// Past the TTL both orders are cancelled and placed again
+	fake.Advance(2 * time.Hour)
+	summary := run()
+	if summary.OrdersReplaced != 2 || summary.OrdersPlaced != 1 {
+		t.Errorf("expected 2 replaced and 1 placement, got %+v", summary)
+	}
+	if len(cancelled) != 2 || cancelled[0] != "algo-1" || cancelled[1] != "algo-2" {
+		t.Errorf("expected algo-1 and algo-2 cancelled, got %v", cancelled)
+	}
+	if placed != 4 {
+		t.Errorf("expected 4 order-algo requests, got %d", placed)
+	}
+	// The replacements are placed before the expired orders are cancelled
+	if got := strings.Join(events, ","); got != "place,place,place,place,cancel" {
+		t.Errorf("expected placements before the cancel, got %s", got)
+	}
+
+	live, err := db.GetLiveTPSLOrders()
+	if err != nil {
+		t.Fatalf("failed to load records: %v", err)
+	}
+	if _, ok := live["algo-1"]; ok || len(live) != 2 {
+		t.Errorf("expected only replacement orders to be live, got %v", live)
+	}
+	if !live["algo-3"].PlacedAt.Equal(fake.Now()) {
+		t.Errorf("expected replacement placed at %v, got %v", fake.Now(), live["algo-3"].PlacedAt)
+	}
+
+	// When the replacement fails the expired orders stay, the position keeps its protection
+	fake.Advance(25 * time.Hour)
+	rejectPlacements = true
+	summary = run()
+	if summary.OrdersReplaced != 0 || summary.PlacementFailures != 1 {
+		t.Errorf("expected no replacement and 1 failure, got %+v", summary)
+	}
+	if len(cancelled) != 2 || len(pending) != 2 {
+		t.Errorf("expected the expired orders kept, got cancelled %v and %d pending", cancelled, len(pending))
+	}
+}
+
+func TestAnalyzeCoverageDecimalPrecision(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	position := testPosition()
+	position.PositionSize = 1.1
+
+	// 1.1 - 1.0 in float64 is 0.10000000000000009, not 0.1
+	if float := position.PositionSize - 1.0; float == 0.1 {
+		t.Fatalf("expected float subtraction to be inexact, got %v", float)
+	}
+	orders := []okx.AlgoOrder{
+		tpslOrder("tp1", "conditional", "1", "52500", ""),
+		tpslOrder("sl1", "conditional", "1", "", "49500"),
+	}
+	if uncovered := manager.analyzeCoverage(position, orders).UncoveredSize; uncovered != 0.1 {
+		t.Errorf("expected uncovered size exactly 0.1, got %v", uncovered)
+	}
+
+	// A size below the old 0.000001 epsilon is still uncovered
+	position.PositionSize = 0.0000005
+	if uncovered := manager.analyzeCoverage(position, nil).UncoveredSize; uncovered != 0.0000005 {
+		t.Errorf("expected uncovered size 0.0000005, got %v", uncovered)
+	}
+
+	// Fully covered is exactly zero
+	position.PositionSize = 1
+	if uncovered := manager.analyzeCoverage(position, orders).UncoveredSize; uncovered != 0 {
+		t.Errorf("expected fully covered, got uncovered %v", uncovered)
+	}
+}
+
+func TestCalculateTPSLPricesDecimalPrecision(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	position := testPosition()
+	position.AveragePrice = 0.1
+
+	// In float64, 0.1 + 0.1*0.01*5 is 0.10500000000000001, so a last price of
+	// 0.105 would not register as having reached the take-profit
+	entry, pct, ratio := position.AveragePrice, manager.config.VolatilityPct, manager.config.ProfitLossRatio
+	floatTP := entry + entry*pct*ratio
+	if 0.105 >= floatTP {
+		t.Fatalf("expected float take-profit above 0.105, got %v", floatTP)
+	}
+
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if prices.TpPrice != 0.105 || prices.SlPrice != 0.099 {
+		t.Errorf("expected TP 0.105 and SL 0.099, got TP %v and SL %v", prices.TpPrice, prices.SlPrice)
+	}
+	if got := formatFloat(prices.TpPrice); got != "0.105" {
+		t.Errorf("expected TP formatted as 0.105, got %s", got)
+	}
+
+	// Price exactly at TP counts as reached, so TP moves above the current price
+	adjusted, _, _ := manager.adjustTPSLPricesWithCurrentPrice(position, prices, 0.105)
+	if adjusted.TpPrice <= 0.105 {
+		t.Errorf("expected TP adjusted above 0.105, got %v", adjusted.TpPrice)
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLMinUncoveredFraction(t *testing.T) {
+	tests := []struct {
+		name          string
+		coveredSize   string
+		expectIgnored int
+		expectAmended int
+	}{
+		{"residual just below threshold", "98.1", 1, 0},
+		{"residual exactly at threshold", "98", 0, 1},
+		{"residual just above threshold", "97.9", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var amends int32
+
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/trade/orders-algo-pending":
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"algoId":"tp1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"` + tt.coveredSize + `","ordType":"conditional","state":"live","tpTriggerPx":"52500"},
+						{"algoId":"sl1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"` + tt.coveredSize + `","ordType":"conditional","state":"live","slTriggerPx":"49500"}]}`))
+				case "/api/v5/trade/amend-algos":
+					atomic.AddInt32(&amends, 1)
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"x","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+			manager.config.MinUncoveredFraction = 0.02
+
+			position := testPosition()
+			position.PositionSize = 100
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.ResidualsIgnored != tt.expectIgnored {
+				t.Errorf("expected %d ignored residuals, got %d", tt.expectIgnored, summary.ResidualsIgnored)
+			}
+			if summary.OrdersAmended != tt.expectAmended {
+				t.Errorf("expected %d amended, got %d", tt.expectAmended, summary.OrdersAmended)
+			}
+			if tt.expectIgnored > 0 && atomic.LoadInt32(&amends) != 0 {
+				t.Errorf("ignored residual must not touch orders, got %d amend requests", amends)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLResidualAction(t *testing.T) {
+	tests := []struct {
+		name          string
+		action        string
+		expectClosed  int
+		expectIgnored int
+	}{
+		{"ignore leaves the residual", "ignore", 0, 1},
+		{"close flattens the residual", "close", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockOKX{
+				last: map[string]string{"BTC-USDT-SWAP": "50000"},
+				pending: []okx.AlgoOrder{
+					tpslOrder("tp1", "conditional", "98.1", "52500", ""),
+					tpslOrder("sl1", "conditional", "98.1", "", "49500"),
+				},
+			}
+			manager := newManagerWithClient(t, client)
+			manager.config.MinUncoveredFraction = 0.02
+			manager.config.ResidualAction = tt.action
+
+			position := testPosition()
+			position.PositionSize = 100
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.ResidualsClosed != tt.expectClosed || summary.ResidualsIgnored != tt.expectIgnored {
+				t.Errorf("expected %d closed and %d ignored, got %+v", tt.expectClosed, tt.expectIgnored, summary)
+			}
+			// The protected portion is never touched
+			if len(client.placed) != 0 || len(client.amended) != 0 {
+				t.Errorf("expected no TPSL placed or amended, got %d placed and %d amended", len(client.placed), len(client.amended))
+			}
+			if len(client.orders) != tt.expectClosed {
+				t.Fatalf("expected %d market orders, got %+v", tt.expectClosed, client.orders)
+			}
+			if tt.expectClosed == 0 {
+				return
+			}
+			order := client.orders[0]
+			if order.OrdType != "market" || !order.ReduceOnly || order.Side != "sell" || order.PosSide != "long" || order.Sz != "1.9" {
+				t.Errorf("expected a reduce-only market sell of 1.9, got %+v", order)
+			}
+		})
+	}
+}
+
+func TestPlaceTPSLRetriesWithRepriceOnTriggerReject(t *testing.T) {
+	var mu sync.Mutex
+	var tpTriggers []string
+	tickerCalls := 0
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			// Price rallies past the TP between the first ticker read and the order
+			tickerCalls++
+			last := "50000"
+			if tickerCalls > 1 {
+				last = "53000"
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"` + last + `"}]}`))
+		case "/api/v5/trade/order-algo":
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			if req.TpTriggerPx != "" {
+				tpTriggers = append(tpTriggers, req.TpTriggerPx)
+				if len(tpTriggers) == 1 {
+					w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"","sCode":"51279","sMsg":"TP trigger price cannot be lower than the last price"}]}`))
+					return
+				}
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	position := testPosition()
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+		t.Fatalf("expected retry to succeed, got: %v", err)
+	}
+
+	if len(tpTriggers) != 2 {
+		t.Fatalf("expected TP placed twice, got %v", tpTriggers)
+	}
+	if tpTriggers[0] != "52500" {
+		t.Errorf("expected first TP at 52500, got %s", tpTriggers[0])
+	}
+	// Repriced above the new last price by the 0.1% buffer
+	if tpTriggers[1] != "53053" {
+		t.Errorf("expected repriced TP 53053, got %s", tpTriggers[1])
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLAlertsUnpairedCoverage(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/trade/orders-algo-pending":
+			w.Write([]byte(`{"code":"0","msg":"","data":[
+				{"algoId":"sl1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","slTriggerPx":"49500"},
+				{"algoId":"tp2","instId":"ETH-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","tpTriggerPx":"3150"},
+				{"algoId":"tp3","instId":"SOL-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","tpTriggerPx":"105"},
+				{"algoId":"sl3","instId":"SOL-USDT-SWAP","posSide":"long","sz":"3","ordType":"conditional","state":"live","slTriggerPx":"99"}]}`))
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"last":"0"}]}`))
+		case "/api/v5/trade/order-algo":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	logPath := filepath.Join(t.TempDir(), "alert.log")
+	alertLog, err := logger.New(logPath, logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { alertLog.Close() })
+	alerter := alert.New(alertLog, time.Hour)
+	manager.SetAlerter(alerter)
+
+	slOnly := testPosition()
+	tpOnly := testPosition()
+	tpOnly.Instrument, tpOnly.AveragePrice = "ETH-USDT-SWAP", 3000
+	paired := testPosition()
+	paired.Instrument, paired.AveragePrice = "SOL-USDT-SWAP", 100
+	positions := []*models.Position{slOnly, tpOnly, paired}
+
+	// Run twice: a persistent condition is counted every run but alerted once
+	for run := 0; run < 2; run++ {
+		summary, err := manager.AnalyzeAndPlaceTPSL(positions)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if summary.UnpairedCoverage != 2 {
+			t.Errorf("run %d: expected 2 unpaired positions, got %d", run, summary.UnpairedCoverage)
+		}
+	}
+
+	for _, tt := range []struct {
+		position *models.Position
+		message  string
+	}{
+		{slOnly, "has SL order sl1 (size 3) but no TP order"},
+		{tpOnly, "has TP order tp2 (size 3) but no SL order"},
+	} {
+		if !alerter.IsActive(unpairedAlertKey(tt.position)) {
+			t.Errorf("expected unpaired alert for %s", tt.position.Instrument)
+		}
+		data, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatalf("failed to read alert log: %v", err)
+		}
+		if n := strings.Count(string(data), tt.message); n != 1 {
+			t.Errorf("expected one alert %q, got %d", tt.message, n)
+		}
+	}
+	if alerter.IsActive(unpairedAlertKey(paired)) {
+		t.Error("paired position must not alert")
+	}
+}
+
+func TestUnpairedOrder(t *testing.T) {
+	tests := []struct {
+		name           string
+		orders         []okx.AlgoOrder
+		expectUnpaired bool
+		expectLone     string
+		expectMissing  models.TPSLLeg
+	}{
+		{"no orders", nil, false, "", ""},
+		{"paired TP and SL", []okx.AlgoOrder{
+			tpslOrder("tp1", "conditional", "3", "52500", ""),
+			tpslOrder("sl1", "conditional", "3", "", "49500"),
+		}, false, "", ""},
+		{"combined order", []okx.AlgoOrder{
+			tpslOrder("oco1", "oco", "3", "52500", "49500"),
+		}, false, "", ""},
+		{"SL only picks largest", []okx.AlgoOrder{
+			tpslOrder("sl1", "conditional", "1", "", "49500"),
+			tpslOrder("sl2", "conditional", "2", "", "49400"),
+		}, true, "sl2", models.TPSLLegTakeProfit},
+		{"TP only", []okx.AlgoOrder{
+			tpslOrder("tp1", "conditional", "3", "52500", ""),
+		}, true, "tp1", models.TPSLLegStopLoss},
+	}
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lone, missing, ok := manager.unpairedOrder(testPosition(), tt.orders)
+			if ok != tt.expectUnpaired {
+				t.Fatalf("expected unpaired=%v, got %v", tt.expectUnpaired, ok)
+			}
+			if !ok {
+				return
+			}
+			if lone.AlgoId != tt.expectLone || missing != tt.expectMissing {
+				t.Errorf("expected lone %s missing %s, got %s missing %s", tt.expectLone, tt.expectMissing, lone.AlgoId, missing)
+			}
+		})
+	}
+}
+
+// refuseNotional puts the position over a notional cap whose action is refuse
+func refuseNotional(m *Manager, p *models.Position) {
+	m.config.MaxNotionalUSD = 100000
+	m.config.NotionalCapAction = "refuse"
+	p.NotionalUSD = 150000
+}
+
+func TestAnalyzeAndPlaceTPSLUnpairedAction(t *testing.T) {
+	tests := []struct {
+		name          string
+		action        string
+		expectCancels int
+		expectOrders  []string // leg:size of each placed order
+		expectPlaced  int
+		expectReplace int
+		setup         func(m *Manager, p *models.Position)
+	}{
+		{"leave places a pair next to the lone SL", "leave", 0, []string{"tp:3", "sl:3"}, 1, 0, nil},
+		{"add_missing places a TP sized like the SL", "add_missing", 0, []string{"tp:2"}, 1, 0, nil},
+		{"replace_both cancels the SL and places a pair", "replace_both", 1, []string{"tp:3", "sl:3"}, 1, 1, nil},
+		{"replace_both keeps the SL when the notional cap refuses", "replace_both", 0, nil, 0, 0, refuseNotional},
+		{"replace_both keeps the SL at the order limit", "replace_both", 0, nil, 0, 0, func(m *Manager, p *models.Position) {
+			m.config.MaxOrdersPerInstrument = 2 // the lone SL plus a new pair would make 3
+		}},
+		{"add_missing refused by the notional cap", "add_missing", 0, nil, 0, 0, refuseNotional},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var cancelled []string
+			var placed []string
+
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				switch r.URL.Path {
+				case "/api/v5/trade/orders-algo-pending":
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"algoId":"sl1","instId":"BTC-USDT-SWAP","posSide":"long","sz":"2","ordType":"conditional","state":"live","slTriggerPx":"49500"}]}`))
+				case "/api/v5/trade/cancel-algos":
+					var reqs []okx.CancelAlgoOrderRequest
+					if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+						t.Errorf("failed to decode cancel request: %v", err)
+					}
+					for _, req := range reqs {
+						cancelled = append(cancelled, req.AlgoId)
+					}
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"sl1","sCode":"0"}]}`))
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+				case "/api/v5/trade/order-algo":
+					var req okx.AlgoOrderRequest
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Errorf("failed to decode order request: %v", err)
+					}
+					leg := "sl"
+					if req.TpTriggerPx != "" {
+						leg = "tp"
+					}
+					placed = append(placed, leg+":"+req.Sz)
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+			manager.config.UnpairedAction = tt.action
+			position := testPosition()
+			if tt.setup != nil {
+				tt.setup(manager, position)
+			}
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if summary.UnpairedCoverage != 1 {
+				t.Errorf("expected 1 unpaired position, got %d", summary.UnpairedCoverage)
+			}
+			if summary.OrdersPlaced != tt.expectPlaced || summary.OrdersReplaced != tt.expectReplace {
+				t.Errorf("expected placed=%d replaced=%d, got %+v", tt.expectPlaced, tt.expectReplace, summary)
+			}
+			if len(cancelled) != tt.expectCancels || (tt.expectCancels > 0 && cancelled[0] != "sl1") {
+				t.Errorf("expected %d cancels of sl1, got %v", tt.expectCancels, cancelled)
+			}
+			if strings.Join(placed, ",") != strings.Join(tt.expectOrders, ",") {
+				t.Errorf("expected orders %v, got %v", tt.expectOrders, placed)
+			}
+		})
+	}
+}
+
+func TestLegRequestInstrumentPrecision(t *testing.T) {
+	tests := []struct {
+		name       string
+		tickSz     string
+		lotSz      string
+		expectPx   string
+		expectSz   string
+		noMetadata bool
+	}{
+		{"1 decimal", "0.1", "0.1", "49123.5", "1.5", false},
+		{"4 decimals", "0.0001", "0.01", "49123.4568", "1.50", false},
+		{"8 decimals", "0.00000001", "0.00000001", "49123.45678912", "1.50000000", false},
+		{"no metadata falls back to generic precision", "", "", "49123.45678912", "1.5", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v5/public/instruments" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				if tt.noMetadata {
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+					return
+				}
+				w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","tickSz":"` + tt.tickSz + `","lotSz":"` + tt.lotSz + `"}]}`))
+			})
+
+			req := manager.legRequest(testPosition(), models.TPSLLegStopLoss, 1.5, 49123.456789123)
+			if req.SlTriggerPx != tt.expectPx {
+				t.Errorf("expected SL trigger %s, got %s", tt.expectPx, req.SlTriggerPx)
+			}
+			if req.Sz != tt.expectSz {
+				t.Errorf("expected size %s, got %s", tt.expectSz, req.Sz)
+			}
+		})
+	}
+}
+
+func TestGetCurrentMarketPriceCache(t *testing.T) {
+	var tickerCalls int32
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/market/ticker" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		atomic.AddInt32(&tickerCalls, 1)
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+	})
+	ttl := 2.0
+	manager.config.PriceCacheTTL = &ttl
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	manager.SetClock(fake)
+
+	read := func(expectCalls int32) {
+		t.Helper()
+		price, err := manager.getCurrentMarketPrice("BTC-USDT-SWAP")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if price != 50000 {
+			t.Errorf("expected price 50000, got %f", price)
+		}
+		if calls := atomic.LoadInt32(&tickerCalls); calls != expectCalls {
+			t.Errorf("expected %d ticker calls, got %d", expectCalls, calls)
+		}
+	}
+
+	read(1)
+	// A second read within the TTL reuses the cached price
+	fake.Advance(time.Second)
+	read(1)
+	// The cached price expires after the TTL
+	fake.Advance(2 * time.Second)
+	read(2)
+	// Invalidation forces a fresh fetch
+	manager.invalidatePrice("BTC-USDT-SWAP")
+	read(3)
+}
+
+func TestPlaceTPSLReduceOnlySetting(t *testing.T) {
+	disabled, enabled := false, true
+	tests := []struct {
+		name       string
+		reduceOnly *bool
+		expected   bool
+	}{
+		{"unset defaults to reduce-only", nil, true},
+		{"enabled", &enabled, true},
+		{"disabled omits the field", &disabled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []map[string]any
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/trade/order-algo":
+					var body map[string]any
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Errorf("failed to decode order: %v", err)
+					}
+					mu.Lock()
+					bodies = append(bodies, body)
+					mu.Unlock()
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+			manager.config.ReduceOnly = tt.reduceOnly
+
+			position := testPosition()
+			prices, err := manager.calculateTPSLPrices(position)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Both placement paths: with current price validation and the fallback without it
+			if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+				t.Fatalf("placeTPSLOrderWithValidation() error = %v", err)
+			}
+			if err := manager.placeTPSLOrderOriginal(position, 3, prices); err != nil {
+				t.Fatalf("placeTPSLOrderOriginal() error = %v", err)
+			}
+
+			if len(bodies) != 4 {
+				t.Fatalf("expected 4 orders, got %d", len(bodies))
+			}
+			for i, body := range bodies {
+				value, present := body["reduceOnly"]
+				if present != tt.expected {
+					t.Errorf("order %d: expected reduceOnly present=%v, got %v", i, tt.expected, body)
+				}
+				if present && value != true {
+					t.Errorf("order %d: expected reduceOnly true, got %v", i, value)
+				}
+			}
+		})
+	}
+}
+
+func TestPrimePriceCache(t *testing.T) {
+	var mu sync.Mutex
+	var bulkTypes []string
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/market/tickers" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+			return
+		}
+		instType := r.URL.Query().Get("instType")
+		mu.Lock()
+		bulkTypes = append(bulkTypes, instType)
+		mu.Unlock()
+		if instType == "SPOT" {
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT","last":"50010"}]}`))
+			return
+		}
+		w.Write([]byte(`{"code":"0","msg":"","data":[
+			{"instId":"BTC-USDT-SWAP","last":"50000"},
+			{"instId":"ETH-USDT-SWAP","last":"3000"},
+			{"instId":"SOL-USDT-SWAP","last":"100"}]}`))
+	})
+	ttl := 2.0
+	manager.config.PriceCacheTTL = &ttl
+
+	positions := []*models.Position{
+		{Instrument: "BTC-USDT-SWAP", PositionSide: models.PositionSideLong, PositionSize: 3, AveragePrice: 50000},
+		{Instrument: "ETH-USDT-SWAP", PositionSide: models.PositionSideShort, PositionSize: 10, AveragePrice: 3000},
+		{Instrument: "BTC-USDT", PositionSide: models.PositionSideNet, PositionSize: 1, AveragePrice: 50000},
+	}
+	manager.primePriceCache(positions)
+
+	// One bulk call per instrument type
+	if len(bulkTypes) != 2 || bulkTypes[0] != "SWAP" || bulkTypes[1] != "SPOT" {
+		t.Errorf("expected bulk tickers for SWAP and SPOT, got %v", bulkTypes)
+	}
+
+	// Only held instruments are cached
+	if _, ok := manager.prices["SOL-USDT-SWAP"]; ok {
+		t.Error("expected SOL-USDT-SWAP not to be cached")
+	}
+	expected := map[string]float64{"BTC-USDT-SWAP": 50000, "ETH-USDT-SWAP": 3000, "BTC-USDT": 50010}
+	for instId, price := range expected {
+		// Served from the cache, a single-ticker call would fail the handler
+		got, err := manager.getCurrentMarketPrice(instId)
+		if err != nil {
+			t.Fatalf("getCurrentMarketPrice(%s) error = %v", instId, err)
+		}
+		if got != price {
+			t.Errorf("expected cached price %f for %s, got %f", price, instId, got)
+		}
+	}
+}
+
+func TestLegRequestCloseFraction(t *testing.T) {
+	tests := []struct {
+		name             string
+		useCloseFraction bool
+		instrument       string
+		expectFraction   string
+		expectSz         string
+	}{
+		{"disabled sends a size", false, "BTC-USDT-SWAP", "", "3"},
+		{"swap closes the whole position", true, "BTC-USDT-SWAP", "1", ""},
+		{"futures closes the whole position", true, "BTC-USD-250328", "1", ""},
+		{"spot keeps a size", true, "BTC-USDT", "", "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No instrument metadata
+			})
+			manager.config.UseCloseFraction = tt.useCloseFraction
+
+			position := testPosition()
+			position.Instrument = tt.instrument
+			req := manager.legRequest(position, models.TPSLLegStopLoss, 3, 49500)
+			if req.CloseFraction != tt.expectFraction || req.Sz != tt.expectSz {
+				t.Errorf("expected closeFraction %q and sz %q, got %q and %q", tt.expectFraction, tt.expectSz, req.CloseFraction, req.Sz)
+			}
+
+			// closeFraction and sz are mutually exclusive on the wire
+			body, err := json.Marshal(req)
+			if err != nil {
+				t.Fatalf("failed to marshal request: %v", err)
+			}
+			if tt.expectFraction != "" && strings.Contains(string(body), `"sz"`) {
+				t.Errorf("expected no sz alongside closeFraction, got %s", body)
+			}
+		})
+	}
+}
+
+func TestLegRequestOrderPrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		useLimit bool
+		offset   float64
+		side     models.PositionSide
+		leg      models.TPSLLeg
+		trigger  float64
+		expectTP string
+		expectSL string
+	}{
+		{"market take-profit", false, 0.01, models.PositionSideLong, models.TPSLLegTakeProfit, 55000, "-1", ""},
+		{"market stop-loss", false, 0.01, models.PositionSideLong, models.TPSLLegStopLoss, 49500, "", "-1"},
+		{"limit take-profit at trigger", true, 0, models.PositionSideLong, models.TPSLLegTakeProfit, 55000, "55000", ""},
+		{"limit take-profit closing long sells below trigger", true, 0.01, models.PositionSideLong, models.TPSLLegTakeProfit, 55000, "54450", ""},
+		{"limit stop-loss closing long sells below trigger", true, 0.01, models.PositionSideLong, models.TPSLLegStopLoss, 49500, "", "49005"},
+		{"limit take-profit closing short buys above trigger", true, 0.01, models.PositionSideShort, models.TPSLLegTakeProfit, 45000, "45450", ""},
+		{"limit stop-loss closing short buys above trigger", true, 0.01, models.PositionSideShort, models.TPSLLegStopLoss, 50500, "", "51005"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No instrument metadata
+			})
+			manager.config.UseLimitOrders = tt.useLimit
+			manager.config.LimitOrderOffsetPct = tt.offset
+
+			position := testPosition()
+			position.PositionSide = tt.side
+			req := manager.legRequest(position, tt.leg, 3, tt.trigger)
+			if req.TpOrdPx != tt.expectTP || req.SlOrdPx != tt.expectSL {
+				t.Errorf("expected tpOrdPx %q and slOrdPx %q, got %q and %q", tt.expectTP, tt.expectSL, req.TpOrdPx, req.SlOrdPx)
+			}
+		})
+	}
+}
+
+func TestPlaceTPSLCloseFraction(t *testing.T) {
+	var mu sync.Mutex
+	var orders []okx.AlgoOrderRequest
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+		case "/api/v5/trade/order-algo":
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode order: %v", err)
+			}
+			mu.Lock()
+			orders = append(orders, req)
+			mu.Unlock()
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"full","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	manager.config.UseCloseFraction = true
+
+	position := testPosition()
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+		t.Fatalf("placeTPSLOrderWithValidation() error = %v", err)
+	}
+
+	// OKX allows one full-close order per position, so both legs go into a single order
+	if len(orders) != 1 {
+		t.Fatalf("expected 1 combined order, got %d", len(orders))
+	}
+	order := orders[0]
+	if order.CloseFraction != "1" || order.Sz != "" {
+		t.Errorf("expected closeFraction 1 without sz, got closeFraction %q sz %q", order.CloseFraction, order.Sz)
+	}
+	if order.TpTriggerPx != "52500" || order.SlTriggerPx != "49500" {
+		t.Errorf("expected TP 52500 and SL 49500, got TP %s SL %s", order.TpTriggerPx, order.SlTriggerPx)
+	}
+}
+
+func TestAnalyzeCoverageCloseFraction(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL.Path)
+	})
+
+	// A full-close order reports no size but covers the position whatever its size
+	full := tpslOrder("full", "conditional", "", "52500", "49500")
+	full.CloseFraction = "1"
+
+	for _, size := range []float64{3, 7.5} {
+		position := testPosition()
+		position.PositionSize = size
+		coverage := manager.analyzeCoverage(position, []okx.AlgoOrder{full})
+		if coverage.UncoveredSize != 0 || coverage.CoveredSize != size {
+			t.Errorf("size %v: expected fully covered, got covered %v uncovered %v", size, coverage.CoveredSize, coverage.UncoveredSize)
+		}
+	}
+
+	// A lone full-close SL still counts as unpaired
+	lone := tpslOrder("sl", "conditional", "", "", "49500")
+	lone.CloseFraction = "1"
+	order, missing, ok := manager.unpairedOrder(testPosition(), []okx.AlgoOrder{lone})
+	if !ok || order.AlgoId != "sl" || missing != models.TPSLLegTakeProfit {
+		t.Errorf("expected lone full-close SL missing its TP, got %v %s %v", order, missing, ok)
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLMaxOrdersPerInstrument(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		expectPlaced  int
+		expectRefused int
+		expectAlert   bool
+	}{
+		{"no limit", 0, 2, 0, false},
+		{"room for the pair", 5, 2, 0, false},
+		{"pair would exceed limit", 4, 0, 1, true},
+		{"already at limit", 3, 0, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placed := 0
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/trade/orders-algo-pending":
+					// Orders of the short side count toward the instrument but don't cover the long position
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"algoId":"a1","instId":"BTC-USDT-SWAP","posSide":"short","sz":"1","ordType":"conditional","state":"live","tpTriggerPx":"45000","slTriggerPx":"51000"},
+						{"algoId":"a2","instId":"BTC-USDT-SWAP","posSide":"short","sz":"1","ordType":"conditional","state":"live","tpTriggerPx":"45000","slTriggerPx":"51000"},
+						{"algoId":"a3","instId":"BTC-USDT-SWAP","posSide":"short","sz":"1","ordType":"conditional","state":"live","tpTriggerPx":"45000","slTriggerPx":"51000"}]}`))
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"last":"50000"}]}`))
+				case "/api/v5/trade/order-algo":
+					placed++
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+			manager.config.MaxOrdersPerInstrument = tt.limit
+			alerter := alert.New(manager.logger, time.Hour)
+			manager.SetAlerter(alerter)
+
+			position := testPosition()
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if placed != tt.expectPlaced {
+				t.Errorf("expected %d order requests, got %d", tt.expectPlaced, placed)
+			}
+			if summary.OrderLimitRefused != tt.expectRefused {
+				t.Errorf("expected %d refused placements, got %d", tt.expectRefused, summary.OrderLimitRefused)
+			}
+			if got := alerter.IsActive(orderLimitAlertKey(position)); got != tt.expectAlert {
+				t.Errorf("expected order limit alert %v, got %v", tt.expectAlert, got)
+			}
+		})
+	}
+}
+
+func TestPlaceTPSLTriggerPxTypes(t *testing.T) {
+	tests := []struct {
+		name             string
+		tpType, slType   string
+		useCloseFraction bool
+		expectOrders     int
+		expectTP         string
+		expectSL         string
+	}{
+		{"unset defaults to last", "", "", false, 2, "last", "last"},
+		{"TP on last, SL on mark", "last", "mark", false, 2, "last", "mark"},
+		{"TP on index, SL on last", "index", "last", false, 2, "index", "last"},
+		{"combined order keeps both types", "last", "mark", true, 1, "last", "mark"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var orders []okx.AlgoOrderRequest
+			manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+				case "/api/v5/trade/order-algo":
+					var req okx.AlgoOrderRequest
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Errorf("failed to decode order: %v", err)
+					}
+					mu.Lock()
+					orders = append(orders, req)
+					mu.Unlock()
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			})
+			manager.config.TPTriggerPxType = tt.tpType
+			manager.config.SLTriggerPxType = tt.slType
+			manager.config.UseCloseFraction = tt.useCloseFraction
+
+			position := testPosition()
+			prices, err := manager.calculateTPSLPrices(position)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+				t.Fatalf("placeTPSLOrderWithValidation() error = %v", err)
+			}
+
+			if len(orders) != tt.expectOrders {
+				t.Fatalf("expected %d orders, got %d", tt.expectOrders, len(orders))
+			}
+			for _, order := range orders {
+				// Each leg carries only its own trigger type
+				if order.TpTriggerPx != "" && order.TpTriggerPxType != tt.expectTP {
+					t.Errorf("expected TP trigger type %q, got %q", tt.expectTP, order.TpTriggerPxType)
+				}
+				if order.SlTriggerPx != "" && order.SlTriggerPxType != tt.expectSL {
+					t.Errorf("expected SL trigger type %q, got %q", tt.expectSL, order.SlTriggerPxType)
+				}
+				if order.TpTriggerPx == "" && order.TpTriggerPxType != "" || order.SlTriggerPx == "" && order.SlTriggerPxType != "" {
+					t.Errorf("trigger type sent without trigger price: %+v", order)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLWithMockClient(t *testing.T) {
+	client := &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000"}}
+	manager := newManagerWithClient(t, client)
+
+	// An uncovered position gets a TP and an SL
+	summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.NotCovered != 1 || summary.OrdersPlaced != 1 {
+		t.Errorf("expected one uncovered position placed, got %+v", summary)
+	}
+	if len(client.placed) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(client.placed))
+	}
+	tp, sl := client.placed[0], client.placed[1]
+	if tp.TpTriggerPx != "52500" || tp.Sz != "3" || tp.Side != "sell" {
+		t.Errorf("unexpected TP order: %+v", tp)
+	}
+	if sl.SlTriggerPx != "49500" || sl.Sz != "3" || sl.Side != "sell" {
+		t.Errorf("unexpected SL order: %+v", sl)
+	}
+
+	// The placed orders are pending now, so the next run finds the position covered
+	summary, err = manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.FullyCovered != 1 || summary.OrdersPlaced != 0 || len(client.placed) != 2 {
+		t.Errorf("expected the position to be covered without new orders, got %+v and %d orders", summary, len(client.placed))
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		wantTP   bool
+		wantSL   bool
+		wantSize int
+	}{
+		{"tp_sl places both legs", "tp_sl", true, true, 2},
+		{"sl_only places only the stop", "sl_only", false, true, 1},
+		{"tp_only places only the take-profit", "tp_only", true, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000"}}
+			manager := newManagerWithClient(t, client)
+			manager.config.Mode = tt.mode
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.OrdersPlaced != 1 {
+				t.Errorf("expected one position placed, got %+v", summary)
+			}
+			if len(client.placed) != tt.wantSize {
+				t.Fatalf("expected %d orders, got %d", tt.wantSize, len(client.placed))
+			}
+			var gotTP, gotSL bool
+			for _, order := range client.placed {
+				gotTP = gotTP || order.TpTriggerPx != ""
+				gotSL = gotSL || order.SlTriggerPx != ""
+			}
+			if gotTP != tt.wantTP || gotSL != tt.wantSL {
+				t.Errorf("expected TP %v SL %v, got TP %v SL %v", tt.wantTP, tt.wantSL, gotTP, gotSL)
+			}
+
+			// The single leg counts as full coverage on the next run
+			summary, err = manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.FullyCovered != 1 || len(client.placed) != tt.wantSize {
+				t.Errorf("expected the position to be covered without new orders, got %+v and %d orders", summary, len(client.placed))
+			}
+		})
+	}
+}
+
+func TestAnalyzeCoverageMode(t *testing.T) {
+	slOnly := []okx.AlgoOrder{tpslOrder("sl", "conditional", "3", "", "49500")}
+	tpOnly := []okx.AlgoOrder{tpslOrder("tp", "conditional", "3", "52500", "")}
+	both := []okx.AlgoOrder{
+		tpslOrder("tp", "conditional", "3", "52500", ""),
+		tpslOrder("sl", "conditional", "3", "", "49500"),
+	}
+
+	tests := []struct {
+		name         string
+		mode         string
+		orders       []okx.AlgoOrder
+		wantCovered  float64
+		wantUnpaired bool
+	}{
+		{"tp_sl with only a stop", "tp_sl", slOnly, 0, true},
+		{"tp_sl with both legs", "tp_sl", both, 3, false},
+		{"sl_only with only a stop", "sl_only", slOnly, 3, false},
+		{"sl_only with only a take-profit", "sl_only", tpOnly, 0, false},
+		{"sl_only with both legs", "sl_only", both, 3, false},
+		{"tp_only with only a take-profit", "tp_only", tpOnly, 3, false},
+		{"tp_only with only a stop", "tp_only", slOnly, 0, false},
+		{"tp_only with both legs", "tp_only", both, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newManagerWithClient(t, &mockOKX{})
+			manager.config.Mode = tt.mode
+
+			coverage := manager.analyzeCoverage(testPosition(), tt.orders)
+			if coverage.CoveredSize != tt.wantCovered || coverage.UncoveredSize != 3-tt.wantCovered {
+				t.Errorf("expected covered %v, got covered %v uncovered %v", tt.wantCovered, coverage.CoveredSize, coverage.UncoveredSize)
+			}
+			if _, _, unpaired := manager.unpairedOrder(testPosition(), tt.orders); unpaired != tt.wantUnpaired {
+				t.Errorf("unpairedOrder() = %v, want %v", unpaired, tt.wantUnpaired)
+			}
+		})
+	}
+}
+
+// amendFailOKX fails the amend calls listed in fail, keyed by algoId and the 1-based call number
+// for that algoId
+type amendFailOKX struct {
+	*mockOKX
+	fail  map[string]int
+	calls map[string]int
+	sizes []string // algoId=sz of every successful amend, in order
+}
+
+func (c *amendFailOKX) AmendAlgoOrder(instId, algoId, newSz, newTpTrigger, newSlTrigger string) (*okx.AlgoOrderResponse, error) {
+	c.calls[algoId]++
+	if c.fail[algoId] == c.calls[algoId] {
+		return nil, &okx.OrderError{SCode: "51000", SMsg: "amend " + algoId + " rejected"}
+	}
+	c.sizes = append(c.sizes, algoId+"="+newSz)
+	return c.mockOKX.AmendAlgoOrder(instId, algoId, newSz, newTpTrigger, newSlTrigger)
+}
+
+func TestAnalyzeAndPlaceTPSLPartialAmend(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         map[string]int
+		expectSizes  []string
+		expectPlaced int // order-algo requests
+		expectFailed int
+	}{
+		{
+			name:         "tp amend fails, sl reverted, new pair placed",
+			fail:         map[string]int{"tp1": 1},
+			expectSizes:  []string{"sl1=3", "sl1=1"},
+			expectPlaced: 2,
+		},
+		{
+			name:         "sl revert fails, nothing placed",
+			fail:         map[string]int{"tp1": 1, "sl1": 2},
+			expectSizes:  []string{"sl1=3"},
+			expectFailed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &amendFailOKX{
+				mockOKX: &mockOKX{
+					last: map[string]string{"BTC-USDT-SWAP": "50000"},
+					pending: []okx.AlgoOrder{
+						tpslOrder("tp1", "conditional", "1", "52500", ""),
+						tpslOrder("sl1", "conditional", "1", "", "49500"),
+					},
+				},
+				fail:  tt.fail,
+				calls: make(map[string]int),
+			}
+			manager := newManagerWithClient(t, client)
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(client.sizes, ",") != strings.Join(tt.expectSizes, ",") {
+				t.Errorf("expected amends %v, got %v", tt.expectSizes, client.sizes)
+			}
+			if len(client.placed) != tt.expectPlaced {
+				t.Errorf("expected %d orders placed, got %d", tt.expectPlaced, len(client.placed))
+			}
+			if summary.OrdersAmended != 0 || summary.PlacementFailures != tt.expectFailed {
+				t.Errorf("expected 0 amended and %d failures, got %d and %d",
+					tt.expectFailed, summary.OrdersAmended, summary.PlacementFailures)
+			}
+		})
+	}
+}
+
+func TestChooseAmendTargetsMode(t *testing.T) {
+	client := &mockOKX{}
+	manager := newManagerWithClient(t, client)
+	manager.config.Mode = "sl_only"
+
+	// A lone, undersized stop is resized without a TP
+	orders := []okx.AlgoOrder{tpslOrder("sl", "conditional", "2", "", "49500")}
+	tp, sl, ok := manager.chooseAmendTargets(testPosition(), orders)
+	if !ok || tp != nil || sl == nil || sl.AlgoId != "sl" {
+		t.Fatalf("expected to amend only the stop, got %v %v %v", tp, sl, ok)
+	}
+	if err := manager.amendTPSLOrders(testPosition(), tp, sl); err != nil {
+		t.Fatalf("amendTPSLOrders() error = %v", err)
+	}
+	if len(client.amended) != 1 || client.amended[0] != "sl" {
+		t.Errorf("expected only the stop amended, got %v", client.amended)
+	}
+}
+
+func TestMarginRisk(t *testing.T) {
+	tests := []struct {
+		name     string
+		side     models.PositionSide
+		entry    float64
+		leverage float64
+		slPrice  float64
+		expected float64
+	}{
+		{"long at 20x", models.PositionSideLong, 100, 20, 98, 0.4},
+		{"short at 10x", models.PositionSideShort, 100, 10, 102, 0.2},
+		{"unknown leverage", models.PositionSideLong, 100, 0, 98, 0},
+		{"no stop", models.PositionSideLong, 100, 20, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := &models.Position{PositionSide: tt.side, AveragePrice: tt.entry, Leverage: tt.leverage}
+			if got := marginRisk(position, tt.slPrice); got != tt.expected {
+				t.Errorf("marginRisk() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLMarginRisk(t *testing.T) {
+	// The 1% stop at 49500 risks 20% of margin at 20x and 50% at 50x, against a 30% cap
+	tests := []struct {
+		name       string
+		leverage   float64
+		action     string
+		wantOrders int
+		wantOver   int
+	}{
+		{"within the cap", 20, "alert", 2, 0},
+		{"above the cap alerts", 50, "alert", 2, 1},
+		{"above the cap refuses", 50, "refuse", 0, 1},
+		{"unknown leverage is not checked", 0, "refuse", 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000"}}
+			manager := newManagerWithClient(t, client)
+			manager.config.MaxMarginRisk = 0.3
+			manager.config.MarginRiskAction = tt.action
+
+			position := testPosition()
+			position.Leverage = tt.leverage
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(client.placed) != tt.wantOrders || summary.OverMarginRisk != tt.wantOver {
+				t.Errorf("expected %d orders and %d over margin risk, got %d orders and %+v", tt.wantOrders, tt.wantOver, len(client.placed), summary)
+			}
+			if tt.wantOrders == 0 {
+				return
+			}
+
+			// The placed stop is reported in the coverage output and checked while covered
+			coverage, err := manager.AnalyzeCoverage([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("AnalyzeCoverage() error = %v", err)
+			}
+			if want := 0.01 * tt.leverage; len(coverage) != 1 || coverage[0].MarginRisk != want {
+				t.Errorf("expected margin risk %v, got %+v", want, coverage)
+			}
+			summary, err = manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.FullyCovered != 1 || summary.OverMarginRisk != tt.wantOver {
+				t.Errorf("expected covered with %d over margin risk, got %+v", tt.wantOver, summary)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCoverageAttachedTPSL(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL.Path)
+	})
+
+	both := models.AttachedTPSL{AlgoId: "att", TpTriggerPx: 52500, SlTriggerPx: 49500, CloseFraction: 1}
+	tests := []struct {
+		name            string
+		attached        []models.AttachedTPSL
+		pending         []okx.AlgoOrder
+		expectUncovered float64
+		expectTP        int
+		expectSL        int
+	}{
+		{"attached TP and SL cover the position", []models.AttachedTPSL{both}, nil, 0, 1, 1},
+		{"attached SL only", []models.AttachedTPSL{{AlgoId: "att", SlTriggerPx: 49500, CloseFraction: 1}}, nil, 3, 0, 1},
+		{"attached half of the position", []models.AttachedTPSL{{AlgoId: "att", TpTriggerPx: 52500, SlTriggerPx: 49500, CloseFraction: 0.5}}, nil, 1.5, 1, 1},
+		{"missing close fraction is ignored", []models.AttachedTPSL{{AlgoId: "att", TpTriggerPx: 52500, SlTriggerPx: 49500}}, nil, 3, 0, 0},
+		{
+			"attached order also pending is counted once",
+			[]models.AttachedTPSL{both},
+			[]okx.AlgoOrder{func() okx.AlgoOrder {
+				o := tpslOrder("att", "conditional", "", "52500", "49500")
+				o.CloseFraction = "1"
+				return o
+			}()},
+			0, 1, 1,
+		},
+		{"attached SL pairs with a pending TP", []models.AttachedTPSL{{AlgoId: "att", SlTriggerPx: 49500, CloseFraction: 1}},
+			[]okx.AlgoOrder{tpslOrder("tp", "conditional", "3", "52500", "")}, 0, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := testPosition()
+			position.AttachedTPSL = tt.attached
+			coverage := manager.analyzeCoverage(position, tt.pending)
+			if coverage.UncoveredSize != tt.expectUncovered {
+				t.Errorf("expected uncovered %v, got %v", tt.expectUncovered, coverage.UncoveredSize)
+			}
+			if coverage.TPCount != tt.expectTP || coverage.SLCount != tt.expectSL {
+				t.Errorf("expected %d TP and %d SL, got %d and %d", tt.expectTP, tt.expectSL, coverage.TPCount, coverage.SLCount)
+			}
+
+			// A pending order paired by an attached leg is not unpaired
+			if _, _, ok := manager.unpairedOrder(position, tt.pending); ok {
+				t.Error("expected no unpaired order")
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLAttachedFullCoverage(t *testing.T) {
+	client := &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000"}}
+	manager := newManagerWithClient(t, client)
+
+	// The attached TP/SL is an oco order, so it is absent from the conditional pending list
+	position := testPosition()
+	position.AttachedTPSL = []models.AttachedTPSL{{AlgoId: "oco1", TpTriggerPx: 52500, SlTriggerPx: 49500, CloseFraction: 1}}
+
+	summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.FullyCovered != 1 || summary.OrdersPlaced != 0 || len(client.placed) != 0 {
+		t.Errorf("expected attached TP/SL to fully cover the position, got %+v and %d orders", summary, len(client.placed))
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLAllowPartialCoverage(t *testing.T) {
+	tests := []struct {
+		name          string
+		allow         bool
+		expectAmended int
+	}{
+		{"partial coverage topped up", false, 1},
+		{"partial coverage accepted", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Scaling out: TP on half the position, SL on all of it
+			client := &mockOKX{
+				last: map[string]string{"BTC-USDT-SWAP": "50000"},
+				pending: []okx.AlgoOrder{
+					tpslOrder("tp", "conditional", "1.5", "52500", ""),
+					tpslOrder("sl", "conditional", "3", "", "49500"),
+				},
+			}
+			manager := newManagerWithClient(t, client)
+			manager.config.AllowPartialCoverage = tt.allow
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.PartiallyCovered != 1 {
+				t.Errorf("expected 1 partially covered position, got %+v", summary)
+			}
+			if summary.OrdersAmended != tt.expectAmended || summary.OrdersPlaced != 0 || len(client.placed) != 0 {
+				t.Errorf("expected %d amends and no placements, got %+v and %d orders", tt.expectAmended, summary, len(client.placed))
+			}
+			if tt.allow && len(client.amended) != 0 {
+				t.Errorf("expected no amend requests, got %v", client.amended)
+			}
+		})
+	}
+}
+
+// slowOKX delays each placement on a fake clock by the next entry in delays
+type slowOKX struct {
+	*mockOKX
+	clock  *clock.Fake
+	delays []time.Duration
+}
+
+func (c *slowOKX) PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	c.clock.Advance(c.delays[0])
+	c.delays = c.delays[1:]
+	return c.mockOKX.PlaceAlgoOrder(req)
+}
+
+func TestPlacementLatencyMetrics(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := &slowOKX{
+		mockOKX: &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000", "ETH-USDT-SWAP": "3000"}},
+		clock:   fake,
+		delays:  []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 2 * time.Second, 2 * time.Second},
+	}
+	manager := newManagerWithClient(t, client)
+	manager.SetClock(fake)
+
+	eth := testPosition()
+	eth.Instrument = "ETH-USDT-SWAP"
+	eth.AveragePrice = 3000
+	if _, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{testPosition(), eth}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metrics := manager.GetMetrics()
+	overall := metrics["placement_latency"].(LatencyStats)
+	expected := LatencyStats{Count: 4, MinMs: 100, AvgMs: 1100, MaxMs: 2000}
+	if overall != expected {
+		t.Errorf("expected overall latency %+v, got %+v", expected, overall)
+	}
+
+	byInstrument := metrics["placement_latency_by_instrument"].(map[string]LatencyStats)
+	if got := byInstrument["BTC-USDT-SWAP"]; got != (LatencyStats{Count: 2, MinMs: 100, AvgMs: 200, MaxMs: 300}) {
+		t.Errorf("unexpected BTC latency: %+v", got)
+	}
+	if got := byInstrument["ETH-USDT-SWAP"]; got != (LatencyStats{Count: 2, MinMs: 2000, AvgMs: 2000, MaxMs: 2000}) {
+		t.Errorf("unexpected ETH latency: %+v", got)
+	}
+
+	// Each TP and SL counts, not each protected position
+	if placed := metrics["orders_placed"]; placed != int64(4) {
+		t.Errorf("expected orders_placed 4, got %v", placed)
+	}
+}
+
+func TestPlaceTPSLClientOrderIds(t *testing.T) {
+	var mu sync.Mutex
+	var requests []okx.AlgoOrderRequest
+	rejected := false
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+		case "/api/v5/trade/order-algo":
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			requests = append(requests, req)
+			// The first TP is rejected on its trigger, so it is retried
+			if req.TpTriggerPx != "" && !rejected {
+				rejected = true
+				w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"","sCode":"51279","sMsg":"TP trigger price cannot be lower than the last price"}]}`))
+				return
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	manager.config.OrderTag = "tenyo"
+	manager.config.ClientOrderIds = true
+	fake := clock.NewFake(time.Date(2024, 3, 9, 23, 0, 0, 0, time.UTC))
+	manager.SetClock(fake)
+
+	position := testPosition()
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected TP, TP retry and SL requests, got %d", len(requests))
+	}
+	tp, retry, sl := requests[0], requests[1], requests[2]
+	if tp.AlgoClOrdId == "" || tp.AlgoClOrdId != retry.AlgoClOrdId {
+		t.Errorf("expected the retried TP to reuse its client order ID, got %q and %q", tp.AlgoClOrdId, retry.AlgoClOrdId)
+	}
+	if sl.AlgoClOrdId == "" || sl.AlgoClOrdId == tp.AlgoClOrdId {
+		t.Errorf("expected a distinct SL client order ID, got TP %q and SL %q", tp.AlgoClOrdId, sl.AlgoClOrdId)
+	}
+	for _, req := range requests {
+		if req.Tag != "tenyo" {
+			t.Errorf("expected tag tenyo, got %q", req.Tag)
+		}
+		if len(req.AlgoClOrdId) > 32 || strings.Trim(req.AlgoClOrdId, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			t.Errorf("client order ID %q is not up to 32 alphanumerics", req.AlgoClOrdId)
+		}
+	}
+
+	// The same leg gets the same ID later that day and a new one the next day
+	if got := clientOrderId(sl, fake.Now().Add(30*time.Minute), 0); got != sl.AlgoClOrdId {
+		t.Errorf("expected stable ID within the UTC day, got %q and %q", got, sl.AlgoClOrdId)
+	}
+	if got := clientOrderId(sl, fake.Now().Add(2*time.Hour), 0); got == sl.AlgoClOrdId {
+		t.Errorf("expected a new ID on the next UTC day, got %q", got)
+	}
+	// Another size, trigger or sequence number is another order
+	for name, req := range map[string]okx.AlgoOrderRequest{
+		"size":     {InstId: sl.InstId, Side: sl.Side, PosSide: sl.PosSide, Sz: "1", SlTriggerPx: sl.SlTriggerPx},
+		"trigger":  {InstId: sl.InstId, Side: sl.Side, PosSide: sl.PosSide, Sz: sl.Sz, SlTriggerPx: "49000"},
+		"sequence": sl,
+	} {
+		seq := 0
+		if name == "sequence" {
+			seq = 1
+		}
+		if got := clientOrderId(req, fake.Now(), seq); got == sl.AlgoClOrdId {
+			t.Errorf("expected a new ID for another %s, got %q", name, got)
+		}
+	}
+}
+
+func TestPlaceTPSLDuplicateClientOrderIdIsIdempotent(t *testing.T) {
+	var mu sync.Mutex
+	placed := map[string]string{} // algoClOrdId -> algoId, orders that exist server-side
+	requests, pendingCalls := 0, 0
+	slLost := true
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+		case "/api/v5/trade/order-algo":
+			requests++
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			// The SL was placed by an earlier attempt whose response was lost
+			if req.SlTriggerPx != "" && slLost {
+				slLost = false
+				placed[req.AlgoClOrdId] = "sl-existing"
+			}
+			if _, ok := placed[req.AlgoClOrdId]; ok {
+				w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"","sCode":"51065","sMsg":"algoClOrdId already exists"}]}`))
+				return
+			}
+			placed[req.AlgoClOrdId] = "tp-new"
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"tp-new","sCode":"0"}]}`))
+		case "/api/v5/trade/orders-algo-pending":
+			pendingCalls++
+			var data []string
+			for clOrdId, algoId := range placed {
+				data = append(data, `{"algoId":"`+algoId+`","algoClOrdId":"`+clOrdId+`","instId":"BTC-USDT-SWAP"}`)
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[` + strings.Join(data, ",") + `]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	manager.config.ClientOrderIds = true
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	manager.SetStorage(db)
+
+	position := testPosition()
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The duplicate SL counts as placed and is recorded under its existing algoId
+	if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+		t.Fatalf("expected duplicate client order ID to be treated as success, got: %v", err)
+	}
+	if requests != 2 || pendingCalls != 1 {
+		t.Errorf("expected 2 placements and 1 pending lookup, got %d and %d", requests, pendingCalls)
+	}
+
+	records, err := db.GetLiveTPSLOrders()
+	if err != nil {
+		t.Fatalf("failed to load records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected TP and SL records, got %v", records)
+	}
+	for _, algoId := range []string{"tp-new", "sl-existing"} {
+		record, ok := records[algoId]
+		if !ok || record.ClientOrderID == "" || placed[record.ClientOrderID] != algoId {
+			t.Errorf("expected record for %s with its client order ID, got %+v", algoId, record)
+		}
+	}
+
+	// Placing again resolves both duplicates against the pending orders without new rows
+	if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+		t.Fatalf("unexpected error on second attempt: %v", err)
+	}
+	if requests != 4 || pendingCalls != 3 {
+		t.Errorf("expected duplicates resolved from pending orders, got %d placements and %d pending lookups", requests, pendingCalls)
+	}
+	records, err = db.GetLiveTPSLOrders()
+	if err != nil {
+		t.Fatalf("failed to load records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected no new records, got %v", records)
+	}
+}
+
+func TestPlaceTPSLDuplicateClientOrderIdNotPending(t *testing.T) {
+	used := map[string]bool{} // client order IDs of orders that triggered or were cancelled
+	var ids []string
+
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/account/positions":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/market/ticker":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+		case "/api/v5/trade/order-algo":
+			var req okx.AlgoOrderRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode request: %v", err)
+			}
+			ids = append(ids, req.AlgoClOrdId)
+			// The first SL of the day was hit and that ID stays taken
+			if req.SlTriggerPx != "" && len(used) == 0 {
+				used[req.AlgoClOrdId] = true
+			}
+			if used[req.AlgoClOrdId] {
+				w.Write([]byte(`{"code":"1","msg":"","data":[{"algoId":"","sCode":"51065","sMsg":"algoClOrdId already exists"}]}`))
+				return
+			}
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"algo-` + strconv.Itoa(len(ids)) + `","sCode":"0"}]}`))
+		case "/api/v5/trade/orders-algo-pending":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		case "/api/v5/public/instruments":
+			w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	manager.config.ClientOrderIds = true
+
+	position := testPosition()
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := manager.placeTPSLOrderWithValidation(position, 3, prices); err != nil {
+		t.Fatalf("expected the SL to be placed again under a new ID, got: %v", err)
+	}
+	if len(ids) != 3 || ids[1] == ids[2] {
+		t.Errorf("expected TP, duplicate SL and SL under a new ID, got %v", ids)
+	}
+
+	// With every ID taken the placement fails instead of counting as protected
+	sl := manager.legRequest(position, models.TPSLLegStopLoss, 3, prices.SlPrice)
+	for seq := 0; seq < clientOrderIdAttempts; seq++ {
+		used[clientOrderId(sl, manager.clock.Now(), seq)] = true
+	}
+	if _, err := manager.placeAlgoOrder(sl); !errors.Is(err, errDuplicateNotPending) {
+		t.Errorf("expected errDuplicateNotPending once every ID is taken, got: %v", err)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {})
+	position := testPosition()
+
+	prices, err := manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if prices.TpPrice != 52500 || prices.SlPrice != 49500 {
+		t.Fatalf("expected TP 52500 and SL 49500, got TP %v and SL %v", prices.TpPrice, prices.SlPrice)
+	}
+
+	// A run in flight keeps its snapshot, the new config applies once it finishes
+	manager.beginRun()
+	manager.SetConfig(&config.TPSLConfig{VolatilityPct: 0.01, ProfitLossRatio: 3.0, PriceBufferPct: 0.001})
+	if ratio := manager.cfg().ProfitLossRatio; ratio != 5.0 {
+		t.Errorf("expected in-flight run to keep ratio 5, got %v", ratio)
+	}
+	manager.endRun()
+
+	prices, err = manager.calculateTPSLPrices(position)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if prices.TpPrice != 51500 || prices.SlPrice != 49500 {
+		t.Errorf("expected TP 51500 and SL 49500 after SetConfig, got TP %v and SL %v", prices.TpPrice, prices.SlPrice)
+	}
+
+	manager.SetConfig(nil)
+	if manager.cfg() == nil {
+		t.Error("expected nil config to be ignored")
+	}
+}
+
+func TestTrailTakeProfit(t *testing.T) {
+	client := &mockOKX{pending: []okx.AlgoOrder{
+		tpslOrder("tp1", "conditional", "3", "52500", ""),
+		tpslOrder("sl1", "conditional", "3", "", "49500"),
+	}}
+	manager := newManagerWithClient(t, client)
+	manager.config.TPTrailDistancePct = 0.01
+	manager.config.TPTrailActivationPct = 0.02
+
+	// Entry 50000, so trailing activates at 51000 and triggers sit 1% around the high-water mark
+	steps := []struct {
+		mark     float64
+		expectTP string
+		expectSL string
+		trailed  bool
+	}{
+		{50500, "52500", "49500", false}, // below activation
+		{51500, "52500", "50985", true},  // SL locks profit, trailed TP 52015 would move the TP down
+		{53000, "53530", "52470", true},  // both ratchet up
+		{52000, "53530", "52470", false}, // retrace: high-water mark and triggers hold
+		{54000, "54540", "53460", true},
+	}
+
+	position := testPosition()
+	for i, step := range steps {
+		position.MarkPx = step.mark
+		trailed, err := manager.trailTakeProfit(position, client.pending)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		if trailed != step.trailed {
+			t.Errorf("step %d (mark %v): expected trailed=%v, got %v", i, step.mark, step.trailed, trailed)
+		}
+		if tp, sl := client.pending[0].TpTriggerPx, client.pending[1].SlTriggerPx; tp != step.expectTP || sl != step.expectSL {
+			t.Errorf("step %d (mark %v): expected TP %s and SL %s, got TP %s and SL %s",
+				i, step.mark, step.expectTP, step.expectSL, tp, sl)
+		}
+	}
+
+	// Closing the position forgets its high-water mark
+	manager.pruneHighWater(nil)
+	position.MarkPx = 50500
+	if trailed, err := manager.trailTakeProfit(position, client.pending); err != nil || trailed {
+		t.Errorf("expected no trailing after the high-water mark was pruned, got %v, %v", trailed, err)
+	}
+	if _, ok := manager.highWater[trailKey(position)]; ok {
+		t.Error("expected no high-water mark below activation")
+	}
+}
+
+func TestTrailTriggersShort(t *testing.T) {
+	tp, sl := trailTriggers(false, 2000, 0.05)
+	if !tp.Equal(toDecimal(1900)) || !sl.Equal(toDecimal(2100)) {
+		t.Errorf("expected short TP 1900 and SL 2100, got TP %s and SL %s", tp, sl)
+	}
+
+	// A short ratchets down only
+	if got := ratchetTrigger("2050", sl, false, genericOrderFormat); got != "" {
+		t.Errorf("expected SL 2100 not to loosen a short stop at 2050, got %s", got)
+	}
+	if got := ratchetTrigger("2200", sl, false, genericOrderFormat); got != "2100" {
+		t.Errorf("expected short stop to move from 2200 to 2100, got %q", got)
+	}
+}
+
+func TestTightenStopLoss(t *testing.T) {
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		afterHours  int
+		openedAgo   time.Duration // 0 leaves the opening time unknown
+		mark        float64
+		currentSL   string
+		expectSL    string
+		expectTight bool
+	}{
+		{"disabled", 0, 72 * time.Hour, 50200, "49500", "49500", false},
+		{"opening time unknown", 48, 0, 50200, "49500", "49500", false},
+		{"younger than the age", 48, 47 * time.Hour, 50200, "49500", "49500", false},
+		{"older than the age", 48, 49 * time.Hour, 50200, "49500", "49750", true},
+		{"price already through the tightened stop", 48, 49 * time.Hour, 49700, "49500", "49500", false},
+		{"stop already tighter", 48, 49 * time.Hour, 50200, "49800", "49800", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockOKX{pending: []okx.AlgoOrder{
+				tpslOrder("tp1", "conditional", "3", "52500", ""),
+				tpslOrder("sl1", "conditional", "3", "", tt.currentSL),
+			}}
+			manager := newManagerWithClient(t, client)
+			manager.SetClock(clock.NewFake(now))
+			manager.config.SLTightenAfterHours = tt.afterHours
+			manager.config.SLTightenFactor = 0.5
+
+			position := testPosition()
+			position.MarkPx = tt.mark
+			if tt.openedAgo > 0 {
+				position.OpenedAt = now.Add(-tt.openedAgo)
+			}
+
+			tightened, err := manager.tightenStopLoss(position, client.pending)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tightened != tt.expectTight {
+				t.Errorf("expected tightened=%v, got %v", tt.expectTight, tightened)
+			}
+			if sl := client.pending[1].SlTriggerPx; sl != tt.expectSL {
+				t.Errorf("expected SL %s, got %s", tt.expectSL, sl)
+			}
+			if tp := client.pending[0].TpTriggerPx; tp != "52500" {
+				t.Errorf("expected TP to stay at 52500, got %s", tp)
+			}
+		})
+	}
+}
+
+func TestCalculateTPSLPricesAged(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	manager := newManagerWithClient(t, &mockOKX{})
+	manager.SetClock(fake)
+	manager.config.SLTightenAfterHours = 24
+	manager.config.SLTightenFactor = 0.5
+
+	position := testPosition()
+	position.OpenedAt = start
+
+	// Entry 50000 with 1% volatility: SL 49500 until the position is a day old, then half as far
+	steps := []struct {
+		advance  time.Duration
+		expectSL float64
+	}{
+		{23 * time.Hour, 49500},
+		{time.Hour, 49750},
+	}
+	for _, step := range steps {
+		fake.Advance(step.advance)
+		prices, err := manager.calculateTPSLPrices(position)
+		if err != nil {
+			t.Fatalf("calculateTPSLPrices() error = %v", err)
+		}
+		if prices.SlPrice != step.expectSL || prices.TpPrice != 52500 {
+			t.Errorf("at %v: expected SL %v and TP 52500, got SL %v and TP %v",
+				fake.Now().Sub(start), step.expectSL, prices.SlPrice, prices.TpPrice)
+		}
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLMaxNotional(t *testing.T) {
+	tests := []struct {
+		name         string
+		notional     float64
+		globalCap    float64
+		instCaps     map[string]float64
+		action       string
+		expectOrders int
+		expectOver   bool
+	}{
+		{"no cap", 200000, 0, nil, "alert", 2, false},
+		{"under the cap", 90000, 100000, nil, "alert", 2, false},
+		{"over the cap alerts and still protects", 150000, 100000, nil, "alert", 2, true},
+		{"over the cap refuses placement", 150000, 100000, nil, "refuse", 0, true},
+		{"per-instrument cap overrides global", 150000, 100000, map[string]float64{"BTC-USDT-SWAP": 200000}, "refuse", 2, false},
+		{"per-instrument cap tighter than global", 90000, 100000, map[string]float64{"BTC-USDT-SWAP": 50000}, "refuse", 0, true},
+		{"unknown notional is not checked", 0, 100000, nil, "refuse", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000"}}
+			manager := newManagerWithClient(t, client)
+			manager.config.MaxNotionalUSD = tt.globalCap
+			manager.config.MaxNotionalUSDByInstrument = tt.instCaps
+			manager.config.NotionalCapAction = tt.action
+			alerter := alert.New(manager.logger, time.Hour)
+			manager.SetAlerter(alerter)
+
+			position := testPosition()
+			position.NotionalUSD = tt.notional
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(client.placed) != tt.expectOrders {
+				t.Errorf("expected %d orders, got %d", tt.expectOrders, len(client.placed))
+			}
+			if over := summary.OverNotionalCap == 1; over != tt.expectOver {
+				t.Errorf("expected over cap %v, got summary %+v", tt.expectOver, summary)
+			}
+			if got := alerter.IsActive(notionalCapAlertKey(position)); got != tt.expectOver {
+				t.Errorf("expected notional cap alert %v, got %v", tt.expectOver, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLNewPositionGrace(t *testing.T) {
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		graceSeconds int
+		openedAgo    time.Duration // 0 leaves the opening time unknown
+		expectPlaced int
+		expectSkip   int
+	}{
+		{"disabled", 0, 5 * time.Second, 2, 0},
+		{"just opened", 60, 5 * time.Second, 0, 1},
+		{"past the grace period", 60, 90 * time.Second, 2, 0},
+		{"opening time unknown", 60, 0, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockOKX{}
+			manager := newManagerWithClient(t, client)
+			manager.SetClock(clock.NewFake(now))
+			manager.config.NewPositionGraceSeconds = tt.graceSeconds
+
+			position := testPosition()
+			if tt.openedAgo > 0 {
+				position.OpenedAt = now.Add(-tt.openedAgo)
+			}
+
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(client.placed) != tt.expectPlaced {
+				t.Errorf("expected %d orders placed, got %d", tt.expectPlaced, len(client.placed))
+			}
+			if summary.Skipped != tt.expectSkip {
+				t.Errorf("expected %d skipped, got %d", tt.expectSkip, summary.Skipped)
+			}
+		})
+	}
+}
+
+func TestAccountCoverageRatio(t *testing.T) {
+	position := func(instId string, size, notional float64) *models.Position {
+		p := testPosition()
+		p.Instrument = instId
+		p.PositionSize = size
+		p.NotionalUSD = notional
+		return p
+	}
+	order := func(algoId, instId, sz, tp, sl string) okx.AlgoOrder {
+		o := tpslOrder(algoId, "conditional", sz, tp, sl)
+		o.InstId = instId
+		return o
+	}
+	covered := []okx.AlgoOrder{
+		order("btc-tp", "BTC-USDT-SWAP", "3", "52500", ""),
+		order("btc-sl", "BTC-USDT-SWAP", "3", "", "49500"),
+		order("eth-tp", "ETH-USDT-SWAP", "4", "3150", ""),
+		order("eth-sl", "ETH-USDT-SWAP", "4", "", "2970"),
+	}
+
+	tests := []struct {
+		name      string
+		positions []*models.Position
+		expected  float64
+	}{
+		{
+			// 150000 covered + 40% of 30000 out of 200000
+			name: "covered, partial and uncovered",
+			positions: []*models.Position{
+				position("BTC-USDT-SWAP", 3, 150000),
+				position("ETH-USDT-SWAP", 10, 30000),
+				position("SOL-USDT-SWAP", 100, 20000),
+			},
+			expected: 0.81,
+		},
+		{
+			name:      "only uncovered",
+			positions: []*models.Position{position("SOL-USDT-SWAP", 100, 20000)},
+			expected:  0,
+		},
+		{
+			name: "unknown notional is left out",
+			positions: []*models.Position{
+				position("BTC-USDT-SWAP", 3, 150000),
+				position("SOL-USDT-SWAP", 100, 0),
+			},
+			expected: 1,
+		},
+		{
+			name:     "no positions",
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newManagerWithClient(t, &mockOKX{pending: covered})
+
+			ratio, err := manager.AccountCoverageRatio(tt.positions)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(ratio-tt.expected) > 1e-9 {
+				t.Errorf("expected ratio %v, got %v", tt.expected, ratio)
+			}
+			if metric := manager.GetMetrics()["account_coverage_ratio"]; metric != ratio {
+				t.Errorf("expected account_coverage_ratio metric %v, got %v", ratio, metric)
+			}
+		})
+	}
+}
+
+func TestAnalyzeAndPlaceTPSLStoresCoverageRatio(t *testing.T) {
+	position := func(instId string, size, notional float64) *models.Position {
+		p := testPosition()
+		p.Instrument = instId
+		p.PositionSize = size
+		p.NotionalUSD = notional
+		return p
+	}
+	// ETH is 4 of 10 covered before the check and SOL is excluded, so it stays unprotected
+	ethTP := tpslOrder("eth-tp", "conditional", "4", "3150", "")
+	ethTP.InstId = "ETH-USDT-SWAP"
+	ethSL := tpslOrder("eth-sl", "conditional", "4", "", "2970")
+	ethSL.InstId = "ETH-USDT-SWAP"
+	client := &mockOKX{
+		last:    map[string]string{"BTC-USDT-SWAP": "50000", "ETH-USDT-SWAP": "50000"},
+		pending: []okx.AlgoOrder{ethTP, ethSL},
+	}
+	manager := newManagerWithClient(t, client)
+	manager.config.ExcludeInstruments = []string{"SOL-USDT-SWAP"}
+
+	summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{
+		position("BTC-USDT-SWAP", 3, 150000),
+		position("ETH-USDT-SWAP", 10, 30000),
+		position("SOL-USDT-SWAP", 100, 20000),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.OrdersPlaced+summary.OrdersAmended != 2 || summary.Skipped != 1 {
+		t.Fatalf("expected BTC and ETH protected and SOL skipped, got %+v", summary)
+	}
+
+	// The ratio reflects the orders placed in this check, not the coverage found before it
+	if metric := manager.GetMetrics()["account_coverage_ratio"]; metric != 0.9 {
+		t.Errorf("expected account_coverage_ratio 0.9 after placement, got %v", metric)
+	}
+}
+
+// lossyOKX acknowledges stop-loss placements but keeps them at slSz, "0" drops them and an
+// empty slSz keeps the size placed
+type lossyOKX struct {
+	*mockOKX
+	slSz string
+}
+
+func (c *lossyOKX) PlaceAlgoOrder(req okx.AlgoOrderRequest) (*okx.AlgoOrderResponse, error) {
+	resp, err := c.mockOKX.PlaceAlgoOrder(req)
+	if err != nil || req.SlTriggerPx == "" || c.slSz == "" {
+		return resp, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := len(c.pending) - 1
+	if c.slSz == "0" {
+		c.pending = c.pending[:last]
+	} else {
+		c.pending[last].Sz = c.slSz
+	}
+	return resp, err
+}
+
+func TestAnalyzeAndPlaceTPSLVerifyPlacement(t *testing.T) {
+	tests := []struct {
+		name        string
+		verify      bool
+		slSz        string
+		expectFail  int
+		expectAlert string // alert message part, empty when no alert is expected
+	}{
+		{"orders live", true, "", 0, ""},
+		{"stop-loss silently dropped", true, "0", 1, "SL order mock-2 is not live"},
+		{"stop-loss smaller than placed", true, "1", 1, "live SL size 1 is below the 3 placed"},
+		{"verification disabled", false, "0", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &lossyOKX{mockOKX: &mockOKX{}, slSz: tt.slSz}
+			manager := newManagerWithClient(t, client)
+			manager.config.VerifyPlacement = tt.verify
+
+			logPath := filepath.Join(t.TempDir(), "alert.log")
+			alertLog, err := logger.New(logPath, logger.DEBUG, 10, 7, 3, false, false)
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			t.Cleanup(func() { alertLog.Close() })
+			alerter := alert.New(alertLog, time.Hour)
+			manager.SetAlerter(alerter)
+
+			position := testPosition()
+			summary, err := manager.AnalyzeAndPlaceTPSL([]*models.Position{position})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.OrdersPlaced != 1 {
+				t.Errorf("expected the pair to be placed, got %d placements", summary.OrdersPlaced)
+			}
+			if summary.UnverifiedPlacements != tt.expectFail {
+				t.Errorf("expected %d unverified placements, got %d", tt.expectFail, summary.UnverifiedPlacements)
+			}
+
+			if active := alerter.IsActive(unverifiedAlertKey(position)); active != (tt.expectAlert != "") {
+				t.Fatalf("expected verification alert active=%v, got %v", tt.expectAlert != "", active)
+			}
+			if tt.expectAlert != "" {
+				data, err := os.ReadFile(logPath)
+				if err != nil {
+					t.Fatalf("failed to read alert log: %v", err)
+				}
+				if !strings.Contains(string(data), tt.expectAlert) {
+					t.Errorf("expected alert containing %q, got:\n%s", tt.expectAlert, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package tpsl
+
+import (
+	"sync"
+	"time"
+)
+
+// LatencyStats 下单延迟统计 / Order placement latency statistics
+type LatencyStats struct {
+	Count int     `json:"count"`
+	MinMs float64 `json:"min_ms"`
+	AvgMs float64 `json:"avg_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+// latencyAggregate 延迟累计值 / Running latency aggregate
+type latencyAggregate struct {
+	count    int
+	min, max time.Duration
+	total    time.Duration
+}
+
+// add 累计一次耗时 / Add one duration
+func (a *latencyAggregate) add(d time.Duration) {
+	if a.count == 0 || d < a.min {
+		a.min = d
+	}
+	if d > a.max {
+		a.max = d
+	}
+	a.count++
+	a.total += d
+}
+
+// stats 转换为统计结果 / Convert to statistics
+func (a *latencyAggregate) stats() LatencyStats {
+	if a.count == 0 {
+		return LatencyStats{}
+	}
+	return LatencyStats{
+		Count: a.count,
+		MinMs: milliseconds(a.min),
+		AvgMs: milliseconds(a.total / time.Duration(a.count)),
+		MaxMs: milliseconds(a.max),
+	}
+}
+
+// milliseconds 将时长转换为毫秒 / Convert a duration to milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// latencyTracker 按交易品种记录下单延迟 / Placement latency recorder, overall and per instrument
+type latencyTracker struct {
+	mu           sync.Mutex
+	overall      latencyAggregate
+	byInstrument map[string]*latencyAggregate
+}
+
+// record 记录一次下单调用的耗时 / Record the duration of one placement call
+func (t *latencyTracker) record(instId string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.overall.add(d)
+	if t.byInstrument == nil {
+		t.byInstrument = make(map[string]*latencyAggregate)
+	}
+	agg, ok := t.byInstrument[instId]
+	if !ok {
+		agg = &latencyAggregate{}
+		t.byInstrument[instId] = agg
+	}
+	agg.add(d)
+}
+
+// snapshot 返回当前统计 / Return the current statistics
+func (t *latencyTracker) snapshot() (LatencyStats, map[string]LatencyStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byInstrument := make(map[string]LatencyStats, len(t.byInstrument))
+	for instId, agg := range t.byInstrument {
+		byInstrument[instId] = agg.stats()
+	}
+	return t.overall.stats(), byInstrument
+}
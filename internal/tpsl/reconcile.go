@@ -0,0 +1,122 @@
+package tpsl
+
+import (
+	"fmt"
+
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// ReconcileSummary 订单记录对账汇总 / Order record reconciliation summary
+type ReconcileSummary struct {
+	Checked    int `json:"checked"`    // live records loaded from storage
+	StillLive  int `json:"still_live"` // records whose order is still pending
+	Filled     int `json:"filled"`     // records marked filled
+	Cancelled  int `json:"cancelled"`  // records marked cancelled
+	Unresolved int `json:"unresolved"` // records whose final state could not be determined
+}
+
+// ReconcileOrders 对账订单记录与实际订单 / Reconcile order records with live orders
+// 启动时调用：加载状态为live的订单记录，与OKX待处理订单对比，
+// 对已不在待处理列表中的订单查询最终状态，并在数据库中标记为已成交或已撤销。
+// 无法确定状态的记录保持live，下次启动时重试
+// Call on startup: load records with status live, compare them with pending orders on OKX,
+// look up the final state of orders that are no longer pending and mark them filled or
+// cancelled in the database. Records whose state cannot be determined stay live and are
+// retried on the next startup
+//
+// Returns:
+//   - *ReconcileSummary: 对账汇总 / Reconciliation summary
+//   - error: 读取记录或查询待处理订单失败时返回错误 / Error loading records or querying pending orders
+func (m *Manager) ReconcileOrders() (*ReconcileSummary, error) {
+	summary := &ReconcileSummary{}
+	if m.storage == nil {
+		return summary, nil
+	}
+
+	records, err := m.storage.GetLiveTPSLOrders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TPSL order records: %w", err)
+	}
+	summary.Checked = len(records)
+	if len(records) == 0 {
+		m.logger.Info("No live TPSL order records to reconcile")
+		return summary, nil
+	}
+
+	pending, err := m.okxClient.GetPendingAlgoOrders("conditional")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending algo orders: %w", err)
+	}
+	pendingIds := make(map[string]bool, len(pending.Data))
+	for _, order := range pending.Data {
+		pendingIds[order.AlgoId] = true
+	}
+
+	for algoId, record := range records {
+		if pendingIds[algoId] {
+			summary.StillLive++
+			continue
+		}
+
+		status, ok := m.finalOrderStatus(algoId)
+		if !ok {
+			summary.Unresolved++
+			continue
+		}
+		if status == models.TPSLOrderStatusLive {
+			summary.StillLive++
+			continue
+		}
+
+		if err := m.storage.UpdateTPSLOrderStatus(algoId, status); err != nil {
+			m.logger.Warn("Failed to mark TPSL order %s as %s: %v", algoId, status, err)
+			summary.Unresolved++
+			continue
+		}
+
+		m.logger.Info("Reconciled %s order %s for %s (%s): %s",
+			record.Leg, algoId, record.Instrument, record.PositionSide, status)
+		if status == models.TPSLOrderStatusFilled {
+			summary.Filled++
+		} else {
+			summary.Cancelled++
+		}
+	}
+
+	m.logger.Info("TPSL order reconciliation complete: checked=%d, still_live=%d, filled=%d, cancelled=%d, unresolved=%d",
+		summary.Checked, summary.StillLive, summary.Filled, summary.Cancelled, summary.Unresolved)
+
+	return summary, nil
+}
+
+// finalOrderStatus 查询不再待处理的订单的最终状态 / Look up the final state of an order that is no longer pending
+//
+// Parameters:
+//   - algoId: 算法订单ID / Algo order ID
+//
+// Returns:
+//   - models.TPSLOrderStatus: 对应的记录状态 / Corresponding record status
+//   - bool: 是否确定了状态 / Whether the state could be determined
+func (m *Manager) finalOrderStatus(algoId string) (models.TPSLOrderStatus, bool) {
+	resp, err := m.okxClient.GetAlgoOrder(algoId)
+	if err != nil {
+		m.logger.Warn("Failed to look up TPSL order %s, leaving record live: %v", algoId, err)
+		return "", false
+	}
+	if len(resp.Data) == 0 {
+		m.logger.Warn("TPSL order %s not found, leaving record live", algoId)
+		return "", false
+	}
+
+	switch state := resp.Data[0].State; state {
+	case "effective", "partially_effective":
+		return models.TPSLOrderStatusFilled, true
+	case "canceled", "order_failed", "partially_failed":
+		return models.TPSLOrderStatusCancelled, true
+	case "live", "pause":
+		return models.TPSLOrderStatusLive, true
+	default:
+		m.logger.Warn("TPSL order %s has unknown state %q, leaving record live", algoId, state)
+		return "", false
+	}
+}
@@ -0,0 +1,92 @@
+package tpsl
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+func TestReconcileOrders(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v5/trade/orders-algo-pending":
+			w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"live1","instId":"BTC-USDT-SWAP","state":"live"}]}`))
+		case "/api/v5/trade/order-algo":
+			switch algoId := r.URL.Query().Get("algoId"); algoId {
+			case "filled1":
+				w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"filled1","state":"effective"}]}`))
+			case "cancelled1":
+				w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"cancelled1","state":"canceled"}]}`))
+			default:
+				w.Write([]byte(`{"code":"51603","msg":"Order does not exist","data":[]}`))
+			}
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+
+	db, err := storage.New(filepath.Join(t.TempDir(), "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	manager.SetStorage(db)
+
+	placedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, algoId := range []string{"live1", "filled1", "cancelled1", "missing1"} {
+		err := db.InsertTPSLOrder(&models.TPSLOrder{
+			AlgoID:       algoId,
+			Instrument:   "BTC-USDT-SWAP",
+			PositionSide: models.PositionSideLong,
+			Leg:          models.TPSLLegStopLoss,
+			Size:         3,
+			TriggerPrice: 49500,
+			PlacedAt:     placedAt,
+			Status:       models.TPSLOrderStatusLive,
+		})
+		if err != nil {
+			t.Fatalf("failed to insert order record: %v", err)
+		}
+	}
+
+	summary, err := manager.ReconcileOrders()
+	if err != nil {
+		t.Fatalf("ReconcileOrders() error = %v", err)
+	}
+	expected := ReconcileSummary{Checked: 4, StillLive: 1, Filled: 1, Cancelled: 1, Unresolved: 1}
+	if *summary != expected {
+		t.Errorf("expected summary %+v, got %+v", expected, *summary)
+	}
+
+	// Orders with a known final state leave the live set, unresolved ones stay for the next run
+	live, err := db.GetLiveTPSLOrders()
+	if err != nil {
+		t.Fatalf("GetLiveTPSLOrders() error = %v", err)
+	}
+	if len(live) != 2 {
+		t.Errorf("expected 2 live records, got %d", len(live))
+	}
+	for _, algoId := range []string{"live1", "missing1"} {
+		if _, ok := live[algoId]; !ok {
+			t.Errorf("expected %s to remain live", algoId)
+		}
+	}
+}
+
+func TestReconcileOrdersWithoutStorage(t *testing.T) {
+	manager := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL.Path)
+	})
+
+	summary, err := manager.ReconcileOrders()
+	if err != nil {
+		t.Fatalf("ReconcileOrders() error = %v", err)
+	}
+	if summary.Checked != 0 {
+		t.Errorf("expected nothing checked without storage, got %+v", summary)
+	}
+}
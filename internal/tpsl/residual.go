@@ -0,0 +1,61 @@
+package tpsl
+
+import (
+	"fmt"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// closeResidual 市价平掉未覆盖的残余仓位 / Close the uncovered residual at market
+// 用只减仓市价单平掉指定数量，已有止盈止损保护的部分保持不变。
+// 与ClosePosition不同，只平掉残余部分而非整个持仓，也不撤销挂单
+// Closes the given size with a reduce-only market order and leaves the protected portion as it
+// is. Unlike ClosePosition only the residual is closed, not the whole position, and pending
+// orders are not cancelled
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - size: 未覆盖的残余数量 / Uncovered residual size
+//
+// Returns:
+//   - error: 数量按精度取整后为0或下单失败时返回错误 / Error when the size rounds to zero or the order fails
+func (m *Manager) closeResidual(position *models.Position, size float64) error {
+	orderSide := "buy" // Close short position
+	if m.isLongPosition(position) {
+		orderSide = "sell" // Close long position
+	}
+
+	tdMode := position.MarginMode.String()
+	if tdMode == "" {
+		tdMode = models.MarginModeCross.String()
+	}
+
+	sz := m.orderFormatFor(position.Instrument).size(size)
+	if d, err := parseDecimal(sz); err != nil || !d.IsPositive() {
+		return fmt.Errorf("residual %s rounds to zero at the instrument's lot size", formatFloat(size))
+	}
+
+	req := okx.OrderRequest{
+		InstId:     position.Instrument,
+		TdMode:     tdMode,
+		Side:       orderSide,
+		PosSide:    m.orderPosSide(position),
+		OrdType:    "market",
+		Sz:         sz,
+		ReduceOnly: true,
+		Tag:        m.cfg().OrderTag,
+	}
+	resp, err := m.okxClient.PlaceOrder(req)
+	if err != nil {
+		return fmt.Errorf("reduce-only market order for %s failed: %w", sz, err)
+	}
+
+	ordId := ""
+	if len(resp.Data) > 0 {
+		ordId = resp.Data[0].OrdId
+	}
+	m.logger.Info("Closed uncovered residual %s of %s (%s) with market order %s",
+		sz, position.Instrument, position.PositionSide, ordId)
+	return nil
+}
@@ -0,0 +1,95 @@
+package tpsl
+
+import (
+	"fmt"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// marginRisk 止损成交时损失的保证金比例 / Fraction of margin lost if a stop fills
+// 计算为止损距离 / 入场价 × 杠杆；杠杆、入场价或止损价未知时为0
+// Computed as stop distance / entry price × leverage; 0 when leverage, entry or stop is unknown
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - slPrice: 止损价 / Stop-loss price
+//
+// Returns:
+//   - float64: 保证金损失比例（1 = 全部保证金）/ Fraction of margin lost (1 = all of it)
+func marginRisk(position *models.Position, slPrice float64) float64 {
+	if position.Leverage <= 0 || position.AveragePrice <= 0 || slPrice <= 0 {
+		return 0
+	}
+	entry := toDecimal(position.AveragePrice)
+	distance := entry.Sub(toDecimal(slPrice)).Abs()
+	return distance.Div(entry).Mul(toDecimal(position.Leverage)).InexactFloat64()
+}
+
+// stopRisk 已有止损的最大保证金损失比例 / Largest margin risk among a position's existing stops
+// 有多个止损时取离入场价最远的一个，即最坏情况
+// With several stops the one farthest from entry counts, the worst case
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - algoOrders: 待处理的算法订单 / Pending algo orders
+//
+// Returns:
+//   - float64: 保证金损失比例，没有止损或杠杆未知时为0 / Fraction of margin lost, 0 without a stop or known leverage
+func (m *Manager) stopRisk(position *models.Position, algoOrders []okx.AlgoOrder) float64 {
+	risk := 0.0
+	for _, order := range algoOrders {
+		if !m.matchesPosition(&order, position) {
+			continue
+		}
+		if trigger, err := parseDecimal(order.SlTriggerPx); err == nil && trigger.IsPositive() {
+			risk = max(risk, marginRisk(position, trigger.InexactFloat64()))
+		}
+	}
+	for _, attached := range position.AttachedTPSL {
+		risk = max(risk, marginRisk(position, attached.SlTriggerPx))
+	}
+	return risk
+}
+
+// marginRiskAlertKey 保证金风险告警键 / Alert key for the margin risk of a position
+func marginRiskAlertKey(position *models.Position) string {
+	return fmt.Sprintf("tpsl_margin_risk:%s:%s", position.Instrument, position.PositionSide)
+}
+
+// exceedsMarginRisk 检查止损的保证金风险是否超过上限 / Check a stop's margin risk against MaxMarginRisk
+// 高杠杆下看似很近的止损也可能损失大部分保证金，超过上限时告警；回到上限以内时解除告警。
+// 未启用或风险未知（0）时不检查
+// At high leverage a stop that looks tight can still lose most of the margin, so an alert is
+// raised above the cap and resolved once back within it. Not checked when disabled or when the
+// risk is unknown (0)
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - risk: 保证金损失比例 / Fraction of margin lost if the stop fills
+//
+// Returns:
+//   - bool: 是否超过上限 / Whether the cap is exceeded
+func (m *Manager) exceedsMarginRisk(position *models.Position, risk float64) bool {
+	limit := m.cfg().MaxMarginRisk
+	if limit <= 0 || risk <= 0 {
+		return false
+	}
+
+	if risk <= limit {
+		m.logger.Debug("Stop-Loss for %s (%s) risks %.2f%% of margin at %.2fx leverage",
+			position.Instrument, position.PositionSide, risk*100, position.Leverage)
+		if m.alerter != nil {
+			m.alerter.Resolve(marginRiskAlertKey(position))
+		}
+		return false
+	}
+
+	m.logger.Warn("Stop-Loss for %s (%s) risks %.2f%% of margin at %.2fx leverage, above the %.2f%% cap",
+		position.Instrument, position.PositionSide, risk*100, position.Leverage, limit*100)
+	if m.alerter != nil {
+		m.alerter.Alert(marginRiskAlertKey(position), "%s (%s) stop-loss risks %.2f%% of margin at %.2fx leverage, above the %.2f%% cap",
+			position.Instrument, position.PositionSide, risk*100, position.Leverage, limit*100)
+	}
+	return true
+}
@@ -2,8 +2,15 @@ package tpsl
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/wTHU1Ew/TenyoJubaku/internal/clock"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
 	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
@@ -15,16 +22,25 @@ import (
 // 负责定期检查持仓并触发TPSL管理
 // Responsible for periodic position checking and triggering TPSL management
 type Scheduler struct {
-	manager  *Manager
-	storage  *storage.Storage
-	config   *config.TPSLConfig
-	logger   *logger.Logger
-	ticker   *time.Ticker
-	ctx      context.Context
-	cancel   context.CancelFunc
-	done     chan struct{}
+	manager   *Manager
+	storage   *storage.Storage
+	okxClient OKXAPI
+	config    *config.TPSLConfig
+	logger    *logger.Logger
+	ticker    *time.Ticker
+	done      chan struct{}
+	trigger   chan struct{}
+	checkMu   sync.Mutex  // serializes scheduled and on-demand checks
+	clock     clock.Clock // snapshot age and live position timestamps
+	paused    atomic.Bool // scheduled checks are skipped while set
 }
 
+// ErrSnapshotStale 持仓快照已过期 / Position snapshot is too old to act on
+var ErrSnapshotStale = errors.New("position snapshot is stale")
+
+// ErrPlacementFailures 单次检查中有TPSL下单失败 / Some TPSL placements failed during a single-run check
+var ErrPlacementFailures = errors.New("TPSL placement failures")
+
 // NewScheduler 创建TPSL调度器 / Create TPSL scheduler
 // 初始化TPSL调度器实例
 // Initialize TPSL scheduler instance
@@ -37,51 +53,101 @@ type Scheduler struct {
 //
 // Returns:
 //   - *Scheduler: TPSL调度器实例 / TPSL scheduler instance
-func NewScheduler(config *config.TPSLConfig, storage *storage.Storage, okxClient *okx.Client, logger *logger.Logger) *Scheduler {
+func NewScheduler(config *config.TPSLConfig, storage *storage.Storage, okxClient OKXAPI, logger *logger.Logger) *Scheduler {
 	manager := New(config, okxClient, logger)
-	ctx, cancel := context.WithCancel(context.Background())
+	manager.SetStorage(storage)
 
 	return &Scheduler{
-		manager: manager,
-		storage: storage,
-		config:  config,
-		logger:  logger,
-		ctx:     ctx,
-		cancel:  cancel,
-		done:    make(chan struct{}),
+		manager:   manager,
+		storage:   storage,
+		okxClient: okxClient,
+		config:    config,
+		logger:    logger,
+		done:      make(chan struct{}),
+		trigger:   make(chan struct{}, 1),
+		clock:     clock.Real{},
+	}
+}
+
+// SetClock 设置时钟 / Set clock
+// 同时设置调度器与其TPSL管理器使用的时钟
+// Sets the clock used by both the scheduler and its TPSL manager
+//
+// Parameters:
+//   - clk: Clock instance, nil keeps the current clock
+func (s *Scheduler) SetClock(clk clock.Clock) {
+	if clk == nil {
+		return
 	}
+	s.clock = clk
+	s.manager.SetClock(clk)
+}
+
+// Manager 获取调度器使用的TPSL管理器 / Get the TPSL manager used by the scheduler
+func (s *Scheduler) Manager() *Manager {
+	return s.manager
 }
 
 // Start 启动TPSL调度器 / Start TPSL scheduler
 // 开始定期执行TPSL检查
 // Start periodic TPSL checks
-func (s *Scheduler) Start() {
-	interval := time.Duration(s.config.CheckInterval) * time.Second
-	s.ticker = time.NewTicker(interval)
+//
+// Parameters:
+//   - ctx: 控制调度器生命周期的上下文，取消后进行中的检查完成后退出
+//     Context controlling the scheduler lifetime; once cancelled, an in-progress check finishes before exit
+func (s *Scheduler) Start(ctx context.Context) {
+	s.ticker = time.NewTicker(s.config.CheckInterval.Duration())
+
+	s.logger.Info("TPSL scheduler started with interval %d seconds, position source: %s", s.config.CheckInterval, s.config.PositionSource)
+
+	go s.run(ctx)
+}
 
-	s.logger.Info("TPSL scheduler started with interval %d seconds", s.config.CheckInterval)
+// Done 返回调度器退出时关闭的通道 / Return channel closed when the scheduler has exited
+// 用于关闭时等待进行中的检查完成 / Used on shutdown to wait for the in-progress check to finish
+func (s *Scheduler) Done() <-chan struct{} {
+	return s.done
+}
 
-	go s.run()
+// TriggerCheck 请求立即执行一次TPSL检查 / Request an immediate TPSL check
+// 非阻塞；检查进行中时多次请求合并为一次
+// Non-blocking; multiple requests while a check is pending are coalesced into one
+func (s *Scheduler) TriggerCheck() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
 }
 
-// Stop 停止TPSL调度器 / Stop TPSL scheduler
-// 优雅地停止调度器
-// Gracefully stop the scheduler
-func (s *Scheduler) Stop() {
-	s.logger.Info("Stopping TPSL scheduler...")
-	s.cancel()
-	if s.ticker != nil {
-		s.ticker.Stop()
+// Pause 暂停定时TPSL检查 / Pause scheduled TPSL checks
+// 用于人工处理订单期间，避免调度器与人工操作冲突；监控服务照常记录数据，
+// 通过管理接口请求的检查仍会执行
+// For manual order management during incidents, so the scheduler doesn't fight the operator;
+// the monitor keeps recording data and checks requested through the admin API still run
+func (s *Scheduler) Pause() {
+	if !s.paused.Swap(true) {
+		s.logger.Warn("TPSL scheduler paused, scheduled checks will be skipped until resumed")
 	}
-	<-s.done // Wait for run goroutine to finish
-	s.logger.Info("TPSL scheduler stopped")
+}
+
+// Resume 恢复定时TPSL检查 / Resume scheduled TPSL checks
+func (s *Scheduler) Resume() {
+	if s.paused.Swap(false) {
+		s.logger.Info("TPSL scheduler resumed")
+	}
+}
+
+// Paused 定时检查是否已暂停 / Whether scheduled checks are paused
+func (s *Scheduler) Paused() bool {
+	return s.paused.Load()
 }
 
 // run 运行调度循环 / Run scheduler loop
 // 执行定期TPSL检查的主循环
 // Main loop for periodic TPSL checks
-func (s *Scheduler) run() {
+func (s *Scheduler) run(ctx context.Context) {
 	defer close(s.done)
+	defer s.ticker.Stop()
 
 	// Run initial check immediately
 	s.runCheck()
@@ -89,18 +155,32 @@ func (s *Scheduler) run() {
 	// Then run periodic checks
 	for {
 		select {
-		case <-s.ctx.Done():
+		case <-ctx.Done():
+			s.logger.Info("TPSL scheduler stopped")
 			return
 		case <-s.ticker.C:
+			// A tick and cancellation may be ready together; don't start a new check after shutdown
+			if ctx.Err() != nil {
+				s.logger.Info("TPSL scheduler stopped")
+				return
+			}
+			s.runCheck()
+		case <-s.trigger:
+			s.logger.Info("Running triggered TPSL check")
 			s.runCheck()
 		}
 	}
 }
 
 // runCheck 执行一次TPSL检查 / Run one TPSL check
-// 执行一次完整的TPSL检查周期
-// Execute one complete TPSL check cycle
+// 执行一次完整的TPSL检查周期，暂停时跳过
+// Execute one complete TPSL check cycle, skipped while paused
 func (s *Scheduler) runCheck() {
+	if s.paused.Load() {
+		s.logger.Info("TPSL scheduler paused, skipping check")
+		return
+	}
+
 	// Use defer/recover to prevent panics from crashing the scheduler
 	defer func() {
 		if r := recover(); r != nil {
@@ -108,13 +188,141 @@ func (s *Scheduler) runCheck() {
 		}
 	}()
 
+	summary, err := s.RunCheck()
+	if errors.Is(err, ErrSnapshotStale) {
+		return // Already logged by loadPositions
+	}
+	if okx.IsMaintenance(err) {
+		s.logger.Warn("TPSL check skipped, OKX in maintenance: %v", err)
+		return
+	}
+	if err != nil {
+		s.logger.Error("TPSL check failed: %v", err)
+		return
+	}
+
+	s.logger.Info("TPSL check cycle completed: %d positions checked, %d orders placed, %d failures",
+		summary.TotalChecked, summary.OrdersPlaced, summary.PlacementFailures)
+}
+
+// RunOnce 执行一次TPSL检查并输出汇总 / Run a single TPSL check and print the summary
+// 用于cron等外部调度，不启动定时循环；覆盖汇总以JSON格式写入out
+// For cron and other external schedulers, without starting the ticker loop; the coverage
+// summary is written to out as JSON
+//
+// Parameters:
+//   - out: 汇总输出目标（通常为标准输出）/ Summary destination (usually stdout)
+//
+// Returns:
+//   - *CoverageSummary: 覆盖情况汇总 / Coverage summary
+//   - error: 检查失败时返回RunCheck的错误；存在下单失败时返回包装ErrPlacementFailures的错误
+//     RunCheck's error when the check fails; an error wrapping ErrPlacementFailures when placements failed
+func (s *Scheduler) RunOnce(out io.Writer) (*CoverageSummary, error) {
+	summary, err := s.RunCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(summary); err != nil {
+		return summary, fmt.Errorf("failed to write coverage summary: %w", err)
+	}
+
+	if summary.PlacementFailures > 0 {
+		return summary, fmt.Errorf("%w: %d of %d checked positions", ErrPlacementFailures, summary.PlacementFailures, summary.TotalChecked)
+	}
+	return summary, nil
+}
+
+// RunCheck 同步执行一次TPSL检查 / Run one TPSL check synchronously
+// 与定时检查互斥执行，避免并发检查重复下单
+// Serialized with scheduled checks so concurrent runs cannot place duplicate orders
+//
+// Returns:
+//   - *CoverageSummary: 覆盖情况汇总 / Coverage summary
+//   - error: 加载持仓或TPSL分析失败时返回错误，快照过期时返回ErrSnapshotStale
+//     Error on position loading or analysis failure, ErrSnapshotStale when the snapshot is too old
+func (s *Scheduler) RunCheck() (*CoverageSummary, error) {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+
 	s.logger.Debug("Starting TPSL check cycle")
 
-	// Fetch current positions from database
-	positionsSlice, err := s.storage.GetLatestPositions()
+	// Load current positions
+	positions, err := s.currentPositions()
 	if err != nil {
-		s.logger.Error("Failed to fetch positions from storage: %v", err)
-		return
+		return nil, err
+	}
+
+	// Run TPSL analysis and placement
+	summary, err := s.manager.AnalyzeAndPlaceTPSL(positions)
+	if err != nil {
+		return nil, fmt.Errorf("TPSL analysis failed: %w", err)
+	}
+
+	return summary, nil
+}
+
+// Coverage 查询当前持仓的TPSL覆盖状态 / Report TPSL coverage of current positions
+// 不下单，仅返回每个持仓的覆盖状态
+// Does not place orders, only reports each position's coverage
+//
+// Returns:
+//   - []PositionCoverage: 每个持仓的覆盖状态 / Coverage status of each position
+//   - error: 加载持仓或查询订单失败时返回错误 / Error on position loading or order query failure
+func (s *Scheduler) Coverage() ([]PositionCoverage, error) {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+
+	positions, err := s.currentPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.manager.AnalyzeCoverage(positions)
+}
+
+// currentPositions 加载持仓，快照过期时返回ErrSnapshotStale / Load positions, ErrSnapshotStale when stale
+func (s *Scheduler) currentPositions() ([]*models.Position, error) {
+	positions, ok, err := s.loadPositions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load positions (source: %s): %w", s.config.PositionSource, err)
+	}
+	if !ok {
+		return nil, ErrSnapshotStale
+	}
+	return positions, nil
+}
+
+// loadPositions 加载用于TPSL检查的持仓 / Load positions for TPSL check
+// 根据配置的持仓来源加载持仓：live模式直接查询OKX，db模式读取数据库最新快照并检查是否过期
+// Load positions from the configured source: "live" queries OKX directly,
+// "db" reads the latest stored snapshot and checks whether it is stale
+//
+// 如果监控服务连续多个周期失败，最新快照可能已不反映真实持仓，
+// 此时跳过本次检查，避免对已平仓的持仓下单
+// If the monitor has failed for several cycles the latest snapshot may no longer reflect
+// real positions, so the check is skipped to avoid acting on positions that are already closed
+//
+// Returns:
+//   - []*models.Position: 持仓列表 / List of positions
+//   - bool: 是否继续本次检查 / Whether the check should proceed (false when snapshot is stale)
+//   - error: 数据库查询或API请求失败时返回错误 / Error on database query or API request failure
+func (s *Scheduler) loadPositions() ([]*models.Position, bool, error) {
+	if s.config.PositionSource == "live" {
+		positions, err := s.fetchLivePositions()
+		if err != nil {
+			return nil, false, err
+		}
+		s.logger.Debug("Using live positions from OKX API (%d positions)", len(positions))
+		return positions, true, nil
+	}
+
+	// Read the snapshot however old it is, staleness is judged against MaxSnapshotAge below
+	positionsSlice, err := s.storage.GetLatestPositionsWithOptions(storage.QueryOptions{IncludeStale: true})
+	if err != nil {
+		return nil, false, err
 	}
 
 	// Convert to pointers for manager
@@ -123,13 +331,85 @@ func (s *Scheduler) runCheck() {
 		positions[i] = &positionsSlice[i]
 	}
 
-	// Run TPSL analysis and placement
-	summary, err := s.manager.AnalyzeAndPlaceTPSL(positions)
+	if len(positions) == 0 {
+		return positions, true, nil // No snapshot stored yet
+	}
+
+	// All rows of a snapshot share the same timestamp
+	snapshotTime := positions[0].Timestamp
+	age := s.clock.Now().Sub(snapshotTime)
+	maxAge := time.Duration(s.config.MaxSnapshotAge) * time.Second
+
+	if age > maxAge {
+		if s.monitorRunning(snapshotTime, maxAge) {
+			s.logger.Debug("No positions stored since %s while the monitor kept running, treating the account as flat",
+				snapshotTime.Format(time.RFC3339))
+			return []*models.Position{}, true, nil
+		}
+		s.logger.Warn("Position snapshot from %s is stale (age %v > max %v), skipping TPSL check - is the monitor running?",
+			snapshotTime.Format(time.RFC3339), age.Truncate(time.Second), maxAge)
+		return nil, false, nil
+	}
+
+	s.logger.Debug("Using database position snapshot from %s (age %v, %d positions)",
+		snapshotTime.Format(time.RFC3339), age.Truncate(time.Second), len(positions))
+
+	return positions, true, nil
+}
+
+// monitorRunning 判断监控服务在持仓快照之后是否仍在运行 / Whether the monitor kept running after a position snapshot
+// 持仓为空时监控服务不写入持仓记录，但每个周期都写入余额快照；
+// 持仓快照之后有未过期的余额快照，说明持仓已平仓，而不是监控服务停止
+// The monitor stores no position rows while the account is flat but stores a balance snapshot
+// every cycle, so a balance snapshot newer than the position snapshot and within maxAge means
+// the positions were closed rather than the monitor having stopped
+//
+// Parameters:
+//   - snapshotTime: 最新持仓快照时间 / Time of the latest position snapshot
+//   - maxAge: 快照最大允许年龄 / Maximum allowed snapshot age
+//
+// Returns:
+//   - bool: 监控服务是否仍在运行 / Whether the monitor is still running
+func (s *Scheduler) monitorRunning(snapshotTime time.Time, maxAge time.Duration) bool {
+	balances, err := s.storage.GetLatestAccountBalances()
 	if err != nil {
-		s.logger.Error("TPSL analysis failed: %v", err)
-		return
+		s.logger.Warn("Failed to get latest balance snapshot: %v", err)
+		return false
 	}
+	if len(balances) == 0 {
+		return false
+	}
+	latest := balances[0].Timestamp
+	return latest.After(snapshotTime) && s.clock.Now().Sub(latest) <= maxAge
+}
 
-	s.logger.Info("TPSL check cycle completed: %d positions checked, %d orders placed, %d failures",
-		summary.TotalChecked, summary.OrdersPlaced, summary.PlacementFailures)
+// fetchLivePositions 从OKX获取实时持仓 / Fetch live positions from OKX
+// 直接调用OKX持仓接口并转换为持仓模型，不依赖监控服务写入的快照
+// Call OKX positions API directly and convert to position models, independent of monitor snapshots
+//
+// Returns:
+//   - []*models.Position: 当前持仓列表（已跳过零仓位）/ Current positions (zero-size positions skipped)
+//   - error: API请求失败时返回错误 / Error on API request failure
+func (s *Scheduler) fetchLivePositions() ([]*models.Position, error) {
+	resp, err := s.okxClient.GetPositions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get positions: %w", err)
+	}
+
+	timestamp := s.clock.Now().UTC()
+	positions := make([]*models.Position, 0, len(resp.Data))
+	for _, pos := range resp.Data {
+		position, skip, err := okx.PositionFromOKX(pos)
+		if skip {
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("Failed to parse live position: %v", err)
+			continue
+		}
+		position.Timestamp = timestamp
+		positions = append(positions, position)
+	}
+
+	return positions, nil
 }
@@ -0,0 +1,245 @@
+package tpsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wTHU1Ew/TenyoJubaku/internal/config"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/logger"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/storage"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// newTestScheduler creates a scheduler backed by a temporary database
+func newTestScheduler(t *testing.T, cfg *config.TPSLConfig) (*Scheduler, *storage.Storage) {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	db, err := storage.New(filepath.Join(tmpDir, "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	log, err := logger.New(filepath.Join(tmpDir, "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	client := okx.New("http://127.0.0.1:0", "key", "secret", "pass", 1, 0, false)
+	return NewScheduler(cfg, db, client, log), db
+}
+
+func TestLoadPositionsSnapshotAge(t *testing.T) {
+	tests := []struct {
+		name          string
+		snapshotAge   time.Duration
+		balanceAge    time.Duration // 0 stores no balance snapshot
+		expectProceed bool
+		expectCount   int
+	}{
+		{
+			name:          "fresh snapshot",
+			snapshotAge:   10 * time.Second,
+			expectProceed: true,
+			expectCount:   1,
+		},
+		{
+			name:          "stale snapshot",
+			snapshotAge:   5 * time.Minute,
+			expectProceed: false,
+			expectCount:   0,
+		},
+		{
+			// Past the storage layer's own 10-minute cutoff, which must not make it look flat
+			name:          "snapshot older than 10 minutes",
+			snapshotAge:   2 * time.Hour,
+			expectProceed: false,
+			expectCount:   0,
+		},
+		{
+			name:          "stale balances too",
+			snapshotAge:   2 * time.Hour,
+			balanceAge:    time.Hour,
+			expectProceed: false,
+			expectCount:   0,
+		},
+		{
+			name:          "monitor running on a flat account",
+			snapshotAge:   2 * time.Hour,
+			balanceAge:    10 * time.Second,
+			expectProceed: true,
+			expectCount:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.TPSLConfig{MaxSnapshotAge: 60}
+			scheduler, db := newTestScheduler(t, cfg)
+
+			position := &models.Position{
+				Timestamp:    time.Now().UTC().Add(-tt.snapshotAge),
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: models.PositionSideLong,
+				PositionSize: 1,
+				AveragePrice: 50000,
+				MarginMode:   models.MarginModeCross,
+			}
+			if err := db.InsertPosition(position); err != nil {
+				t.Fatalf("failed to insert position: %v", err)
+			}
+			if tt.balanceAge > 0 {
+				balance := &models.AccountBalance{Timestamp: time.Now().UTC().Add(-tt.balanceAge), Currency: "USDT", Balance: 1000}
+				if err := db.InsertAccountBalance(balance); err != nil {
+					t.Fatalf("failed to insert balance: %v", err)
+				}
+			}
+
+			positions, proceed, err := scheduler.loadPositions()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if proceed != tt.expectProceed {
+				t.Errorf("expected proceed=%v, got %v", tt.expectProceed, proceed)
+			}
+			if len(positions) != tt.expectCount {
+				t.Errorf("expected %d positions, got %d", tt.expectCount, len(positions))
+			}
+		})
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		orderResponse string
+		expectError   error
+		expectPlaced  int
+		expectFailed  int
+	}{
+		{
+			name:          "placement succeeds",
+			orderResponse: `{"code":"0","msg":"","data":[{"algoId":"new","sCode":"0"}]}`,
+			expectPlaced:  1,
+		},
+		{
+			name:          "placement fails",
+			orderResponse: `{"code":"1","msg":"","data":[{"algoId":"","sCode":"51008","sMsg":"Insufficient margin"}]}`,
+			expectError:   ErrPlacementFailures,
+			expectFailed:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v5/account/positions":
+					w.Write([]byte(`{"code":"0","msg":"","data":[
+						{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"3","avgPx":"50000","mgnMode":"cross"}]}`))
+				case "/api/v5/trade/orders-algo-pending":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`))
+				case "/api/v5/market/ticker":
+					w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","last":"50000"}]}`))
+				case "/api/v5/trade/order-algo":
+					w.Write([]byte(tt.orderResponse))
+				case "/api/v5/public/instruments":
+					w.Write([]byte(`{"code":"0","msg":"","data":[]}`)) // No metadata, generic precision
+				default:
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+			}))
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			db, err := storage.New(filepath.Join(tmpDir, "test.db"), true, 1, 1)
+			if err != nil {
+				t.Fatalf("failed to create storage: %v", err)
+			}
+			defer db.Close()
+			log, err := logger.New(filepath.Join(tmpDir, "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			defer log.Close()
+
+			cfg := &config.TPSLConfig{VolatilityPct: 0.01, ProfitLossRatio: 5.0, PriceBufferPct: 0.001, PositionSource: "live"}
+			client := okx.New(server.URL, "key", "secret", "pass", 5, 0, false)
+			scheduler := NewScheduler(cfg, db, client, log)
+
+			var out bytes.Buffer
+			summary, err := scheduler.RunOnce(&out)
+			if tt.expectError == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectError != nil && !errors.Is(err, tt.expectError) {
+				t.Fatalf("expected %v, got %v", tt.expectError, err)
+			}
+			if summary.OrdersPlaced != tt.expectPlaced || summary.PlacementFailures != tt.expectFailed {
+				t.Errorf("expected placed=%d failures=%d, got %+v", tt.expectPlaced, tt.expectFailed, summary)
+			}
+
+			// The summary is printed even when placements failed
+			var printed CoverageSummary
+			if err := json.Unmarshal(out.Bytes(), &printed); err != nil {
+				t.Fatalf("failed to decode printed summary %q: %v", out.String(), err)
+			}
+			if printed != *summary {
+				t.Errorf("printed summary %+v does not match returned %+v", printed, *summary)
+			}
+		})
+	}
+}
+
+func TestSchedulerPauseResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := storage.New(filepath.Join(tmpDir, "test.db"), true, 1, 1)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	log, err := logger.New(filepath.Join(tmpDir, "test.log"), logger.DEBUG, 10, 7, 3, false, false)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	position := testPosition()
+	position.Timestamp = time.Now().UTC()
+	if err := db.InsertPosition(position); err != nil {
+		t.Fatalf("failed to insert position: %v", err)
+	}
+
+	cfg := &config.TPSLConfig{VolatilityPct: 0.01, ProfitLossRatio: 5.0, PriceBufferPct: 0.001, PositionSource: "db", MaxSnapshotAge: 60}
+	client := &mockOKX{last: map[string]string{"BTC-USDT-SWAP": "50000"}}
+	scheduler := NewScheduler(cfg, db, client, log)
+
+	// A paused scheduler skips its checks
+	scheduler.Pause()
+	if !scheduler.Paused() {
+		t.Fatal("expected scheduler to be paused")
+	}
+	scheduler.runCheck()
+	if len(client.placed) != 0 {
+		t.Fatalf("expected no orders while paused, got %d", len(client.placed))
+	}
+
+	// Placement resumes with the next check
+	scheduler.Resume()
+	if scheduler.Paused() {
+		t.Fatal("expected scheduler to be resumed")
+	}
+	scheduler.runCheck()
+	if len(client.placed) != 2 {
+		t.Errorf("expected TP and SL placed after resume, got %d orders", len(client.placed))
+	}
+}
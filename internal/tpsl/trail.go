@@ -0,0 +1,240 @@
+package tpsl
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// highWaterMark 持仓的最有利价格 / Most favourable price seen for a position
+type highWaterMark struct {
+	long  bool    // direction the mark was tracked for, a flipped net position starts over
+	price float64 // highest price for longs, lowest for shorts
+}
+
+// trailKey 高水位记录键 / High-water mark key of a position
+func trailKey(position *models.Position) string {
+	return position.Instrument + ":" + position.PositionSide.String()
+}
+
+// pruneHighWater 清除已平仓持仓的高水位 / Drop high-water marks of closed positions
+// 平仓后重新开仓的持仓需等价格再次越过激活价才开始跟踪
+// A position reopened after a close only trails again once price passes its activation level
+//
+// Parameters:
+//   - positions: 当前持仓 / Current positions
+func (m *Manager) pruneHighWater(positions []*models.Position) {
+	held := make(map[string]bool, len(positions))
+	for _, position := range positions {
+		held[trailKey(position)] = true
+	}
+
+	m.trailMu.Lock()
+	defer m.trailMu.Unlock()
+	for key := range m.highWater {
+		if !held[key] {
+			delete(m.highWater, key)
+		}
+	}
+}
+
+// updateHighWater 更新持仓的高水位 / Update the high-water mark of a position
+// 价格越过激活价（入场价按TPTrailActivationPct向盈利方向偏移）后开始跟踪，之后只向有利方向移动
+// Tracking starts once price passes the activation level (entry moved by TPTrailActivationPct
+// in the profitable direction) and afterwards only moves in the favourable direction
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - isLong: 是否为多头 / Whether the position is long
+//   - price: 当前标记价格 / Current mark price
+//
+// Returns:
+//   - float64: 当前高水位 / Current high-water mark
+//   - bool: 是否已激活跟踪 / Whether trailing is active
+func (m *Manager) updateHighWater(position *models.Position, isLong bool, price float64) (float64, bool) {
+	key := trailKey(position)
+
+	m.trailMu.Lock()
+	defer m.trailMu.Unlock()
+
+	mark, ok := m.highWater[key]
+	if ok && mark.long == isLong {
+		if (isLong && price > mark.price) || (!isLong && price < mark.price) {
+			mark.price = price
+			m.highWater[key] = mark
+		}
+		return mark.price, true
+	}
+
+	activation := toDecimal(m.cfg().TPTrailActivationPct)
+	entry := toDecimal(position.AveragePrice)
+	current := toDecimal(price)
+	if isLong && current.LessThan(entry.Mul(decimal.NewFromInt(1).Add(activation))) {
+		delete(m.highWater, key)
+		return 0, false
+	}
+	if !isLong && current.GreaterThan(entry.Mul(decimal.NewFromInt(1).Sub(activation))) {
+		delete(m.highWater, key)
+		return 0, false
+	}
+
+	m.highWater[key] = highWaterMark{long: isLong, price: price}
+	return price, true
+}
+
+// trailTriggers 根据高水位计算跟踪的触发价 / Compute trailed trigger prices from a high-water mark
+// 止盈保持在高水位之外distance处，不封顶趋势；止损跟在高水位之后distance处，锁定利润
+// The TP stays distance beyond the high-water mark so it does not cap the trend; the SL trails
+// distance behind it to lock in profit
+//
+// Parameters:
+//   - isLong: 是否为多头 / Whether the position is long
+//   - highWater: 高水位 / High-water mark
+//   - distance: 跟踪距离（高水位的比例）/ Trail distance as a fraction of the high-water mark
+//
+// Returns:
+//   - decimal.Decimal: 止盈触发价 / Take-profit trigger price
+//   - decimal.Decimal: 止损触发价 / Stop-loss trigger price
+func trailTriggers(isLong bool, highWater, distance float64) (decimal.Decimal, decimal.Decimal) {
+	hwm := toDecimal(highWater)
+	offset := hwm.Mul(toDecimal(distance))
+	if isLong {
+		return hwm.Add(offset), hwm.Sub(offset)
+	}
+	return hwm.Sub(offset), hwm.Add(offset)
+}
+
+// trailTakeProfit 随价格推进锁定利润 / Ratchet TP and SL as price advances
+// 在TPTrailDistancePct大于0时，对已完整覆盖且止盈止损各有一个可修改订单的持仓：
+// 价格越过激活价后记录高水位，并将触发价只向有利方向修改（多头上移，空头下移），
+// 从不放宽已有的止盈或止损
+// With TPTrailDistancePct above 0, for a fully covered position with one amendable order per
+// leg: once price passes the activation level the high-water mark is tracked and the triggers
+// are amended in the favourable direction only (up for longs, down for shorts), never
+// loosening an existing TP or SL
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - algoOrders: 待处理的算法订单 / Pending algo orders
+//
+// Returns:
+//   - bool: 是否修改了订单 / Whether an order was amended
+//   - error: 获取价格或修改订单失败时返回错误 / Error fetching the price or amending an order
+func (m *Manager) trailTakeProfit(position *models.Position, algoOrders []okx.AlgoOrder) (bool, error) {
+	distance := m.cfg().TPTrailDistancePct
+	if distance <= 0 {
+		return false, nil
+	}
+
+	tp, sl, ok := m.chooseAmendTargets(position, algoOrders)
+	if !ok || tp == nil || sl == nil {
+		return false, nil
+	}
+
+	price := position.MarkPx
+	if price <= 0 {
+		var err error
+		if price, err = m.getCurrentMarketPrice(position.Instrument); err != nil {
+			return false, fmt.Errorf("failed to get price for trailing: %w", err)
+		}
+	}
+
+	isLong := m.isLongPosition(position)
+	highWater, active := m.updateHighWater(position, isLong, price)
+	if !active {
+		return false, nil
+	}
+
+	format := m.orderFormatFor(position.Instrument)
+	targetTP, targetSL := trailTriggers(isLong, highWater, distance)
+	newTP := ratchetTrigger(tp.TpTriggerPx, targetTP, isLong, format)
+	newSL := ratchetTrigger(sl.SlTriggerPx, targetSL, isLong, format)
+	if newSL != "" && crossesPrice(newSL, price, isLong) {
+		// Price has already retraced past the trailed stop, which OKX would reject
+		m.logger.Warn("Trailed Stop-Loss %s for %s (%s) is through the current price %s, keeping %s",
+			newSL, position.Instrument, position.PositionSide, formatFloat(price), sl.SlTriggerPx)
+		newSL = ""
+	}
+	if newTP == "" && newSL == "" {
+		return false, nil
+	}
+
+	// Combined TP/SL order: amend both triggers at once
+	if tp.AlgoId == sl.AlgoId {
+		if _, err := m.okxClient.AmendAlgoOrder(tp.InstId, tp.AlgoId, "", newTP, newSL); err != nil {
+			return false, fmt.Errorf("trailing amend of %s failed: %w", tp.AlgoId, err)
+		}
+		m.logTrail(position, highWater, tp.AlgoId, newTP, newSL)
+		return true, nil
+	}
+
+	// Raise the stop first so a partial failure never leaves only the TP moved away
+	if newSL != "" {
+		if _, err := m.okxClient.AmendAlgoOrder(sl.InstId, sl.AlgoId, "", "", newSL); err != nil {
+			return false, fmt.Errorf("trailing Stop-Loss amend of %s failed: %w", sl.AlgoId, err)
+		}
+		m.logTrail(position, highWater, sl.AlgoId, "", newSL)
+	}
+	if newTP != "" {
+		if _, err := m.okxClient.AmendAlgoOrder(tp.InstId, tp.AlgoId, "", newTP, ""); err != nil {
+			return newSL != "", fmt.Errorf("trailing Take-Profit amend of %s failed: %w", tp.AlgoId, err)
+		}
+		m.logTrail(position, highWater, tp.AlgoId, newTP, "")
+	}
+	return true, nil
+}
+
+// ratchetTrigger 计算只向有利方向移动的触发价 / Compute a trigger that only moves favourably
+//
+// Parameters:
+//   - current: 当前触发价 / Current trigger price
+//   - target: 跟踪目标触发价 / Trailed target trigger price
+//   - isLong: 是否为多头 / Whether the position is long
+//   - format: 下单精度 / Order precision
+//
+// Returns:
+//   - string: 新的触发价，无需修改时为空 / New trigger price, empty when no amend is needed
+func ratchetTrigger(current string, target decimal.Decimal, isLong bool, format orderFormat) string {
+	formatted := format.price(target.InexactFloat64())
+	next, err := parseDecimal(formatted)
+	if err != nil || !next.IsPositive() {
+		return ""
+	}
+	if existing, err := parseDecimal(current); err == nil {
+		if isLong && !next.GreaterThan(existing) {
+			return ""
+		}
+		if !isLong && !next.LessThan(existing) {
+			return ""
+		}
+	}
+	return formatted
+}
+
+// crossesPrice 判断止损触发价是否已越过当前价格 / Check if a stop trigger is at or through the current price
+func crossesPrice(trigger string, price float64, isLong bool) bool {
+	d, err := parseDecimal(trigger)
+	if err != nil {
+		return true
+	}
+	if isLong {
+		return !d.LessThan(toDecimal(price))
+	}
+	return !d.GreaterThan(toDecimal(price))
+}
+
+// logTrail 记录跟踪修改 / Log a trailing amend
+func (m *Manager) logTrail(position *models.Position, highWater float64, algoId, newTP, newSL string) {
+	m.logger.Info("Trailing TPSL order %s for %s (%s) at high-water %s: tp=%s sl=%s",
+		algoId, position.Instrument, position.PositionSide, formatFloat(highWater), valueOrKept(newTP), valueOrKept(newSL))
+}
+
+// valueOrKept 日志中未修改的触发价显示为kept / Show an unchanged trigger as kept in logs
+func valueOrKept(s string) string {
+	if s == "" {
+		return "kept"
+	}
+	return s
+}
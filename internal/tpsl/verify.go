@@ -0,0 +1,154 @@
+package tpsl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/wTHU1Ew/TenyoJubaku/internal/okx"
+	"github.com/wTHU1Ew/TenyoJubaku/pkg/models"
+)
+
+// placedOrder 本次检查中下单的订单，待下单后验证 / Order placed in the current check, awaiting verification
+type placedOrder struct {
+	position *models.Position
+	leg      models.TPSLLeg
+	algoId   string
+	size     float64
+}
+
+// notePlaced 记录待验证的已下单订单 / Note a placed order for post-placement verification
+// 仅在启用VerifyPlacement时记录 / Only noted when VerifyPlacement is enabled
+func (m *Manager) notePlaced(position *models.Position, leg models.TPSLLeg, algoId string, size float64) {
+	if !m.cfg().VerifyPlacement || algoId == "" {
+		return
+	}
+	m.placedMu.Lock()
+	defer m.placedMu.Unlock()
+	m.placed = append(m.placed, placedOrder{position: position, leg: leg, algoId: algoId, size: size})
+}
+
+// takePlaced 取出待验证的订单并清空记录 / Take the orders awaiting verification and clear the record
+func (m *Manager) takePlaced() []placedOrder {
+	m.placedMu.Lock()
+	defer m.placedMu.Unlock()
+	placed := m.placed
+	m.placed = nil
+	return placed
+}
+
+// unverifiedAlertKey 下单验证失败告警键 / Alert key for a position whose placement failed verification
+func unverifiedAlertKey(position *models.Position) string {
+	return fmt.Sprintf("tpsl_unverified:%s:%s", position.Instrument, position.PositionSide)
+}
+
+// verifyPlacements 验证本次检查下单的订单 / Verify the orders placed in the current check
+// 重新查询待处理算法订单，确认每个持仓本次下单的订单均为live，且每一侧的数量之和不少于下单数量；
+// 未通过时告警，通过时解除该持仓此前的告警。用于发现下单响应成功但订单未生效的静默失败
+// Re-queries pending algo orders and confirms that the orders placed for each position in this
+// check are live and that each leg's live size adds up to at least the size placed; positions
+// that fail raise an alert and positions that pass resolve an earlier one. Catches silent
+// failures where the placement response reported success but the order did not take effect
+//
+// Returns:
+//   - int: 验证失败的持仓数量 / Number of positions that failed verification
+//   - error: 查询待处理订单失败时返回错误 / Error when pending algo orders cannot be queried
+func (m *Manager) verifyPlacements() (int, error) {
+	placed := m.takePlaced()
+	if len(placed) == 0 {
+		return 0, nil
+	}
+
+	resp, err := m.okxClient.GetPendingAlgoOrders("conditional")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending algo orders: %w", err)
+	}
+	live := make(map[string]*okx.AlgoOrder, len(resp.Data))
+	for i := range resp.Data {
+		live[resp.Data[i].AlgoId] = &resp.Data[i]
+	}
+
+	// Group by position, keeping the order positions were placed in
+	var positions []*models.Position
+	byPosition := make(map[*models.Position][]placedOrder)
+	for _, order := range placed {
+		if _, ok := byPosition[order.position]; !ok {
+			positions = append(positions, order.position)
+		}
+		byPosition[order.position] = append(byPosition[order.position], order)
+	}
+
+	failed := 0
+	for _, position := range positions {
+		if problems := m.verifyPosition(position, byPosition[position], live); len(problems) > 0 {
+			failed++
+			m.alertUnverified(position, problems)
+		} else if m.alerter != nil {
+			m.alerter.Resolve(unverifiedAlertKey(position))
+		}
+	}
+
+	m.logger.Info("Verified %d placed TPSL orders for %d positions, %d positions failed verification",
+		len(placed), len(positions), failed)
+	return failed, nil
+}
+
+// verifyPosition 验证单个持仓本次下单的订单 / Verify the orders placed for one position
+//
+// Parameters:
+//   - position: 持仓信息 / Position information
+//   - placed: 该持仓本次下单的订单 / Orders placed for the position in this check
+//   - live: 按algoId索引的待处理订单 / Pending orders by algoId
+//
+// Returns:
+//   - []string: 发现的问题，为空表示验证通过 / Problems found, empty when verified
+func (m *Manager) verifyPosition(position *models.Position, placed []placedOrder, live map[string]*okx.AlgoOrder) []string {
+	var problems []string
+	format := m.orderFormatFor(position.Instrument)
+	expected := make(map[models.TPSLLeg]decimal.Decimal)
+	found := make(map[models.TPSLLeg]decimal.Decimal)
+	var legs []models.TPSLLeg
+
+	for _, order := range placed {
+		if _, ok := expected[order.leg]; !ok {
+			legs = append(legs, order.leg)
+		}
+		// Compare against the size actually sent, rounded to the lot size
+		sent, err := parseDecimal(format.size(order.size))
+		if err != nil {
+			sent = toDecimal(order.size)
+		}
+		expected[order.leg] = expected[order.leg].Add(sent)
+
+		pending, ok := live[order.algoId]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s order %s is not live", strings.ToUpper(order.leg.String()), order.algoId))
+			continue
+		}
+		size, err := orderSize(pending, position)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s order %s has unreadable size %q", strings.ToUpper(order.leg.String()), order.algoId, pending.Sz))
+			continue
+		}
+		found[order.leg] = found[order.leg].Add(size)
+	}
+
+	for _, leg := range legs {
+		if found[leg].LessThan(expected[leg]) {
+			problems = append(problems, fmt.Sprintf("live %s size %s is below the %s placed",
+				strings.ToUpper(leg.String()), found[leg].String(), expected[leg].String()))
+		}
+	}
+	return problems
+}
+
+// alertUnverified 告警下单验证失败的持仓 / Alert on a position whose placement failed verification
+func (m *Manager) alertUnverified(position *models.Position, problems []string) {
+	m.logger.Error("TPSL placement for %s (%s) failed verification: %s",
+		position.Instrument, position.PositionSide, strings.Join(problems, "; "))
+	if m.alerter == nil {
+		return
+	}
+	m.alerter.Alert(unverifiedAlertKey(position), "%s (%s) may not be protected, placed TPSL failed verification: %s",
+		position.Instrument, position.PositionSide, strings.Join(problems, "; "))
+}
@@ -10,10 +10,12 @@ type AccountBalance struct {
 	ID        int64     `json:"id" db:"id"`
 	Timestamp time.Time `json:"timestamp" db:"timestamp"`
 	Currency  string    `json:"currency" db:"currency"`
-	Balance   float64   `json:"balance" db:"balance"`
+	Balance   float64   `json:"balance" db:"balance"` // in the currency itself
 	Available float64   `json:"available" db:"available"`
 	Frozen    float64   `json:"frozen" db:"frozen"`
-	Equity    float64   `json:"equity" db:"equity"`
+	Equity    float64   `json:"equity" db:"equity"` // valued in USD
+	// UnrealizedPnL 该币种的未实现盈亏，已包含在Balance中 / Unrealized PnL in this currency, included in Balance
+	UnrealizedPnL float64 `json:"unrealized_pnl" db:"unrealized_pnl"`
 }
 
 // Validate 验证账户余额数据 / Validate account balance data
@@ -38,3 +40,30 @@ func (ab *AccountBalance) String() string {
 	return fmt.Sprintf("AccountBalance{Currency=%s, Balance=%.8f, Available=%.8f, Frozen=%.8f, Equity=%.8f, Timestamp=%s}",
 		ab.Currency, ab.Balance, ab.Available, ab.Frozen, ab.Equity, ab.Timestamp.Format(time.RFC3339))
 }
+
+// AccountMargin 账户保证金风险 / Account-level margin risk snapshot
+// MarginRatio为OKX返回的维持保证金率（1表示100%），越低越接近强平，0表示未知（无杠杆持仓）
+// MarginRatio is OKX's maintenance margin ratio (1 means 100%), lower is closer to liquidation,
+// 0 means unknown (no leveraged positions)
+type AccountMargin struct {
+	ID                int64     `json:"id" db:"id"`
+	Timestamp         time.Time `json:"timestamp" db:"timestamp"`
+	TotalEquity       float64   `json:"total_equity" db:"total_equity"`
+	MarginRatio       float64   `json:"margin_ratio" db:"margin_ratio"`
+	InitialMargin     float64   `json:"initial_margin" db:"initial_margin"`
+	MaintenanceMargin float64   `json:"maintenance_margin" db:"maintenance_margin"`
+}
+
+// Validate 验证账户保证金数据 / Validate account margin data
+func (am *AccountMargin) Validate() error {
+	if am.MarginRatio < 0 {
+		return fmt.Errorf("margin_ratio cannot be negative")
+	}
+	if am.InitialMargin < 0 {
+		return fmt.Errorf("initial_margin cannot be negative")
+	}
+	if am.MaintenanceMargin < 0 {
+		return fmt.Errorf("maintenance_margin cannot be negative")
+	}
+	return nil
+}
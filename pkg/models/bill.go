@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Bill 账户账单流水 / Account bill (ledger entry)
+// 记录每笔余额变动，用于核对已实现盈亏、手续费和资金费
+// Records each balance change, used to reconcile realized PnL, fees and funding
+type Bill struct {
+	ID            int64     `json:"id" db:"id"`
+	BillID        string    `json:"bill_id" db:"bill_id"`
+	Timestamp     time.Time `json:"timestamp" db:"timestamp"`
+	InstType      string    `json:"inst_type" db:"inst_type"`
+	Instrument    string    `json:"instrument" db:"instrument"`
+	Currency      string    `json:"currency" db:"currency"`
+	Type          string    `json:"type" db:"type"`         // OKX bill type, e.g. "2" trade, "8" funding fee
+	SubType       string    `json:"sub_type" db:"sub_type"` // OKX bill sub type
+	BalanceChange float64   `json:"balance_change" db:"balance_change"`
+	Balance       float64   `json:"balance" db:"balance"`
+	PnL           float64   `json:"pnl" db:"pnl"` // Realized PnL of the fill, 0 for non-trade bills
+	Fee           float64   `json:"fee" db:"fee"` // Negative when charged, positive for rebates
+	OrderID       string    `json:"order_id" db:"order_id"`
+}
+
+// Validate 验证账单数据 / Validate bill data
+func (b *Bill) Validate() error {
+	if b.BillID == "" {
+		return fmt.Errorf("bill_id is required")
+	}
+	if b.Currency == "" {
+		return fmt.Errorf("currency is required")
+	}
+	if b.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+	return nil
+}
@@ -113,3 +113,55 @@ func (t TriggerPriceType) String() string {
 func (t TriggerPriceType) IsValid() bool {
 	return t == TriggerPriceTypeLast || t == TriggerPriceTypeIndex || t == TriggerPriceTypeMark
 }
+
+// TPSLLeg 止盈止损订单类型 / TPSL order leg
+type TPSLLeg string
+
+const (
+	// TPSLLegTakeProfit 止盈 / Take-profit leg
+	TPSLLegTakeProfit TPSLLeg = "tp"
+
+	// TPSLLegStopLoss 止损 / Stop-loss leg
+	TPSLLegStopLoss TPSLLeg = "sl"
+)
+
+// String 返回字符串表示 / Return string representation
+func (l TPSLLeg) String() string {
+	return string(l)
+}
+
+// IsValid 检查是否为有效的止盈止损类型 / Check if valid TPSL leg
+func (l TPSLLeg) IsValid() bool {
+	return l == TPSLLegTakeProfit || l == TPSLLegStopLoss
+}
+
+// TPSLOrderStatus 止盈止损订单记录状态 / TPSL order record status
+type TPSLOrderStatus string
+
+const (
+	// TPSLOrderStatusLive 已下单，未触发 / Placed and not yet triggered
+	TPSLOrderStatusLive TPSLOrderStatus = "live"
+
+	// TPSLOrderStatusReplaced 已过期并被撤单重下 / Expired and cancelled for replacement
+	TPSLOrderStatusReplaced TPSLOrderStatus = "replaced"
+
+	// TPSLOrderStatusFilled 已触发成交 / Triggered and filled
+	TPSLOrderStatusFilled TPSLOrderStatus = "filled"
+
+	// TPSLOrderStatusCancelled 在本系统之外被撤销或失败 / Cancelled or failed outside this system
+	TPSLOrderStatusCancelled TPSLOrderStatus = "cancelled"
+)
+
+// String 返回字符串表示 / Return string representation
+func (s TPSLOrderStatus) String() string {
+	return string(s)
+}
+
+// IsValid 检查是否为有效的订单记录状态 / Check if valid TPSL order status
+func (s TPSLOrderStatus) IsValid() bool {
+	switch s {
+	case TPSLOrderStatusLive, TPSLOrderStatusReplaced, TPSLOrderStatusFilled, TPSLOrderStatusCancelled:
+		return true
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -187,6 +188,16 @@ func TestPositionValidate(t *testing.T) {
 			expectError: true,
 			errorMsg:    "position_size cannot be negative",
 		},
+		{
+			name: "negative position_size in net mode",
+			position: Position{
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: "net",
+				PositionSize: -1.0,
+				AveragePrice: 50000.0,
+			},
+			expectError: false,
+		},
 		{
 			name: "negative average_price",
 			position: Position{
@@ -223,6 +234,42 @@ func TestPositionValidate(t *testing.T) {
 			expectError: true,
 			errorMsg:    "leverage cannot be negative",
 		},
+		{
+			name: "unknown liquidation and mark price",
+			position: Position{
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: "long",
+				PositionSize: 1.0,
+				AveragePrice: 50000.0,
+			},
+			expectError: false,
+		},
+		{
+			name: "negative liquidation price",
+			position: Position{
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: "long",
+				PositionSize: 1.0,
+				AveragePrice: 50000.0,
+				LiqPx:        -1,
+				MarkPx:       50100.0,
+			},
+			expectError: true,
+			errorMsg:    "liq_px cannot be negative",
+		},
+		{
+			name: "negative mark price",
+			position: Position{
+				Instrument:   "BTC-USDT-SWAP",
+				PositionSide: "long",
+				PositionSize: 1.0,
+				AveragePrice: 50000.0,
+				LiqPx:        45000.0,
+				MarkPx:       -1,
+			},
+			expectError: true,
+			errorMsg:    "mark_px cannot be negative",
+		},
 	}
 
 	for _, tt := range tests {
@@ -274,6 +321,46 @@ func TestPositionString(t *testing.T) {
 	}
 }
 
+func TestPositionRecomputePnL(t *testing.T) {
+	// 3 contracts of 0.01 BTC marked at 50000 hold 0.03 BTC, 1500 USD
+	linear := func(side PositionSide, size float64) Position {
+		return Position{Instrument: "BTC-USDT-SWAP", PositionSide: side, PositionSize: size,
+			AveragePrice: 49000, MarkPx: 50000, NotionalUSD: 1500, UnrealizedPnL: 30}
+	}
+	// 10 contracts of 100 USD
+	inverse := Position{Instrument: "BTC-USD-SWAP", PositionSide: PositionSideLong, PositionSize: 10,
+		AveragePrice: 50000, MarkPx: 45000, NotionalUSD: 1000, UnrealizedPnL: -0.002}
+
+	tests := []struct {
+		name     string
+		position Position
+		price    float64
+		expected float64
+	}{
+		{"linear long gains", linear(PositionSideLong, 3), 51000, 60},
+		{"linear long loses", linear(PositionSideLong, 3), 48000, -30},
+		{"linear short", linear(PositionSideShort, 3), 51000, -60},
+		{"net short", linear(PositionSideNet, -3), 48000, 30},
+		{"net long", linear(PositionSideNet, 3), 48000, -30},
+		{"inverse long", inverse, 40000, -0.005},
+		{"no price keeps the snapshot", linear(PositionSideLong, 3), 0, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.position.RecomputePnL(tt.price); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("RecomputePnL(%v) = %v, expected %v", tt.price, got, tt.expected)
+			}
+		})
+	}
+
+	unknown := linear(PositionSideLong, 3)
+	unknown.NotionalUSD = 0
+	if got := unknown.RecomputePnL(51000); got != unknown.UnrealizedPnL {
+		t.Errorf("expected the snapshot %v without a notional, got %v", unknown.UnrealizedPnL, got)
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	for i := 0; i <= len(s)-len(substr); i++ {
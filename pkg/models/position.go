@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -17,6 +19,23 @@ type Position struct {
 	Margin        float64      `json:"margin" db:"margin"`
 	Leverage      float64      `json:"leverage" db:"leverage"`
 	MarginMode    MarginMode   `json:"margin_mode" db:"margin_mode"`
+	LiqPx         float64      `json:"liq_px" db:"liquidation_price"`  // 0 when OKX reports no liquidation price
+	MarkPx        float64      `json:"mark_px" db:"mark_price"`        // 0 when unknown
+	NotionalUSD   float64      `json:"notional_usd" db:"notional_usd"` // position value in USD, 0 when unknown
+	OpenedAt      time.Time    `json:"opened_at" db:"opened_at"`       // creation time reported by OKX, zero when unknown
+
+	// AttachedTPSL is the TP/SL attached to the position (OKX closeOrderAlgo); only positions
+	// read live from OKX carry it, stored snapshots don't
+	AttachedTPSL []AttachedTPSL `json:"attached_tpsl,omitempty" db:"-"`
+}
+
+// AttachedTPSL 持仓关联的止盈止损 / TP/SL attached to a position
+// 对应OKX持仓接口返回的closeOrderAlgo项 / Corresponds to a closeOrderAlgo item of the OKX positions response
+type AttachedTPSL struct {
+	AlgoId        string  `json:"algo_id"`
+	TpTriggerPx   float64 `json:"tp_trigger_px"`  // 0 when there is no TP
+	SlTriggerPx   float64 `json:"sl_trigger_px"`  // 0 when there is no SL
+	CloseFraction float64 `json:"close_fraction"` // fraction of the position closed once triggered, 1 = all
 }
 
 // Validate 验证持仓数据 / Validate position data
@@ -28,9 +47,10 @@ func (p *Position) Validate() error {
 		return fmt.Errorf("position_side is required")
 	}
 	if !p.PositionSide.IsValid() {
-		return fmt.Errorf("invalid position_side: %s (must be 'long', 'short', or 'net')", p.PositionSide)
+		return fmt.Errorf("position_side must be 'long', 'short', or 'net'")
 	}
-	if p.PositionSize < 0 {
+	// In net (one-way) mode a negative size denotes a short position
+	if p.PositionSize < 0 && p.PositionSide != PositionSideNet {
 		return fmt.Errorf("position_size cannot be negative")
 	}
 	if p.AveragePrice < 0 {
@@ -42,6 +62,16 @@ func (p *Position) Validate() error {
 	if p.Leverage < 0 {
 		return fmt.Errorf("leverage cannot be negative")
 	}
+	// Zero means OKX did not report the price
+	if p.LiqPx < 0 {
+		return fmt.Errorf("liq_px cannot be negative")
+	}
+	if p.MarkPx < 0 {
+		return fmt.Errorf("mark_px cannot be negative")
+	}
+	if p.NotionalUSD < 0 {
+		return fmt.Errorf("notional_usd cannot be negative")
+	}
 	if p.MarginMode != "" && !p.MarginMode.IsValid() {
 		return fmt.Errorf("invalid margin_mode: %s (must be 'cross' or 'isolated')", p.MarginMode)
 	}
@@ -53,3 +83,48 @@ func (p *Position) String() string {
 	return fmt.Sprintf("Position{Instrument=%s, Side=%s, Size=%.8f, AvgPrice=%.8f, UnrealizedPnL=%.8f, Margin=%.8f, Leverage=%.2f, Mode=%s, Timestamp=%s}",
 		p.Instrument, p.PositionSide, p.PositionSize, p.AveragePrice, p.UnrealizedPnL, p.Margin, p.Leverage, p.MarginMode, p.Timestamp.Format(time.RFC3339))
 }
+
+// RecomputePnL 按当前价格重新计算未实现盈亏 / Recompute unrealized PnL at the current price
+// UnrealizedPnL是监控周期的快照，两次周期之间会过时；此方法根据开仓均价、持仓方向和当前价格（最新价或标记价格）
+// 重新计算，用于展示接近实时的盈亏。持仓数量由快照的USD名义价值推出，因此无需合约面值：
+//   - 正向合约（USDT/USDC保证金）及现货/杠杆：数量 = NotionalUSD / MarkPx，盈亏 = 方向 × 数量 × (当前价 - 均价)，单位为计价币，视USDT/USDC为USD
+//   - 反向合约（如BTC-USD-SWAP）：NotionalUSD即合约面值，盈亏 = 方向 × 面值 × (1/均价 - 1/当前价)，单位为保证金币种
+//
+// 期权盈亏与标的价格不成线性关系，缺少均价、标记价格或名义价值时也无法推算，这些情况返回快照值
+// UnrealizedPnL is a snapshot from the monitoring cycle and goes stale between cycles; this
+// recomputes it from the average entry price, the side and a current (last or mark) price, for a
+// near-real-time display. The held quantity is derived from the snapshot's USD notional, so no
+// contract value is needed:
+//   - Linear contracts (USDT/USDC margined), spot and margin: quantity = NotionalUSD / MarkPx and
+//     PnL = side × quantity × (price - entry) in the quote currency, taking USDT/USDC as USD
+//   - Inverse contracts (e.g. BTC-USD-SWAP): NotionalUSD is the USD face value and
+//     PnL = side × face value × (1/entry - 1/price) in the margin currency
+//
+// Option PnL is not linear in the underlying's price, and without an entry price, mark price or
+// notional nothing can be derived; those cases return the snapshot
+//
+// Parameters:
+//   - currentPrice: 当前价格 / Current price
+//
+// Returns:
+//   - float64: 未实现盈亏，单位同UnrealizedPnL / Unrealized PnL, in the same currency as UnrealizedPnL
+func (p *Position) RecomputePnL(currentPrice float64) float64 {
+	if currentPrice <= 0 || p.AveragePrice <= 0 || p.MarkPx <= 0 || p.NotionalUSD == 0 {
+		return p.UnrealizedPnL
+	}
+	parts := strings.Split(p.Instrument, "-")
+	if len(parts) == 5 {
+		return p.UnrealizedPnL // Option
+	}
+
+	direction := 1.0
+	if p.PositionSide == PositionSideShort || (p.PositionSide != PositionSideLong && p.PositionSize < 0) {
+		direction = -1.0 // Net-mode shorts have a negative size
+	}
+	notional := math.Abs(p.NotionalUSD)
+
+	if len(parts) == 3 && parts[1] == "USD" {
+		return direction * notional * (1/p.AveragePrice - 1/currentPrice)
+	}
+	return direction * notional / p.MarkPx * (currentPrice - p.AveragePrice)
+}
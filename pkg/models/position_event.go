@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// PositionEventType 持仓变化类型 / Kind of position change
+type PositionEventType string
+
+const (
+	PositionEventOpened    PositionEventType = "opened"    // not held in the previous snapshot
+	PositionEventIncreased PositionEventType = "increased" // size grew
+	PositionEventDecreased PositionEventType = "decreased" // size shrank but the position is still open
+	PositionEventClosed    PositionEventType = "closed"    // no longer held
+)
+
+// IsValid 检查持仓变化类型是否有效 / Check if the event type is valid
+func (t PositionEventType) IsValid() bool {
+	switch t {
+	case PositionEventOpened, PositionEventIncreased, PositionEventDecreased, PositionEventClosed:
+		return true
+	}
+	return false
+}
+
+// PositionEvent 持仓变化事件 / Position change event
+// 由相邻两次快照的差异得出，构成无需解析原始快照的交易历史
+// Derived from the difference between consecutive snapshots, giving a trade history without
+// parsing raw snapshots
+type PositionEvent struct {
+	ID           int64             `json:"id" db:"id"`
+	Timestamp    time.Time         `json:"timestamp" db:"timestamp"` // snapshot in which the change was seen
+	Instrument   string            `json:"instrument" db:"instrument"`
+	PositionSide PositionSide      `json:"position_side" db:"position_side"`
+	EventType    PositionEventType `json:"event_type" db:"event_type"`
+	PreviousSize float64           `json:"previous_size" db:"previous_size"` // 0 when opened
+	Size         float64           `json:"size" db:"size"`                   // 0 when closed
+	AveragePrice float64           `json:"average_price" db:"average_price"` // entry price, the last known one when closed
+}
+
+// Validate 验证持仓变化事件 / Validate position event data
+func (e *PositionEvent) Validate() error {
+	if e.Instrument == "" {
+		return fmt.Errorf("instrument is required")
+	}
+	if !e.PositionSide.IsValid() {
+		return fmt.Errorf("position_side must be 'long', 'short', or 'net'")
+	}
+	if !e.EventType.IsValid() {
+		return fmt.Errorf("invalid event_type: %q", e.EventType)
+	}
+	if e.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunSession 运行会话记录 / Run session record
+// 每次正常关闭时写入一条，记录本次运行的时长和活动量
+// Written once per graceful shutdown, recording how long the bot ran and what it did
+type RunSession struct {
+	ID           int64     `json:"id" db:"id"`
+	StartedAt    time.Time `json:"started_at" db:"started_at"`
+	StoppedAt    time.Time `json:"stopped_at" db:"stopped_at"`
+	Cycles       int       `json:"cycles" db:"cycles"` // Monitoring cycles run, successful or not
+	SuccessCount int       `json:"success_count" db:"success_count"`
+	ErrorCount   int       `json:"error_count" db:"error_count"`
+	OrdersPlaced int       `json:"orders_placed" db:"orders_placed"` // TPSL orders placed, 0 when TPSL is disabled
+}
+
+// Validate 验证运行会话数据 / Validate run session data
+func (r *RunSession) Validate() error {
+	if r.StartedAt.IsZero() {
+		return fmt.Errorf("started_at is required")
+	}
+	if r.StoppedAt.Before(r.StartedAt) {
+		return fmt.Errorf("stopped_at must not be before started_at")
+	}
+	if r.Cycles < 0 || r.SuccessCount < 0 || r.ErrorCount < 0 || r.OrdersPlaced < 0 {
+		return fmt.Errorf("counts must be non-negative")
+	}
+	return nil
+}
+
+// Uptime 运行时长 / Time the session ran for
+func (r *RunSession) Uptime() time.Duration {
+	return r.StoppedAt.Sub(r.StartedAt)
+}
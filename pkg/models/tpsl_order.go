@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// TPSLOrder 已下单的止盈止损订单记录 / Record of a placed TPSL order
+// 记录由本系统下单的订单，用于跟踪订单年龄 / Tracks orders placed by this system so their age is known
+type TPSLOrder struct {
+	ID            int64           `json:"id" db:"id"`
+	AlgoID        string          `json:"algo_id" db:"algo_id"`
+	ClientOrderID string          `json:"client_order_id,omitempty" db:"client_order_id"`
+	Instrument    string          `json:"instrument" db:"instrument"`
+	PositionSide  PositionSide    `json:"position_side" db:"position_side"`
+	Leg           TPSLLeg         `json:"leg" db:"leg"`
+	Size          float64         `json:"size" db:"size"`
+	TriggerPrice  float64         `json:"trigger_price" db:"trigger_price"`
+	PlacedAt      time.Time       `json:"placed_at" db:"placed_at"`
+	Status        TPSLOrderStatus `json:"status" db:"status"`
+}
+
+// Validate 验证止盈止损订单记录 / Validate TPSL order record
+func (o *TPSLOrder) Validate() error {
+	if o.AlgoID == "" {
+		return fmt.Errorf("algo_id is required")
+	}
+	if o.Instrument == "" {
+		return fmt.Errorf("instrument is required")
+	}
+	if !o.Leg.IsValid() {
+		return fmt.Errorf("leg must be 'tp' or 'sl'")
+	}
+	if !o.Status.IsValid() {
+		return fmt.Errorf("invalid status: %s", o.Status)
+	}
+	if o.Size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	if o.TriggerPrice <= 0 {
+		return fmt.Errorf("trigger_price must be positive")
+	}
+	return nil
+}